@@ -16,6 +16,8 @@ type Config struct {
 	JWT       JWTConfig
 	RateLimit RateLimitConfig
 	Logging   LoggingConfig
+	Exam      ExamConfig
+	Media     MediaConfig
 }
 
 type ServerConfig struct {
@@ -57,6 +59,27 @@ type LoggingConfig struct {
 	Format string
 }
 
+type ExamConfig struct {
+	GracePeriod    time.Duration // extra time allowed after an attempt's deadline before it is closed
+	WorkerInterval time.Duration // how often the timer worker looks for expired attempts
+}
+
+type MediaConfig struct {
+	Storage         string        // "local" or "s3"
+	LocalDir        string        // where the local backend keeps files
+	PublicURL       string        // prefix of signed media links, empty for links relative to the API host
+	SigningKey      string        // signs media links, defaults to the JWT secret
+	URLExpiry       time.Duration // how long a signed media link stays valid
+	OrphanGrace     time.Duration // how long an upload may stay unattached before it is removed
+	CleanupInterval time.Duration
+	S3Endpoint      string
+	S3Region        string
+	S3Bucket        string
+	S3AccessKey     string
+	S3SecretKey     string
+	S3UseSSL        bool
+}
+
 var AppConfig *Config
 
 func LoadConfig() {
@@ -99,6 +122,25 @@ func LoadConfig() {
 			Level:  getEnv("LOG_LEVEL", "info"),
 			Format: getEnv("LOG_FORMAT", "json"),
 		},
+		Exam: ExamConfig{
+			GracePeriod:    getEnvAsDuration("EXAM_GRACE_PERIOD", "30s"),
+			WorkerInterval: getEnvAsPositiveDuration("EXAM_WORKER_INTERVAL", "30s"),
+		},
+		Media: MediaConfig{
+			Storage:         getEnv("MEDIA_STORAGE", "local"),
+			LocalDir:        getEnv("MEDIA_LOCAL_DIR", "./uploads"),
+			PublicURL:       getEnv("MEDIA_PUBLIC_URL", ""),
+			SigningKey:      getEnv("MEDIA_SIGNING_KEY", ""),
+			URLExpiry:       getEnvAsDuration("MEDIA_URL_EXPIRY", "3h"),
+			OrphanGrace:     getEnvAsDuration("MEDIA_ORPHAN_GRACE", "24h"),
+			CleanupInterval: getEnvAsPositiveDuration("MEDIA_CLEANUP_INTERVAL", "1h"),
+			S3Endpoint:      getEnv("MEDIA_S3_ENDPOINT", ""),
+			S3Region:        getEnv("MEDIA_S3_REGION", "us-east-1"),
+			S3Bucket:        getEnv("MEDIA_S3_BUCKET", ""),
+			S3AccessKey:     getEnv("MEDIA_S3_ACCESS_KEY", ""),
+			S3SecretKey:     getEnv("MEDIA_S3_SECRET_KEY", ""),
+			S3UseSSL:        getEnvAsBool("MEDIA_S3_USE_SSL", true),
+		},
 	}
 }
 
@@ -139,3 +181,13 @@ func getEnvAsDuration(key string, defaultValue string) time.Duration {
 	duration, _ := time.ParseDuration(defaultValue)
 	return duration
 }
+
+// getEnvAsPositiveDuration is getEnvAsDuration for ticker intervals, which must
+// be greater than zero; other values fall back to the default
+func getEnvAsPositiveDuration(key string, defaultValue string) time.Duration {
+	if duration := getEnvAsDuration(key, defaultValue); duration > 0 {
+		return duration
+	}
+	duration, _ := time.ParseDuration(defaultValue)
+	return duration
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"exam-system/middleware"
+	"exam-system/models"
 	"exam-system/services"
 	"net/http"
 
@@ -9,12 +10,21 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Authenticator is the part of AuthService the handler calls, so tests can
+// substitute a mock
+type Authenticator interface {
+	Register(req services.RegisterRequest) (*models.User, error)
+	Login(req services.LoginRequest) (*models.User, *services.TokenResponse, error)
+	RefreshToken(req services.RefreshTokenRequest) (*services.TokenResponse, error)
+	Logout(userID uint) error
+}
+
 type AuthHandler struct {
-	authService *services.AuthService
+	authService Authenticator
 	logger      *logrus.Logger
 }
 
-func NewAuthHandler(authService *services.AuthService, logger *logrus.Logger) *AuthHandler {
+func NewAuthHandler(authService Authenticator, logger *logrus.Logger) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
 		logger:      logger,
@@ -222,4 +232,3 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		},
 	})
 }
-
@@ -175,6 +175,50 @@ func (h *ExamHandler) CreateExam(c *gin.Context) {
 			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTIONS", "Some questions are invalid or inactive", nil)
 			return
 		}
+		if strings.Contains(err.Error(), "invalid questions") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTIONS", "Some questions are invalid", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid scoring policy") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_SCORING_POLICY", "Invalid scoring policy", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid late policy") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_LATE_POLICY", "Invalid late policy", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid keep score policy") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_KEEP_SCORE_POLICY", "Invalid keep score policy", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "blueprint cannot be satisfied") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "BLUEPRINT_UNSATISFIABLE", "Question bank cannot satisfy the blueprint", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid blueprint") || strings.Contains(err.Error(), "questions or a blueprint") || strings.Contains(err.Error(), "both questions and a blueprint") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_CONTENT", "Exam needs either a question list or a valid blueprint", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid sections") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_SECTIONS", "Exam sections are invalid", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid adaptive settings") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ADAPTIVE_SETTINGS", "Adaptive exam settings are invalid", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid schedule") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_SCHEDULE", "Exam schedule is invalid", err.Error())
+			return
+		}
 
 		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "EXAM_CREATE_FAILED", "Failed to create exam", nil)
 		return
@@ -207,7 +251,7 @@ func (h *ExamHandler) CreateExam(c *gin.Context) {
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Failure 403 {object} map[string]interface{} "Forbidden"
 // @Failure 404 {object} map[string]interface{} "Exam not found"
-// @Failure 409 {object} map[string]interface{} "Cannot update completed exam"
+// @Failure 409 {object} map[string]interface{} "Cannot update closed exam, invalid status transition or attempts in progress"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/v1/exams/{id} [put]
 func (h *ExamHandler) UpdateExam(c *gin.Context) {
@@ -237,8 +281,18 @@ func (h *ExamHandler) UpdateExam(c *gin.Context) {
 			return
 		}
 
-		if err.Error() == "cannot update completed exam" {
-			middleware.StructuredErrorResponse(c, http.StatusConflict, "EXAM_COMPLETED", "Cannot update completed exam", nil)
+		if err.Error() == "cannot update closed exam" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "EXAM_CLOSED", "Cannot update closed exam", nil)
+			return
+		}
+
+		if err.Error() == "cannot change exam questions or sections while attempts are in progress" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "ATTEMPTS_IN_PROGRESS", "Cannot change exam questions or sections while attempts are in progress", nil)
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid status transition") || strings.Contains(err.Error(), "invalid exam status") {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "INVALID_STATUS_TRANSITION", "Invalid exam status transition", err.Error())
 			return
 		}
 
@@ -246,6 +300,50 @@ func (h *ExamHandler) UpdateExam(c *gin.Context) {
 			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTIONS", "Some questions are invalid or inactive", nil)
 			return
 		}
+		if strings.Contains(err.Error(), "invalid questions") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTIONS", "Some questions are invalid", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid scoring policy") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_SCORING_POLICY", "Invalid scoring policy", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid late policy") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_LATE_POLICY", "Invalid late policy", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid keep score policy") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_KEEP_SCORE_POLICY", "Invalid keep score policy", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "blueprint cannot be satisfied") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "BLUEPRINT_UNSATISFIABLE", "Question bank cannot satisfy the blueprint", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid blueprint") || strings.Contains(err.Error(), "questions or a blueprint") || strings.Contains(err.Error(), "both questions and a blueprint") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_CONTENT", "Exam needs either a question list or a valid blueprint", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid sections") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_SECTIONS", "Exam sections are invalid", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid adaptive settings") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ADAPTIVE_SETTINGS", "Adaptive exam settings are invalid", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid schedule") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_SCHEDULE", "Exam schedule is invalid", err.Error())
+			return
+		}
 
 		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "EXAM_UPDATE_FAILED", "Failed to update exam", nil)
 		return
@@ -364,6 +462,11 @@ func (h *ExamHandler) AssignExam(c *gin.Context) {
 			return
 		}
 
+		if strings.Contains(err.Error(), "invalid schedule") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_SCHEDULE", "Assignment window is invalid", err.Error())
+			return
+		}
+
 		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "EXAM_ASSIGN_FAILED", "Failed to assign exam", nil)
 		return
 	}
@@ -390,8 +493,9 @@ func (h *ExamHandler) AssignExam(c *gin.Context) {
 // @Success 200 {object} services.StartExamResponse "Exam started successfully"
 // @Failure 400 {object} map[string]interface{} "Bad request"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Exam cannot be started"
+// @Failure 403 {object} map[string]interface{} "Exam cannot be started or retake cooldown active"
 // @Failure 404 {object} map[string]interface{} "Exam not assigned to user"
+// @Failure 409 {object} map[string]interface{} "Blueprint cannot be satisfied or exam changed while starting"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/v1/exams/{id}/start [post]
 func (h *ExamHandler) StartExam(c *gin.Context) {
@@ -426,6 +530,36 @@ func (h *ExamHandler) StartExam(c *gin.Context) {
 			return
 		}
 
+		if err.Error() == "retake cooldown has not elapsed" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "RETAKE_COOLDOWN", "Retake cooldown has not elapsed", nil)
+			return
+		}
+
+		if err.Error() == "exam is not open" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_NOT_OPEN", "Exam is not open", nil)
+			return
+		}
+
+		if err.Error() == "exam has not opened yet" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_NOT_OPEN_YET", "Exam has not opened yet", nil)
+			return
+		}
+
+		if err.Error() == "exam has closed" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_CLOSED", "Exam has closed", nil)
+			return
+		}
+
+		if strings.Contains(err.Error(), "blueprint cannot be satisfied") {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "BLUEPRINT_UNSATISFIABLE", "Question bank can no longer satisfy the exam blueprint", err.Error())
+			return
+		}
+
+		if err.Error() == "exam changed while starting" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "EXAM_CHANGED", "Exam was updated while starting, try again", nil)
+			return
+		}
+
 		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "EXAM_START_FAILED", "Failed to start exam", nil)
 		return
 	}
@@ -454,7 +588,7 @@ func (h *ExamHandler) StartExam(c *gin.Context) {
 // @Success 200 {object} map[string]interface{} "Exam submitted successfully"
 // @Failure 400 {object} map[string]interface{} "Bad request"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Exam cannot be submitted"
+// @Failure 403 {object} map[string]interface{} "Exam cannot be submitted or time has expired"
 // @Failure 404 {object} map[string]interface{} "Exam not assigned to user"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/v1/exams/{id}/submit [post]
@@ -496,6 +630,21 @@ func (h *ExamHandler) SubmitExam(c *gin.Context) {
 			return
 		}
 
+		if err.Error() == "exam time has expired" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_TIME_EXPIRED", "Exam time has expired", nil)
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid option") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ANSWER", "Answer contains an unknown option", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid answer") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ANSWER", "Answer does not fit the question", err.Error())
+			return
+		}
+
 		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "EXAM_SUBMIT_FAILED", "Failed to submit exam", nil)
 		return
 	}
@@ -514,3 +663,765 @@ func (h *ExamHandler) SubmitExam(c *gin.Context) {
 	})
 }
 
+// SaveAnswer autosaves a single answer during an exam attempt
+// @Summary Autosave answer
+// @Description Save or replace the answer to one question of an in-progress exam attempt
+// @Tags exams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Param request body services.SubmitAnswerRequest true "Answer"
+// @Success 200 {object} map[string]interface{} "Answer saved successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Exam not in progress or time has expired"
+// @Failure 404 {object} map[string]interface{} "Exam not assigned to user"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/answers [put]
+func (h *ExamHandler) SaveAnswer(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	var req services.SubmitAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request data", err.Error())
+		return
+	}
+
+	saved, err := h.examService.SaveAnswer(uint(examID), userID, req)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":     examID,
+			"user_id":     userID,
+			"question_id": req.QuestionID,
+			"request_id":  middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to save answer")
+
+		if err.Error() == "exam not assigned to user" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_ASSIGNED", "Exam not assigned to user", nil)
+			return
+		}
+
+		if err.Error() == "exam is not in progress" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_NOT_IN_PROGRESS", "Exam is not in progress", nil)
+			return
+		}
+
+		if err.Error() == "exam time has expired" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_TIME_EXPIRED", "Exam time has expired", nil)
+			return
+		}
+
+		if err.Error() == "question is not part of this exam" {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTION", "Question is not part of this exam", nil)
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid option") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ANSWER", "Answer contains an unknown option", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid answer") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ANSWER", "Answer does not fit the question", err.Error())
+			return
+		}
+
+		if err.Error() == "exam is in linear mode" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "LINEAR_MODE", "Linear exams take answers one question at a time", nil)
+			return
+		}
+
+		if err.Error() == "section is not open yet" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "SECTION_NOT_OPEN", "Question belongs to a section that is not open yet", nil)
+			return
+		}
+
+		if err.Error() == "section is closed" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "SECTION_CLOSED", "Question belongs to a closed section", nil)
+			return
+		}
+
+		if err.Error() == "section time has expired" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "SECTION_TIME_EXPIRED", "Section time has expired", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "ANSWER_SAVE_FAILED", "Failed to save answer", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Answer saved successfully",
+		"saved_at": saved.UpdatedAt,
+	})
+}
+
+// GetSavedAnswers returns the answers autosaved during an exam attempt
+// @Summary Get saved answers
+// @Description Get the answers autosaved so far for an in-progress exam attempt
+// @Tags exams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Success 200 {object} services.SavedAnswersResponse "Saved answers"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Exam not in progress or time has expired"
+// @Failure 404 {object} map[string]interface{} "Exam not assigned to user"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/answers [get]
+func (h *ExamHandler) GetSavedAnswers(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	response, err := h.examService.GetSavedAnswers(uint(examID), userID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"user_id":    userID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get saved answers")
+
+		if err.Error() == "exam not assigned to user" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_ASSIGNED", "Exam not assigned to user", nil)
+			return
+		}
+
+		if err.Error() == "exam is not in progress" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_NOT_IN_PROGRESS", "Exam is not in progress", nil)
+			return
+		}
+
+		if err.Error() == "exam time has expired" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_TIME_EXPIRED", "Exam time has expired", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "SAVED_ANSWERS_FETCH_FAILED", "Failed to get saved answers", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResumeExam resumes an in-progress exam for the current user
+// @Summary Resume exam
+// @Description Resume an in-progress exam with its saved answers and remaining time
+// @Tags exams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Success 200 {object} services.StartExamResponse "Exam resumed successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Exam not in progress or time has expired"
+// @Failure 404 {object} map[string]interface{} "Exam not assigned to user"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/resume [post]
+func (h *ExamHandler) ResumeExam(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	response, err := h.examService.ResumeExam(uint(examID), userID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"user_id":    userID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to resume exam")
+
+		if err.Error() == "exam not assigned to user" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_ASSIGNED", "Exam not assigned to user", nil)
+			return
+		}
+
+		if err.Error() == "exam is not in progress" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_NOT_IN_PROGRESS", "Exam is not in progress", nil)
+			return
+		}
+
+		if err.Error() == "exam time has expired" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_TIME_EXPIRED", "Exam time has expired", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "EXAM_RESUME_FAILED", "Failed to resume exam", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Exam resumed successfully",
+		"data":    response,
+	})
+}
+
+// GetAttempts lists every attempt at an exam
+// @Summary Get exam attempts
+// @Description List every attempt a user has made at an exam with the score kept under the exam's keep-score policy. Admins can pass user_id to view another user's attempts.
+// @Tags exams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Param user_id query int false "User ID (admin only)"
+// @Success 200 {object} services.AttemptListResponse "Exam attempts"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 404 {object} map[string]interface{} "Exam not assigned to user"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/attempts [get]
+func (h *ExamHandler) GetAttempts(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	// Admins may look at another user's attempts
+	targetUserID := userID
+	if userIDStr := c.Query("user_id"); userIDStr != "" && middleware.IsAdmin(c) {
+		id, err := strconv.ParseUint(userIDStr, 10, 32)
+		if err != nil {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+			return
+		}
+		targetUserID = uint(id)
+	}
+
+	attempts, err := h.examService.GetAttempts(uint(examID), targetUserID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":        examID,
+			"user_id":        userID,
+			"target_user_id": targetUserID,
+			"request_id":     middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get exam attempts")
+
+		if err.Error() == "exam not assigned to user" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_ASSIGNED", "Exam not assigned to user", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "ATTEMPTS_FETCH_FAILED", "Failed to get exam attempts", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, attempts)
+}
+
+// GetAttemptPermutation shows the question and option order of an attempt (admin only)
+// @Summary Get attempt permutation
+// @Description Get the exact question and option order a candidate saw during an attempt (admin only)
+// @Tags exams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Param attempt_id path int true "Attempt ID"
+// @Success 200 {object} services.AttemptPermutationResponse "Attempt permutation"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Attempt not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/attempts/{attempt_id}/permutation [get]
+func (h *ExamHandler) GetAttemptPermutation(c *gin.Context) {
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	attemptIDStr := c.Param("attempt_id")
+	attemptID, err := strconv.ParseUint(attemptIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ATTEMPT_ID", "Invalid attempt ID", nil)
+		return
+	}
+
+	permutation, err := h.examService.GetAttemptPermutation(uint(examID), uint(attemptID))
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"attempt_id": attemptID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get attempt permutation")
+
+		if err.Error() == "attempt not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "ATTEMPT_NOT_FOUND", "Attempt not found", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "PERMUTATION_FETCH_FAILED", "Failed to get attempt permutation", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, permutation)
+}
+
+// PreviewExam draws a sample set of questions from a blueprint exam (admin only)
+// @Summary Preview blueprint draw
+// @Description Draw a sample set of questions for a blueprint exam without starting an attempt (admin only). Pass the returned seed back to reproduce the same draw.
+// @Tags exams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Param seed query int false "Draw seed"
+// @Success 200 {object} services.BlueprintPreviewResponse "Sample draw"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Exam not found"
+// @Failure 409 {object} map[string]interface{} "Blueprint cannot be satisfied"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/preview [get]
+func (h *ExamHandler) PreviewExam(c *gin.Context) {
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	var seed *int64
+	if seedStr := c.Query("seed"); seedStr != "" {
+		parsed, err := strconv.ParseInt(seedStr, 10, 64)
+		if err != nil {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_SEED", "Invalid seed", nil)
+			return
+		}
+		seed = &parsed
+	}
+
+	preview, err := h.examService.PreviewExamDraw(uint(examID), seed)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to preview exam")
+
+		if err.Error() == "exam not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_FOUND", "Exam not found", nil)
+			return
+		}
+
+		if err.Error() == "exam does not use a blueprint" {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "EXAM_NOT_BLUEPRINT", "Exam does not use a blueprint", nil)
+			return
+		}
+
+		if strings.Contains(err.Error(), "blueprint cannot be satisfied") {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "BLUEPRINT_UNSATISFIABLE", "Question bank cannot satisfy the blueprint", err.Error())
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "EXAM_PREVIEW_FAILED", "Failed to preview exam", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// NextSection closes the open section of an exam attempt and opens the next one
+// @Summary Move to next section
+// @Description Close the current section of an in-progress exam attempt and open the next one. Sections that lock on close can't be answered again.
+// @Tags exams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Success 200 {object} services.SectionProgressResponse "Next section opened"
+// @Failure 400 {object} map[string]interface{} "Exam has no sections or already in the last section"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Exam not in progress or time has expired"
+// @Failure 404 {object} map[string]interface{} "Exam not assigned to user"
+// @Failure 409 {object} map[string]interface{} "Section already changed by another request"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/sections/next [post]
+func (h *ExamHandler) NextSection(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	response, err := h.examService.NextSection(uint(examID), userID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"user_id":    userID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to move to next section")
+
+		if err.Error() == "exam not assigned to user" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_ASSIGNED", "Exam not assigned to user", nil)
+			return
+		}
+
+		if err.Error() == "exam is not in progress" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_NOT_IN_PROGRESS", "Exam is not in progress", nil)
+			return
+		}
+
+		if err.Error() == "exam time has expired" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_TIME_EXPIRED", "Exam time has expired", nil)
+			return
+		}
+
+		if err.Error() == "exam has no sections" {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "EXAM_HAS_NO_SECTIONS", "Exam has no sections", nil)
+			return
+		}
+
+		if err.Error() == "already in the last section" {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "LAST_SECTION", "Already in the last section", nil)
+			return
+		}
+
+		if err.Error() == "section has already changed" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "SECTION_CHANGED", "Section has already changed, reload the attempt", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "SECTION_ADVANCE_FAILED", "Failed to move to next section", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetCurrentQuestion serves the current question of a linear exam attempt
+// @Summary Get current question
+// @Description Serve the question the candidate is on in a linear exam. The server records when it was first served and closes it once its time limit runs out. In an adaptive exam the next question is picked by the candidate's estimated ability, until a stopping rule ends the test.
+// @Tags exams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Success 200 {object} services.LinearQuestionResponse "Current question"
+// @Failure 400 {object} map[string]interface{} "Exam is not in linear mode"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Exam not in progress or time has expired"
+// @Failure 404 {object} map[string]interface{} "Exam not assigned to user"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/questions/current [get]
+func (h *ExamHandler) GetCurrentQuestion(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	response, err := h.examService.GetCurrentQuestion(uint(examID), userID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"user_id":    userID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get current question")
+
+		if err.Error() == "exam not assigned to user" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_ASSIGNED", "Exam not assigned to user", nil)
+			return
+		}
+
+		if err.Error() == "exam is not in progress" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_NOT_IN_PROGRESS", "Exam is not in progress", nil)
+			return
+		}
+
+		if err.Error() == "exam time has expired" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_TIME_EXPIRED", "Exam time has expired", nil)
+			return
+		}
+
+		if err.Error() == "exam is not in linear mode" {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "NOT_LINEAR_MODE", "Exam is not in linear mode", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "QUESTION_FETCH_FAILED", "Failed to get current question", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AnswerCurrentQuestion answers the current question of a linear exam attempt
+// @Summary Answer current question
+// @Description Answer the current question of a linear exam. Time spent is measured by the server from when the question was served; the client-reported value is ignored. Returns the next question.
+// @Tags exams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Param request body services.SubmitAnswerRequest true "Answer"
+// @Success 200 {object} services.LinearQuestionResponse "Next question"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Exam not in progress or time has expired"
+// @Failure 404 {object} map[string]interface{} "Exam not assigned to user"
+// @Failure 409 {object} map[string]interface{} "Question is not the current question or was already answered"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/questions/current/answer [post]
+func (h *ExamHandler) AnswerCurrentQuestion(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	var req services.SubmitAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request data", err.Error())
+		return
+	}
+
+	response, err := h.examService.AnswerCurrentQuestion(uint(examID), userID, req)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":     examID,
+			"user_id":     userID,
+			"question_id": req.QuestionID,
+			"request_id":  middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to answer current question")
+
+		if err.Error() == "exam not assigned to user" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_ASSIGNED", "Exam not assigned to user", nil)
+			return
+		}
+
+		if err.Error() == "exam is not in progress" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_NOT_IN_PROGRESS", "Exam is not in progress", nil)
+			return
+		}
+
+		if err.Error() == "exam time has expired" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "EXAM_TIME_EXPIRED", "Exam time has expired", nil)
+			return
+		}
+
+		if err.Error() == "exam is not in linear mode" {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "NOT_LINEAR_MODE", "Exam is not in linear mode", nil)
+			return
+		}
+
+		if err.Error() == "question time has expired" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "QUESTION_TIME_EXPIRED", "Question time has expired", nil)
+			return
+		}
+
+		if err.Error() == "question is not the current question" || err.Error() == "question has not been served" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "NOT_CURRENT_QUESTION", "Question is not the current question", nil)
+			return
+		}
+
+		if err.Error() == "question has already been answered" || err.Error() == "all questions have been answered" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "QUESTION_ALREADY_ANSWERED", "Question has already been answered", nil)
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid option") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ANSWER", "Answer contains an unknown option", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid answer") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ANSWER", "Answer does not fit the question", err.Error())
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "ANSWER_SAVE_FAILED", "Failed to save answer", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// TransitionExam moves an exam through its lifecycle (admin only)
+// @Summary Change exam status
+// @Description Move an exam through its lifecycle: draft -> scheduled -> active -> closed -> archived (admin only). Closing an exam auto-submits attempts still in progress.
+// @Tags exams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Param request body services.ExamStatusRequest true "New status"
+// @Success 200 {object} map[string]interface{} "Exam status changed successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Exam not found"
+// @Failure 409 {object} map[string]interface{} "Invalid status transition"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/status [post]
+func (h *ExamHandler) TransitionExam(c *gin.Context) {
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	var req services.ExamStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request data", err.Error())
+		return
+	}
+
+	exam, err := h.examService.TransitionExam(uint(examID), req.Status)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"status":     req.Status,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to change exam status")
+
+		if err.Error() == "exam not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_FOUND", "Exam not found", nil)
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid status transition") || strings.Contains(err.Error(), "invalid exam status") || err.Error() == "exam status changed concurrently" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "INVALID_STATUS_TRANSITION", "Invalid exam status transition", err.Error())
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid schedule") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_SCHEDULE", "Exam schedule is invalid", err.Error())
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "EXAM_STATUS_UPDATE_FAILED", "Failed to change exam status", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Exam status changed successfully",
+		"exam":    exam.ToResponse(false, nil),
+	})
+}
+
+// GrantExtraTime gives a candidate's running attempt more time (admin only)
+// @Summary Grant extra time
+// @Description Add minutes to a candidate's in-progress attempt (admin only). The grant applies to the current attempt only and may run past the end of the exam window.
+// @Tags exams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Param request body services.GrantExtraTimeRequest true "Extra time"
+// @Success 200 {object} map[string]interface{} "Extra time granted successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Exam not assigned to user"
+// @Failure 409 {object} map[string]interface{} "Exam not in progress"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/extra-time [post]
+func (h *ExamHandler) GrantExtraTime(c *gin.Context) {
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	var req services.GrantExtraTimeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request data", err.Error())
+		return
+	}
+
+	userExam, err := h.examService.GrantExtraTime(uint(examID), req)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"user_id":    req.UserID,
+			"minutes":    req.Minutes,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to grant extra time")
+
+		if err.Error() == "exam not assigned to user" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_ASSIGNED", "Exam not assigned to user", nil)
+			return
+		}
+
+		if err.Error() == "exam is not in progress" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "EXAM_NOT_IN_PROGRESS", "Exam is not in progress", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "EXTRA_TIME_FAILED", "Failed to grant extra time", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Extra time granted successfully",
+		"user_exam": userExam,
+	})
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"exam-system/config"
+	"exam-system/middleware"
+	"exam-system/services"
+	"exam-system/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type MediaHandler struct {
+	mediaService *services.MediaService
+	logger       *logrus.Logger
+}
+
+func NewMediaHandler(mediaService *services.MediaService, logger *logrus.Logger) *MediaHandler {
+	return &MediaHandler{
+		mediaService: mediaService,
+		logger:       logger,
+	}
+}
+
+// UploadMedia stores an image, audio or video file for use in questions (admin only)
+// @Summary Upload media
+// @Description Upload an image (PNG, JPEG, GIF, WebP; up to 5 MB), audio (MP3, WAV, Ogg; up to 20 MB) or video (MP4, WebM; up to 50 MB) file. Attach it to questions or options by its ID; files left unattached are removed after a grace period.
+// @Tags media
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "Media file"
+// @Success 201 {object} map[string]interface{} "Media uploaded successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/media [post]
+func (h *MediaHandler) UploadMedia(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "A file is required", err.Error())
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read the uploaded file", nil)
+		return
+	}
+	defer file.Close()
+
+	media, err := h.mediaService.UploadMedia(file, header.Filename, header.Size, userID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"user_id":    userID,
+			"filename":   header.Filename,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to upload media")
+
+		if strings.Contains(err.Error(), "invalid media") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_MEDIA", "Media file is not accepted", err.Error())
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "MEDIA_UPLOAD_FAILED", "Failed to upload media", nil)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Media uploaded successfully",
+		"media":   media,
+		"url":     utils.SignMediaURL(media.ID, time.Now().Add(config.AppConfig.Media.URLExpiry)),
+	})
+}
+
+// GetMediaContent serves a media file from a signed link
+// @Summary Get media file
+// @Description Download a media file. The link comes signed in question responses and works without a login until it expires.
+// @Tags media
+// @Produce octet-stream
+// @Param id path int true "Media ID"
+// @Param expires query int true "Expiry of the link, as a Unix time"
+// @Param signature query string true "Signature of the link"
+// @Success 200 {file} file "Media file"
+// @Success 302 "Redirect to the storage backend"
+// @Failure 403 {object} map[string]interface{} "Invalid or expired link"
+// @Failure 404 {object} map[string]interface{} "Media not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/media/{id}/content [get]
+func (h *MediaHandler) GetMediaContent(c *gin.Context) {
+	mediaID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_MEDIA_ID", "Invalid media ID", nil)
+		return
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusForbidden, "INVALID_MEDIA_LINK", "Media link is invalid", nil)
+		return
+	}
+
+	content, err := h.mediaService.OpenSignedMedia(uint(mediaID), expires, c.Query("signature"))
+	if err != nil {
+		if err.Error() == "invalid media signature" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "INVALID_MEDIA_LINK", "Media link is invalid", nil)
+			return
+		}
+		if err.Error() == "media link has expired" {
+			middleware.StructuredErrorResponse(c, http.StatusForbidden, "MEDIA_LINK_EXPIRED", "Media link has expired", nil)
+			return
+		}
+		if err.Error() == "media not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "MEDIA_NOT_FOUND", "Media not found", nil)
+			return
+		}
+
+		h.logger.WithFields(logrus.Fields{
+			"media_id":   mediaID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get media")
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "MEDIA_GET_FAILED", "Failed to get media", nil)
+		return
+	}
+
+	// The link is only good until it expires, so caches must not outlive it
+	maxAge := expires - time.Now().Unix()
+	c.Header("Cache-Control", "private, max-age="+strconv.FormatInt(maxAge, 10))
+
+	if content.RedirectURL != "" {
+		c.Redirect(http.StatusFound, content.RedirectURL)
+		return
+	}
+	defer content.Body.Close()
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, content.Media.Size, content.Media.ContentType, content.Body, nil)
+}
+
+// DeleteMedia removes an uploaded file that no question uses (admin only)
+// @Summary Delete media
+// @Description Delete an uploaded media file. Files attached to questions can't be deleted.
+// @Tags media
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Media ID"
+// @Success 200 {object} map[string]interface{} "Media deleted successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Media not found"
+// @Failure 409 {object} map[string]interface{} "Media is attached to questions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/media/{id} [delete]
+func (h *MediaHandler) DeleteMedia(c *gin.Context) {
+	mediaID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_MEDIA_ID", "Invalid media ID", nil)
+		return
+	}
+
+	if err := h.mediaService.DeleteMedia(uint(mediaID)); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"media_id":   mediaID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to delete media")
+
+		if err.Error() == "media not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "MEDIA_NOT_FOUND", "Media not found", nil)
+			return
+		}
+		if err.Error() == "media is attached to questions" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "MEDIA_IN_USE", "Media is attached to questions", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "MEDIA_DELETE_FAILED", "Failed to delete media", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Media deleted successfully",
+	})
+}
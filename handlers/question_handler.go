@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -55,7 +56,26 @@ func (h *QuestionHandler) GetQuestions(c *gin.Context) {
 		pageSize = 10
 	}
 
-	// Parse filters
+	filter := parseQuestionFilter(c)
+
+	questions, err := h.questionService.GetQuestions(page, pageSize, filter)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"page":       page,
+			"page_size":  pageSize,
+			"filter":     filter,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get questions")
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "QUESTIONS_FETCH_FAILED", "Failed to get questions", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, questions)
+}
+
+// parseQuestionFilter reads the question filters of a listing or export request
+func parseQuestionFilter(c *gin.Context) services.QuestionFilter {
 	filter := services.QuestionFilter{
 		Search: c.Query("search"),
 	}
@@ -82,20 +102,7 @@ func (h *QuestionHandler) GetQuestions(c *gin.Context) {
 		}
 	}
 
-	questions, err := h.questionService.GetQuestions(page, pageSize, filter)
-	if err != nil {
-		h.logger.WithFields(logrus.Fields{
-			"page":       page,
-			"page_size":  pageSize,
-			"filter":     filter,
-			"request_id": middleware.GetRequestID(c),
-		}).WithError(err).Error("Failed to get questions")
-
-		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "QUESTIONS_FETCH_FAILED", "Failed to get questions", nil)
-		return
-	}
-
-	c.JSON(http.StatusOK, questions)
+	return filter
 }
 
 // GetQuestion returns a specific question by ID
@@ -179,6 +186,19 @@ func (h *QuestionHandler) CreateQuestion(c *gin.Context) {
 			"request_id": middleware.GetRequestID(c),
 		}).WithError(err).Error("Failed to create question")
 
+		if strings.Contains(err.Error(), "invalid attachment") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ATTACHMENT", "Question attachment is invalid", err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "invalid content format") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_CONTENT_FORMAT", "Question content format is invalid", err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "invalid question type") || strings.Contains(err.Error(), "invalid answer key") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ANSWER_KEY", "Question answer key is invalid", err.Error())
+			return
+		}
+
 		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "QUESTION_CREATE_FAILED", "Failed to create question", nil)
 		return
 	}
@@ -198,7 +218,7 @@ func (h *QuestionHandler) CreateQuestion(c *gin.Context) {
 
 // UpdateQuestion updates a specific question (admin only)
 // @Summary Update question
-// @Description Update a specific question (admin only)
+// @Description Update a specific question (admin only). A change to its content records a new revision; exams open to candidates keep the revision they pinned, draft and scheduled exams move to the new one.
 // @Tags questions
 // @Accept json
 // @Produce json
@@ -226,7 +246,8 @@ func (h *QuestionHandler) UpdateQuestion(c *gin.Context) {
 		return
 	}
 
-	question, err := h.questionService.UpdateQuestion(uint(questionID), req)
+	userID, _ := middleware.GetUserID(c)
+	question, err := h.questionService.UpdateQuestion(uint(questionID), req, userID)
 	if err != nil {
 		h.logger.WithFields(logrus.Fields{
 			"question_id": questionID,
@@ -239,6 +260,19 @@ func (h *QuestionHandler) UpdateQuestion(c *gin.Context) {
 			return
 		}
 
+		if strings.Contains(err.Error(), "invalid attachment") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ATTACHMENT", "Question attachment is invalid", err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "invalid content format") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_CONTENT_FORMAT", "Question content format is invalid", err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "invalid question type") || strings.Contains(err.Error(), "invalid answer key") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ANSWER_KEY", "Question answer key is invalid", err.Error())
+			return
+		}
+
 		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "QUESTION_UPDATE_FAILED", "Failed to update question", nil)
 		return
 	}
@@ -290,8 +324,8 @@ func (h *QuestionHandler) DeleteQuestion(c *gin.Context) {
 			return
 		}
 
-		if strings.Contains(err.Error(), "used in active or draft exams") {
-			middleware.StructuredErrorResponse(c, http.StatusConflict, "QUESTION_IN_USE", "Cannot delete question as it is used in active or draft exams", nil)
+		if strings.Contains(err.Error(), "used in draft, scheduled or active exams") {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "QUESTION_IN_USE", "Cannot delete question as it is used in draft, scheduled or active exams", nil)
 			return
 		}
 
@@ -435,6 +469,375 @@ func (h *QuestionHandler) GetRandomQuestionsByTags(c *gin.Context) {
 	})
 }
 
+// maxImportFileSize caps the size of a question import file
+const maxImportFileSize = 10 << 20
+
+// GetQuestionRevisions lists the revisions of a question (admin only)
+// @Summary List question revisions
+// @Description List every revision of a question, newest first. Each edit that changes a question's content records a revision; exams, attempts and results keep the revision they used.
+// @Tags questions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Question ID"
+// @Success 200 {object} map[string]interface{} "Question revisions"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Question not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/questions/{id}/revisions [get]
+func (h *QuestionHandler) GetQuestionRevisions(c *gin.Context) {
+	questionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTION_ID", "Invalid question ID", nil)
+		return
+	}
+
+	revisions, err := h.questionService.GetQuestionRevisions(uint(questionID))
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"question_id": questionID,
+			"request_id":  middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get question revisions")
+
+		if err.Error() == "question not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "QUESTION_NOT_FOUND", "Question not found", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "REVISION_FETCH_FAILED", "Failed to get question revisions", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revisions": revisions,
+	})
+}
+
+// GetQuestionRevision returns one revision of a question (admin only)
+// @Summary Get question revision
+// @Description Get a question as it was at one revision
+// @Tags questions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Question ID"
+// @Param revision path int true "Revision number"
+// @Success 200 {object} map[string]interface{} "Question revision"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Question or revision not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/questions/{id}/revisions/{revision} [get]
+func (h *QuestionHandler) GetQuestionRevision(c *gin.Context) {
+	questionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTION_ID", "Invalid question ID", nil)
+		return
+	}
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revision < 1 {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REVISION", "Invalid revision number", nil)
+		return
+	}
+
+	found, err := h.questionService.GetQuestionRevision(uint(questionID), revision)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"question_id": questionID,
+			"revision":    revision,
+			"request_id":  middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get question revision")
+
+		if err.Error() == "question not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "QUESTION_NOT_FOUND", "Question not found", nil)
+			return
+		}
+		if err.Error() == "revision not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "REVISION_NOT_FOUND", "Revision not found", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "REVISION_FETCH_FAILED", "Failed to get question revision", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revision": found,
+	})
+}
+
+// DiffQuestionRevisions compares two revisions of a question (admin only)
+// @Summary Diff question revisions
+// @Description List the fields that changed between two revisions of a question, with their old and new values. By default the current revision is compared with the one before it.
+// @Tags questions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Question ID"
+// @Param from query int false "Older revision, by default the one before to"
+// @Param to query int false "Newer revision, by default the current one"
+// @Success 200 {object} services.RevisionDiffResponse "Changed fields"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Question or revision not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/questions/{id}/revisions/diff [get]
+func (h *QuestionHandler) DiffQuestionRevisions(c *gin.Context) {
+	questionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTION_ID", "Invalid question ID", nil)
+		return
+	}
+	from, err := strconv.Atoi(c.DefaultQuery("from", "0"))
+	if err != nil || from < 0 {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REVISION", "Invalid from revision", nil)
+		return
+	}
+	to, err := strconv.Atoi(c.DefaultQuery("to", "0"))
+	if err != nil || to < 0 {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REVISION", "Invalid to revision", nil)
+		return
+	}
+
+	diff, err := h.questionService.DiffQuestionRevisions(uint(questionID), from, to)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"question_id": questionID,
+			"from":        from,
+			"to":          to,
+			"request_id":  middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to diff question revisions")
+
+		if err.Error() == "question not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "QUESTION_NOT_FOUND", "Question not found", nil)
+			return
+		}
+		if err.Error() == "revision not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "REVISION_NOT_FOUND", "Revision not found", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "REVISION_FETCH_FAILED", "Failed to diff question revisions", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// RestoreQuestionRevision brings back an earlier revision of a question (admin only)
+// @Summary Restore question revision
+// @Description Make the content of an earlier revision current again. The restore records a new revision; published exams keep the revision they pinned.
+// @Tags questions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Question ID"
+// @Param revision path int true "Revision number to restore"
+// @Success 200 {object} map[string]interface{} "Revision restored"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Question or revision not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/questions/{id}/revisions/{revision}/restore [post]
+func (h *QuestionHandler) RestoreQuestionRevision(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	questionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTION_ID", "Invalid question ID", nil)
+		return
+	}
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revision < 1 {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REVISION", "Invalid revision number", nil)
+		return
+	}
+
+	question, err := h.questionService.RestoreQuestionRevision(uint(questionID), revision, userID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"question_id": questionID,
+			"revision":    revision,
+			"request_id":  middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to restore question revision")
+
+		if err.Error() == "question not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "QUESTION_NOT_FOUND", "Question not found", nil)
+			return
+		}
+		if err.Error() == "revision not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "REVISION_NOT_FOUND", "Revision not found", nil)
+			return
+		}
+		if strings.Contains(err.Error(), "invalid attachment") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ATTACHMENT", "The revision's attachments are no longer available", err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "invalid") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_ANSWER_KEY", "The revision no longer passes validation", err.Error())
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "REVISION_RESTORE_FAILED", "Failed to restore question revision", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Question revision restored",
+		"question": question.ToResponse(true),
+	})
+}
+
+// ImportQuestions imports questions from a file (admin only)
+// @Summary Import questions
+// @Description Import questions from a Moodle XML file, a native JSON export, a CSV or XLSX spreadsheet, or an Aiken or GIFT text file. Runs as a dry run by default and reports every question as valid or invalid with its line or row; send dry_run=false to create the valid questions. In all_or_nothing mode a file with invalid questions creates nothing and is answered with 422.
+// @Tags questions
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "Import file"
+// @Param format formData string false "File format (moodle_xml, json, csv, xlsx, aiken, gift)" default(moodle_xml)
+// @Param mode formData string false "What to do when some questions are invalid (skip_invalid, all_or_nothing)" default(skip_invalid)
+// @Param dry_run formData bool false "Only validate the questions" default(true)
+// @Param difficulty formData string false "Difficulty of questions the file doesn't give one (easy, medium, hard)" default(medium)
+// @Success 200 {object} services.ImportReport "Dry run report"
+// @Success 201 {object} services.ImportReport "Import report"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 422 {object} services.ImportReport "All-or-nothing import rejected"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/questions/import [post]
+func (h *QuestionHandler) ImportQuestions(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "A file is required", err.Error())
+		return
+	}
+	if header.Size > maxImportFileSize {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "FILE_TOO_LARGE", "Import files are limited to 10 MB", nil)
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultPostForm("dry_run", "true"))
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Invalid dry_run value", nil)
+		return
+	}
+
+	opts := services.ImportOptions{
+		Format: services.ImportFormat(c.DefaultPostForm("format", string(services.ImportMoodleXML))),
+		Mode:   services.ImportMode(c.PostForm("mode")),
+		DryRun: dryRun,
+	}
+	if !opts.Mode.IsValid() {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Import mode must be skip_invalid or all_or_nothing", nil)
+		return
+	}
+	if difficultyStr := c.PostForm("difficulty"); difficultyStr != "" {
+		if !isValidDifficulty(difficultyStr) {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_DIFFICULTY", "Invalid difficulty value", nil)
+			return
+		}
+		opts.Difficulty = models.QuestionDifficulty(difficultyStr)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read the uploaded file", nil)
+		return
+	}
+	defer file.Close()
+
+	report, err := h.questionService.ImportQuestions(file, opts, userID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"user_id":    userID,
+			"format":     opts.Format,
+			"filename":   header.Filename,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to import questions")
+
+		if strings.Contains(err.Error(), "unsupported import format") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "UNSUPPORTED_IMPORT_FORMAT", "Import format is not supported", err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "invalid import file") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_IMPORT_FILE", "Import file could not be read", err.Error())
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "QUESTION_IMPORT_FAILED", "Failed to import questions", nil)
+		return
+	}
+
+	status := http.StatusCreated
+	if report.DryRun {
+		status = http.StatusOK
+	} else if report.Mode == services.ImportAllOrNothing && report.Invalid > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, report)
+}
+
+// ExportQuestions streams the questions matching the listing filters as a file (admin only)
+// @Summary Export questions
+// @Description Download the questions matching the listing filters as a native JSON export (which POST /questions/import reads back), a Moodle XML quiz or an IMS QTI 2.1 package. Answer keys are included.
+// @Tags questions
+// @Produce json
+// @Produce xml
+// @Produce application/zip
+// @Security BearerAuth
+// @Param format query string false "Export format (json, moodle_xml, qti)" default(json)
+// @Param tags query string false "Comma-separated list of tags"
+// @Param difficulty query string false "Question difficulty (easy, medium, hard)"
+// @Param type query string false "Question type"
+// @Param search query string false "Search term"
+// @Param is_active query bool false "Filter by active status"
+// @Success 200 {file} file "Export file"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/questions/export [get]
+func (h *QuestionHandler) ExportQuestions(c *gin.Context) {
+	format := services.ExportFormat(c.DefaultQuery("format", string(services.ExportJSON)))
+	if !format.IsValid() {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "UNSUPPORTED_EXPORT_FORMAT", "Export format must be json, moodle_xml or qti", nil)
+		return
+	}
+	filter := parseQuestionFilter(c)
+
+	filename := "questions-" + time.Now().Format("20060102-150405") + format.Extension()
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if err := h.questionService.ExportQuestions(c.Writer, format, filter); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"format":     format,
+			"filter":     filter,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to export questions")
+
+		// Once the file has started the status is sent, and the download is cut short
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "QUESTION_EXPORT_FAILED", "Failed to export questions", nil)
+		}
+	}
+}
+
 // Helper functions for validation
 func isValidDifficulty(difficulty string) bool {
 	validDifficulties := []string{"easy", "medium", "hard"}
@@ -3,8 +3,10 @@ package handlers
 import (
 	"exam-system/middleware"
 	"exam-system/services"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -295,8 +297,9 @@ func (h *ResultHandler) GetUserStatistics(c *gin.Context) {
 		return
 	}
 
-	// Calculate user statistics
-	totalExams := len(results.Results)
+	// Calculate user statistics; results awaiting grading have no score yet
+	totalExams := 0
+	pendingExams := 0
 	passedExams := 0
 	totalScore := 0.0
 	totalTimeSpent := 0
@@ -304,17 +307,23 @@ func (h *ResultHandler) GetUserStatistics(c *gin.Context) {
 	lowestScore := 100.0
 
 	for _, result := range results.Results {
-		if result.Passed {
+		totalTimeSpent += result.Duration
+		if result.AwaitingGrading {
+			pendingExams++
+			continue
+		}
+
+		totalExams++
+		if *result.Passed {
 			passedExams++
 		}
-		totalScore += result.Score
-		totalTimeSpent += result.Duration
+		totalScore += *result.Score
 
-		if result.Score > highestScore {
-			highestScore = result.Score
+		if *result.Score > highestScore {
+			highestScore = *result.Score
 		}
-		if result.Score < lowestScore {
-			lowestScore = result.Score
+		if *result.Score < lowestScore {
+			lowestScore = *result.Score
 		}
 	}
 
@@ -334,6 +343,7 @@ func (h *ResultHandler) GetUserStatistics(c *gin.Context) {
 		"total_exams":      totalExams,
 		"passed_exams":     passedExams,
 		"failed_exams":     totalExams - passedExams,
+		"pending_exams":    pendingExams,
 		"pass_rate":        passRate,
 		"average_score":    averageScore,
 		"highest_score":    highestScore,
@@ -346,3 +356,536 @@ func (h *ResultHandler) GetUserStatistics(c *gin.Context) {
 	})
 }
 
+// GetGradingQueue lists the essays of an exam waiting to be marked
+// @Summary Get grading queue
+// @Description List the essay answers of an exam that no grader has marked yet, oldest submissions first (admin only)
+// @Tags results
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Success 200 {object} services.GradingQueueResponse "Ungraded answers"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Exam not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/grading [get]
+func (h *ResultHandler) GetGradingQueue(c *gin.Context) {
+	examIDStr := c.Param("id")
+	examID, err := strconv.ParseUint(examIDStr, 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	queue, err := h.resultService.GetGradingQueue(uint(examID))
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get grading queue")
+
+		if err.Error() == "exam not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_FOUND", "Exam not found", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "GRADING_QUEUE_FETCH_FAILED", "Failed to get grading queue", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, queue)
+}
+
+// GradeEssay marks one essay answer of a result
+// @Summary Grade essay answer
+// @Description Score an essay answer against its rubric, or with points when the question has none, with comments (admin only). Essays can be re-marked until the result is finalized.
+// @Tags results
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Result ID"
+// @Param question_id path int true "Question ID"
+// @Param request body services.GradeEssayRequest true "Marks"
+// @Success 200 {object} map[string]interface{} "Answer graded successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Result or answer not found"
+// @Failure 409 {object} map[string]interface{} "Result already graded"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/results/{id}/answers/{question_id}/grade [post]
+func (h *ResultHandler) GradeEssay(c *gin.Context) {
+	graderID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	resultID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_RESULT_ID", "Invalid result ID", nil)
+		return
+	}
+
+	questionID, err := strconv.ParseUint(c.Param("question_id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTION_ID", "Invalid question ID", nil)
+		return
+	}
+
+	var req services.GradeEssayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request data", err.Error())
+		return
+	}
+
+	result, err := h.resultService.GradeEssay(uint(resultID), uint(questionID), req, graderID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"result_id":   resultID,
+			"question_id": questionID,
+			"grader_id":   graderID,
+			"request_id":  middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to grade answer")
+
+		if err.Error() == "result not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "RESULT_NOT_FOUND", "Result not found", nil)
+			return
+		}
+
+		if err.Error() == "answer not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "ANSWER_NOT_FOUND", "Result has no answer to this question", nil)
+			return
+		}
+
+		if err.Error() == "result is already graded" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "RESULT_ALREADY_GRADED", "Result is already graded", nil)
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid grade") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_GRADE", "Marks do not fit the question", err.Error())
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "GRADE_ANSWER_FAILED", "Failed to grade answer", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Answer graded successfully",
+		"result":  result.ToResponse(true, true),
+	})
+}
+
+// FinalizeResult closes grading of a result
+// @Summary Finalize result
+// @Description Recompute the score and pass mark of a result once all its essays are marked, and release it to the candidate (admin only)
+// @Tags results
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Result ID"
+// @Success 200 {object} map[string]interface{} "Result finalized successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Result not found"
+// @Failure 409 {object} map[string]interface{} "Result already graded or has ungraded answers"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/results/{id}/finalize [post]
+func (h *ResultHandler) FinalizeResult(c *gin.Context) {
+	graderID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	resultID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_RESULT_ID", "Invalid result ID", nil)
+		return
+	}
+
+	result, err := h.resultService.FinalizeResult(uint(resultID), graderID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"result_id":  resultID,
+			"grader_id":  graderID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to finalize result")
+
+		if err.Error() == "result not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "RESULT_NOT_FOUND", "Result not found", nil)
+			return
+		}
+
+		if err.Error() == "result is already graded" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "RESULT_ALREADY_GRADED", "Result is already graded", nil)
+			return
+		}
+
+		if err.Error() == "result has ungraded answers" {
+			middleware.StructuredErrorResponse(c, http.StatusConflict, "UNGRADED_ANSWERS", "Result has essays that are not graded yet", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "FINALIZE_RESULT_FAILED", "Failed to finalize result", nil)
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"result_id":  resultID,
+		"grader_id":  graderID,
+		"score":      result.Score,
+		"passed":     result.Passed,
+		"request_id": middleware.GetRequestID(c),
+	}).Info("Result finalized")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Result finalized successfully",
+		"result":  result.ToResponse(true, true),
+	})
+}
+
+// RegradeExam regrades the results of an exam after an answer key correction
+// @Summary Regrade exam results
+// @Description Grade the stored answers of an exam again against the current answer keys, or only the answers to question_id. For one question the mode can also accept more options of a single-answer question or drop the question, giving everyone full credit. Reports the results whose score moved and the candidates whose pass/fail status flipped; dry_run previews the report without saving (admin only).
+// @Tags results
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Param request body services.RegradeRequest true "Regrade options"
+// @Success 200 {object} services.RegradeReport "Regrade report"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Exam not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/regrade [post]
+func (h *ResultHandler) RegradeExam(c *gin.Context) {
+	adminID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	examID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	var req services.RegradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request data", err.Error())
+		return
+	}
+
+	report, err := h.resultService.RegradeExam(uint(examID), req, adminID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"admin_id":   adminID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to regrade exam")
+
+		if err.Error() == "exam not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_FOUND", "Exam not found", nil)
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid regrade") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REGRADE", "Invalid regrade options", err.Error())
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "REGRADE_FAILED", "Failed to regrade results", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// RegradeQuestion regrades the answers to a question in every exam using it
+// @Summary Regrade question
+// @Description Grade the stored answers to a question again in every exam that uses it, against its current answer key, accepting more options of a single-answer question, or dropping it to give everyone full credit. Reports the results whose score moved and the candidates whose pass/fail status flipped; dry_run previews the report without saving (admin only).
+// @Tags questions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Question ID"
+// @Param request body services.RegradeRequest true "Regrade options"
+// @Success 200 {object} services.RegradeReport "Regrade report"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Question not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/questions/{id}/regrade [post]
+func (h *ResultHandler) RegradeQuestion(c *gin.Context) {
+	adminID, exists := middleware.GetUserID(c)
+	if !exists {
+		middleware.StructuredErrorResponse(c, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", nil)
+		return
+	}
+
+	questionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTION_ID", "Invalid question ID", nil)
+		return
+	}
+
+	var req services.RegradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request data", err.Error())
+		return
+	}
+	if req.QuestionID != nil && *req.QuestionID != uint(questionID) {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REGRADE", "question_id does not match the question being regraded", nil)
+		return
+	}
+
+	report, err := h.resultService.RegradeQuestion(uint(questionID), req, adminID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"question_id": questionID,
+			"admin_id":    adminID,
+			"request_id":  middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to regrade question")
+
+		if err.Error() == "question not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "QUESTION_NOT_FOUND", "Question not found", nil)
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid regrade") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REGRADE", "Invalid regrade options", err.Error())
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "REGRADE_FAILED", "Failed to regrade results", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetRegrades returns the regrade audit trail of an exam
+// @Summary Get exam regrades
+// @Description List the regrades that touched an exam's results, newest first, with the before and after score and pass mark of each result they changed (admin only)
+// @Tags results
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Success 200 {object} map[string]interface{} "Regrades"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Exam not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/regrades [get]
+func (h *ResultHandler) GetRegrades(c *gin.Context) {
+	examID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	regrades, err := h.resultService.GetRegrades(uint(examID))
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get regrades")
+
+		if err.Error() == "exam not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_FOUND", "Exam not found", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "REGRADE_FETCH_FAILED", "Failed to get regrades", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"regrades": regrades,
+	})
+}
+
+// GetExamItemAnalysis returns the item analysis of an exam
+// @Summary Get exam item analysis
+// @Description Classical item analysis over the graded results of an exam: p-value, point-biserial and upper/lower discrimination index per question, option selection frequencies for choice questions, and KR-20/Cronbach's alpha for the exam. Items are flagged too easy, too hard or negatively discriminating (admin only).
+// @Tags results
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Param easy_above query number false "Flag items with a higher p-value as too easy" default(0.9)
+// @Param hard_below query number false "Flag items with a lower p-value as too hard" default(0.2)
+// @Success 200 {object} services.ItemAnalysisResponse "Item analysis"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Exam not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/item-analysis [get]
+func (h *ResultHandler) GetExamItemAnalysis(c *gin.Context) {
+	examID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	opts, err := parseItemAnalysisOptions(c)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_THRESHOLD", "Invalid flag threshold", err.Error())
+		return
+	}
+
+	analysis, err := h.resultService.GetExamItemAnalysis(uint(examID), opts)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get item analysis")
+
+		if err.Error() == "exam not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_FOUND", "Exam not found", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "ITEM_ANALYSIS_FAILED", "Failed to get item analysis", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, analysis)
+}
+
+// GetQuestionItemAnalysis returns the item analysis of a question
+// @Summary Get question item analysis
+// @Description Classical item analysis of a question over the graded results of every exam that used it: p-value, point-biserial and upper/lower discrimination index, and option selection frequencies for choice questions, with the same flags as the exam analysis (admin only).
+// @Tags questions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Question ID"
+// @Param easy_above query number false "Flag the item as too easy above this p-value" default(0.9)
+// @Param hard_below query number false "Flag the item as too hard below this p-value" default(0.2)
+// @Success 200 {object} services.ItemAnalysisResponse "Item analysis"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Question not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/questions/{id}/item-analysis [get]
+func (h *ResultHandler) GetQuestionItemAnalysis(c *gin.Context) {
+	questionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_QUESTION_ID", "Invalid question ID", nil)
+		return
+	}
+
+	opts, err := parseItemAnalysisOptions(c)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_THRESHOLD", "Invalid flag threshold", err.Error())
+		return
+	}
+
+	analysis, err := h.resultService.GetQuestionItemAnalysis(uint(questionID), opts)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"question_id": questionID,
+			"request_id":  middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to get item analysis")
+
+		if err.Error() == "question not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "QUESTION_NOT_FOUND", "Question not found", nil)
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "ITEM_ANALYSIS_FAILED", "Failed to get item analysis", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, analysis)
+}
+
+// CalibrateExam fits item response theory parameters to the questions of an exam
+// @Summary Calibrate exam questions
+// @Description Fit 1PL or 2PL item response theory parameters (discrimination and difficulty, with standard errors) to the questions of an exam by marginal maximum likelihood, from the graded answers given to their current revision in every exam that used them. Questions with fewer than min_responses answers, only right or only wrong answers, and essays are skipped. The parameters are stored on the questions for adaptive exams; dry_run previews them without saving (admin only).
+// @Tags results
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Exam ID"
+// @Param request body services.CalibrationRequest true "Calibration options"
+// @Success 200 {object} services.CalibrationReport "Calibration report"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Exam not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/exams/{id}/calibrate [post]
+func (h *ResultHandler) CalibrateExam(c *gin.Context) {
+	examID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_EXAM_ID", "Invalid exam ID", nil)
+		return
+	}
+
+	var req services.CalibrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request data", err.Error())
+		return
+	}
+
+	report, err := h.resultService.CalibrateExam(uint(examID), req)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"exam_id":    examID,
+			"request_id": middleware.GetRequestID(c),
+		}).WithError(err).Error("Failed to calibrate questions")
+
+		if err.Error() == "exam not found" {
+			middleware.StructuredErrorResponse(c, http.StatusNotFound, "EXAM_NOT_FOUND", "Exam not found", nil)
+			return
+		}
+
+		if strings.Contains(err.Error(), "invalid calibration") {
+			middleware.StructuredErrorResponse(c, http.StatusBadRequest, "INVALID_CALIBRATION", "Invalid calibration options", err.Error())
+			return
+		}
+
+		middleware.StructuredErrorResponse(c, http.StatusInternalServerError, "CALIBRATION_FAILED", "Failed to calibrate questions", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// parseItemAnalysisOptions reads the flag thresholds of an item analysis request
+func parseItemAnalysisOptions(c *gin.Context) (services.ItemAnalysisOptions, error) {
+	opts := services.ItemAnalysisOptions{EasyAbove: services.DefaultEasyAbove, HardBelow: services.DefaultHardBelow}
+
+	if value := c.Query("easy_above"); value != "" {
+		easyAbove, err := strconv.ParseFloat(value, 64)
+		if err != nil || easyAbove <= 0 || easyAbove > 1 {
+			return opts, fmt.Errorf("easy_above must be between 0 and 1")
+		}
+		opts.EasyAbove = easyAbove
+	}
+	if value := c.Query("hard_below"); value != "" {
+		hardBelow, err := strconv.ParseFloat(value, 64)
+		if err != nil || hardBelow <= 0 || hardBelow > 1 {
+			return opts, fmt.Errorf("hard_below must be between 0 and 1")
+		}
+		opts.HardBelow = hardBelow
+	}
+
+	return opts, nil
+}
@@ -13,6 +13,7 @@ import (
 	"exam-system/middleware"
 	"exam-system/models"
 	"exam-system/services"
+	"exam-system/storage"
 	"exam-system/utils"
 
 	// _ "exam-system/docs"
@@ -68,6 +69,21 @@ func main() {
 	examService := services.NewExamService(db, redisClient, logger)
 	resultService := services.NewResultService(db, logger)
 
+	mediaStorage, err := storage.New(config.AppConfig.Media)
+	if err != nil {
+		logger.Fatal("Failed to initialize media storage: ", err)
+	}
+	mediaService := services.NewMediaService(db, mediaStorage, logger)
+
+	// Start background worker that auto-submits attempts past their time limit
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	examTimerWorker := services.NewExamTimerWorker(examService, config.AppConfig.Exam.WorkerInterval, config.AppConfig.Exam.GracePeriod, logger)
+	examTimerWorker.Start(workerCtx)
+
+	// Start background worker that removes media no question uses any more
+	mediaCleanupWorker := services.NewMediaCleanupWorker(mediaService, config.AppConfig.Media.CleanupInterval, config.AppConfig.Media.OrphanGrace, logger)
+	mediaCleanupWorker.Start(workerCtx)
+
 	// Set Gin mode
 	gin.SetMode(config.AppConfig.Server.GinMode)
 
@@ -85,9 +101,10 @@ func main() {
 	questionHandler := handlers.NewQuestionHandler(questionService, logger)
 	examHandler := handlers.NewExamHandler(examService, logger)
 	resultHandler := handlers.NewResultHandler(resultService, logger)
+	mediaHandler := handlers.NewMediaHandler(mediaService, logger)
 
 	// Setup routes
-	setupRoutes(router, authHandler, userHandler, questionHandler, examHandler, resultHandler, redisClient, logger)
+	setupRoutes(router, authHandler, userHandler, questionHandler, examHandler, resultHandler, mediaHandler, redisClient, logger)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -122,6 +139,11 @@ func main() {
 		logger.Fatal("Server forced to shutdown: ", err)
 	}
 
+	// Stop background workers after in-flight requests have finished
+	stopWorkers()
+	examTimerWorker.Wait()
+	mediaCleanupWorker.Wait()
+
 	logger.Info("Server exited")
 }
 
@@ -132,6 +154,7 @@ func setupRoutes(
 	questionHandler *handlers.QuestionHandler,
 	examHandler *handlers.ExamHandler,
 	resultHandler *handlers.ResultHandler,
+	mediaHandler *handlers.MediaHandler,
 	redisClient *utils.RedisClient,
 	logger *logrus.Logger,
 ) {
@@ -179,6 +202,7 @@ func setupRoutes(
 		questionGroup.GET("", questionHandler.GetQuestions)
 		questionGroup.GET("/tags", questionHandler.GetTags)
 		questionGroup.GET("/random", questionHandler.GetRandomQuestionsByTags)
+		questionGroup.GET("/export", middleware.AdminMiddleware(), questionHandler.ExportQuestions)
 		questionGroup.GET("/:id", questionHandler.GetQuestion)
 
 		// Admin only routes
@@ -186,8 +210,15 @@ func setupRoutes(
 		adminQuestionGroup.Use(middleware.AdminMiddleware())
 		{
 			adminQuestionGroup.POST("", questionHandler.CreateQuestion)
+			adminQuestionGroup.POST("/import", questionHandler.ImportQuestions)
 			adminQuestionGroup.PUT("/:id", questionHandler.UpdateQuestion)
 			adminQuestionGroup.DELETE("/:id", questionHandler.DeleteQuestion)
+			adminQuestionGroup.GET("/:id/revisions", questionHandler.GetQuestionRevisions)
+			adminQuestionGroup.GET("/:id/revisions/diff", questionHandler.DiffQuestionRevisions)
+			adminQuestionGroup.GET("/:id/revisions/:revision", questionHandler.GetQuestionRevision)
+			adminQuestionGroup.POST("/:id/revisions/:revision/restore", questionHandler.RestoreQuestionRevision)
+			adminQuestionGroup.POST("/:id/regrade", resultHandler.RegradeQuestion)
+			adminQuestionGroup.GET("/:id/item-analysis", resultHandler.GetQuestionItemAnalysis)
 		}
 	}
 
@@ -198,6 +229,13 @@ func setupRoutes(
 		examGroup.GET("", examHandler.GetExams)
 		examGroup.GET("/:id", examHandler.GetExam)
 		examGroup.POST("/:id/start", examHandler.StartExam)
+		examGroup.POST("/:id/resume", examHandler.ResumeExam)
+		examGroup.POST("/:id/sections/next", examHandler.NextSection)
+		examGroup.GET("/:id/questions/current", examHandler.GetCurrentQuestion)
+		examGroup.POST("/:id/questions/current/answer", examHandler.AnswerCurrentQuestion)
+		examGroup.GET("/:id/attempts", examHandler.GetAttempts)
+		examGroup.GET("/:id/answers", examHandler.GetSavedAnswers)
+		examGroup.PUT("/:id/answers", examHandler.SaveAnswer)
 		examGroup.POST("/:id/submit", middleware.RateLimitMiddleware(redisClient, config.AppConfig.RateLimit.SubmitLimit, config.AppConfig.RateLimit.Window, "submit"), examHandler.SubmitExam)
 
 		// Admin only routes
@@ -206,8 +244,17 @@ func setupRoutes(
 		{
 			adminExamGroup.POST("", examHandler.CreateExam)
 			adminExamGroup.PUT("/:id", examHandler.UpdateExam)
+			adminExamGroup.POST("/:id/status", examHandler.TransitionExam)
 			adminExamGroup.DELETE("/:id", examHandler.DeleteExam)
 			adminExamGroup.POST("/:id/assign", examHandler.AssignExam)
+			adminExamGroup.POST("/:id/extra-time", examHandler.GrantExtraTime)
+			adminExamGroup.GET("/:id/attempts/:attempt_id/permutation", examHandler.GetAttemptPermutation)
+			adminExamGroup.GET("/:id/preview", examHandler.PreviewExam)
+			adminExamGroup.GET("/:id/grading", resultHandler.GetGradingQueue)
+			adminExamGroup.POST("/:id/regrade", resultHandler.RegradeExam)
+			adminExamGroup.GET("/:id/regrades", resultHandler.GetRegrades)
+			adminExamGroup.GET("/:id/item-analysis", resultHandler.GetExamItemAnalysis)
+			adminExamGroup.POST("/:id/calibrate", resultHandler.CalibrateExam)
 		}
 	}
 
@@ -223,9 +270,21 @@ func setupRoutes(
 		adminResultGroup.Use(middleware.AdminMiddleware())
 		{
 			adminResultGroup.GET("/statistics", resultHandler.GetStatistics)
+			adminResultGroup.POST("/:id/answers/:question_id/grade", resultHandler.GradeEssay)
+			adminResultGroup.POST("/:id/finalize", resultHandler.FinalizeResult)
 		}
 	}
 
+	// Media routes. Files are fetched with signed links that work without a login,
+	// as <img>, <audio> and <video> tags can't send a token.
+	v1.GET("/media/:id/content", mediaHandler.GetMediaContent)
+	mediaGroup := v1.Group("/media")
+	mediaGroup.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
+	{
+		mediaGroup.POST("", mediaHandler.UploadMedia)
+		mediaGroup.DELETE("/:id", mediaHandler.DeleteMedia)
+	}
+
 	// Admin routes
 	adminGroup := v1.Group("/admin")
 	adminGroup.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
@@ -0,0 +1,8 @@
+-- Add scoring policy settings to exams
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS scoring_policy VARCHAR(50) DEFAULT 'all_or_nothing' CHECK (scoring_policy IN ('all_or_nothing', 'partial_credit', 'wrong_penalty', 'negative_marking'));
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS negative_mark_ratio DECIMAL(4,3) DEFAULT 0;
+
+-- Results can hold fractional points and record the policy they were graded with
+ALTER TABLE results ALTER COLUMN total_points TYPE DECIMAL(10,2);
+ALTER TABLE results ADD COLUMN IF NOT EXISTS scoring_policy VARCHAR(50) DEFAULT 'all_or_nothing';
+ALTER TABLE results ADD COLUMN IF NOT EXISTS negative_mark_ratio DECIMAL(4,3) DEFAULT 0;
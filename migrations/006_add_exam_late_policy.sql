@@ -0,0 +1,6 @@
+-- Add late submission policy to exams
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS late_policy VARCHAR(50) DEFAULT 'reject' CHECK (late_policy IN ('reject', 'truncate'));
+
+-- Flag results that were accepted late or closed by the timer worker
+ALTER TABLE results ADD COLUMN IF NOT EXISTS submitted_late BOOLEAN DEFAULT false;
+ALTER TABLE results ADD COLUMN IF NOT EXISTS auto_submitted BOOLEAN DEFAULT false;
@@ -0,0 +1,13 @@
+-- Create saved_answers table for answers autosaved during an attempt
+CREATE TABLE IF NOT EXISTS saved_answers (
+    id SERIAL PRIMARY KEY,
+    user_exam_id INTEGER NOT NULL REFERENCES user_exams(id) ON DELETE CASCADE,
+    question_id INTEGER NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    selected_options JSONB,
+    time_spent INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One saved answer per question per attempt
+CREATE UNIQUE INDEX IF NOT EXISTS idx_saved_answers_user_exam_question ON saved_answers(user_exam_id, question_id);
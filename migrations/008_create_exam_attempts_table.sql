@@ -0,0 +1,46 @@
+-- Create exam_attempts table, one row per attempt at an assigned exam
+CREATE TABLE IF NOT EXISTS exam_attempts (
+    id SERIAL PRIMARY KEY,
+    user_exam_id INTEGER NOT NULL REFERENCES user_exams(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    exam_id INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+    attempt_number INTEGER NOT NULL,
+    status VARCHAR(50) DEFAULT 'started' CHECK (status IN ('started', 'completed')),
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exam_attempts_user_exam_number ON exam_attempts(user_exam_id, attempt_number);
+CREATE INDEX IF NOT EXISTS idx_exam_attempts_user_id ON exam_attempts(user_id);
+CREATE INDEX IF NOT EXISTS idx_exam_attempts_exam_id ON exam_attempts(exam_id);
+
+-- Retake rules on exams
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS retake_cooldown INTEGER DEFAULT 0;
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS keep_score VARCHAR(50) DEFAULT 'best' CHECK (keep_score IN ('best', 'last', 'average'));
+
+-- Link assignments and results to attempts
+ALTER TABLE user_exams ADD COLUMN IF NOT EXISTS current_attempt_id INTEGER REFERENCES exam_attempts(id) ON DELETE SET NULL;
+ALTER TABLE results ADD COLUMN IF NOT EXISTS exam_attempt_id INTEGER REFERENCES exam_attempts(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_results_exam_attempt_id ON results(exam_attempt_id);
+
+-- A user exam now has one result per attempt
+ALTER TABLE results DROP CONSTRAINT IF EXISTS results_user_exam_id_key;
+
+-- Backfill one attempt for every assignment that was already started
+INSERT INTO exam_attempts (user_exam_id, user_id, exam_id, attempt_number, status, started_at, completed_at)
+SELECT ue.id, ue.user_id, ue.exam_id, GREATEST(ue.attempt_count, 1),
+       CASE WHEN ue.status = 'started' THEN 'started' ELSE 'completed' END,
+       ue.started_at, ue.completed_at
+FROM user_exams ue
+WHERE ue.started_at IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM exam_attempts ea WHERE ea.user_exam_id = ue.id);
+
+UPDATE user_exams ue SET current_attempt_id = ea.id
+FROM exam_attempts ea
+WHERE ea.user_exam_id = ue.id AND ue.current_attempt_id IS NULL;
+
+UPDATE results r SET exam_attempt_id = ea.id
+FROM exam_attempts ea
+WHERE ea.user_exam_id = r.user_exam_id AND r.exam_attempt_id IS NULL;
@@ -0,0 +1,8 @@
+-- Per-exam shuffle settings
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS shuffle_questions BOOLEAN DEFAULT false;
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS shuffle_options BOOLEAN DEFAULT false;
+
+-- Seed and settings that fix the order each attempt was shown
+ALTER TABLE exam_attempts ADD COLUMN IF NOT EXISTS seed BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE exam_attempts ADD COLUMN IF NOT EXISTS shuffle_questions BOOLEAN DEFAULT false;
+ALTER TABLE exam_attempts ADD COLUMN IF NOT EXISTS shuffle_options BOOLEAN DEFAULT false;
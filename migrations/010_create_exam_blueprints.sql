@@ -0,0 +1,28 @@
+-- Create exam_blueprint_sections table for exams drawn from the question bank
+CREATE TABLE IF NOT EXISTS exam_blueprint_sections (
+    id SERIAL PRIMARY KEY,
+    exam_id INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+    name VARCHAR(255),
+    "order" INTEGER NOT NULL,
+    question_count INTEGER NOT NULL CHECK (question_count > 0),
+    tags JSONB,
+    difficulty VARCHAR(50),
+    points INTEGER DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_exam_blueprint_sections_exam_id ON exam_blueprint_sections(exam_id);
+
+-- Create attempt_questions table recording each attempt's blueprint draw
+CREATE TABLE IF NOT EXISTS attempt_questions (
+    id SERIAL PRIMARY KEY,
+    exam_attempt_id INTEGER NOT NULL REFERENCES exam_attempts(id) ON DELETE CASCADE,
+    section_id INTEGER REFERENCES exam_blueprint_sections(id) ON DELETE SET NULL,
+    question_id INTEGER NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    "order" INTEGER NOT NULL,
+    points INTEGER DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_attempt_questions_exam_attempt_id ON attempt_questions(exam_attempt_id);
@@ -0,0 +1,26 @@
+-- Create exam_sections table for exams split into timed parts
+CREATE TABLE IF NOT EXISTS exam_sections (
+    id SERIAL PRIMARY KEY,
+    exam_id INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    instructions TEXT,
+    "order" INTEGER NOT NULL,
+    duration INTEGER DEFAULT 0 CHECK (duration >= 0), -- in minutes, 0 means no limit of its own
+    lock_on_close BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_exam_sections_exam_id ON exam_sections(exam_id);
+
+-- Place questions and blueprint draws in sections
+ALTER TABLE exam_questions ADD COLUMN IF NOT EXISTS section_id INTEGER REFERENCES exam_sections(id) ON DELETE SET NULL;
+ALTER TABLE exam_blueprint_sections ADD COLUMN IF NOT EXISTS exam_section_id INTEGER REFERENCES exam_sections(id) ON DELETE SET NULL;
+ALTER TABLE attempt_questions ADD COLUMN IF NOT EXISTS exam_section_id INTEGER REFERENCES exam_sections(id) ON DELETE SET NULL;
+
+-- Track which section each attempt is in
+ALTER TABLE exam_attempts ADD COLUMN IF NOT EXISTS section_index INTEGER DEFAULT 0;
+ALTER TABLE exam_attempts ADD COLUMN IF NOT EXISTS section_started_at TIMESTAMP WITH TIME ZONE;
+
+-- Section-level subscores
+ALTER TABLE results ADD COLUMN IF NOT EXISTS section_scores JSONB;
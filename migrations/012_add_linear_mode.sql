@@ -0,0 +1,17 @@
+-- Linear exams serve one question at a time and time each answer on the server
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS linear_mode BOOLEAN DEFAULT FALSE;
+ALTER TABLE exam_attempts ADD COLUMN IF NOT EXISTS linear_mode BOOLEAN DEFAULT FALSE;
+
+-- Create question_timings table recording when each question was served and answered
+CREATE TABLE IF NOT EXISTS question_timings (
+    id SERIAL PRIMARY KEY,
+    exam_attempt_id INTEGER NOT NULL REFERENCES exam_attempts(id) ON DELETE CASCADE,
+    question_id INTEGER NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    served_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    answered_at TIMESTAMP WITH TIME ZONE,
+    timed_out BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_question_timings_attempt_question ON question_timings(exam_attempt_id, question_id);
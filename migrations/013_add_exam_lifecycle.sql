@@ -0,0 +1,11 @@
+-- Exam lifecycle: draft -> scheduled -> active -> closed -> archived
+ALTER TABLE exams DROP CONSTRAINT IF EXISTS exams_status_check;
+UPDATE exams SET status = 'closed' WHERE status = 'completed';
+ALTER TABLE exams ADD CONSTRAINT exams_status_check CHECK (status IN ('draft', 'scheduled', 'active', 'closed', 'archived'));
+
+-- Zero-valued times used to be stored for exams created without a window
+UPDATE exams SET start_time = NULL WHERE start_time = '0001-01-01 00:00:00+00';
+UPDATE exams SET end_time = NULL WHERE end_time = '0001-01-01 00:00:00+00';
+
+CREATE INDEX IF NOT EXISTS idx_exams_status_start_time ON exams(status, start_time);
+CREATE INDEX IF NOT EXISTS idx_exams_status_end_time ON exams(status, end_time);
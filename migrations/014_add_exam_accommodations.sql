@@ -0,0 +1,11 @@
+-- Per-candidate accommodations: time multiplier, extra minutes and a custom window
+ALTER TABLE user_exams ADD COLUMN IF NOT EXISTS time_multiplier DOUBLE PRECISION NOT NULL DEFAULT 1;
+ALTER TABLE user_exams ADD COLUMN IF NOT EXISTS extra_minutes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_exams ADD COLUMN IF NOT EXISTS window_start TIMESTAMP WITH TIME ZONE;
+ALTER TABLE user_exams ADD COLUMN IF NOT EXISTS window_end TIMESTAMP WITH TIME ZONE;
+
+-- Extra time granted by an admin during the current attempt
+ALTER TABLE user_exams ADD COLUMN IF NOT EXISTS granted_minutes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE exam_attempts ADD COLUMN IF NOT EXISTS granted_minutes INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_user_exams_window_start ON user_exams(window_start) WHERE window_start IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Short-answer and cloze questions keep their answer key in blanks instead of options
+ALTER TABLE questions DROP CONSTRAINT IF EXISTS questions_type_check;
+ALTER TABLE questions ADD CONSTRAINT questions_type_check CHECK (type IN ('multiple_choice', 'true_false', 'short_answer', 'cloze'));
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS blanks JSONB;
+ALTER TABLE saved_answers ADD COLUMN IF NOT EXISTS text_answers JSONB;
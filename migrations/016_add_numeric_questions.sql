@@ -0,0 +1,5 @@
+-- Numeric questions keep their answer key (value, tolerance, units) in numeric_key
+ALTER TABLE questions DROP CONSTRAINT IF EXISTS questions_type_check;
+ALTER TABLE questions ADD CONSTRAINT questions_type_check CHECK (type IN ('multiple_choice', 'true_false', 'short_answer', 'cloze', 'numeric'));
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS numeric_key JSONB;
+ALTER TABLE saved_answers ADD COLUMN IF NOT EXISTS numeric_answer JSONB;
@@ -0,0 +1,6 @@
+-- Ordering and matching questions; matching questions keep their right-hand items
+-- in match_choices, and options point at them with match_id
+ALTER TABLE questions DROP CONSTRAINT IF EXISTS questions_type_check;
+ALTER TABLE questions ADD CONSTRAINT questions_type_check CHECK (type IN ('multiple_choice', 'true_false', 'short_answer', 'cloze', 'numeric', 'ordering', 'matching'));
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS match_choices JSONB;
+ALTER TABLE saved_answers ADD COLUMN IF NOT EXISTS matches JSONB;
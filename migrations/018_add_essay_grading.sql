@@ -0,0 +1,10 @@
+-- Essay questions are marked by a grader, optionally against a rubric
+ALTER TABLE questions DROP CONSTRAINT IF EXISTS questions_type_check;
+ALTER TABLE questions ADD CONSTRAINT questions_type_check CHECK (type IN ('multiple_choice', 'true_false', 'short_answer', 'cloze', 'numeric', 'ordering', 'matching', 'essay'));
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS rubric JSONB;
+ALTER TABLE saved_answers ADD COLUMN IF NOT EXISTS essay TEXT;
+
+-- Results with essays wait in pending_grading until a grader finalizes them
+ALTER TABLE results ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'graded' CHECK (status IN ('graded', 'pending_grading'));
+ALTER TABLE results ADD COLUMN IF NOT EXISTS graded_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_results_exam_id_status ON results(exam_id, status);
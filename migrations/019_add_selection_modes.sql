@@ -0,0 +1,11 @@
+-- Multiple-choice questions are single- or multi-select
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS selection_mode VARCHAR(20) CHECK (selection_mode IN ('single', 'multiple'));
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS min_selections INTEGER DEFAULT 0;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS max_selections INTEGER DEFAULT 0;
+
+-- Existing questions take the mode their answer key implies
+UPDATE questions q SET selection_mode = CASE
+    WHEN (SELECT COUNT(*) FROM jsonb_array_elements(q.options) o WHERE (o->>'is_correct')::boolean) = 1 THEN 'single'
+    ELSE 'multiple'
+END
+WHERE q.type = 'multiple_choice' AND q.selection_mode IS NULL;
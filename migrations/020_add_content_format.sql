@@ -0,0 +1,3 @@
+-- Question content, option texts and explanations are plain text, Markdown or sanitized HTML
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS content_format VARCHAR(20) DEFAULT 'plain' CHECK (content_format IN ('plain', 'markdown', 'html'));
+UPDATE questions SET content_format = 'plain' WHERE content_format IS NULL;
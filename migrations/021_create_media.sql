@@ -0,0 +1,24 @@
+-- Uploaded images, audio and video; files live in the configured storage backend
+CREATE TABLE IF NOT EXISTS media (
+    id SERIAL PRIMARY KEY,
+    key VARCHAR(255) NOT NULL UNIQUE,
+    filename VARCHAR(255),
+    content_type VARCHAR(100) NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('image', 'audio', 'video')),
+    size BIGINT NOT NULL DEFAULT 0,
+    checksum VARCHAR(64),
+    uploaded_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Which media each question uses; media no question links to is cleaned up
+CREATE TABLE IF NOT EXISTS question_media (
+    question_id INTEGER NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    media_id INTEGER NOT NULL REFERENCES media(id),
+    PRIMARY KEY (question_id, media_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_question_media_media_id ON question_media(media_id);
+CREATE INDEX IF NOT EXISTS idx_media_created_at ON media(created_at);
+
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS attachments JSONB;
@@ -0,0 +1,40 @@
+-- Every edit that changes a question's content records a revision; exams, blueprint
+-- draws and graded answers keep the revision they used
+CREATE TABLE IF NOT EXISTS question_revisions (
+    id SERIAL PRIMARY KEY,
+    question_id INTEGER NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    content_format VARCHAR(20) DEFAULT 'plain',
+    type VARCHAR(50),
+    difficulty VARCHAR(50),
+    options JSONB,
+    match_choices JSONB,
+    blanks JSONB,
+    numeric_key JSONB,
+    rubric JSONB,
+    attachments JSONB,
+    selection_mode VARCHAR(20),
+    min_selections INTEGER DEFAULT 0,
+    max_selections INTEGER DEFAULT 0,
+    tags JSONB,
+    points INTEGER,
+    time_limit INTEGER,
+    explanation TEXT,
+    restored_from INTEGER,
+    edited_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_question_revisions_revision ON question_revisions(question_id, revision);
+
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE exam_questions ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE attempt_questions ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1;
+
+-- Existing questions start at revision 1
+INSERT INTO question_revisions (question_id, revision, title, content, content_format, type, difficulty, options, match_choices, blanks, numeric_key, rubric, attachments, selection_mode, min_selections, max_selections, tags, points, time_limit, explanation, edited_by, created_at)
+SELECT id, 1, title, content, content_format, type, difficulty, options, match_choices, blanks, numeric_key, rubric, attachments, selection_mode, min_selections, max_selections, tags, points, time_limit, explanation, created_by, updated_at
+FROM questions
+ON CONFLICT (question_id, revision) DO NOTHING;
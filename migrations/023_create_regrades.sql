@@ -0,0 +1,36 @@
+-- Audit trail of result regrades after answer key corrections
+CREATE TABLE IF NOT EXISTS regrades (
+    id SERIAL PRIMARY KEY,
+    exam_id INTEGER REFERENCES exams(id) ON DELETE SET NULL,
+    question_id INTEGER REFERENCES questions(id) ON DELETE SET NULL,
+    mode VARCHAR(20) NOT NULL CHECK (mode IN ('current_key', 'accept_options', 'drop_question')),
+    accept_options JSONB,
+    reason TEXT,
+    results_regraded INTEGER NOT NULL DEFAULT 0,
+    results_changed INTEGER NOT NULL DEFAULT 0,
+    pass_changes INTEGER NOT NULL DEFAULT 0,
+    regraded_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Before and after values of every result a regrade changed
+CREATE TABLE IF NOT EXISTS result_changes (
+    id SERIAL PRIMARY KEY,
+    regrade_id INTEGER NOT NULL REFERENCES regrades(id) ON DELETE CASCADE,
+    result_id INTEGER NOT NULL REFERENCES results(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id),
+    exam_id INTEGER REFERENCES exams(id),
+    score_before DECIMAL(5,2),
+    score_after DECIMAL(5,2),
+    points_before DECIMAL(10,2),
+    points_after DECIMAL(10,2),
+    passed_before BOOLEAN,
+    passed_after BOOLEAN,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_regrades_exam_id ON regrades(exam_id);
+CREATE INDEX IF NOT EXISTS idx_regrades_question_id ON regrades(question_id);
+CREATE INDEX IF NOT EXISTS idx_result_changes_regrade_id ON result_changes(regrade_id);
+CREATE INDEX IF NOT EXISTS idx_result_changes_result_id ON result_changes(result_id);
+CREATE INDEX IF NOT EXISTS idx_result_changes_exam_id ON result_changes(exam_id);
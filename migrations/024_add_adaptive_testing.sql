@@ -0,0 +1,12 @@
+-- Item response theory parameters calibrated from graded answers
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt JSONB;
+
+-- Adaptive exams pick each next question by the candidate's estimated ability
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS adaptive_mode BOOLEAN DEFAULT false;
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS adaptive_max_items INTEGER DEFAULT 0 CHECK (adaptive_max_items >= 0);
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS adaptive_target_se DECIMAL(6,3) DEFAULT 0 CHECK (adaptive_target_se >= 0);
+ALTER TABLE exam_attempts ADD COLUMN IF NOT EXISTS adaptive_mode BOOLEAN DEFAULT false;
+
+-- Results of adaptive exams record the candidate's ability estimate
+ALTER TABLE results ADD COLUMN IF NOT EXISTS ability DECIMAL(6,3);
+ALTER TABLE results ADD COLUMN IF NOT EXISTS ability_se DECIMAL(6,3);
@@ -0,0 +1,32 @@
+-- Which media each question revision shows; media a revision links to isn't
+-- cleaned up, so results keep showing the files of the revision that was answered.
+-- Links are dropped once no exam, attempt or result uses the revision.
+CREATE TABLE IF NOT EXISTS revision_media (
+    revision_id INTEGER NOT NULL REFERENCES question_revisions(id) ON DELETE CASCADE,
+    media_id INTEGER NOT NULL REFERENCES media(id),
+    PRIMARY KEY (revision_id, media_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_revision_media_media_id ON revision_media(media_id);
+
+-- Link the revisions stored so far; attachments sit on the question and on its
+-- options and match choices
+INSERT INTO revision_media (revision_id, media_id)
+SELECT DISTINCT linked.revision_id, media.id
+FROM (
+    SELECT r.id AS revision_id, (a->>'media_id')::INTEGER AS media_id
+    FROM question_revisions r,
+        jsonb_array_elements(CASE WHEN jsonb_typeof(r.attachments) = 'array' THEN r.attachments ELSE '[]'::jsonb END) a
+    UNION
+    SELECT r.id, (o->'attachment'->>'media_id')::INTEGER
+    FROM question_revisions r,
+        jsonb_array_elements(CASE WHEN jsonb_typeof(r.options) = 'array' THEN r.options ELSE '[]'::jsonb END) o
+    WHERE o->'attachment' IS NOT NULL AND jsonb_typeof(o->'attachment') = 'object'
+    UNION
+    SELECT r.id, (o->'attachment'->>'media_id')::INTEGER
+    FROM question_revisions r,
+        jsonb_array_elements(CASE WHEN jsonb_typeof(r.match_choices) = 'array' THEN r.match_choices ELSE '[]'::jsonb END) o
+    WHERE o->'attachment' IS NOT NULL AND jsonb_typeof(o->'attachment') = 'object'
+) linked
+JOIN media ON media.id = linked.media_id
+ON CONFLICT (revision_id, media_id) DO NOTHING;
@@ -0,0 +1,13 @@
+-- The sections an attempt was taken in, in order; edits made once no attempts are
+-- running replace an exam's sections, and the attempt's question order depends on them
+ALTER TABLE exam_attempts ADD COLUMN IF NOT EXISTS section_ids JSONB;
+
+-- Attempts so far took the exam's current sections
+UPDATE exam_attempts
+SET section_ids = (
+    SELECT jsonb_agg(s.id ORDER BY s."order", s.id)
+    FROM exam_sections s
+    WHERE s.exam_id = exam_attempts.exam_id
+)
+WHERE section_ids IS NULL
+    AND EXISTS (SELECT 1 FROM exam_sections s WHERE s.exam_id = exam_attempts.exam_id);
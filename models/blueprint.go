@@ -0,0 +1,99 @@
+package models
+
+import (
+	"time"
+)
+
+// ExamBlueprintSection describes one slice of a blueprint exam: QuestionCount
+// questions drawn from the bank that carry all of Tags and match Difficulty (if
+// set), each worth Points. Every candidate gets their own draw when they start.
+type ExamBlueprintSection struct {
+	ID            uint               `json:"id" gorm:"primaryKey"`
+	ExamID        uint               `json:"exam_id" gorm:"not null;index"`
+	Name          string             `json:"name"`
+	Order         int                `json:"order" gorm:"not null"`
+	QuestionCount int                `json:"question_count" gorm:"not null"`
+	Tags          StringArray        `json:"tags" gorm:"type:jsonb"`
+	Difficulty    QuestionDifficulty `json:"difficulty"`              // empty means any difficulty
+	Points        int                `json:"points" gorm:"default:1"` // per question
+	ExamSectionID *uint              `json:"exam_section_id"`         // timed section the drawn questions belong to
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+}
+
+// Matches reports whether a question from the bank is eligible for the section
+func (s *ExamBlueprintSection) Matches(question *Question) bool {
+	if !question.IsActive {
+		return false
+	}
+
+	if s.Difficulty != "" && question.Difficulty != s.Difficulty {
+		return false
+	}
+
+	questionTags := make(map[string]bool)
+	for _, tag := range question.Tags {
+		questionTags[tag] = true
+	}
+	for _, tag := range s.Tags {
+		if !questionTags[tag] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type ExamBlueprintSectionResponse struct {
+	ID            uint               `json:"id"`
+	Name          string             `json:"name"`
+	Order         int                `json:"order"`
+	QuestionCount int                `json:"question_count"`
+	Tags          []string           `json:"tags"`
+	Difficulty    QuestionDifficulty `json:"difficulty,omitempty"`
+	Points        int                `json:"points"`
+	ExamSectionID *uint              `json:"exam_section_id,omitempty"`
+}
+
+func (s *ExamBlueprintSection) ToResponse() ExamBlueprintSectionResponse {
+	return ExamBlueprintSectionResponse{
+		ID:            s.ID,
+		Name:          s.Name,
+		Order:         s.Order,
+		QuestionCount: s.QuestionCount,
+		Tags:          []string(s.Tags),
+		Difficulty:    s.Difficulty,
+		Points:        s.Points,
+		ExamSectionID: s.ExamSectionID,
+	}
+}
+
+// AttemptQuestion is a question drawn for one attempt of a blueprint exam. The
+// draw is stored so resume, grading and review all see the same questions.
+type AttemptQuestion struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	ExamAttemptID uint      `json:"exam_attempt_id" gorm:"not null;index"`
+	SectionID     *uint     `json:"section_id"` // blueprint section the question was drawn for
+	ExamSectionID *uint     `json:"exam_section_id"`
+	QuestionID    uint      `json:"question_id" gorm:"not null"`
+	Revision      int       `json:"revision" gorm:"not null;default:1"` // revision of the question when it was drawn
+	Order         int       `json:"order" gorm:"not null"`
+	Points        int       `json:"points" gorm:"default:1"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// Relationships
+	Question Question `json:"question,omitempty" gorm:"foreignKey:QuestionID"`
+}
+
+// ToExamQuestion adapts the drawn question so it can be graded like a fixed exam question
+func (aq *AttemptQuestion) ToExamQuestion(examID uint) ExamQuestion {
+	return ExamQuestion{
+		ExamID:     examID,
+		QuestionID: aq.QuestionID,
+		Revision:   aq.Revision,
+		SectionID:  aq.ExamSectionID,
+		Order:      aq.Order,
+		Points:     aq.Points,
+		Question:   aq.Question,
+	}
+}
@@ -0,0 +1,35 @@
+package models
+
+import "exam-system/utils"
+
+// ContentFormat is the markup a question's content, option texts and explanation
+// are written in. Whatever the format, LaTeX math between $...$, $$...$$, \(...\)
+// or \[...\] is passed through for the client to typeset.
+type ContentFormat string
+
+const (
+	FormatPlain    ContentFormat = "plain"
+	FormatMarkdown ContentFormat = "markdown"
+	FormatHTML     ContentFormat = "html" // sanitized when the question is saved and again when rendered
+)
+
+// IsValid reports whether f is a known content format; empty means plain
+func (f ContentFormat) IsValid() bool {
+	switch f {
+	case "", FormatPlain, FormatMarkdown, FormatHTML:
+		return true
+	}
+	return false
+}
+
+// Render turns source written in the format into HTML that is safe to show
+// candidates
+func (f ContentFormat) Render(source string) string {
+	switch f {
+	case FormatMarkdown:
+		return utils.RenderMarkdown(source)
+	case FormatHTML:
+		return utils.SanitizeHTML(source)
+	}
+	return utils.RenderPlainText(source)
+}
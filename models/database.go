@@ -47,10 +47,22 @@ func RunMigrations(db *gorm.DB) error {
 	err := db.AutoMigrate(
 		&User{},
 		&Question{},
+		&QuestionRevision{},
 		&Exam{},
+		&ExamSection{},
 		&ExamQuestion{},
+		&ExamBlueprintSection{},
 		&UserExam{},
+		&ExamAttempt{},
+		&AttemptQuestion{},
+		&SavedAnswer{},
+		&QuestionTiming{},
 		&Result{},
+		&Media{},
+		&QuestionMedia{},
+		&RevisionMedia{},
+		&Regrade{},
+		&ResultChange{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
@@ -104,4 +116,3 @@ func addIndexes(db *gorm.DB) error {
 
 	return nil
 }
-
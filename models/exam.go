@@ -6,41 +6,137 @@ import (
 	"gorm.io/gorm"
 )
 
+// ExamStatus is the lifecycle state of an exam:
+// draft -> scheduled -> active -> closed -> archived
 type ExamStatus string
 
 const (
-	ExamDraft     ExamStatus = "draft"
-	ExamActive    ExamStatus = "active"
-	ExamCompleted ExamStatus = "completed"
-	ExamArchived  ExamStatus = "archived"
+	ExamDraft     ExamStatus = "draft"     // being authored, invisible to candidates
+	ExamScheduled ExamStatus = "scheduled" // published, opens at StartTime
+	ExamActive    ExamStatus = "active"    // open for attempts within its window
+	ExamClosed    ExamStatus = "closed"    // window over, in-progress attempts were auto-submitted
+	ExamArchived  ExamStatus = "archived"  // kept for its results only
 )
 
+// examTransitions lists the states each state may move to
+var examTransitions = map[ExamStatus][]ExamStatus{
+	ExamDraft:     {ExamScheduled, ExamActive, ExamArchived},
+	ExamScheduled: {ExamDraft, ExamActive, ExamClosed},
+	ExamActive:    {ExamClosed},
+	ExamClosed:    {ExamArchived},
+	ExamArchived:  {},
+}
+
+// IsValid reports whether the status is one of the lifecycle states
+func (s ExamStatus) IsValid() bool {
+	_, ok := examTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether the lifecycle allows moving from s to next
+func (s ExamStatus) CanTransitionTo(next ExamStatus) bool {
+	for _, allowed := range examTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ScoringPolicy controls how points are awarded for each graded answer
+type ScoringPolicy string
+
+const (
+	ScoringAllOrNothing    ScoringPolicy = "all_or_nothing"   // full points only for an exact answer
+	ScoringPartialCredit   ScoringPolicy = "partial_credit"   // multi-answer questions earn a share per correct option, nothing if a wrong one is picked; cloze questions a share per correct blank
+	ScoringWrongPenalty    ScoringPolicy = "wrong_penalty"    // multi-answer questions: each wrong option cancels out a correct one
+	ScoringNegativeMarking ScoringPolicy = "negative_marking" // wrong answers lose NegativeMarkRatio of their points, exam total floored at zero
+)
+
+// IsValid reports whether the policy is one of the supported scoring policies
+func (p ScoringPolicy) IsValid() bool {
+	switch p {
+	case ScoringAllOrNothing, ScoringPartialCredit, ScoringWrongPenalty, ScoringNegativeMarking:
+		return true
+	}
+	return false
+}
+
+// LatePolicy controls what happens to a submission that arrives after the
+// attempt's time limit (plus the configured grace period) has run out
+type LatePolicy string
+
+const (
+	LateReject   LatePolicy = "reject"   // refuse the submission; the timer worker grades the attempt instead
+	LateTruncate LatePolicy = "truncate" // accept the answers but cut the attempt off at the deadline and flag it late
+)
+
+// IsValid reports whether the policy is one of the supported late policies
+func (p LatePolicy) IsValid() bool {
+	return p == LateReject || p == LateTruncate
+}
+
+// KeepScorePolicy decides which attempt's score counts when an exam allows retakes
+type KeepScorePolicy string
+
+const (
+	KeepBestScore    KeepScorePolicy = "best"    // highest score across all completed attempts
+	KeepLastScore    KeepScorePolicy = "last"    // score of the most recent completed attempt
+	KeepAverageScore KeepScorePolicy = "average" // mean score of all completed attempts
+)
+
+// IsValid reports whether the policy is one of the supported keep-score policies
+func (p KeepScorePolicy) IsValid() bool {
+	return p == KeepBestScore || p == KeepLastScore || p == KeepAverageScore
+}
+
 type Exam struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	Title       string         `json:"title" gorm:"not null"`
-	Description string         `json:"description" gorm:"type:text"`
-	Duration    int            `json:"duration" gorm:"not null"` // in minutes
-	TotalPoints int            `json:"total_points" gorm:"default:0"`
-	PassScore   int            `json:"pass_score" gorm:"default:60"` // percentage
-	Status      ExamStatus     `json:"status" gorm:"default:'draft'"`
-	StartTime   *time.Time     `json:"start_time"`
-	EndTime     *time.Time     `json:"end_time"`
-	IsActive    bool           `json:"is_active" gorm:"default:true"`
-	CreatedBy   uint           `json:"created_by"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                uint            `json:"id" gorm:"primaryKey"`
+	Title             string          `json:"title" gorm:"not null"`
+	Description       string          `json:"description" gorm:"type:text"`
+	Duration          int             `json:"duration" gorm:"not null"` // in minutes
+	TotalPoints       int             `json:"total_points" gorm:"default:0"`
+	PassScore         int             `json:"pass_score" gorm:"default:60"` // percentage
+	Status            ExamStatus      `json:"status" gorm:"default:'draft'"`
+	ScoringPolicy     ScoringPolicy   `json:"scoring_policy" gorm:"default:'all_or_nothing'"`
+	NegativeMarkRatio float64         `json:"negative_mark_ratio" gorm:"default:0"` // share of a question's points lost for a wrong answer
+	LatePolicy        LatePolicy      `json:"late_policy" gorm:"default:'reject'"`
+	RetakeCooldown    int             `json:"retake_cooldown" gorm:"default:0"` // minutes a candidate must wait between attempts
+	KeepScore         KeepScorePolicy `json:"keep_score" gorm:"default:'best'"`
+	ShuffleQuestions  bool            `json:"shuffle_questions" gorm:"default:false"`
+	ShuffleOptions    bool            `json:"shuffle_options" gorm:"default:false"`
+	LinearMode        bool            `json:"linear_mode" gorm:"default:false"`    // serve one question at a time and time each answer on the server
+	AdaptiveMode      bool            `json:"adaptive_mode" gorm:"default:false"`  // computerized adaptive test: questions are picked one at a time by the candidate's estimated ability
+	AdaptiveMaxItems  int             `json:"adaptive_max_items" gorm:"default:0"` // stop after this many questions, 0 means the whole pool
+	AdaptiveTargetSE  float64         `json:"adaptive_target_se" gorm:"default:0"` // stop once the ability's standard error is this small, 0 means never
+	StartTime         *time.Time      `json:"start_time"`
+	EndTime           *time.Time      `json:"end_time"`
+	IsActive          bool            `json:"is_active" gorm:"default:true"`
+	CreatedBy         uint            `json:"created_by"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt  `json:"-" gorm:"index"`
 
 	// Relationships - Note: Removed Results to break circular dependency
-	Creator       User           `json:"creator,omitempty" gorm:"foreignKey:CreatedBy"`
-	ExamQuestions []ExamQuestion `json:"exam_questions,omitempty" gorm:"foreignKey:ExamID"`
-	UserExams     []UserExam     `json:"user_exams,omitempty" gorm:"foreignKey:ExamID"`
+	Creator           User                   `json:"creator,omitempty" gorm:"foreignKey:CreatedBy"`
+	Sections          []ExamSection          `json:"sections,omitempty" gorm:"foreignKey:ExamID"`
+	ExamQuestions     []ExamQuestion         `json:"exam_questions,omitempty" gorm:"foreignKey:ExamID"`
+	BlueprintSections []ExamBlueprintSection `json:"blueprint_sections,omitempty" gorm:"foreignKey:ExamID"`
+	UserExams         []UserExam             `json:"user_exams,omitempty" gorm:"foreignKey:ExamID"`
+}
+
+// UsesBlueprint reports whether candidates get their own draw from the question bank.
+// BlueprintSections must be loaded.
+func (e *Exam) UsesBlueprint() bool {
+	return len(e.BlueprintSections) > 0
 }
 
 type ExamQuestion struct {
 	ID         uint      `json:"id" gorm:"primaryKey"`
 	ExamID     uint      `json:"exam_id" gorm:"not null"`
 	QuestionID uint      `json:"question_id" gorm:"not null"`
+	Revision   int       `json:"revision" gorm:"not null;default:1"` // revision of the question the exam uses
+	SectionID  *uint     `json:"section_id" gorm:"index"`
 	Order      int       `json:"order" gorm:"not null"`
 	Points     int       `json:"points" gorm:"default:1"`
 	CreatedAt  time.Time `json:"created_at"`
@@ -60,17 +156,23 @@ const (
 )
 
 type UserExam struct {
-	ID           uint           `json:"id" gorm:"primaryKey"`
-	UserID       uint           `json:"user_id" gorm:"not null"`
-	ExamID       uint           `json:"exam_id" gorm:"not null"`
-	Status       UserExamStatus `json:"status" gorm:"default:'assigned'"`
-	StartedAt    *time.Time     `json:"started_at"`
-	CompletedAt  *time.Time     `json:"completed_at"`
-	ExpiresAt    *time.Time     `json:"expires_at"`
-	AttemptCount int            `json:"attempt_count" gorm:"default:0"`
-	MaxAttempts  int            `json:"max_attempts" gorm:"default:1"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	UserID           uint           `json:"user_id" gorm:"not null"`
+	ExamID           uint           `json:"exam_id" gorm:"not null"`
+	Status           UserExamStatus `json:"status" gorm:"default:'assigned'"`
+	StartedAt        *time.Time     `json:"started_at"`
+	CompletedAt      *time.Time     `json:"completed_at"`
+	ExpiresAt        *time.Time     `json:"expires_at"`
+	AttemptCount     int            `json:"attempt_count" gorm:"default:0"`
+	MaxAttempts      int            `json:"max_attempts" gorm:"default:1"`
+	CurrentAttemptID *uint          `json:"current_attempt_id"`               // latest ExamAttempt; Status and StartedAt mirror it
+	TimeMultiplier   float64        `json:"time_multiplier" gorm:"default:1"` // accommodation: scales every timer of the exam
+	ExtraMinutes     int            `json:"extra_minutes" gorm:"default:0"`   // accommodation: added to the exam duration
+	WindowStart      *time.Time     `json:"window_start"`                     // accommodation: replaces the exam's start time
+	WindowEnd        *time.Time     `json:"window_end"`                       // accommodation: replaces the exam's end time
+	GrantedMinutes   int            `json:"granted_minutes" gorm:"default:0"` // extra time granted to the running attempt
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
 
 	// Relationships - Note: Removed Result relationship to break circular dependency
 	// Results can be loaded separately using UserExamID foreign key
@@ -78,22 +180,124 @@ type UserExam struct {
 	Exam Exam `json:"exam,omitempty" gorm:"foreignKey:ExamID"`
 }
 
+type ExamAttemptStatus string
+
+const (
+	AttemptStarted   ExamAttemptStatus = "started"
+	AttemptCompleted ExamAttemptStatus = "completed"
+)
+
+// ExamAttempt is one sitting of an assigned exam. A UserExam keeps one row per
+// attempt so retakes don't overwrite earlier history; each completed attempt is
+// linked from its Result.
+type ExamAttempt struct {
+	ID               uint              `json:"id" gorm:"primaryKey"`
+	UserExamID       uint              `json:"user_exam_id" gorm:"not null;uniqueIndex:idx_exam_attempts_user_exam_number"`
+	UserID           uint              `json:"user_id" gorm:"not null;index"`
+	ExamID           uint              `json:"exam_id" gorm:"not null;index"`
+	AttemptNumber    int               `json:"attempt_number" gorm:"not null;uniqueIndex:idx_exam_attempts_user_exam_number"`
+	Status           ExamAttemptStatus `json:"status" gorm:"default:'started'"`
+	Seed             int64             `json:"seed" gorm:"not null;default:0"`         // fixes the question and option order the candidate sees
+	ShuffleQuestions bool              `json:"shuffle_questions" gorm:"default:false"` // exam settings copied at start so later edits don't change the permutation
+	ShuffleOptions   bool              `json:"shuffle_options" gorm:"default:false"`
+	LinearMode       bool              `json:"linear_mode" gorm:"default:false"`
+	AdaptiveMode     bool              `json:"adaptive_mode" gorm:"default:false"`      // questions are picked as the attempt goes and recorded as AttemptQuestions
+	SectionIDs       SectionIDs        `json:"section_ids,omitempty" gorm:"type:jsonb"` // the exam's sections when the attempt started, as edits afterwards replace them
+	SectionIndex     int               `json:"section_index" gorm:"default:0"`          // position of the open section in a sectioned exam
+	SectionStartedAt *time.Time        `json:"section_started_at"`
+	GrantedMinutes   int               `json:"granted_minutes" gorm:"default:0"` // extra time granted while the attempt was running
+	StartedAt        time.Time         `json:"started_at" gorm:"not null"`
+	CompletedAt      *time.Time        `json:"completed_at"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+}
+
+type ExamAttemptResponse struct {
+	ID            uint              `json:"id"`
+	AttemptNumber int               `json:"attempt_number"`
+	Status        ExamAttemptStatus `json:"status"`
+	StartedAt     time.Time         `json:"started_at"`
+	CompletedAt   *time.Time        `json:"completed_at"`
+	Result        *ResultResponse   `json:"result,omitempty"`
+}
+
+// ToResponse converts the attempt, attaching its result summary when it has one
+func (a *ExamAttempt) ToResponse(result *Result) ExamAttemptResponse {
+	response := ExamAttemptResponse{
+		ID:            a.ID,
+		AttemptNumber: a.AttemptNumber,
+		Status:        a.Status,
+		StartedAt:     a.StartedAt,
+		CompletedAt:   a.CompletedAt,
+	}
+
+	if result != nil {
+		resultResp := result.ToResponse(false, false)
+		response.Result = &resultResp
+	}
+
+	return response
+}
+
+// SavedAnswer is an answer autosaved while an attempt is in progress. It is the
+// durable copy of the Redis autosave cache and is merged into the final submission.
+type SavedAnswer struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	UserExamID      uint           `json:"user_exam_id" gorm:"not null;uniqueIndex:idx_saved_answers_user_exam_question"`
+	QuestionID      uint           `json:"question_id" gorm:"not null;uniqueIndex:idx_saved_answers_user_exam_question"`
+	SelectedOptions StringArray    `json:"selected_options" gorm:"type:jsonb"`
+	TextAnswers     StringArray    `json:"text_answers,omitempty" gorm:"type:jsonb"`
+	NumericAnswer   *NumericAnswer `json:"numeric_answer,omitempty" gorm:"type:jsonb"`
+	Matches         StringMap      `json:"matches,omitempty" gorm:"type:jsonb"`
+	Essay           string         `json:"essay,omitempty" gorm:"type:text"`
+	TimeSpent       int            `json:"time_spent"` // in seconds
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+// QuestionTiming records when the server served a question of a linear attempt
+// and when its answer came back, so time spent is measured rather than reported
+// by the client.
+type QuestionTiming struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	ExamAttemptID uint       `json:"exam_attempt_id" gorm:"not null;uniqueIndex:idx_question_timings_attempt_question"`
+	QuestionID    uint       `json:"question_id" gorm:"not null;uniqueIndex:idx_question_timings_attempt_question"`
+	ServedAt      time.Time  `json:"served_at" gorm:"not null"`
+	AnsweredAt    *time.Time `json:"answered_at"`
+	TimedOut      bool       `json:"timed_out" gorm:"default:false"` // closed unanswered when its time limit ran out
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
 type ExamResponse struct {
-	ID          uint               `json:"id"`
-	Title       string             `json:"title"`
-	Description string             `json:"description"`
-	Duration    int                `json:"duration"`
-	TotalPoints int                `json:"total_points"`
-	PassScore   int                `json:"pass_score"`
-	Status      ExamStatus         `json:"status"`
-	StartTime   *time.Time         `json:"start_time"`
-	EndTime     *time.Time         `json:"end_time"`
-	IsActive    bool               `json:"is_active"`
-	CreatedBy   uint               `json:"created_by"`
-	CreatedAt   time.Time          `json:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at"`
-	Questions   []QuestionResponse `json:"questions,omitempty"`
-	UserExam    *UserExamResponse  `json:"user_exam,omitempty"`
+	ID                uint                           `json:"id"`
+	Title             string                         `json:"title"`
+	Description       string                         `json:"description"`
+	Duration          int                            `json:"duration"`
+	TotalPoints       int                            `json:"total_points"`
+	PassScore         int                            `json:"pass_score"`
+	Status            ExamStatus                     `json:"status"`
+	ScoringPolicy     ScoringPolicy                  `json:"scoring_policy"`
+	NegativeMarkRatio float64                        `json:"negative_mark_ratio"`
+	LatePolicy        LatePolicy                     `json:"late_policy"`
+	RetakeCooldown    int                            `json:"retake_cooldown"`
+	KeepScore         KeepScorePolicy                `json:"keep_score"`
+	ShuffleQuestions  bool                           `json:"shuffle_questions"`
+	ShuffleOptions    bool                           `json:"shuffle_options"`
+	LinearMode        bool                           `json:"linear_mode"`
+	AdaptiveMode      bool                           `json:"adaptive_mode"`
+	AdaptiveMaxItems  int                            `json:"adaptive_max_items,omitempty"`
+	AdaptiveTargetSE  float64                        `json:"adaptive_target_se,omitempty"`
+	StartTime         *time.Time                     `json:"start_time"`
+	EndTime           *time.Time                     `json:"end_time"`
+	IsActive          bool                           `json:"is_active"`
+	CreatedBy         uint                           `json:"created_by"`
+	CreatedAt         time.Time                      `json:"created_at"`
+	UpdatedAt         time.Time                      `json:"updated_at"`
+	Questions         []QuestionResponse             `json:"questions,omitempty"`
+	Blueprint         []ExamBlueprintSectionResponse `json:"blueprint,omitempty"`
+	Sections          []ExamSectionResponse          `json:"sections,omitempty"`
+	UserExam          *UserExamResponse              `json:"user_exam,omitempty"`
 }
 
 type UserExamResponse struct {
@@ -105,23 +309,41 @@ type UserExamResponse struct {
 	AttemptCount int            `json:"attempt_count"`
 	MaxAttempts  int            `json:"max_attempts"`
 	TimeLeft     *int           `json:"time_left,omitempty"` // in seconds
+
+	// Accommodations
+	TimeMultiplier float64    `json:"time_multiplier,omitempty"`
+	ExtraMinutes   int        `json:"extra_minutes,omitempty"`
+	WindowStart    *time.Time `json:"window_start,omitempty"`
+	WindowEnd      *time.Time `json:"window_end,omitempty"`
+	GrantedMinutes int        `json:"granted_minutes,omitempty"`
 }
 
 func (e *Exam) ToResponse(includeQuestions bool, userExam *UserExam) ExamResponse {
 	response := ExamResponse{
-		ID:          e.ID,
-		Title:       e.Title,
-		Description: e.Description,
-		Duration:    e.Duration,
-		TotalPoints: e.TotalPoints,
-		PassScore:   e.PassScore,
-		Status:      e.Status,
-		StartTime:   e.StartTime,
-		EndTime:     e.EndTime,
-		IsActive:    e.IsActive,
-		CreatedBy:   e.CreatedBy,
-		CreatedAt:   e.CreatedAt,
-		UpdatedAt:   e.UpdatedAt,
+		ID:                e.ID,
+		Title:             e.Title,
+		Description:       e.Description,
+		Duration:          e.Duration,
+		TotalPoints:       e.TotalPoints,
+		PassScore:         e.PassScore,
+		Status:            e.Status,
+		ScoringPolicy:     e.ScoringPolicy,
+		NegativeMarkRatio: e.NegativeMarkRatio,
+		LatePolicy:        e.LatePolicy,
+		RetakeCooldown:    e.RetakeCooldown,
+		KeepScore:         e.KeepScore,
+		ShuffleQuestions:  e.ShuffleQuestions,
+		ShuffleOptions:    e.ShuffleOptions,
+		LinearMode:        e.LinearMode,
+		AdaptiveMode:      e.AdaptiveMode,
+		AdaptiveMaxItems:  e.AdaptiveMaxItems,
+		AdaptiveTargetSE:  e.AdaptiveTargetSE,
+		StartTime:         e.StartTime,
+		EndTime:           e.EndTime,
+		IsActive:          e.IsActive,
+		CreatedBy:         e.CreatedBy,
+		CreatedAt:         e.CreatedAt,
+		UpdatedAt:         e.UpdatedAt,
 	}
 
 	if includeQuestions {
@@ -132,34 +354,113 @@ func (e *Exam) ToResponse(includeQuestions bool, userExam *UserExam) ExamRespons
 		response.Questions = questions
 	}
 
-	if userExam != nil {
-		userExamResp := &UserExamResponse{
-			ID:           userExam.ID,
-			Status:       userExam.Status,
-			StartedAt:    userExam.StartedAt,
-			CompletedAt:  userExam.CompletedAt,
-			ExpiresAt:    userExam.ExpiresAt,
-			AttemptCount: userExam.AttemptCount,
-			MaxAttempts:  userExam.MaxAttempts,
+	if len(e.Sections) > 0 {
+		sections := make([]ExamSectionResponse, len(e.Sections))
+		for i, section := range e.Sections {
+			sections[i] = section.ToResponse()
+		}
+		response.Sections = sections
+	}
+
+	if len(e.BlueprintSections) > 0 {
+		sections := make([]ExamBlueprintSectionResponse, len(e.BlueprintSections))
+		for i, section := range e.BlueprintSections {
+			sections[i] = section.ToResponse()
 		}
+		response.Blueprint = sections
+	}
 
-		// Calculate time left if exam is started
-		if userExam.StartedAt != nil && userExam.Status == UserExamStarted {
-			examDuration := time.Duration(e.Duration) * time.Minute
-			elapsed := time.Since(*userExam.StartedAt)
-			timeLeft := int((examDuration - elapsed).Seconds())
+	if userExam != nil {
+		response.UserExam = userExam.ToResponse(e)
+	}
+
+	return response
+}
+
+// ToResponse converts the assignment, with the time left if an attempt is running
+func (ue *UserExam) ToResponse(exam *Exam) *UserExamResponse {
+	response := &UserExamResponse{
+		ID:             ue.ID,
+		Status:         ue.Status,
+		StartedAt:      ue.StartedAt,
+		CompletedAt:    ue.CompletedAt,
+		ExpiresAt:      ue.ExpiresAt,
+		AttemptCount:   ue.AttemptCount,
+		MaxAttempts:    ue.MaxAttempts,
+		ExtraMinutes:   ue.ExtraMinutes,
+		WindowStart:    ue.WindowStart,
+		WindowEnd:      ue.WindowEnd,
+		GrantedMinutes: ue.GrantedMinutes,
+	}
+	if ue.TimeMultiplier > 0 && ue.TimeMultiplier != 1 {
+		response.TimeMultiplier = ue.TimeMultiplier
+	}
+
+	if ue.Status == UserExamStarted {
+		if deadline := ue.Deadline(exam); deadline != nil {
+			timeLeft := int(time.Until(*deadline).Seconds())
 			if timeLeft < 0 {
 				timeLeft = 0
 			}
-			userExamResp.TimeLeft = &timeLeft
+			response.TimeLeft = &timeLeft
 		}
-
-		response.UserExam = userExamResp
 	}
 
 	return response
 }
 
+// ScaleDuration stretches a timer by an accommodation multiplier; anything below
+// or equal to zero counts as no multiplier
+func ScaleDuration(d time.Duration, multiplier float64) time.Duration {
+	if multiplier <= 0 || multiplier == 1 {
+		return d
+	}
+	return time.Duration(float64(d) * multiplier)
+}
+
+// Scale applies the candidate's time multiplier to a timer
+func (ue *UserExam) Scale(d time.Duration) time.Duration {
+	return ScaleDuration(d, ue.TimeMultiplier)
+}
+
+// AttemptDuration is how long the candidate's attempt may run, with the time
+// multiplier, extra minutes and any time granted during the attempt
+func (ue *UserExam) AttemptDuration(exam *Exam) time.Duration {
+	return ue.Scale(time.Duration(exam.Duration)*time.Minute) +
+		time.Duration(ue.ExtraMinutes+ue.GrantedMinutes)*time.Minute
+}
+
+// Window returns the candidate's sitting window: their own if they have one,
+// otherwise the exam's
+func (ue *UserExam) Window(exam *Exam) (*time.Time, *time.Time) {
+	start, end := exam.StartTime, exam.EndTime
+	if ue.WindowStart != nil {
+		start = ue.WindowStart
+	}
+	if ue.WindowEnd != nil {
+		end = ue.WindowEnd
+	}
+	return start, end
+}
+
+// Deadline returns when the current attempt runs out of time, or nil if it hasn't started
+func (ue *UserExam) Deadline(exam *Exam) *time.Time {
+	if ue.StartedAt == nil {
+		return nil
+	}
+	deadline := ue.StartedAt.Add(ue.AttemptDuration(exam))
+
+	// No attempt runs past the end of the candidate's window, except for time an
+	// admin granted while it was running
+	if _, end := ue.Window(exam); end != nil {
+		windowEnd := end.Add(time.Duration(ue.GrantedMinutes) * time.Minute)
+		if windowEnd.Before(deadline) {
+			deadline = windowEnd
+		}
+	}
+	return &deadline
+}
+
 func (ue *UserExam) IsExpired() bool {
 	if ue.ExpiresAt == nil {
 		return false
@@ -167,8 +468,30 @@ func (ue *UserExam) IsExpired() bool {
 	return time.Now().After(*ue.ExpiresAt)
 }
 
+// HasAttemptsLeft reports whether the assignment allows another attempt
+func (ue *UserExam) HasAttemptsLeft() bool {
+	maxAttempts := ue.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return ue.AttemptCount < maxAttempts
+}
+
+// NextAttemptAt returns when a retake becomes available under the exam's cool-down,
+// or nil if there's nothing to wait for
+func (ue *UserExam) NextAttemptAt(exam *Exam) *time.Time {
+	if ue.Status != UserExamCompleted || ue.CompletedAt == nil || exam.RetakeCooldown <= 0 {
+		return nil
+	}
+	next := ue.CompletedAt.Add(time.Duration(exam.RetakeCooldown) * time.Minute)
+	return &next
+}
+
 func (ue *UserExam) CanStart() bool {
-	return ue.Status == UserExamAssigned && !ue.IsExpired()
+	if ue.IsExpired() || !ue.HasAttemptsLeft() {
+		return false
+	}
+	return ue.Status == UserExamAssigned || ue.Status == UserExamCompleted
 }
 
 func (ue *UserExam) CanSubmit() bool {
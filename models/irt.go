@@ -0,0 +1,81 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IRTModel is the item response theory model a question was calibrated under.
+// Both are logistic models without the 1.7 scaling constant: a candidate of
+// ability theta answers correctly with probability 1/(1+exp(-a(theta-b))).
+type IRTModel string
+
+const (
+	IRT1PL IRTModel = "1pl" // difficulty only, every item discriminates with a = 1
+	IRT2PL IRTModel = "2pl" // difficulty and discrimination
+)
+
+// IsValid reports whether m is one of the supported models
+func (m IRTModel) IsValid() bool {
+	return m == IRT1PL || m == IRT2PL
+}
+
+// ItemParameters are the item response theory parameters of a question,
+// calibrated from the answers given to one revision of it
+type ItemParameters struct {
+	Model            IRTModel  `json:"model"`
+	Discrimination   float64   `json:"discrimination"` // a
+	Difficulty       float64   `json:"difficulty"`     // b, on the ability scale
+	DiscriminationSE *float64  `json:"discrimination_se,omitempty"`
+	DifficultySE     *float64  `json:"difficulty_se,omitempty"`
+	Revision         int       `json:"revision"`  // revision whose answers were calibrated
+	Responses        int       `json:"responses"` // answers the calibration used
+	CalibratedAt     time.Time `json:"calibrated_at"`
+}
+
+func (p ItemParameters) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *ItemParameters) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, p)
+}
+
+// difficultyPriors places uncalibrated questions on the ability scale by their
+// authored difficulty
+var difficultyPriors = map[QuestionDifficulty]float64{
+	Easy:   -1,
+	Medium: 0,
+	Hard:   1,
+}
+
+// ItemParameters returns the question's calibrated parameters when they belong
+// to its current revision, otherwise 1PL parameters guessed from its difficulty
+func (q *Question) ItemParameters() ItemParameters {
+	if q.IRT != nil && q.IRT.Revision == q.Revision {
+		return *q.IRT
+	}
+	return ItemParameters{
+		Model:          IRT1PL,
+		Discrimination: 1,
+		Difficulty:     difficultyPriors[q.Difficulty],
+		Revision:       q.Revision,
+	}
+}
+
+// IsCalibrated reports whether the question has parameters calibrated for its
+// current revision
+func (q *Question) IsCalibrated() bool {
+	return q.IRT != nil && q.IRT.Revision == q.Revision
+}
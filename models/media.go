@@ -0,0 +1,113 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"exam-system/config"
+	"exam-system/utils"
+	"time"
+)
+
+type MediaKind string
+
+const (
+	MediaImage MediaKind = "image"
+	MediaAudio MediaKind = "audio"
+	MediaVideo MediaKind = "video"
+)
+
+// Media is an uploaded image, audio or video file. The file itself lives in the
+// configured storage backend under Key.
+type Media struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Key         string    `json:"-" gorm:"uniqueIndex;not null"`
+	Filename    string    `json:"filename"` // as uploaded
+	ContentType string    `json:"content_type" gorm:"not null"`
+	Kind        MediaKind `json:"kind" gorm:"not null"`
+	Size        int64     `json:"size"`     // in bytes
+	Checksum    string    `json:"checksum"` // hex SHA-256 of the file
+	UploadedBy  uint      `json:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// QuestionMedia links a question to the media its content and options show.
+// Media no live question links to is removed after a grace period.
+type QuestionMedia struct {
+	QuestionID uint `gorm:"primaryKey"`
+	MediaID    uint `gorm:"primaryKey;index"`
+}
+
+// Attachment places an uploaded file on a question or option. Kind and
+// ContentType are copied from the media when the question is saved.
+type Attachment struct {
+	MediaID     uint      `json:"media_id"`
+	Kind        MediaKind `json:"kind,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Alt         string    `json:"alt,omitempty"` // text alternative for screen readers
+}
+
+type Attachments []Attachment
+
+func (a Attachments) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+func (a *Attachments) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, a)
+}
+
+type AttachmentResponse struct {
+	MediaID     uint      `json:"media_id"`
+	Kind        MediaKind `json:"kind"`
+	ContentType string    `json:"content_type"`
+	Alt         string    `json:"alt,omitempty"`
+	URL         string    `json:"url"` // signed, works without a login until ExpiresAt
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// ToResponse describes the attachment with a download link signed until expires
+func (a Attachment) ToResponse(expires time.Time) AttachmentResponse {
+	return AttachmentResponse{
+		MediaID:     a.MediaID,
+		Kind:        a.Kind,
+		ContentType: a.ContentType,
+		Alt:         a.Alt,
+		URL:         utils.SignMediaURL(a.MediaID, expires),
+		ExpiresAt:   expires,
+	}
+}
+
+// mediaLinkExpiry is when media links handed out now stop working
+func mediaLinkExpiry() time.Time {
+	return time.Now().Add(config.AppConfig.Media.URLExpiry).Truncate(time.Second)
+}
+
+// RevisionMedia links a question revision to the media it shows, so files outlive
+// later edits while an exam, attempt or result still shows the revision.
+type RevisionMedia struct {
+	RevisionID uint `gorm:"primaryKey"`
+	MediaID    uint `gorm:"primaryKey;index"`
+}
+
+func (Media) TableName() string {
+	return "media"
+}
+
+func (QuestionMedia) TableName() string {
+	return "question_media"
+}
+
+func (RevisionMedia) TableName() string {
+	return "revision_media"
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"math/rand"
 	"time"
 
 	"gorm.io/gorm"
@@ -14,8 +15,62 @@ type QuestionType string
 const (
 	MultipleChoice QuestionType = "multiple_choice"
 	TrueFalse      QuestionType = "true_false"
+	ShortAnswer    QuestionType = "short_answer" // a single typed answer
+	Cloze          QuestionType = "cloze"        // blanks marked {{id}} in Content
+	Numeric        QuestionType = "numeric"      // a number, graded within a tolerance
+	Ordering       QuestionType = "ordering"     // Options listed in their correct order
+	Matching       QuestionType = "matching"     // each option is paired with one of MatchChoices
+	Essay          QuestionType = "essay"        // free text marked by a grader, optionally against a Rubric
 )
 
+// IsValid reports whether t is a known question type
+func (t QuestionType) IsValid() bool {
+	switch t {
+	case MultipleChoice, TrueFalse, ShortAnswer, Cloze, Numeric, Ordering, Matching, Essay:
+		return true
+	}
+	return false
+}
+
+// IsTextAnswer reports whether candidates type their answers instead of picking options
+func (t QuestionType) IsTextAnswer() bool {
+	return t == ShortAnswer || t == Cloze
+}
+
+// SelectionMode tells candidates whether to pick one option or several
+type SelectionMode string
+
+const (
+	SelectSingle   SelectionMode = "single"   // exactly one correct option, one pick allowed
+	SelectMultiple SelectionMode = "multiple" // any number of correct options, within MinSelections..MaxSelections
+)
+
+// IsValid reports whether m is a known selection mode
+func (m SelectionMode) IsValid() bool {
+	return m == SelectSingle || m == SelectMultiple
+}
+
+// MatchMode controls how a typed answer is compared with an accepted answer.
+// Every mode except regex ignores leading and trailing whitespace.
+type MatchMode string
+
+const (
+	MatchExact             MatchMode = "exact"
+	MatchWhitespace        MatchMode = "whitespace"         // runs of whitespace count as one space
+	MatchCaseInsensitive   MatchMode = "case_insensitive"   // also normalizes whitespace
+	MatchAccentInsensitive MatchMode = "accent_insensitive" // also ignores case and diacritics, e.g. "Hà Nội" = "ha noi"
+	MatchRegex             MatchMode = "regex"              // Text is a pattern the whole answer must match
+)
+
+// IsValid reports whether m is a known match mode; empty means exact
+func (m MatchMode) IsValid() bool {
+	switch m {
+	case "", MatchExact, MatchWhitespace, MatchCaseInsensitive, MatchAccentInsensitive, MatchRegex:
+		return true
+	}
+	return false
+}
+
 type QuestionDifficulty string
 
 const (
@@ -25,9 +80,11 @@ const (
 )
 
 type Option struct {
-	ID        string `json:"id"`
-	Text      string `json:"text"`
-	IsCorrect bool   `json:"is_correct"`
+	ID         string      `json:"id"`
+	Text       string      `json:"text"`
+	IsCorrect  bool        `json:"is_correct"`
+	MatchID    string      `json:"match_id,omitempty"` // matching questions: the ID of the right-hand choice this option pairs with
+	Attachment *Attachment `json:"attachment,omitempty"`
 }
 
 type Options []Option
@@ -50,6 +107,142 @@ func (o *Options) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, o)
 }
 
+// AcceptedAnswer is one answer that earns credit for a blank
+type AcceptedAnswer struct {
+	Text  string    `json:"text"`
+	Match MatchMode `json:"match,omitempty"`
+}
+
+// Blank is a gap the candidate fills in with text. A short-answer question has
+// one blank; a cloze question has one per {{id}} placeholder in its Content.
+type Blank struct {
+	ID       string           `json:"id"`
+	Accepted []AcceptedAnswer `json:"accepted"`
+}
+
+type Blanks []Blank
+
+func (b Blanks) Value() (driver.Value, error) {
+	return json.Marshal(b)
+}
+
+func (b *Blanks) Scan(value interface{}) error {
+	if value == nil {
+		*b = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, b)
+}
+
+type ToleranceType string
+
+const (
+	ToleranceAbsolute ToleranceType = "absolute" // within ±Tolerance of Answer
+	ToleranceRelative ToleranceType = "relative" // within ±Tolerance×|Answer|, e.g. 0.01 for 1%
+)
+
+// NumericUnit is a unit a numeric answer may be given in. Multiplier converts a
+// value in this unit to the unit of NumericKey.Answer, e.g. 0.01 for "cm" when the
+// key is in metres.
+type NumericUnit struct {
+	Symbol     string  `json:"symbol"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// NumericKey is the answer key of a numeric question
+type NumericKey struct {
+	Answer             float64       `json:"answer"`
+	Tolerance          float64       `json:"tolerance"`
+	ToleranceType      ToleranceType `json:"tolerance_type,omitempty"` // absolute when empty
+	Units              []NumericUnit `json:"units,omitempty"`
+	UnitRequired       bool          `json:"unit_required,omitempty"`       // otherwise a bare number is read in the key's unit
+	SignificantFigures int           `json:"significant_figures,omitempty"` // exact count required when set
+}
+
+func (k NumericKey) Value() (driver.Value, error) {
+	return json.Marshal(k)
+}
+
+func (k *NumericKey) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, k)
+}
+
+// RubricCriterion is one criterion an essay is marked on. Graders award between
+// MinPoints and MaxPoints for it; the criteria's points are scaled to the
+// question's points in the exam.
+type RubricCriterion struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description,omitempty"`
+	MinPoints   float64 `json:"min_points"`
+	MaxPoints   float64 `json:"max_points"`
+}
+
+type Rubric []RubricCriterion
+
+// MaxPoints totals the highest points of every criterion
+func (r Rubric) MaxPoints() float64 {
+	total := 0.0
+	for _, criterion := range r {
+		total += criterion.MaxPoints
+	}
+	return total
+}
+
+func (r Rubric) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+func (r *Rubric) Scan(value interface{}) error {
+	if value == nil {
+		*r = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, r)
+}
+
+// StringMap stores a JSON object of strings, e.g. the pairs of a matching answer
+type StringMap map[string]string
+
+func (m StringMap) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+func (m *StringMap) Scan(value interface{}) error {
+	if value == nil {
+		*m = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, m)
+}
+
 type StringArray []string
 
 func (s StringArray) Value() (driver.Value, error) {
@@ -71,21 +264,36 @@ func (s *StringArray) Scan(value interface{}) error {
 }
 
 type Question struct {
-	ID          uint               `json:"id" gorm:"primaryKey"`
-	Title       string             `json:"title" gorm:"not null"`
-	Content     string             `json:"content" gorm:"type:text;not null"`
-	Type        QuestionType       `json:"type" gorm:"default:'multiple_choice'"`
-	Difficulty  QuestionDifficulty `json:"difficulty" gorm:"default:'medium'"`
-	Options     Options            `json:"options" gorm:"type:jsonb"`
-	Tags        StringArray        `json:"tags" gorm:"type:jsonb"`
-	Points      int                `json:"points" gorm:"default:1"`
-	TimeLimit   int                `json:"time_limit" gorm:"default:60"` // in seconds
-	Explanation string             `json:"explanation" gorm:"type:text"`
-	IsActive    bool               `json:"is_active" gorm:"default:true"`
-	CreatedBy   uint               `json:"created_by"`
-	CreatedAt   time.Time          `json:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt     `json:"-" gorm:"index"`
+	ID            uint               `json:"id" gorm:"primaryKey"`
+	Title         string             `json:"title" gorm:"not null"`
+	Content       string             `json:"content" gorm:"type:text;not null"`
+	ContentFormat ContentFormat      `json:"content_format" gorm:"type:varchar(20);default:'plain'"` // markup of the content, option texts and explanation
+	Type          QuestionType       `json:"type" gorm:"default:'multiple_choice'"`
+	Difficulty    QuestionDifficulty `json:"difficulty" gorm:"default:'medium'"`
+	Options       Options            `json:"options" gorm:"type:jsonb"`
+	MatchChoices  Options            `json:"match_choices,omitempty" gorm:"type:jsonb"`              // right-hand items of matching questions, distractors included
+	Blanks        Blanks             `json:"blanks,omitempty" gorm:"type:jsonb"`                     // answer key of short-answer and cloze questions
+	Numeric       *NumericKey        `json:"numeric,omitempty" gorm:"column:numeric_key;type:jsonb"` // answer key of numeric questions
+	Rubric        Rubric             `json:"rubric,omitempty" gorm:"type:jsonb"`                     // marking criteria of essay questions, optional
+	Attachments   Attachments        `json:"attachments,omitempty" gorm:"type:jsonb"`                // images, audio and video shown with the content
+	SelectionMode SelectionMode      `json:"selection_mode,omitempty" gorm:"type:varchar(20)"`       // multiple-choice questions
+	MinSelections int                `json:"min_selections,omitempty" gorm:"default:0"`              // multi-select only, 0 means no minimum
+	MaxSelections int                `json:"max_selections,omitempty" gorm:"default:0"`              // multi-select only, 0 means no maximum
+	Tags          StringArray        `json:"tags" gorm:"type:jsonb"`
+	Points        int                `json:"points" gorm:"default:1"`
+	TimeLimit     int                `json:"time_limit" gorm:"default:60"` // in seconds
+	Explanation   string             `json:"explanation" gorm:"type:text"`
+	IsActive      bool               `json:"is_active" gorm:"default:true"`
+	Revision      int                `json:"revision" gorm:"not null;default:1"`         // current revision, see QuestionRevision
+	IRT           *ItemParameters    `json:"irt,omitempty" gorm:"column:irt;type:jsonb"` // calibrated item response theory parameters
+	CreatedBy     uint               `json:"created_by"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt     `json:"-" gorm:"index"`
+
+	// ShuffleSeed fixes the presented order of ordering items and matching
+	// choices within an attempt; zero shuffles them at random
+	ShuffleSeed int64 `json:"-" gorm:"-"`
 
 	// Relationships
 	Creator       User           `json:"creator,omitempty" gorm:"foreignKey:CreatedBy"`
@@ -93,60 +301,231 @@ type Question struct {
 }
 
 type QuestionResponse struct {
-	ID          uint               `json:"id"`
-	Title       string             `json:"title"`
-	Content     string             `json:"content"`
-	Type        QuestionType       `json:"type"`
-	Difficulty  QuestionDifficulty `json:"difficulty"`
-	Options     []OptionResponse   `json:"options"`
-	Tags        []string           `json:"tags"`
-	Points      int                `json:"points"`
-	TimeLimit   int                `json:"time_limit"`
-	Explanation string             `json:"explanation,omitempty"`
-	IsActive    bool               `json:"is_active"`
-	CreatedBy   uint               `json:"created_by"`
-	CreatedAt   time.Time          `json:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at"`
+	ID              uint                 `json:"id"`
+	Title           string               `json:"title"`
+	Content         string               `json:"content"`      // as authored, in ContentFormat
+	ContentHTML     string               `json:"content_html"` // rendered and sanitized for display
+	ContentFormat   ContentFormat        `json:"content_format"`
+	Type            QuestionType         `json:"type"`
+	Difficulty      QuestionDifficulty   `json:"difficulty"`
+	Options         []OptionResponse     `json:"options"`
+	MatchChoices    []OptionResponse     `json:"match_choices,omitempty"`
+	Blanks          []BlankResponse      `json:"blanks,omitempty"`
+	Numeric         *NumericResponse     `json:"numeric,omitempty"`
+	Rubric          []RubricCriterion    `json:"rubric,omitempty"` // shown to candidates so they know how essays are marked
+	Attachments     []AttachmentResponse `json:"attachments,omitempty"`
+	SelectionMode   SelectionMode        `json:"selection_mode,omitempty"`
+	MinSelections   int                  `json:"min_selections,omitempty"`
+	MaxSelections   int                  `json:"max_selections,omitempty"`
+	Tags            []string             `json:"tags"`
+	Points          int                  `json:"points"`
+	TimeLimit       int                  `json:"time_limit"`
+	Explanation     string               `json:"explanation,omitempty"`
+	ExplanationHTML string               `json:"explanation_html,omitempty"`
+	IsActive        bool                 `json:"is_active"`
+	Revision        int                  `json:"revision"`
+	IRT             *ItemParameters      `json:"irt,omitempty"` // only with correct answers
+	CreatedBy       uint                 `json:"created_by"`
+	CreatedAt       time.Time            `json:"created_at"`
+	UpdatedAt       time.Time            `json:"updated_at"`
 }
 
 type OptionResponse struct {
-	ID   string `json:"id"`
-	Text string `json:"text"`
+	ID         string              `json:"id"`
+	Text       string              `json:"text"`
+	TextHTML   string              `json:"text_html"`
+	Attachment *AttachmentResponse `json:"attachment,omitempty"`
 	// IsCorrect is omitted for security reasons when serving to users
+	MatchID string `json:"match_id,omitempty"` // only with correct answers
+}
+
+// NumericResponse tells candidates how to give a numeric answer; the expected
+// answer and tolerance are only included with correct answers
+type NumericResponse struct {
+	Units              []string      `json:"units,omitempty"`
+	UnitRequired       bool          `json:"unit_required,omitempty"`
+	SignificantFigures int           `json:"significant_figures,omitempty"`
+	Answer             *float64      `json:"answer,omitempty"`
+	Tolerance          *float64      `json:"tolerance,omitempty"`
+	ToleranceType      ToleranceType `json:"tolerance_type,omitempty"`
+}
+
+type BlankResponse struct {
+	ID       string           `json:"id"`
+	Accepted []AcceptedAnswer `json:"accepted,omitempty"` // only with correct answers
 }
 
 func (q *Question) ToResponse(includeCorrectAnswers bool) QuestionResponse {
+	format := q.Format()
+
+	// Media links are signed only when there is media to link to
+	var expires time.Time
+	if len(q.MediaIDs()) > 0 {
+		expires = mediaLinkExpiry()
+	}
+
 	options := make([]OptionResponse, len(q.Options))
 	for i, opt := range q.Options {
 		options[i] = OptionResponse{
-			ID:   opt.ID,
-			Text: opt.Text,
+			ID:       opt.ID,
+			Text:     opt.Text,
+			TextHTML: format.Render(opt.Text),
+		}
+		if opt.Attachment != nil {
+			attachment := opt.Attachment.ToResponse(expires)
+			options[i].Attachment = &attachment
+		}
+		if includeCorrectAnswers {
+			options[i].MatchID = opt.MatchID
+		}
+	}
+
+	var matchChoices []OptionResponse
+	for _, choice := range q.MatchChoices {
+		response := OptionResponse{ID: choice.ID, Text: choice.Text, TextHTML: format.Render(choice.Text)}
+		if choice.Attachment != nil {
+			attachment := choice.Attachment.ToResponse(expires)
+			response.Attachment = &attachment
+		}
+		matchChoices = append(matchChoices, response)
+	}
+
+	// The authored order of ordering items is the answer, and matching choices
+	// would line up with their options, so candidates always get them shuffled
+	if !includeCorrectAnswers && (q.Type == Ordering || q.Type == Matching) {
+		seed := q.ShuffleSeed
+		if seed == 0 {
+			seed = rand.Int63()
+		}
+		rng := rand.New(rand.NewSource(seed))
+		if q.Type == Ordering {
+			rng.Shuffle(len(options), func(a, b int) {
+				options[a], options[b] = options[b], options[a]
+			})
+		} else {
+			rng.Shuffle(len(matchChoices), func(a, b int) {
+				matchChoices[a], matchChoices[b] = matchChoices[b], matchChoices[a]
+			})
 		}
 	}
 
 	response := QuestionResponse{
-		ID:         q.ID,
-		Title:      q.Title,
-		Content:    q.Content,
-		Type:       q.Type,
-		Difficulty: q.Difficulty,
-		Options:    options,
-		Tags:       []string(q.Tags),
-		Points:     q.Points,
-		TimeLimit:  q.TimeLimit,
-		IsActive:   q.IsActive,
-		CreatedBy:  q.CreatedBy,
-		CreatedAt:  q.CreatedAt,
-		UpdatedAt:  q.UpdatedAt,
+		ID:            q.ID,
+		Title:         q.Title,
+		Content:       q.Content,
+		ContentHTML:   format.Render(q.Content),
+		ContentFormat: format,
+		Type:          q.Type,
+		Difficulty:    q.Difficulty,
+		Options:       options,
+		MatchChoices:  matchChoices,
+		Rubric:        q.Rubric,
+		SelectionMode: q.Selection(),
+		MinSelections: q.MinSelections,
+		MaxSelections: q.MaxSelections,
+		Tags:          []string(q.Tags),
+		Points:        q.Points,
+		TimeLimit:     q.TimeLimit,
+		IsActive:      q.IsActive,
+		Revision:      q.Revision,
+		CreatedBy:     q.CreatedBy,
+		CreatedAt:     q.CreatedAt,
+		UpdatedAt:     q.UpdatedAt,
+	}
+
+	for _, attachment := range q.Attachments {
+		response.Attachments = append(response.Attachments, attachment.ToResponse(expires))
+	}
+
+	if len(q.Blanks) > 0 {
+		response.Blanks = make([]BlankResponse, len(q.Blanks))
+		for i, blank := range q.Blanks {
+			response.Blanks[i] = BlankResponse{ID: blank.ID}
+			if includeCorrectAnswers {
+				response.Blanks[i].Accepted = blank.Accepted
+			}
+		}
+	}
+
+	if q.Numeric != nil {
+		numeric := &NumericResponse{
+			UnitRequired:       q.Numeric.UnitRequired,
+			SignificantFigures: q.Numeric.SignificantFigures,
+		}
+		for _, unit := range q.Numeric.Units {
+			numeric.Units = append(numeric.Units, unit.Symbol)
+		}
+		if includeCorrectAnswers {
+			answer, tolerance := q.Numeric.Answer, q.Numeric.Tolerance
+			numeric.Answer = &answer
+			numeric.Tolerance = &tolerance
+			numeric.ToleranceType = q.Numeric.ToleranceType
+		}
+		response.Numeric = numeric
 	}
 
 	if includeCorrectAnswers {
+		response.IRT = q.IRT
 		response.Explanation = q.Explanation
+		if q.Explanation != "" {
+			response.ExplanationHTML = format.Render(q.Explanation)
+		}
 	}
 
 	return response
 }
 
+// MediaIDs lists the media the question and its options show, without repeats
+func (q *Question) MediaIDs() []uint {
+	ids := []uint{}
+	seen := make(map[uint]bool)
+	add := func(attachment *Attachment) {
+		if attachment != nil && !seen[attachment.MediaID] {
+			seen[attachment.MediaID] = true
+			ids = append(ids, attachment.MediaID)
+		}
+	}
+
+	for i := range q.Attachments {
+		add(&q.Attachments[i])
+	}
+	for _, opt := range q.Options {
+		add(opt.Attachment)
+	}
+	for _, choice := range q.MatchChoices {
+		add(choice.Attachment)
+	}
+	return ids
+}
+
+// Format returns the markup the question is written in; questions stored before
+// content formats existed are plain text
+func (q *Question) Format() ContentFormat {
+	if q.ContentFormat == "" {
+		return FormatPlain
+	}
+	return q.ContentFormat
+}
+
+// Selection returns how many options candidates may pick. True/false questions are
+// always single-select; multiple-choice questions stored before selection modes
+// existed are single-select when they have exactly one correct option.
+func (q *Question) Selection() SelectionMode {
+	switch q.Type {
+	case TrueFalse:
+		return SelectSingle
+	case MultipleChoice:
+		if q.SelectionMode != "" {
+			return q.SelectionMode
+		}
+		if len(q.GetCorrectAnswers()) == 1 {
+			return SelectSingle
+		}
+		return SelectMultiple
+	}
+	return ""
+}
+
 func (q *Question) GetCorrectAnswers() []string {
 	var correctAnswers []string
 	for _, opt := range q.Options {
@@ -159,18 +538,19 @@ func (q *Question) GetCorrectAnswers() []string {
 
 func (q *Question) ValidateAnswer(selectedOptions []string) bool {
 	correctAnswers := q.GetCorrectAnswers()
-	
-	if len(selectedOptions) != len(correctAnswers) {
-		return false
+
+	// Compare as sets so duplicated selections can't pad out the count
+	selectedSet := make(map[string]bool)
+	for _, selected := range selectedOptions {
+		selectedSet[selected] = true
 	}
 
-	correctMap := make(map[string]bool)
-	for _, correct := range correctAnswers {
-		correctMap[correct] = true
+	if len(selectedSet) != len(correctAnswers) {
+		return false
 	}
 
-	for _, selected := range selectedOptions {
-		if !correctMap[selected] {
+	for _, correct := range correctAnswers {
+		if !selectedSet[correct] {
 			return false
 		}
 	}
@@ -178,3 +558,12 @@ func (q *Question) ValidateAnswer(selectedOptions []string) bool {
 	return true
 }
 
+// HasOption reports whether the question has an option with the given ID
+func (q *Question) HasOption(optionID string) bool {
+	for _, opt := range q.Options {
+		if opt.ID == optionID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+type RegradeMode string
+
+const (
+	RegradeCurrentKey    RegradeMode = "current_key"    // grade against the question's current answer key
+	RegradeAcceptOptions RegradeMode = "accept_options" // also accept other options of a single-answer question
+	RegradeDropQuestion  RegradeMode = "drop_question"  // give every candidate full credit for the question
+)
+
+func (m RegradeMode) IsValid() bool {
+	switch m {
+	case RegradeCurrentKey, RegradeAcceptOptions, RegradeDropQuestion:
+		return true
+	}
+	return false
+}
+
+// RegradeAdjustment records on an answer that a regrade overrode its question's
+// answer key, so later regrades of the exam keep the override
+type RegradeAdjustment struct {
+	Mode          RegradeMode `json:"mode"`
+	AcceptOptions []string    `json:"accept_options,omitempty"`
+	RegradeID     uint        `json:"regrade_id"`
+}
+
+// Regrade is the audit record of one regrade: what was regraded, how, by whom,
+// and the before and after values of every result whose score changed
+type Regrade struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	ExamID          *uint          `json:"exam_id" gorm:"index"`     // set when one exam was regraded
+	QuestionID      *uint          `json:"question_id" gorm:"index"` // set when one question was regraded
+	Mode            RegradeMode    `json:"mode" gorm:"type:varchar(20);not null"`
+	AcceptOptions   StringArray    `json:"accept_options,omitempty" gorm:"type:jsonb"`
+	Reason          string         `json:"reason" gorm:"type:text"`
+	ResultsRegraded int            `json:"results_regraded"`
+	ResultsChanged  int            `json:"results_changed"`
+	PassChanges     int            `json:"pass_changes"` // results whose pass/fail status flipped
+	RegradedBy      uint           `json:"regraded_by"`
+	CreatedAt       time.Time      `json:"created_at"`
+	Changes         []ResultChange `json:"changes" gorm:"foreignKey:RegradeID"`
+}
+
+// ResultChange is the before and after values of one result in a regrade
+type ResultChange struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	RegradeID    uint      `json:"regrade_id" gorm:"not null;index"`
+	ResultID     uint      `json:"result_id" gorm:"not null;index"`
+	UserID       uint      `json:"user_id"`
+	ExamID       uint      `json:"exam_id" gorm:"index"`
+	ScoreBefore  float64   `json:"score_before"`
+	ScoreAfter   float64   `json:"score_after"`
+	PointsBefore float64   `json:"points_before"`
+	PointsAfter  float64   `json:"points_after"`
+	PassedBefore bool      `json:"passed_before"`
+	PassedAfter  bool      `json:"passed_after"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// PassChanged reports whether the regrade flipped the result between pass and fail
+func (c *ResultChange) PassChanged() bool {
+	return c.PassedBefore != c.PassedAfter
+}
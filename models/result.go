@@ -10,11 +10,128 @@ import (
 )
 
 type Answer struct {
-	QuestionID      uint     `json:"question_id"`
-	SelectedOptions []string `json:"selected_options"`
-	IsCorrect       bool     `json:"is_correct"`
-	Points          int      `json:"points"`
-	TimeSpent       int      `json:"time_spent"` // in seconds
+	QuestionID      uint               `json:"question_id"`
+	Revision        int                `json:"revision,omitempty"` // revision of the question that was shown and graded, 0 for answers from before versioning
+	SelectedOptions []string           `json:"selected_options"`
+	TextAnswers     []string           `json:"text_answers,omitempty"` // one per blank of short-answer and cloze questions
+	NumericAnswer   *NumericAnswer     `json:"numeric_answer,omitempty"`
+	Matches         map[string]string  `json:"matches,omitempty"` // matching questions, option ID -> match choice ID
+	Essay           string             `json:"essay,omitempty"`
+	IsCorrect       bool               `json:"is_correct"`
+	Points          float64            `json:"points"`
+	MaxPoints       int                `json:"max_points"`
+	TimeSpent       int                `json:"time_spent"`                // in seconds
+	PendingGrading  bool               `json:"pending_grading,omitempty"` // an essay no grader has marked yet
+	Grading         *GradingBreakdown  `json:"grading,omitempty"`
+	Adjustment      *RegradeAdjustment `json:"adjustment,omitempty"` // set when a regrade overrode the answer key
+}
+
+// NumericAnswer is a candidate's answer to a numeric question. Number keeps the
+// number as typed so significant figures survive; clients may send it as a JSON
+// number or string, with a decimal point or comma.
+type NumericAnswer struct {
+	Number string `json:"number"`
+	Unit   string `json:"unit,omitempty"`
+}
+
+func (n *NumericAnswer) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Number json.RawMessage `json:"number"`
+		Unit   string          `json:"unit"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	n.Unit = raw.Unit
+	n.Number = ""
+	if len(raw.Number) > 0 && raw.Number[0] == '"' {
+		return json.Unmarshal(raw.Number, &n.Number)
+	}
+	if len(raw.Number) > 0 && string(raw.Number) != "null" {
+		n.Number = string(raw.Number)
+	}
+	return nil
+}
+
+func (n NumericAnswer) Value() (driver.Value, error) {
+	return json.Marshal(n)
+}
+
+func (n *NumericAnswer) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, n)
+}
+
+type GradingRule string
+
+const (
+	GradingExactSet    GradingRule = "exact_set"    // selection must equal the set of correct options
+	GradingSingleMatch GradingRule = "single_match" // exactly one option, and it must be the correct one
+	GradingTextMatch   GradingRule = "text_match"   // every blank must match one of its accepted answers
+	GradingNumeric     GradingRule = "numeric"      // the number must fall within the tolerance, in an accepted unit
+	GradingOrdering    GradingRule = "ordering"     // every item must sit at its position in CorrectOptions
+	GradingMatching    GradingRule = "matching"     // every option must be paired as in CorrectMatches
+	GradingManual      GradingRule = "manual"       // marked by a grader, see Manual
+)
+
+// GradingBreakdown records how an answer was graded so results can be
+// reviewed later without re-running the scoring engine
+type GradingBreakdown struct {
+	Rule            GradingRule       `json:"rule"`
+	Answered        bool              `json:"answered"`
+	CorrectOptions  []string          `json:"correct_options"`
+	CorrectSelected int               `json:"correct_selected"`        // correct options the candidate picked, or blanks filled in correctly
+	WrongSelected   int               `json:"wrong_selected"`          // incorrect options the candidate picked, or blanks filled in wrongly
+	MissedOptions   int               `json:"missed_options"`          // correct options the candidate left out, or blanks left empty
+	BelowMinimum    bool              `json:"below_minimum,omitempty"` // fewer options picked than the question's MinSelections, which earns no credit
+	Blanks          []BlankGrade      `json:"blanks,omitempty"`
+	Numeric         *NumericGrade     `json:"numeric,omitempty"`
+	CorrectMatches  map[string]string `json:"correct_matches,omitempty"`
+	Manual          *ManualGrade      `json:"manual,omitempty"`
+	Credit          float64           `json:"credit"` // share of MaxPoints awarded under the exam's scoring policy, negative for penalties
+}
+
+// ManualGrade records how a grader marked an essay: per rubric criterion when the
+// question has a rubric, otherwise as a single score
+type ManualGrade struct {
+	GraderID uint             `json:"grader_id"`
+	GradedAt time.Time        `json:"graded_at"`
+	Criteria []CriterionScore `json:"criteria,omitempty"`
+	Comment  string           `json:"comment,omitempty"`
+}
+
+// CriterionScore is the points a grader awarded for one rubric criterion
+type CriterionScore struct {
+	CriterionID string  `json:"criterion_id"`
+	Points      float64 `json:"points"`
+	Comment     string  `json:"comment,omitempty"`
+}
+
+// NumericGrade records how a numeric answer was graded
+type NumericGrade struct {
+	Value              float64 `json:"value"` // the answer converted to the key's unit
+	Expected           float64 `json:"expected"`
+	Min                float64 `json:"min"`
+	Max                float64 `json:"max"`
+	UnitAccepted       bool    `json:"unit_accepted"`
+	SignificantFigures int     `json:"significant_figures"` // as typed by the candidate
+	FiguresAccepted    bool    `json:"figures_accepted"`
+}
+
+// BlankGrade records how one blank of a text answer was graded
+type BlankGrade struct {
+	ID       string   `json:"id"`
+	Correct  bool     `json:"correct"`
+	Accepted []string `json:"accepted"`
 }
 
 type Answers []Answer
@@ -37,72 +154,138 @@ func (a *Answers) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, a)
 }
 
+type ResultStatus string
+
+const (
+	ResultGraded         ResultStatus = "graded"
+	ResultPendingGrading ResultStatus = "pending_grading" // essays are waiting for a grader; Score and Passed are provisional
+)
+
 type Result struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	UserID      uint           `json:"user_id" gorm:"not null"`
-	ExamID      uint           `json:"exam_id" gorm:"not null"`
-	UserExamID  uint           `json:"user_exam_id" gorm:"not null"`
-	Score       float64        `json:"score" gorm:"not null"`        // percentage score
-	TotalPoints int            `json:"total_points" gorm:"not null"` // points earned
-	MaxPoints   int            `json:"max_points" gorm:"not null"`   // maximum possible points
-	Passed      bool           `json:"passed" gorm:"default:false"`
-	Answers     Answers        `json:"answers" gorm:"type:jsonb"`
-	StartTime   time.Time      `json:"start_time" gorm:"not null"`
-	EndTime     time.Time      `json:"end_time" gorm:"not null"`
-	Duration    int            `json:"duration" gorm:"not null"` // in seconds
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	UserID            uint           `json:"user_id" gorm:"not null"`
+	ExamID            uint           `json:"exam_id" gorm:"not null"`
+	UserExamID        uint           `json:"user_exam_id" gorm:"not null"`
+	ExamAttemptID     *uint          `json:"exam_attempt_id" gorm:"index"`
+	Score             float64        `json:"score" gorm:"not null"`        // percentage score
+	TotalPoints       float64        `json:"total_points" gorm:"not null"` // points earned
+	MaxPoints         int            `json:"max_points" gorm:"not null"`   // maximum possible points
+	Passed            bool           `json:"passed" gorm:"default:false"`
+	Status            ResultStatus   `json:"status" gorm:"default:'graded'"`
+	GradedAt          *time.Time     `json:"graded_at"`                                      // set when a grader finalizes a result with essays
+	ScoringPolicy     ScoringPolicy  `json:"scoring_policy" gorm:"default:'all_or_nothing'"` // policy in force at grading time, kept so exam edits don't reinterpret old results
+	NegativeMarkRatio float64        `json:"negative_mark_ratio" gorm:"default:0"`
+	SubmittedLate     bool           `json:"submitted_late" gorm:"default:false"` // accepted after the deadline under the truncate late policy
+	AutoSubmitted     bool           `json:"auto_submitted" gorm:"default:false"` // closed by the timer worker rather than the candidate
+	SectionScores     SectionScores  `json:"section_scores" gorm:"type:jsonb"`
+	Ability           *float64       `json:"ability"`    // adaptive exams: ability estimate on the item response theory scale
+	AbilitySE         *float64       `json:"ability_se"` // standard error of Ability
+	Answers           Answers        `json:"answers" gorm:"type:jsonb"`
+	StartTime         time.Time      `json:"start_time" gorm:"not null"`
+	EndTime           time.Time      `json:"end_time" gorm:"not null"`
+	Duration          int            `json:"duration" gorm:"not null"` // in seconds
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships - Note: Removed UserExam to break circular dependency
 	// UserExam can be loaded separately using UserExamID foreign key
 	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 	Exam Exam `json:"exam,omitempty" gorm:"foreignKey:ExamID"`
+
+	// Questions holds the answered questions at the revision each answer used,
+	// when loaded, so responses show them as the candidate saw them
+	Questions map[uint]*Question `json:"-" gorm:"-"`
 }
 
 type ResultResponse struct {
-	ID          uint              `json:"id"`
-	UserID      uint              `json:"user_id"`
-	ExamID      uint              `json:"exam_id"`
-	UserExamID  uint              `json:"user_exam_id"`
-	ExamTitle   string            `json:"exam_title"`
-	Score       float64           `json:"score"`
-	TotalPoints int               `json:"total_points"`
-	MaxPoints   int               `json:"max_points"`
-	Passed      bool              `json:"passed"`
-	StartTime   time.Time         `json:"start_time"`
-	EndTime     time.Time         `json:"end_time"`
-	Duration    int               `json:"duration"`
-	CreatedAt   time.Time         `json:"created_at"`
-	Answers     []AnswerResponse  `json:"answers,omitempty"`
-	User        *UserResponse     `json:"user,omitempty"`
-	UserExam    *UserExamResponse `json:"user_exam,omitempty"` // Can be populated from service layer
+	ID                uint              `json:"id"`
+	UserID            uint              `json:"user_id"`
+	ExamID            uint              `json:"exam_id"`
+	UserExamID        uint              `json:"user_exam_id"`
+	ExamAttemptID     *uint             `json:"exam_attempt_id,omitempty"`
+	ExamTitle         string            `json:"exam_title"`
+	Score             *float64          `json:"score"`        // null while awaiting grading
+	TotalPoints       *float64          `json:"total_points"` // null while awaiting grading
+	MaxPoints         int               `json:"max_points"`
+	Passed            *bool             `json:"passed"` // null while awaiting grading
+	Status            ResultStatus      `json:"status"`
+	AwaitingGrading   bool              `json:"awaiting_grading"`
+	GradedAt          *time.Time        `json:"graded_at,omitempty"`
+	ScoringPolicy     ScoringPolicy     `json:"scoring_policy"`
+	NegativeMarkRatio float64           `json:"negative_mark_ratio"`
+	SubmittedLate     bool              `json:"submitted_late"`
+	AutoSubmitted     bool              `json:"auto_submitted"`
+	SectionScores     []SectionScore    `json:"section_scores,omitempty"`
+	Ability           *float64          `json:"ability,omitempty"`    // adaptive exams only, null while awaiting grading
+	AbilitySE         *float64          `json:"ability_se,omitempty"` // standard error of Ability
+	StartTime         time.Time         `json:"start_time"`
+	EndTime           time.Time         `json:"end_time"`
+	Duration          int               `json:"duration"`
+	CreatedAt         time.Time         `json:"created_at"`
+	Answers           []AnswerResponse  `json:"answers,omitempty"`
+	User              *UserResponse     `json:"user,omitempty"`
+	UserExam          *UserExamResponse `json:"user_exam,omitempty"` // Can be populated from service layer
 }
 
 type AnswerResponse struct {
-	QuestionID      uint              `json:"question_id"`
-	Question        *QuestionResponse `json:"question,omitempty"`
-	SelectedOptions []string          `json:"selected_options"`
-	CorrectOptions  []string          `json:"correct_options,omitempty"`
-	IsCorrect       bool              `json:"is_correct"`
-	Points          int               `json:"points"`
-	TimeSpent       int               `json:"time_spent"`
+	QuestionID      uint               `json:"question_id"`
+	Revision        int                `json:"revision,omitempty"`
+	Question        *QuestionResponse  `json:"question,omitempty"`
+	SelectedOptions []string           `json:"selected_options"`
+	TextAnswers     []string           `json:"text_answers,omitempty"`
+	NumericAnswer   *NumericAnswer     `json:"numeric_answer,omitempty"`
+	Matches         map[string]string  `json:"matches,omitempty"`
+	Essay           string             `json:"essay,omitempty"`
+	CorrectOptions  []string           `json:"correct_options,omitempty"`
+	Blanks          []BlankGrade       `json:"blanks,omitempty"`  // only with correct answers
+	Numeric         *NumericGrade      `json:"numeric,omitempty"` // only with correct answers
+	CorrectMatches  map[string]string  `json:"correct_matches,omitempty"`
+	Feedback        *ManualGrade       `json:"feedback,omitempty"` // the grader's marks and comments on an essay
+	IsCorrect       *bool              `json:"is_correct"`         // null while awaiting grading
+	Points          *float64           `json:"points"`             // null while awaiting grading
+	MaxPoints       int                `json:"max_points"`
+	TimeSpent       int                `json:"time_spent"`
+	PendingGrading  bool               `json:"pending_grading,omitempty"`
+	Adjustment      *RegradeAdjustment `json:"adjustment,omitempty"`
 }
 
 func (r *Result) ToResponse(includeAnswers bool, includeCorrectAnswers bool) ResultResponse {
 	response := ResultResponse{
-		ID:          r.ID,
-		UserID:      r.UserID,
-		ExamID:      r.ExamID,
-		UserExamID:  r.UserExamID,
-		Score:       r.Score,
-		TotalPoints: r.TotalPoints,
-		MaxPoints:   r.MaxPoints,
-		Passed:      r.Passed,
-		StartTime:   r.StartTime,
-		EndTime:     r.EndTime,
-		Duration:    r.Duration,
-		CreatedAt:   r.CreatedAt,
+		ID:                r.ID,
+		UserID:            r.UserID,
+		ExamID:            r.ExamID,
+		UserExamID:        r.UserExamID,
+		ExamAttemptID:     r.ExamAttemptID,
+		MaxPoints:         r.MaxPoints,
+		Status:            r.Status,
+		GradedAt:          r.GradedAt,
+		StartTime:         r.StartTime,
+		EndTime:           r.EndTime,
+		Duration:          r.Duration,
+		CreatedAt:         r.CreatedAt,
+		ScoringPolicy:     r.ScoringPolicy,
+		NegativeMarkRatio: r.NegativeMarkRatio,
+		SubmittedLate:     r.SubmittedLate,
+		AutoSubmitted:     r.AutoSubmitted,
+	}
+
+	// A provisional score, overall or by section, leaves out the essays and would
+	// mislead candidates
+	if r.AwaitingGrading() {
+		response.Status = ResultPendingGrading
+		response.AwaitingGrading = true
+	} else {
+		score, totalPoints, passed := r.Score, r.TotalPoints, r.Passed
+		response.Score = &score
+		response.TotalPoints = &totalPoints
+		response.Passed = &passed
+		response.SectionScores = r.SectionScores
+		response.Ability = r.Ability
+		response.AbilitySE = r.AbilitySE
+		if response.Status == "" {
+			response.Status = ResultGraded
+		}
 	}
 
 	if r.Exam.Title != "" {
@@ -119,15 +302,39 @@ func (r *Result) ToResponse(includeAnswers bool, includeCorrectAnswers bool) Res
 		for i, ans := range r.Answers {
 			answerResp := AnswerResponse{
 				QuestionID:      ans.QuestionID,
+				Revision:        ans.Revision,
 				SelectedOptions: ans.SelectedOptions,
-				IsCorrect:       ans.IsCorrect,
-				Points:          ans.Points,
+				TextAnswers:     ans.TextAnswers,
+				NumericAnswer:   ans.NumericAnswer,
+				Matches:         ans.Matches,
+				Essay:           ans.Essay,
+				MaxPoints:       ans.MaxPoints,
 				TimeSpent:       ans.TimeSpent,
+				PendingGrading:  ans.PendingGrading,
+				Adjustment:      ans.Adjustment,
 			}
 
-			if includeCorrectAnswers {
-				// This would need to be populated from the question data
-				// For now, we'll leave it empty and populate it in the service layer
+			// Marks can still change until the result is finalized, and the answers'
+			// points would add up to the provisional score
+			if !r.AwaitingGrading() {
+				isCorrect, points := ans.IsCorrect, ans.Points
+				answerResp.IsCorrect = &isCorrect
+				answerResp.Points = &points
+				if ans.Grading != nil && ans.Grading.Manual != nil {
+					answerResp.Feedback = ans.Grading.Manual
+				}
+			}
+
+			if question, ok := r.Questions[ans.QuestionID]; ok {
+				questionResp := question.ToResponse(includeCorrectAnswers)
+				answerResp.Question = &questionResp
+			}
+
+			if includeCorrectAnswers && ans.Grading != nil {
+				answerResp.CorrectOptions = ans.Grading.CorrectOptions
+				answerResp.Blanks = ans.Grading.Blanks
+				answerResp.Numeric = ans.Grading.Numeric
+				answerResp.CorrectMatches = ans.Grading.CorrectMatches
 			}
 
 			answers[i] = answerResp
@@ -138,6 +345,12 @@ func (r *Result) ToResponse(includeAnswers bool, includeCorrectAnswers bool) Res
 	return response
 }
 
+// AwaitingGrading reports whether essays of the result still have to be marked
+// before its score counts
+func (r *Result) AwaitingGrading() bool {
+	return r.Status == ResultPendingGrading
+}
+
 // ToResponseWithUserExam allows including UserExam data when available
 // This should be called from the service layer where UserExam can be loaded separately
 func (r *Result) ToResponseWithUserExam(includeAnswers bool, includeCorrectAnswers bool, userExam *UserExam) ResultResponse {
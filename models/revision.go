@@ -0,0 +1,162 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// QuestionRevision is a snapshot of a question's content. Creating a question
+// records revision 1 and every edit that changes its content records the next
+// one, so exams, attempts and results keep pointing at the question as it was
+// when they used it. Whether a question is active is not part of its content.
+type QuestionRevision struct {
+	ID            uint               `json:"id" gorm:"primaryKey"`
+	QuestionID    uint               `json:"question_id" gorm:"not null;uniqueIndex:idx_question_revisions_revision"`
+	Revision      int                `json:"revision" gorm:"not null;uniqueIndex:idx_question_revisions_revision"`
+	Title         string             `json:"title" gorm:"not null"`
+	Content       string             `json:"content" gorm:"type:text;not null"`
+	ContentFormat ContentFormat      `json:"content_format" gorm:"type:varchar(20);default:'plain'"`
+	Type          QuestionType       `json:"type"`
+	Difficulty    QuestionDifficulty `json:"difficulty"`
+	Options       Options            `json:"options" gorm:"type:jsonb"`
+	MatchChoices  Options            `json:"match_choices,omitempty" gorm:"type:jsonb"`
+	Blanks        Blanks             `json:"blanks,omitempty" gorm:"type:jsonb"`
+	Numeric       *NumericKey        `json:"numeric,omitempty" gorm:"column:numeric_key;type:jsonb"`
+	Rubric        Rubric             `json:"rubric,omitempty" gorm:"type:jsonb"`
+	Attachments   Attachments        `json:"attachments,omitempty" gorm:"type:jsonb"`
+	SelectionMode SelectionMode      `json:"selection_mode,omitempty" gorm:"type:varchar(20)"`
+	MinSelections int                `json:"min_selections,omitempty" gorm:"default:0"`
+	MaxSelections int                `json:"max_selections,omitempty" gorm:"default:0"`
+	Tags          StringArray        `json:"tags" gorm:"type:jsonb"`
+	Points        int                `json:"points"`
+	TimeLimit     int                `json:"time_limit"` // in seconds
+	Explanation   string             `json:"explanation" gorm:"type:text"`
+	RestoredFrom  *int               `json:"restored_from,omitempty"` // the earlier revision this one brought back
+	EditedBy      uint               `json:"edited_by"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+// NewQuestionRevision snapshots the current content of a question
+func NewQuestionRevision(q *Question, editedBy uint) QuestionRevision {
+	return QuestionRevision{
+		QuestionID:    q.ID,
+		Revision:      q.Revision,
+		Title:         q.Title,
+		Content:       q.Content,
+		ContentFormat: q.ContentFormat,
+		Type:          q.Type,
+		Difficulty:    q.Difficulty,
+		Options:       q.Options,
+		MatchChoices:  q.MatchChoices,
+		Blanks:        q.Blanks,
+		Numeric:       q.Numeric,
+		Rubric:        q.Rubric,
+		Attachments:   q.Attachments,
+		SelectionMode: q.SelectionMode,
+		MinSelections: q.MinSelections,
+		MaxSelections: q.MaxSelections,
+		Tags:          q.Tags,
+		Points:        q.Points,
+		TimeLimit:     q.TimeLimit,
+		Explanation:   q.Explanation,
+		EditedBy:      editedBy,
+	}
+}
+
+// MediaIDs returns the media the revision's content and options show
+func (r *QuestionRevision) MediaIDs() []uint {
+	q := Question{Attachments: r.Attachments, Options: r.Options, MatchChoices: r.MatchChoices}
+	return q.MediaIDs()
+}
+
+// Apply puts the revision's content on q, which then reads as that revision
+func (r *QuestionRevision) Apply(q *Question) {
+	q.Revision = r.Revision
+	q.Title = r.Title
+	q.Content = r.Content
+	q.ContentFormat = r.ContentFormat
+	q.Type = r.Type
+	q.Difficulty = r.Difficulty
+	q.Options = r.Options
+	q.MatchChoices = r.MatchChoices
+	q.Blanks = r.Blanks
+	q.Numeric = r.Numeric
+	q.Rubric = r.Rubric
+	q.Attachments = r.Attachments
+	q.SelectionMode = r.SelectionMode
+	q.MinSelections = r.MinSelections
+	q.MaxSelections = r.MaxSelections
+	q.Tags = r.Tags
+	q.Points = r.Points
+	q.TimeLimit = r.TimeLimit
+	q.Explanation = r.Explanation
+}
+
+// RevisionChange is a field whose value differs between two revisions
+type RevisionChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+// DiffRevisions lists the fields that changed from one revision to another, in
+// the order they appear on a question
+func DiffRevisions(from, to *QuestionRevision) []RevisionChange {
+	changes := []RevisionChange{}
+	fromFields, toFields := from.contentFields(), to.contentFields()
+	for i, field := range fromFields {
+		before, _ := json.Marshal(field.value)
+		after, _ := json.Marshal(toFields[i].value)
+		if !bytes.Equal(before, after) {
+			changes = append(changes, RevisionChange{Field: field.name, From: before, To: after})
+		}
+	}
+	return changes
+}
+
+// SameContent reports whether two revisions hold the same content
+func (r *QuestionRevision) SameContent(other *QuestionRevision) bool {
+	return len(DiffRevisions(r, other)) == 0
+}
+
+type revisionField struct {
+	name  string
+	value interface{}
+}
+
+// contentFields lists the content of a revision under its JSON names. Empty
+// lists and a missing format compare equal to what they default to.
+func (r *QuestionRevision) contentFields() []revisionField {
+	format := r.ContentFormat
+	if format == "" {
+		format = FormatPlain
+	}
+	return []revisionField{
+		{"title", r.Title},
+		{"content", r.Content},
+		{"content_format", format},
+		{"type", r.Type},
+		{"difficulty", r.Difficulty},
+		{"options", emptyAsNil(len(r.Options), r.Options)},
+		{"match_choices", emptyAsNil(len(r.MatchChoices), r.MatchChoices)},
+		{"blanks", emptyAsNil(len(r.Blanks), r.Blanks)},
+		{"numeric", r.Numeric},
+		{"rubric", emptyAsNil(len(r.Rubric), r.Rubric)},
+		{"attachments", emptyAsNil(len(r.Attachments), r.Attachments)},
+		{"selection_mode", r.SelectionMode},
+		{"min_selections", r.MinSelections},
+		{"max_selections", r.MaxSelections},
+		{"tags", emptyAsNil(len(r.Tags), r.Tags)},
+		{"points", r.Points},
+		{"time_limit", r.TimeLimit},
+		{"explanation", r.Explanation},
+	}
+}
+
+func emptyAsNil(length int, value interface{}) interface{} {
+	if length == 0 {
+		return nil
+	}
+	return value
+}
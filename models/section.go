@@ -0,0 +1,104 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ExamSection is a timed part of an exam (e.g. theory, practical). Candidates go
+// through sections in order; a section closes when they move on or its time runs
+// out, and with LockOnClose its answers can't be changed afterwards.
+type ExamSection struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ExamID       uint      `json:"exam_id" gorm:"not null;index"`
+	Title        string    `json:"title" gorm:"not null"`
+	Instructions string    `json:"instructions" gorm:"type:text"`
+	Order        int       `json:"order" gorm:"not null"`
+	Duration     int       `json:"duration" gorm:"default:0"` // in minutes, 0 means no limit of its own
+	LockOnClose  bool      `json:"lock_on_close" gorm:"default:false"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type SectionStatus string
+
+const (
+	SectionClosed   SectionStatus = "closed"
+	SectionOpen     SectionStatus = "open"
+	SectionUpcoming SectionStatus = "upcoming"
+)
+
+type ExamSectionResponse struct {
+	ID           uint          `json:"id"`
+	Title        string        `json:"title"`
+	Instructions string        `json:"instructions"`
+	Order        int           `json:"order"`
+	Duration     int           `json:"duration"`
+	LockOnClose  bool          `json:"lock_on_close"`
+	Status       SectionStatus `json:"status,omitempty"`
+	QuestionIDs  []uint        `json:"question_ids,omitempty"`
+	TimeLeft     *int          `json:"time_left,omitempty"` // in seconds, only for the open section
+}
+
+func (s *ExamSection) ToResponse() ExamSectionResponse {
+	return ExamSectionResponse{
+		ID:           s.ID,
+		Title:        s.Title,
+		Instructions: s.Instructions,
+		Order:        s.Order,
+		Duration:     s.Duration,
+		LockOnClose:  s.LockOnClose,
+	}
+}
+
+// SectionScore is the subscore of one section in a result
+type SectionScore struct {
+	SectionID uint    `json:"section_id"`
+	Title     string  `json:"title"`
+	Points    float64 `json:"points"`
+	MaxPoints int     `json:"max_points"`
+	Score     float64 `json:"score"` // percentage
+}
+
+type SectionScores []SectionScore
+
+func (s SectionScores) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *SectionScores) Scan(value interface{}) error {
+	if value == nil {
+		*s = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, s)
+}
+
+// SectionIDs lists the sections of an exam in the order an attempt took them
+type SectionIDs []uint
+
+func (s SectionIDs) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *SectionIDs) Scan(value interface{}) error {
+	if value == nil {
+		*s = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, s)
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type GrantExtraTimeRequest struct {
+	UserID  uint `json:"user_id" binding:"required"`
+	Minutes int  `json:"minutes" binding:"required,min=1,max=600"`
+}
+
+// GrantExtraTime gives a running attempt more time. The grant only applies to the
+// current attempt and may run past the end of the candidate's window.
+func (s *ExamService) GrantExtraTime(examID uint, req GrantExtraTimeRequest) (*models.UserExamResponse, error) {
+	var userExam models.UserExam
+	if err := s.db.Preload("Exam").Where("user_id = ? AND exam_id = ?", req.UserID, examID).First(&userExam).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("exam not assigned to user")
+		}
+		s.logger.WithError(err).Error("Failed to get user exam")
+		return nil, fmt.Errorf("failed to grant extra time")
+	}
+
+	if userExam.Status != models.UserExamStarted || userExam.CurrentAttemptID == nil {
+		return nil, fmt.Errorf("exam is not in progress")
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Conditional so the grant can't land on an attempt that has just been submitted
+		update := tx.Model(&models.UserExam{}).
+			Where("id = ? AND status = ? AND current_attempt_id = ?", userExam.ID, models.UserExamStarted, *userExam.CurrentAttemptID).
+			Update("granted_minutes", gorm.Expr("granted_minutes + ?", req.Minutes))
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errAttemptAlreadyClosed
+		}
+
+		return tx.Model(&models.ExamAttempt{}).
+			Where("id = ?", *userExam.CurrentAttemptID).
+			Update("granted_minutes", gorm.Expr("granted_minutes + ?", req.Minutes)).Error
+	})
+	if err == errAttemptAlreadyClosed {
+		return nil, fmt.Errorf("exam is not in progress")
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to grant extra time")
+		return nil, fmt.Errorf("failed to grant extra time")
+	}
+
+	userExam.GrantedMinutes += req.Minutes
+	s.storeExamSession(&userExam, &userExam.Exam)
+
+	s.logger.WithFields(logrus.Fields{
+		"exam_id":         examID,
+		"user_id":         req.UserID,
+		"minutes":         req.Minutes,
+		"granted_minutes": userExam.GrantedMinutes,
+	}).Info("Extra time granted")
+
+	return s.convertUserExamToResponse(&userExam, &userExam.Exam), nil
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// An adaptive exam is a computerized adaptive test. Its questions are a pool the
+// candidate is given one at a time through the linear endpoints: each next
+// question is the one most informative at the candidate's ability as estimated
+// from their answers so far, and the test stops once the estimate is precise
+// enough, the item limit is reached or the pool runs out. Every question handed
+// out is recorded as an AttemptQuestion, so only those are graded, and the final
+// ability estimate is stored on the result.
+
+// AdaptiveStop is why an adaptive test stopped
+type AdaptiveStop string
+
+const (
+	AdaptiveStopMaxItems      AdaptiveStop = "max_items"      // the exam's item limit was reached
+	AdaptiveStopTargetSE      AdaptiveStop = "target_se"      // the ability's standard error fell to the exam's target
+	AdaptiveStopPoolExhausted AdaptiveStop = "pool_exhausted" // every question of the pool was given
+)
+
+// AdaptiveStopRule reports why an adaptive test with the given item limit and
+// standard error target stops after administering some questions, with some
+// left in the pool, at the ability estimate; empty when it goes on. A zero limit
+// or target switches that rule off.
+func AdaptiveStopRule(maxItems int, targetSE float64, administered, remaining int, estimate AbilityEstimate) AdaptiveStop {
+	switch {
+	case maxItems > 0 && administered >= maxItems:
+		return AdaptiveStopMaxItems
+	case targetSE > 0 && administered > 0 && estimate.SE <= targetSE:
+		return AdaptiveStopTargetSE
+	case remaining == 0:
+		return AdaptiveStopPoolExhausted
+	}
+	return ""
+}
+
+// nextAdaptiveItem picks the pool question most informative at the ability among
+// those not administered yet, and reports how many were left to pick from
+func nextAdaptiveItem(pool []models.ExamQuestion, administered []models.ExamQuestion, ability float64) (*models.ExamQuestion, int) {
+	given := make([]uint, len(administered))
+	for i, eq := range administered {
+		given[i] = eq.QuestionID
+	}
+
+	candidates := []*models.ExamQuestion{}
+	parameters := []models.ItemParameters{}
+	for i := range pool {
+		if containsID(given, pool[i].QuestionID) || pool[i].Question.Type == models.Essay {
+			continue
+		}
+		candidates = append(candidates, &pool[i])
+		parameters = append(parameters, pool[i].Question.ItemParameters())
+	}
+
+	best := SelectItem(parameters, ability)
+	if best < 0 {
+		return nil, 0
+	}
+	return candidates[best], len(candidates)
+}
+
+// adaptiveAttemptQuestion records a pool question as the attempt's question at
+// the given 1-based position
+func adaptiveAttemptQuestion(eq *models.ExamQuestion, order int) models.AttemptQuestion {
+	return models.AttemptQuestion{
+		QuestionID: eq.QuestionID,
+		Revision:   eq.Revision,
+		Order:      order,
+		Points:     eq.Points,
+		Question:   eq.Question,
+	}
+}
+
+// estimateAbility estimates a candidate's ability from their graded answers to
+// the questions, each scored right or wrong
+func estimateAbility(examQuestions []models.ExamQuestion, answers []models.Answer) AbilityEstimate {
+	parameters := make(map[uint]models.ItemParameters, len(examQuestions))
+	for _, eq := range examQuestions {
+		parameters[eq.QuestionID] = eq.Question.ItemParameters()
+	}
+
+	responses := []ItemResponse{}
+	for _, answer := range answers {
+		if item, ok := parameters[answer.QuestionID]; ok {
+			responses = append(responses, ItemResponse{Parameters: item, Correct: answer.IsCorrect})
+		}
+	}
+	return EstimateAbility(responses)
+}
+
+// checkAdaptiveSettings makes sure an adaptive exam picks from a fixed list of
+// questions that can be scored the moment they are answered
+func (s *ExamService) checkAdaptiveSettings(adaptive bool, questions []ExamQuestionRequest, blueprint []BlueprintSectionRequest, sections []ExamSectionRequest) error {
+	if !adaptive {
+		return nil
+	}
+	if len(blueprint) > 0 {
+		return fmt.Errorf("invalid adaptive settings: adaptive exams pick from their own questions, not a blueprint")
+	}
+	if len(sections) > 0 {
+		return fmt.Errorf("invalid adaptive settings: adaptive exams cannot be split into sections")
+	}
+
+	questionIDs := make([]uint, len(questions))
+	for i, q := range questions {
+		questionIDs[i] = q.QuestionID
+	}
+	var essays int64
+	if err := s.db.Model(&models.Question{}).Where("id IN ? AND type = ?", questionIDs, models.Essay).Count(&essays).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to check adaptive questions")
+		return fmt.Errorf("failed to validate questions")
+	}
+	if essays > 0 {
+		return fmt.Errorf("invalid adaptive settings: essay questions cannot be scored as they are answered")
+	}
+	return nil
+}
+
+// adaptivePool loads the questions an adaptive exam picks from, at the revisions
+// the exam pins
+func (s *ExamService) adaptivePool(examID uint) ([]models.ExamQuestion, error) {
+	var pool []models.ExamQuestion
+	if err := s.db.Preload("Question").Where("exam_id = ?", examID).Order("\"order\"").Find(&pool).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get adaptive question pool")
+		return nil, err
+	}
+	if err := applyPinnedRevisions(s.db, pool); err != nil {
+		s.logger.WithError(err).Error("Failed to get question revisions")
+		return nil, err
+	}
+	return pool, nil
+}
+
+// attemptAbility estimates the candidate's ability from the answers recorded for
+// the questions administered so far; questions closed without an answer count
+// as wrong
+func (s *ExamService) attemptAbility(userExam *models.UserExam, administered []models.ExamQuestion) (AbilityEstimate, error) {
+	saved, err := s.loadSavedAnswers(userExam)
+	if err != nil {
+		return AbilityEstimate{}, err
+	}
+	submitted := make(map[uint]SubmitAnswerRequest, len(saved))
+	for _, answer := range saved {
+		submitted[answer.QuestionID] = answer
+	}
+
+	answers := make([]models.Answer, 0, len(administered))
+	for _, eq := range administered {
+		request, ok := submitted[eq.QuestionID]
+		if !ok {
+			request = SubmitAnswerRequest{QuestionID: eq.QuestionID}
+		}
+		answer, err := GradeSubmission(&eq.Question, eq.Points, request)
+		if err != nil {
+			return AbilityEstimate{}, err
+		}
+		answers = append(answers, answer)
+	}
+
+	return estimateAbility(administered, answers), nil
+}
+
+// advanceAdaptiveTest hands out the next question of an adaptive attempt once
+// the candidate is past every question given so far, appending it to
+// exam.ExamQuestions. It returns why the test stopped, if it did, and how many
+// questions it runs to.
+func (s *ExamService) advanceAdaptiveTest(userExam *models.UserExam, exam *models.Exam, attempt *models.ExamAttempt, index int) (AdaptiveStop, int, error) {
+	pool, err := s.adaptivePool(exam.ID)
+	if err != nil {
+		return "", 0, err
+	}
+	length := len(pool)
+	if exam.AdaptiveMaxItems > 0 && exam.AdaptiveMaxItems < length {
+		length = exam.AdaptiveMaxItems
+	}
+
+	administered := len(exam.ExamQuestions)
+	if index < administered {
+		return "", length, nil
+	}
+
+	estimate, err := s.attemptAbility(userExam, exam.ExamQuestions)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to estimate ability")
+		return "", 0, err
+	}
+	next, remaining := nextAdaptiveItem(pool, exam.ExamQuestions, estimate.Ability)
+	if stop := AdaptiveStopRule(exam.AdaptiveMaxItems, exam.AdaptiveTargetSE, administered, remaining, estimate); stop != "" {
+		return stop, administered, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Locked so two requests racing past the same answer hand out one question
+		var locked models.ExamAttempt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", attempt.ID).First(&locked).Error; err != nil {
+			return err
+		}
+
+		var given int64
+		if err := tx.Model(&models.AttemptQuestion{}).Where("exam_attempt_id = ?", attempt.ID).Count(&given).Error; err != nil {
+			return err
+		}
+		if int(given) != administered {
+			return nil
+		}
+
+		item := adaptiveAttemptQuestion(next, administered+1)
+		item.ExamAttemptID = attempt.ID
+		return tx.Omit("Question").Create(&item).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to record adaptive question")
+		return "", 0, err
+	}
+
+	// Read the attempt's questions back so the new one is presented like the rest
+	if err := s.presentExamQuestions(exam, userExam); err != nil {
+		return "", 0, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_exam_id": userExam.ID,
+		"question_id":  next.QuestionID,
+		"position":     administered + 1,
+		"ability":      estimate.Ability,
+		"ability_se":   estimate.SE,
+	}).Info("Adaptive question selected")
+
+	return "", length, nil
+}
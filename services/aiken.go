@@ -0,0 +1,79 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Aiken files hold single-answer multiple-choice questions: the question text,
+// one option per line labelled "A." or "A)", then an "ANSWER: B" line. Blank
+// lines between questions are ignored.
+
+var (
+	aikenOption = regexp.MustCompile(`^([A-Za-z])[.)]\s+(.*)$`)
+	aikenAnswer = regexp.MustCompile(`^(?i:answer):\s*([A-Za-z])\s*$`)
+)
+
+// parseAiken reads the questions of an Aiken file
+func parseAiken(r io.Reader) ([]importedQuestion, error) {
+	scanner := newLineScanner(r)
+	questions := []importedQuestion{}
+	var current *importedQuestion
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if text == "" {
+			continue
+		}
+
+		if current == nil {
+			current = &importedQuestion{Line: line}
+			current.Request.Type = models.MultipleChoice
+			current.Request.Content = text
+			continue
+		}
+		req := &current.Request
+
+		if match := aikenAnswer.FindStringSubmatch(text); match != nil {
+			if current.Err == nil {
+				current.Err = markCorrectOptions(req.Options, match[1])
+			}
+			req.Title = importTitle("", req.Content)
+			questions = append(questions, *current)
+			current = nil
+			continue
+		}
+
+		if match := aikenOption.FindStringSubmatch(text); match != nil {
+			id := strings.ToLower(match[1])
+			if id != importOptionID(len(req.Options)) && current.Err == nil {
+				current.Err = fmt.Errorf("line %d: expected option %s", line, strings.ToUpper(importOptionID(len(req.Options))))
+			}
+			req.Options = append(req.Options, models.Option{ID: id, Text: strings.TrimSpace(match[2])})
+			continue
+		}
+
+		// Until the first option, further lines continue the question text
+		if len(req.Options) == 0 {
+			req.Content += "\n" + text
+		} else if current.Err == nil {
+			current.Err = fmt.Errorf("line %d: expected an option or the ANSWER line", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid import file: %v", err)
+	}
+
+	if current != nil {
+		current.Request.Title = importTitle("", current.Request.Content)
+		current.Err = fmt.Errorf("question has no ANSWER line")
+		questions = append(questions, *current)
+	}
+	return questions, nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+)
+
+// Ordering and matching questions are graded item by item: an ordering item is
+// right when it sits at its authored position, a matching option when it is paired
+// with its MatchID. The answer is correct when every item is right; the exam's
+// partial_credit policy awards a share per right item.
+
+// GradeOrderingAnswer grades the order a candidate put the items of an ordering
+// question in. The order may be incomplete while an attempt is in progress; items
+// left out count as missed. Unknown or repeated items are rejected.
+func GradeOrderingAnswer(question *models.Question, points int, order []string) (models.Answer, error) {
+	answer := models.Answer{
+		QuestionID:      question.ID,
+		SelectedOptions: []string{},
+		IsCorrect:       false,
+		Points:          0,
+		MaxPoints:       points,
+	}
+
+	seen := make(map[string]bool)
+	for _, optionID := range order {
+		if !question.HasOption(optionID) {
+			return answer, fmt.Errorf("invalid option %q for question %d", optionID, question.ID)
+		}
+		if seen[optionID] {
+			return answer, fmt.Errorf("invalid answer for question %d: item %q is placed twice", question.ID, optionID)
+		}
+		seen[optionID] = true
+	}
+	answer.SelectedOptions = append(answer.SelectedOptions, order...)
+
+	correctOrder := make([]string, len(question.Options))
+	for i, opt := range question.Options {
+		correctOrder[i] = opt.ID
+	}
+
+	breakdown := &models.GradingBreakdown{
+		Rule:           models.GradingOrdering,
+		Answered:       len(order) > 0,
+		CorrectOptions: correctOrder,
+	}
+	answer.Grading = breakdown
+
+	for i, optionID := range order {
+		if correctOrder[i] == optionID {
+			breakdown.CorrectSelected++
+		} else {
+			breakdown.WrongSelected++
+		}
+	}
+	breakdown.MissedOptions = len(correctOrder) - len(order)
+
+	if !breakdown.Answered {
+		return answer, nil
+	}
+
+	answer.IsCorrect = breakdown.CorrectSelected == len(correctOrder)
+	if answer.IsCorrect {
+		answer.Points = float64(points)
+		breakdown.Credit = 1
+	}
+
+	return answer, nil
+}
+
+// GradeMatchingAnswer grades the pairs of a matching question, keyed by option ID
+// with the ID of the chosen right-hand choice. Options left unpaired count as
+// missed; a choice may be used for more than one option.
+func GradeMatchingAnswer(question *models.Question, points int, matches map[string]string) (models.Answer, error) {
+	answer := models.Answer{
+		QuestionID:      question.ID,
+		SelectedOptions: []string{},
+		IsCorrect:       false,
+		Points:          0,
+		MaxPoints:       points,
+	}
+
+	choices := make(map[string]bool, len(question.MatchChoices))
+	for _, choice := range question.MatchChoices {
+		choices[choice.ID] = true
+	}
+
+	pairs := make(map[string]string, len(matches))
+	for optionID, choiceID := range matches {
+		if !question.HasOption(optionID) {
+			return answer, fmt.Errorf("invalid option %q for question %d", optionID, question.ID)
+		}
+		if choiceID == "" {
+			continue
+		}
+		if !choices[choiceID] {
+			return answer, fmt.Errorf("invalid option %q for question %d", choiceID, question.ID)
+		}
+		pairs[optionID] = choiceID
+	}
+	answer.Matches = pairs
+
+	correctMatches := make(map[string]string, len(question.Options))
+	for _, opt := range question.Options {
+		correctMatches[opt.ID] = opt.MatchID
+	}
+
+	breakdown := &models.GradingBreakdown{
+		Rule:           models.GradingMatching,
+		Answered:       len(pairs) > 0,
+		CorrectOptions: []string{},
+		CorrectMatches: correctMatches,
+	}
+	answer.Grading = breakdown
+
+	for optionID, choiceID := range pairs {
+		if correctMatches[optionID] == choiceID {
+			breakdown.CorrectSelected++
+		} else {
+			breakdown.WrongSelected++
+		}
+	}
+	breakdown.MissedOptions = len(question.Options) - len(pairs)
+
+	if !breakdown.Answered {
+		return answer, nil
+	}
+
+	answer.IsCorrect = breakdown.CorrectSelected == len(question.Options)
+	if answer.IsCorrect {
+		answer.Points = float64(points)
+		breakdown.Credit = 1
+	}
+
+	return answer, nil
+}
+
+// isPerItemRule reports whether a grading rule scores each item of an answer on
+// its own, so that a wrong item only loses its own share under partial credit
+func isPerItemRule(rule models.GradingRule) bool {
+	switch rule {
+	case models.GradingTextMatch, models.GradingOrdering, models.GradingMatching:
+		return true
+	}
+	return false
+}
+
+// validateArrangement checks the items of an ordering or matching question
+func validateArrangement(question *models.Question) error {
+	if len(question.Options) < 2 {
+		return fmt.Errorf("question must have at least 2 options")
+	}
+	if err := checkItemList(question.Options, "option"); err != nil {
+		return err
+	}
+
+	if question.Type == models.Ordering {
+		if len(question.MatchChoices) > 0 {
+			return fmt.Errorf("invalid answer key: only matching questions take match choices")
+		}
+		return nil
+	}
+
+	if len(question.MatchChoices) < 2 {
+		return fmt.Errorf("invalid answer key: matching questions need at least 2 match choices")
+	}
+	if err := checkItemList(question.MatchChoices, "match choice"); err != nil {
+		return err
+	}
+
+	choices := make(map[string]bool, len(question.MatchChoices))
+	for _, choice := range question.MatchChoices {
+		choices[choice.ID] = true
+	}
+	for _, opt := range question.Options {
+		if !choices[opt.MatchID] {
+			return fmt.Errorf("invalid answer key: option %q must be matched to one of the match choices", opt.ID)
+		}
+	}
+
+	return nil
+}
+
+// checkItemList makes sure every item has an ID and text and that IDs are unique
+func checkItemList(items []models.Option, what string) error {
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if item.Text == "" {
+			return fmt.Errorf("%s text cannot be empty", what)
+		}
+		if item.ID == "" {
+			return fmt.Errorf("%s ID cannot be empty", what)
+		}
+		if seen[item.ID] {
+			return fmt.Errorf("invalid answer key: duplicate %s ID %q", what, item.ID)
+		}
+		seen[item.ID] = true
+	}
+	return nil
+}
@@ -15,7 +15,7 @@ import (
 
 type AuthService struct {
 	db          *gorm.DB
-	redisClient *utils.RedisClient
+	redisClient utils.RedisStore
 	logger      *logrus.Logger
 }
 
@@ -44,14 +44,14 @@ type RefreshTokenRequest struct {
 }
 
 type Claims struct {
-	UserID   uint             `json:"user_id"`
-	Email    string           `json:"email"`
-	Username string           `json:"username"`
-	Role     models.UserRole  `json:"role"`
+	UserID   uint            `json:"user_id"`
+	Email    string          `json:"email"`
+	Username string          `json:"username"`
+	Role     models.UserRole `json:"role"`
 	jwt.RegisteredClaims
 }
 
-func NewAuthService(db *gorm.DB, redisClient *utils.RedisClient, logger *logrus.Logger) *AuthService {
+func NewAuthService(db *gorm.DB, redisClient utils.RedisStore, logger *logrus.Logger) *AuthService {
 	return &AuthService{
 		db:          db,
 		redisClient: redisClient,
@@ -263,4 +263,3 @@ func (s *AuthService) generateTokens(user *models.User) (*TokenResponse, error)
 		TokenType:    "Bearer",
 	}, nil
 }
-
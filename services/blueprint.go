@@ -0,0 +1,276 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"math/rand"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type BlueprintSectionRequest struct {
+	Name          string                    `json:"name"`
+	QuestionCount int                       `json:"question_count" binding:"required,min=1"`
+	Tags          []string                  `json:"tags"`
+	Difficulty    models.QuestionDifficulty `json:"difficulty"`
+	Points        int                       `json:"points" binding:"min=1"`  // per question
+	Section       int                       `json:"section" binding:"min=0"` // 1-based position in the exam's sections
+}
+
+type BlueprintPreviewResponse struct {
+	ExamID      uint                       `json:"exam_id"`
+	Seed        int64                      `json:"seed"` // pass it back to reproduce the same draw
+	TotalPoints int                        `json:"total_points"`
+	Questions   []BlueprintPreviewQuestion `json:"questions"`
+}
+
+type BlueprintPreviewQuestion struct {
+	SectionID   *uint                   `json:"section_id"`
+	SectionName string                  `json:"section_name"`
+	Order       int                     `json:"order"`
+	Points      int                     `json:"points"`
+	Question    models.QuestionResponse `json:"question"`
+}
+
+// DrawBlueprint picks questions from the bank for every section of a blueprint.
+// A question is never used twice, even when sections overlap: slots are filled
+// with augmenting paths, so a draw only fails when no valid assignment exists.
+// Candidates are shuffled with rng first, so each seed gives its own draw.
+func DrawBlueprint(sections []models.ExamBlueprintSection, bank []models.Question, rng *rand.Rand) ([]models.AttemptQuestion, error) {
+	candidates := make([][]int, len(sections))
+	for i := range sections {
+		for j := range bank {
+			if sections[i].Matches(&bank[j]) {
+				candidates[i] = append(candidates[i], j)
+			}
+		}
+		rng.Shuffle(len(candidates[i]), func(a, b int) {
+			candidates[i][a], candidates[i][b] = candidates[i][b], candidates[i][a]
+		})
+
+		if len(candidates[i]) < sections[i].QuestionCount {
+			return nil, fmt.Errorf("blueprint cannot be satisfied: section %q needs %d questions but the bank only has %d matching",
+				sectionLabel(&sections[i], i), sections[i].QuestionCount, len(candidates[i]))
+		}
+	}
+
+	// One slot per question to draw, remembering which section it belongs to
+	var slotSection []int
+	for i := range sections {
+		for n := 0; n < sections[i].QuestionCount; n++ {
+			slotSection = append(slotSection, i)
+		}
+	}
+
+	slotQuestion := make([]int, len(slotSection))
+	questionSlot := make(map[int]int)
+
+	var assign func(slot int, visited map[int]bool) bool
+	assign = func(slot int, visited map[int]bool) bool {
+		for _, q := range candidates[slotSection[slot]] {
+			if visited[q] {
+				continue
+			}
+			visited[q] = true
+
+			owner, taken := questionSlot[q]
+			if !taken || assign(owner, visited) {
+				questionSlot[q] = slot
+				slotQuestion[slot] = q
+				return true
+			}
+		}
+		return false
+	}
+
+	for slot, section := range slotSection {
+		if !assign(slot, make(map[int]bool)) {
+			return nil, fmt.Errorf("blueprint cannot be satisfied: section %q needs %d questions that aren't already drawn for other sections",
+				sectionLabel(&sections[section], section), sections[section].QuestionCount)
+		}
+	}
+
+	drawn := make([]models.AttemptQuestion, len(slotSection))
+	for slot, section := range slotSection {
+		question := bank[slotQuestion[slot]]
+
+		var sectionID *uint
+		if sections[section].ID != 0 {
+			id := sections[section].ID
+			sectionID = &id
+		}
+
+		drawn[slot] = models.AttemptQuestion{
+			SectionID:     sectionID,
+			ExamSectionID: sections[section].ExamSectionID,
+			QuestionID:    question.ID,
+			Revision:      question.Revision,
+			Order:         slot + 1,
+			Points:        sections[section].Points,
+			Question:      question,
+		}
+	}
+
+	return drawn, nil
+}
+
+func sectionLabel(section *models.ExamBlueprintSection, index int) string {
+	if section.Name != "" {
+		return section.Name
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+// orderBlueprintSections is a preload scope that keeps sections in blueprint order
+func orderBlueprintSections(db *gorm.DB) *gorm.DB {
+	return db.Order("\"order\"")
+}
+
+// buildBlueprintSections validates blueprint sections from a request and returns
+// them with the exam's total points
+func buildBlueprintSections(requests []BlueprintSectionRequest) ([]models.ExamBlueprintSection, int, error) {
+	sections := make([]models.ExamBlueprintSection, len(requests))
+	totalPoints := 0
+
+	for i, req := range requests {
+		switch req.Difficulty {
+		case "", models.Easy, models.Medium, models.Hard:
+		default:
+			return nil, 0, fmt.Errorf("invalid blueprint: unknown difficulty %q in section %d", req.Difficulty, i+1)
+		}
+
+		points := req.Points
+		if points < 1 {
+			points = 1
+		}
+
+		tags := req.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+
+		sections[i] = models.ExamBlueprintSection{
+			Name:          req.Name,
+			Order:         i + 1,
+			QuestionCount: req.QuestionCount,
+			Tags:          models.StringArray(tags),
+			Difficulty:    req.Difficulty,
+			Points:        points,
+		}
+		totalPoints += req.QuestionCount * points
+	}
+
+	return sections, totalPoints, nil
+}
+
+// loadBlueprintBank loads the active questions that match at least one section
+func (s *ExamService) loadBlueprintBank(sections []models.ExamBlueprintSection) ([]models.Question, error) {
+	var bank []models.Question
+	seen := make(map[uint]bool)
+
+	for _, section := range sections {
+		query := s.db.Where("is_active = ?", true)
+		for _, tag := range section.Tags {
+			query = query.Where("tags @> ?", fmt.Sprintf(`["%s"]`, tag))
+		}
+		if section.Difficulty != "" {
+			query = query.Where("difficulty = ?", section.Difficulty)
+		}
+
+		var questions []models.Question
+		if err := query.Order("id").Find(&questions).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to load blueprint questions")
+			return nil, fmt.Errorf("failed to load question bank")
+		}
+
+		for _, question := range questions {
+			if !seen[question.ID] {
+				seen[question.ID] = true
+				bank = append(bank, question)
+			}
+		}
+	}
+
+	return bank, nil
+}
+
+// checkBlueprint makes sure the bank can currently satisfy the blueprint
+func (s *ExamService) checkBlueprint(sections []models.ExamBlueprintSection) error {
+	bank, err := s.loadBlueprintBank(sections)
+	if err != nil {
+		return err
+	}
+
+	_, err = DrawBlueprint(sections, bank, rand.New(rand.NewSource(0)))
+	return err
+}
+
+// drawAttemptQuestions draws a blueprint exam's questions for a new attempt
+func (s *ExamService) drawAttemptQuestions(exam *models.Exam, seed int64) ([]models.AttemptQuestion, error) {
+	bank, err := s.loadBlueprintBank(exam.BlueprintSections)
+	if err != nil {
+		return nil, err
+	}
+
+	return DrawBlueprint(exam.BlueprintSections, bank, rand.New(rand.NewSource(seed)))
+}
+
+// PreviewExamDraw produces a sample draw of a blueprint exam without starting an
+// attempt. Without a seed a random one is picked and returned.
+func (s *ExamService) PreviewExamDraw(examID uint, seed *int64) (*BlueprintPreviewResponse, error) {
+	var exam models.Exam
+	if err := s.db.Preload("BlueprintSections", orderBlueprintSections).Where("id = ?", examID).First(&exam).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("exam not found")
+		}
+		s.logger.WithError(err).Error("Failed to get exam")
+		return nil, fmt.Errorf("failed to preview exam")
+	}
+
+	if !exam.UsesBlueprint() {
+		return nil, fmt.Errorf("exam does not use a blueprint")
+	}
+
+	drawSeed := newAttemptSeed()
+	if seed != nil {
+		drawSeed = *seed
+	}
+
+	drawn, err := s.drawAttemptQuestions(&exam, drawSeed)
+	if err != nil {
+		return nil, err
+	}
+
+	sectionNames := make(map[uint]string)
+	for _, section := range exam.BlueprintSections {
+		sectionNames[section.ID] = section.Name
+	}
+
+	response := &BlueprintPreviewResponse{
+		ExamID:      exam.ID,
+		Seed:        drawSeed,
+		TotalPoints: exam.TotalPoints,
+		Questions:   make([]BlueprintPreviewQuestion, len(drawn)),
+	}
+	for i, aq := range drawn {
+		preview := BlueprintPreviewQuestion{
+			SectionID: aq.SectionID,
+			Order:     aq.Order,
+			Points:    aq.Points,
+			Question:  aq.Question.ToResponse(true),
+		}
+		if aq.SectionID != nil {
+			preview.SectionName = sectionNames[*aq.SectionID]
+		}
+		response.Questions[i] = preview
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"exam_id":   exam.ID,
+		"seed":      drawSeed,
+		"questions": len(drawn),
+	}).Info("Blueprint draw previewed")
+
+	return response, nil
+}
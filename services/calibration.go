@@ -0,0 +1,286 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Calibration fits item response theory parameters to the questions of an exam
+// from the graded answers given to them, in this exam and in every other exam
+// that used them. Each graded result is one candidate's response pattern, each
+// answer scored right or wrong. Only answers to a question's current revision
+// count, and answers to a dropped question don't count at all, as everyone got
+// credit for them. The parameters are stored on the questions, where adaptive
+// exams pick them up.
+
+type CalibrationRequest struct {
+	Model        models.IRTModel `json:"model"`                         // 1pl or 2pl, 2pl by default
+	MinResponses int             `json:"min_responses" binding:"min=0"` // answers a question needs to be calibrated, 30 by default
+	DryRun       bool            `json:"dry_run"`
+}
+
+type CalibratedItem struct {
+	QuestionID    uint                  `json:"question_id"`
+	QuestionTitle string                `json:"question_title"`
+	Responses     int                   `json:"responses"`
+	PValue        float64               `json:"p_value"`
+	Parameters    models.ItemParameters `json:"parameters"`
+}
+
+type SkippedItem struct {
+	QuestionID    uint   `json:"question_id"`
+	QuestionTitle string `json:"question_title"`
+	Responses     int    `json:"responses"`
+	Reason        string `json:"reason"`
+}
+
+type CalibrationReport struct {
+	ExamID        uint             `json:"exam_id"`
+	Model         models.IRTModel  `json:"model"`
+	DryRun        bool             `json:"dry_run"`
+	Candidates    int              `json:"candidates"` // response patterns the calibration used
+	Cycles        int              `json:"cycles"`
+	Converged     bool             `json:"converged"`
+	LogLikelihood float64          `json:"log_likelihood"`
+	Items         []CalibratedItem `json:"items"`
+	Skipped       []SkippedItem    `json:"skipped"`
+}
+
+// CalibrateExam calibrates the questions of an exam and, unless it is a dry run,
+// stores their parameters
+func (s *ResultService) CalibrateExam(examID uint, req CalibrationRequest) (*CalibrationReport, error) {
+	if req.Model == "" {
+		req.Model = DefaultCalibrationModel
+	}
+	if !req.Model.IsValid() {
+		return nil, fmt.Errorf("invalid calibration: unknown model %q", req.Model)
+	}
+	if req.MinResponses == 0 {
+		req.MinResponses = DefaultMinCalibrationResponses
+	}
+
+	var exam models.Exam
+	if err := s.db.Where("id = ?", examID).First(&exam).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("exam not found")
+		}
+		s.logger.WithError(err).Error("Failed to get exam")
+		return nil, fmt.Errorf("failed to calibrate questions")
+	}
+
+	questionIDs, err := questionsUsedByExam(s.db, examID)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get exam questions")
+		return nil, fmt.Errorf("failed to calibrate questions")
+	}
+	questions, err := s.loadQuestions(s.db, questionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calibrate questions")
+	}
+
+	examIDs := []uint{examID}
+	for _, questionID := range questionIDs {
+		using, err := examsUsingQuestion(s.db, questionID)
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to get exams using question")
+			return nil, fmt.Errorf("failed to calibrate questions")
+		}
+		for _, id := range using {
+			if !containsID(examIDs, id) {
+				examIDs = append(examIDs, id)
+			}
+		}
+	}
+
+	var results []models.Result
+	if err := s.db.Where("exam_id IN ? AND status = ?", examIDs, models.ResultGraded).Order("id").Find(&results).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get results")
+		return nil, fmt.Errorf("failed to calibrate questions")
+	}
+
+	// Score every result's answers to the questions, one map per candidate
+	scored := make([]map[uint]bool, 0, len(results))
+	for _, result := range results {
+		answers := make(map[uint]bool)
+		for _, answer := range result.Answers {
+			question, ok := questions[answer.QuestionID]
+			if !ok || !calibrationAnswer(&question, answer) {
+				continue
+			}
+			answers[answer.QuestionID] = answer.IsCorrect
+		}
+		if len(answers) > 0 {
+			scored = append(scored, answers)
+		}
+	}
+
+	report := &CalibrationReport{
+		ExamID:  examID,
+		Model:   req.Model,
+		DryRun:  req.DryRun,
+		Items:   []CalibratedItem{},
+		Skipped: []SkippedItem{},
+	}
+
+	// Questions need enough answers, and both right and wrong ones, to calibrate
+	calibrated := []uint{}
+	for _, questionID := range questionIDs {
+		question := questions[questionID]
+		responses, correct := 0, 0
+		for _, answers := range scored {
+			if isCorrect, ok := answers[questionID]; ok {
+				responses++
+				if isCorrect {
+					correct++
+				}
+			}
+		}
+
+		skipped := SkippedItem{QuestionID: questionID, QuestionTitle: question.Title, Responses: responses}
+		switch {
+		case question.Type == models.Essay:
+			skipped.Reason = "essay questions are not scored right or wrong"
+		case responses < req.MinResponses:
+			skipped.Reason = fmt.Sprintf("fewer than %d responses", req.MinResponses)
+		case correct == responses:
+			skipped.Reason = "every response was correct"
+		case correct == 0:
+			skipped.Reason = "no response was correct"
+		default:
+			calibrated = append(calibrated, questionID)
+			report.Items = append(report.Items, CalibratedItem{
+				QuestionID:    questionID,
+				QuestionTitle: question.Title,
+				Responses:     responses,
+				PValue:        roundStatistic(float64(correct) / float64(responses)),
+			})
+			continue
+		}
+		report.Skipped = append(report.Skipped, skipped)
+	}
+	if len(calibrated) == 0 {
+		return report, nil
+	}
+
+	patterns := []ResponsePattern{}
+	for _, answers := range scored {
+		pattern := make(ResponsePattern, len(calibrated))
+		given := false
+		for i, questionID := range calibrated {
+			pattern[i] = -1
+			if isCorrect, ok := answers[questionID]; ok {
+				pattern[i] = 0
+				if isCorrect {
+					pattern[i] = 1
+				}
+				given = true
+			}
+		}
+		if given {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	fit := CalibrateItems(patterns, len(calibrated), req.Model)
+	report.Candidates = len(patterns)
+	report.Cycles = fit.Cycles
+	report.Converged = fit.Converged
+	report.LogLikelihood = roundStatistic(fit.LogLikelihood)
+
+	now := time.Now()
+	for i := range report.Items {
+		parameters := fit.Items[i]
+		parameters.Discrimination = roundStatistic(parameters.Discrimination)
+		parameters.Difficulty = roundStatistic(parameters.Difficulty)
+		parameters.DiscriminationSE = roundOptional(parameters.DiscriminationSE)
+		parameters.DifficultySE = roundOptional(parameters.DifficultySE)
+		parameters.Revision = questions[report.Items[i].QuestionID].Revision
+		parameters.Responses = report.Items[i].Responses
+		parameters.CalibratedAt = now
+		report.Items[i].Parameters = parameters
+	}
+
+	if req.DryRun {
+		return report, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, item := range report.Items {
+			if err := tx.Model(&models.Question{}).Unscoped().Where("id = ?", item.QuestionID).UpdateColumn("irt", item.Parameters).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to store item parameters")
+		return nil, fmt.Errorf("failed to calibrate questions")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"exam_id":    examID,
+		"model":      req.Model,
+		"candidates": report.Candidates,
+		"calibrated": len(report.Items),
+		"skipped":    len(report.Skipped),
+		"converged":  report.Converged,
+	}).Info("Questions calibrated")
+
+	return report, nil
+}
+
+// calibrationAnswer reports whether an answer counts towards calibrating its
+// question: graded, given to the current revision, and not to a dropped question
+func calibrationAnswer(question *models.Question, answer models.Answer) bool {
+	if answer.PendingGrading {
+		return false
+	}
+	if answer.Adjustment != nil && answer.Adjustment.Mode == models.RegradeDropQuestion {
+		return false
+	}
+
+	revision := answer.Revision
+	if revision == 0 {
+		// Answers graded before questions were versioned were given to revision 1
+		revision = 1
+	}
+	return revision == question.Revision
+}
+
+// questionsUsedByExam returns the questions an exam lists and those drawn for its
+// attempts, in that order
+func questionsUsedByExam(db *gorm.DB, examID uint) ([]uint, error) {
+	var listed []uint
+	if err := db.Model(&models.ExamQuestion{}).Where("exam_id = ?", examID).Order("\"order\"").Pluck("question_id", &listed).Error; err != nil {
+		return nil, err
+	}
+
+	var drawn []uint
+	if err := db.Model(&models.AttemptQuestion{}).
+		Joins("JOIN exam_attempts ON exam_attempts.id = attempt_questions.exam_attempt_id").
+		Where("exam_attempts.exam_id = ?", examID).
+		Order("attempt_questions.id").
+		Pluck("attempt_questions.question_id", &drawn).Error; err != nil {
+		return nil, err
+	}
+
+	questionIDs := []uint{}
+	for _, questionID := range append(listed, drawn...) {
+		if !containsID(questionIDs, questionID) {
+			questionIDs = append(questionIDs, questionID)
+		}
+	}
+	return questionIDs, nil
+}
+
+func roundOptional(value *float64) *float64 {
+	if value == nil {
+		return nil
+	}
+	rounded := roundStatistic(*value)
+	return &rounded
+}
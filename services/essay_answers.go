@@ -0,0 +1,146 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxEssayLength caps an essay answer, in characters
+const maxEssayLength = 20000
+
+// Essays can't be graded automatically. A written essay is stored with no points
+// and marked pending, which keeps its result pending until a grader has scored
+// it with ScoreEssay and finalized the result. An essay left blank earns nothing
+// and needs no grader.
+
+type GradeEssayRequest struct {
+	Criteria []models.CriterionScore `json:"criteria"` // one per rubric criterion, for questions with a rubric
+	Points   *float64                `json:"points"`   // for questions without a rubric, out of the question's points in the exam
+	Comment  string                  `json:"comment"`
+}
+
+// GradeEssayAnswer records an essay answer for manual grading
+func GradeEssayAnswer(question *models.Question, points int, essay string) (models.Answer, error) {
+	answer := models.Answer{
+		QuestionID:      question.ID,
+		SelectedOptions: []string{},
+		IsCorrect:       false,
+		Points:          0,
+		MaxPoints:       points,
+	}
+
+	if utf8.RuneCountInString(essay) > maxEssayLength {
+		return answer, fmt.Errorf("invalid answer for question %d: essays are limited to %d characters", question.ID, maxEssayLength)
+	}
+	answer.Essay = essay
+
+	breakdown := &models.GradingBreakdown{
+		Rule:           models.GradingManual,
+		Answered:       strings.TrimSpace(essay) != "",
+		CorrectOptions: []string{},
+	}
+	answer.Grading = breakdown
+	answer.PendingGrading = breakdown.Answered
+
+	return answer, nil
+}
+
+// ScoreEssay applies a grader's marks to an essay answer. With a rubric every
+// criterion must be scored within its range and the total is scaled to the
+// answer's points; without one the grader gives the points directly.
+func ScoreEssay(rubric models.Rubric, answer *models.Answer, req GradeEssayRequest, graderID uint, now time.Time) error {
+	if answer.Grading == nil || answer.Grading.Rule != models.GradingManual {
+		return fmt.Errorf("invalid grade: question %d is not an essay question", answer.QuestionID)
+	}
+	if !answer.Grading.Answered {
+		return fmt.Errorf("invalid grade: question %d was left unanswered", answer.QuestionID)
+	}
+
+	credit := 0.0
+	if len(rubric) > 0 {
+		if req.Points != nil {
+			return fmt.Errorf("invalid grade: question %d is marked against its rubric, score each criterion", answer.QuestionID)
+		}
+
+		known := make(map[string]bool, len(rubric))
+		for _, criterion := range rubric {
+			known[criterion.ID] = true
+		}
+
+		scores := make(map[string]models.CriterionScore, len(req.Criteria))
+		for _, score := range req.Criteria {
+			if !known[score.CriterionID] {
+				return fmt.Errorf("invalid grade: unknown criterion %q", score.CriterionID)
+			}
+			if _, seen := scores[score.CriterionID]; seen {
+				return fmt.Errorf("invalid grade: criterion %q is scored twice", score.CriterionID)
+			}
+			scores[score.CriterionID] = score
+		}
+
+		total := 0.0
+		criteria := make([]models.CriterionScore, len(rubric))
+		for i, criterion := range rubric {
+			score, ok := scores[criterion.ID]
+			if !ok {
+				return fmt.Errorf("invalid grade: criterion %q is not scored", criterion.ID)
+			}
+			if math.IsNaN(score.Points) || score.Points < criterion.MinPoints || score.Points > criterion.MaxPoints {
+				return fmt.Errorf("invalid grade: criterion %q takes %g to %g points", criterion.ID, criterion.MinPoints, criterion.MaxPoints)
+			}
+			total += score.Points
+			criteria[i] = score
+		}
+
+		credit = total / rubric.MaxPoints()
+		answer.Grading.Manual = &models.ManualGrade{Criteria: criteria}
+	} else {
+		if len(req.Criteria) > 0 {
+			return fmt.Errorf("invalid grade: question %d has no rubric", answer.QuestionID)
+		}
+		if req.Points == nil || math.IsNaN(*req.Points) || *req.Points < 0 || *req.Points > float64(answer.MaxPoints) {
+			return fmt.Errorf("invalid grade: points must be between 0 and %d", answer.MaxPoints)
+		}
+
+		if answer.MaxPoints > 0 {
+			credit = *req.Points / float64(answer.MaxPoints)
+		}
+		answer.Grading.Manual = &models.ManualGrade{}
+	}
+
+	answer.Grading.Manual.GraderID = graderID
+	answer.Grading.Manual.GradedAt = now
+	answer.Grading.Manual.Comment = req.Comment
+	answer.Grading.Credit = credit
+	answer.Points = roundPoints(credit * float64(answer.MaxPoints))
+	answer.IsCorrect = credit == 1
+	answer.PendingGrading = false
+
+	return nil
+}
+
+// validateRubric checks the marking criteria of an essay question
+func validateRubric(rubric models.Rubric) error {
+	seen := make(map[string]bool, len(rubric))
+	for _, criterion := range rubric {
+		if criterion.ID == "" {
+			return fmt.Errorf("invalid answer key: rubric criterion ID cannot be empty")
+		}
+		if seen[criterion.ID] {
+			return fmt.Errorf("invalid answer key: duplicate rubric criterion %q", criterion.ID)
+		}
+		seen[criterion.ID] = true
+
+		if strings.TrimSpace(criterion.Title) == "" {
+			return fmt.Errorf("invalid answer key: rubric criterion %q needs a title", criterion.ID)
+		}
+		if criterion.MinPoints < 0 || criterion.MaxPoints <= criterion.MinPoints {
+			return fmt.Errorf("invalid answer key: rubric criterion %q needs 0 <= min_points < max_points", criterion.ID)
+		}
+	}
+	return nil
+}
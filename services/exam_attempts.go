@@ -0,0 +1,379 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AttemptListResponse struct {
+	ExamID          uint                         `json:"exam_id"`
+	UserID          uint                         `json:"user_id"`
+	Status          models.UserExamStatus        `json:"status"`
+	AttemptCount    int                          `json:"attempt_count"`
+	MaxAttempts     int                          `json:"max_attempts"`
+	KeepScore       models.KeepScorePolicy       `json:"keep_score"`
+	KeptScore       *float64                     `json:"kept_score"` // nil until an attempt has been completed, or while one awaits grading
+	Passed          *bool                        `json:"passed"`
+	AwaitingGrading bool                         `json:"awaiting_grading"`
+	NextAttemptAt   *time.Time                   `json:"next_attempt_at,omitempty"`
+	Attempts        []models.ExamAttemptResponse `json:"attempts"`
+}
+
+// startAttempt opens a new attempt for the assignment and points the UserExam at
+// it. The status update is conditional so two concurrent starts can't both win.
+// It holds a lock on the exam so an update can't replace the content the attempt
+// was drawn from; if one did so before the lock was taken, the start fails.
+func (s *ExamService) startAttempt(userExam *models.UserExam, exam *models.Exam, seed int64, drawn []models.AttemptQuestion, now time.Time) (*models.ExamAttempt, error) {
+	attempt := models.ExamAttempt{
+		UserExamID:       userExam.ID,
+		UserID:           userExam.UserID,
+		ExamID:           userExam.ExamID,
+		AttemptNumber:    userExam.AttemptCount + 1,
+		Status:           models.AttemptStarted,
+		Seed:             seed,
+		ShuffleQuestions: exam.ShuffleQuestions && !exam.AdaptiveMode, // adaptive questions come in the order they were picked
+		ShuffleOptions:   exam.ShuffleOptions,
+		LinearMode:       exam.LinearMode || exam.AdaptiveMode,
+		AdaptiveMode:     exam.AdaptiveMode,
+		StartedAt:        now,
+	}
+	if len(exam.Sections) > 0 {
+		attempt.SectionStartedAt = &now
+		attempt.SectionIDs = make(models.SectionIDs, len(exam.Sections))
+		for i, section := range exam.Sections {
+			attempt.SectionIDs[i] = section.ID
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Starts share the lock with each other, only UpdateExam takes it exclusively
+		var locked models.Exam
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("id", "updated_at").Where("id = ?", exam.ID).First(&locked).Error; err != nil {
+			return err
+		}
+		if !locked.UpdatedAt.Equal(exam.UpdatedAt) {
+			return errExamChanged
+		}
+
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+
+		// Record the attempt's questions so every later read sees the same ones
+		for i := range drawn {
+			drawn[i].ExamAttemptID = attempt.ID
+			if err := tx.Omit("Question").Create(&drawn[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		update := tx.Model(&models.UserExam{}).
+			Where("id = ? AND status = ? AND attempt_count = ?", userExam.ID, userExam.Status, userExam.AttemptCount).
+			Updates(map[string]interface{}{
+				"status":             models.UserExamStarted,
+				"started_at":         now,
+				"completed_at":       nil,
+				"attempt_count":      attempt.AttemptNumber,
+				"current_attempt_id": attempt.ID,
+				"granted_minutes":    0,
+			})
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errAttemptAlreadyClosed
+		}
+
+		return nil
+	})
+	if err == errAttemptAlreadyClosed {
+		return nil, fmt.Errorf("exam cannot be started")
+	}
+	if err == errExamChanged {
+		return nil, fmt.Errorf("exam changed while starting")
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to start exam attempt")
+		return nil, fmt.Errorf("failed to start exam")
+	}
+
+	userExam.Status = models.UserExamStarted
+	userExam.StartedAt = &now
+	userExam.CompletedAt = nil
+	userExam.AttemptCount = attempt.AttemptNumber
+	userExam.CurrentAttemptID = &attempt.ID
+	userExam.GrantedMinutes = 0
+
+	return &attempt, nil
+}
+
+// currentAttempt loads the attempt a user exam is on, or nil before the first start
+func (s *ExamService) currentAttempt(userExam *models.UserExam) (*models.ExamAttempt, error) {
+	if userExam.CurrentAttemptID == nil {
+		return nil, nil
+	}
+
+	var attempt models.ExamAttempt
+	if err := s.db.Where("id = ?", *userExam.CurrentAttemptID).First(&attempt).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get exam attempt")
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// GetAttempts lists every attempt a user has made at an exam, oldest first, with
+// the score kept under the exam's keep-score policy
+func (s *ExamService) GetAttempts(examID uint, userID uint) (*AttemptListResponse, error) {
+	var userExam models.UserExam
+	if err := s.db.Preload("Exam").Where("user_id = ? AND exam_id = ?", userID, examID).First(&userExam).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("exam not assigned to user")
+		}
+		s.logger.WithError(err).Error("Failed to get user exam")
+		return nil, fmt.Errorf("failed to get attempts")
+	}
+
+	var attempts []models.ExamAttempt
+	if err := s.db.Where("user_exam_id = ?", userExam.ID).Order("attempt_number").Find(&attempts).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get exam attempts")
+		return nil, fmt.Errorf("failed to get attempts")
+	}
+
+	var results []models.Result
+	if err := s.db.Where("user_exam_id = ?", userExam.ID).Find(&results).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get attempt results")
+		return nil, fmt.Errorf("failed to get attempts")
+	}
+
+	resultByAttempt := make(map[uint]*models.Result)
+	for i := range results {
+		if results[i].ExamAttemptID != nil {
+			resultByAttempt[*results[i].ExamAttemptID] = &results[i]
+		}
+	}
+
+	keepScore := userExam.Exam.KeepScore
+	if keepScore == "" {
+		keepScore = models.KeepBestScore
+	}
+
+	response := &AttemptListResponse{
+		ExamID:        examID,
+		UserID:        userID,
+		Status:        userExam.Status,
+		AttemptCount:  userExam.AttemptCount,
+		MaxAttempts:   userExam.MaxAttempts,
+		KeepScore:     keepScore,
+		NextAttemptAt: userExam.NextAttemptAt(&userExam.Exam),
+		Attempts:      make([]models.ExamAttemptResponse, len(attempts)),
+	}
+
+	scores := []float64{}
+	for i := range attempts {
+		result := resultByAttempt[attempts[i].ID]
+		if result != nil {
+			scores = append(scores, result.Score)
+			if result.AwaitingGrading() {
+				response.AwaitingGrading = true
+			}
+		}
+		response.Attempts[i] = attempts[i].ToResponse(result)
+	}
+
+	// Any attempt could still become the kept one once its essays are marked
+	if kept, ok := KeptScore(keepScore, scores); ok && !response.AwaitingGrading {
+		passed := kept >= float64(userExam.Exam.PassScore)
+		response.KeptScore = &kept
+		response.Passed = &passed
+	}
+
+	return response, nil
+}
+
+// KeptScore picks the score that counts for an assignment from the scores of its
+// completed attempts, given in attempt order. It returns false if there are none.
+func KeptScore(policy models.KeepScorePolicy, scores []float64) (float64, bool) {
+	if len(scores) == 0 {
+		return 0, false
+	}
+
+	switch policy {
+	case models.KeepLastScore:
+		return scores[len(scores)-1], true
+	case models.KeepAverageScore:
+		total := 0.0
+		for _, score := range scores {
+			total += score
+		}
+		return roundPoints(total / float64(len(scores))), true
+	default:
+		best := scores[0]
+		for _, score := range scores[1:] {
+			if score > best {
+				best = score
+			}
+		}
+		return best, true
+	}
+}
+
+type AttemptPermutationResponse struct {
+	AttemptID        uint                `json:"attempt_id"`
+	ExamID           uint                `json:"exam_id"`
+	UserID           uint                `json:"user_id"`
+	AttemptNumber    int                 `json:"attempt_number"`
+	Seed             int64               `json:"seed"`
+	ShuffleQuestions bool                `json:"shuffle_questions"`
+	ShuffleOptions   bool                `json:"shuffle_options"`
+	Questions        []PresentedQuestion `json:"questions"`
+}
+
+// PresentedQuestion is one question as it appeared to the candidate
+type PresentedQuestion struct {
+	Position    int      `json:"position"` // 1-based position shown to the candidate
+	QuestionID  uint     `json:"question_id"`
+	Order       int      `json:"order"` // authoring order on the exam
+	OptionOrder []string `json:"option_order"`
+}
+
+// presentExamQuestions replaces exam.ExamQuestions with the questions of the user's
+// current attempt in the order the candidate sees them. Attempts from before
+// shuffling existed keep authoring order.
+func (s *ExamService) presentExamQuestions(exam *models.Exam, userExam *models.UserExam) error {
+	if userExam.CurrentAttemptID == nil {
+		if err := applyPinnedRevisions(s.db, exam.ExamQuestions); err != nil {
+			s.logger.WithError(err).Error("Failed to get question revisions")
+			return err
+		}
+		exam.ExamQuestions = ShuffleExamQuestions(exam.ExamQuestions, exam.Sections, 0, false, false)
+		return nil
+	}
+
+	var attempt models.ExamAttempt
+	if err := s.db.Where("id = ?", *userExam.CurrentAttemptID).First(&attempt).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get exam attempt")
+		return err
+	}
+
+	questions, err := s.attemptExamQuestions(exam, &attempt)
+	if err != nil {
+		return err
+	}
+
+	exam.ExamQuestions = ShuffleExamQuestions(questions, exam.Sections, attempt.Seed, attempt.ShuffleQuestions, attempt.ShuffleOptions)
+	return nil
+}
+
+// attemptExamQuestions returns the questions an attempt was given, at the
+// revisions it was given them: the questions recorded when it started, or the
+// exam's current questions for attempts from before those were recorded
+func (s *ExamService) attemptExamQuestions(exam *models.Exam, attempt *models.ExamAttempt) ([]models.ExamQuestion, error) {
+	var drawn []models.AttemptQuestion
+	if err := s.db.Preload("Question", func(db *gorm.DB) *gorm.DB {
+		// Questions retired from the bank still belong to attempts that drew them
+		return db.Unscoped()
+	}).Where("exam_attempt_id = ?", attempt.ID).Order("\"order\"").Find(&drawn).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get attempt questions")
+		return nil, err
+	}
+
+	questions := exam.ExamQuestions
+	if len(drawn) > 0 {
+		questions = make([]models.ExamQuestion, len(drawn))
+		for i := range drawn {
+			questions[i] = drawn[i].ToExamQuestion(exam.ID)
+		}
+	}
+
+	if err := applyPinnedRevisions(s.db, questions); err != nil {
+		s.logger.WithError(err).Error("Failed to get question revisions")
+		return nil, err
+	}
+	return questions, nil
+}
+
+// attemptSections returns the sections an attempt was taken in, in order. Only
+// their IDs are known once the exam has been edited; attempts started before
+// they were recorded use the exam's current sections.
+func attemptSections(exam *models.Exam, attempt *models.ExamAttempt) []models.ExamSection {
+	if attempt.SectionIDs == nil {
+		return exam.Sections
+	}
+	sections := make([]models.ExamSection, len(attempt.SectionIDs))
+	for i, id := range attempt.SectionIDs {
+		sections[i] = models.ExamSection{ID: id, ExamID: exam.ID, Order: i + 1}
+	}
+	return sections
+}
+
+// snapshotAttemptQuestions records a fixed exam's questions, at the revisions
+// they are presented in, as an attempt's own
+func snapshotAttemptQuestions(examQuestions []models.ExamQuestion) []models.AttemptQuestion {
+	snapshot := make([]models.AttemptQuestion, len(examQuestions))
+	for i, eq := range examQuestions {
+		snapshot[i] = models.AttemptQuestion{
+			ExamSectionID: eq.SectionID,
+			QuestionID:    eq.QuestionID,
+			Revision:      eq.Question.Revision,
+			Order:         eq.Order,
+			Points:        eq.Points,
+			Question:      eq.Question,
+		}
+	}
+	return snapshot
+}
+
+// GetAttemptPermutation rebuilds the exact question and option order a candidate
+// saw during an attempt
+func (s *ExamService) GetAttemptPermutation(examID uint, attemptID uint) (*AttemptPermutationResponse, error) {
+	var attempt models.ExamAttempt
+	if err := s.db.Where("id = ? AND exam_id = ?", attemptID, examID).First(&attempt).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("attempt not found")
+		}
+		s.logger.WithError(err).Error("Failed to get exam attempt")
+		return nil, fmt.Errorf("failed to get attempt permutation")
+	}
+
+	var exam models.Exam
+	if err := s.db.Unscoped().Preload("Sections", orderSections).Preload("ExamQuestions.Question").Where("id = ?", examID).First(&exam).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get exam")
+		return nil, fmt.Errorf("failed to get attempt permutation")
+	}
+
+	questions, err := s.attemptExamQuestions(&exam, &attempt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attempt permutation")
+	}
+	presented := ShuffleExamQuestions(questions, attemptSections(&exam, &attempt), attempt.Seed, attempt.ShuffleQuestions, attempt.ShuffleOptions)
+
+	response := &AttemptPermutationResponse{
+		AttemptID:        attempt.ID,
+		ExamID:           attempt.ExamID,
+		UserID:           attempt.UserID,
+		AttemptNumber:    attempt.AttemptNumber,
+		Seed:             attempt.Seed,
+		ShuffleQuestions: attempt.ShuffleQuestions,
+		ShuffleOptions:   attempt.ShuffleOptions,
+		Questions:        make([]PresentedQuestion, len(presented)),
+	}
+
+	for i, eq := range presented {
+		optionOrder := make([]string, len(eq.Question.Options))
+		for j, option := range eq.Question.Options {
+			optionOrder[j] = option.ID
+		}
+		response.Questions[i] = PresentedQuestion{
+			Position:    i + 1,
+			QuestionID:  eq.QuestionID,
+			Order:       eq.Order,
+			OptionOrder: optionOrder,
+		}
+	}
+
+	return response, nil
+}
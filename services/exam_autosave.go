@@ -0,0 +1,316 @@
+package services
+
+import (
+	"encoding/json"
+	"exam-system/config"
+	"exam-system/models"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Autosaved answers are written through to both Redis and Postgres. The
+// saved_answers table is the source of truth: the Redis hash may have lost some
+// or all of its entries to a restart or an eviction, so reads start from the
+// table and only let the hash's entries overlay it. A crashed browser or a Redis
+// restart never loses answers.
+
+type SavedAnswersResponse struct {
+	Answers  []SubmitAnswerRequest `json:"answers"`
+	TimeLeft int                   `json:"time_left"` // in seconds
+}
+
+func autosaveKey(userID, examID uint) string {
+	return fmt.Sprintf("exam_answers:%d:%d", userID, examID)
+}
+
+// SaveAnswer stores or replaces a single answer for the user's in-progress attempt
+func (s *ExamService) SaveAnswer(examID uint, userID uint, req SubmitAnswerRequest) (*models.SavedAnswer, error) {
+	userExam, exam, err := s.getActiveAttempt(examID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Linear attempts only take answers through the current-question endpoint
+	linear, err := s.inLinearMode(userExam)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save answer")
+	}
+	if linear {
+		return nil, fmt.Errorf("exam is in linear mode")
+	}
+
+	var question *models.Question
+	for i := range exam.ExamQuestions {
+		if exam.ExamQuestions[i].QuestionID == req.QuestionID {
+			question = &exam.ExamQuestions[i].Question
+			break
+		}
+	}
+	if question == nil {
+		return nil, fmt.Errorf("question is not part of this exam")
+	}
+
+	progress, err := s.loadSectionProgress(exam, userExam, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to save answer")
+	}
+	if progress != nil {
+		if err := progress.checkAnswerable(req.QuestionID, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	answer, err := ValidateResponse(question, req)
+	if err != nil {
+		return nil, err
+	}
+
+	saved := models.SavedAnswer{
+		UserExamID:      userExam.ID,
+		QuestionID:      req.QuestionID,
+		SelectedOptions: models.StringArray(answer.SelectedOptions),
+		TextAnswers:     models.StringArray(answer.TextAnswers),
+		NumericAnswer:   answer.NumericAnswer,
+		Matches:         models.StringMap(answer.Matches),
+		Essay:           answer.Essay,
+		TimeSpent:       req.TimeSpent,
+	}
+
+	// Postgres holds the durable copy
+	if err := storeSavedAnswer(s.db, &saved); err != nil {
+		s.logger.WithError(err).Error("Failed to save answer")
+		return nil, fmt.Errorf("failed to save answer")
+	}
+	s.cacheSavedAnswer(userExam, exam, &saved)
+
+	return &saved, nil
+}
+
+// storeSavedAnswer inserts or replaces the durable copy of an autosaved answer
+func storeSavedAnswer(db *gorm.DB, saved *models.SavedAnswer) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_exam_id"}, {Name: "question_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"selected_options", "text_answers", "numeric_answer", "matches", "essay", "time_spent", "updated_at"}),
+	}).Create(saved).Error
+}
+
+// cacheSavedAnswer writes an answer to the Redis fast path. If Redis can't be
+// updated the key is dropped so reads fall back to Postgres instead of serving a
+// stale answer.
+func (s *ExamService) cacheSavedAnswer(userExam *models.UserExam, exam *models.Exam, saved *models.SavedAnswer) {
+	key := autosaveKey(userExam.UserID, userExam.ExamID)
+	cached := SubmitAnswerRequest{
+		QuestionID:      saved.QuestionID,
+		SelectedOptions: []string(saved.SelectedOptions),
+		TextAnswers:     []string(saved.TextAnswers),
+		NumericAnswer:   saved.NumericAnswer,
+		Matches:         saved.Matches,
+		Essay:           saved.Essay,
+		TimeSpent:       saved.TimeSpent,
+	}
+	if err := s.redisClient.HSetJSON(key, strconv.FormatUint(uint64(saved.QuestionID), 10), cached); err != nil {
+		s.logger.WithError(err).Warn("Failed to cache saved answer in Redis")
+		s.redisClient.Del(key)
+		return
+	}
+
+	ttl := time.Until(*userExam.Deadline(exam)) + config.AppConfig.Exam.GracePeriod + time.Hour
+	s.redisClient.Expire(key, ttl)
+}
+
+// GetSavedAnswers returns the answers autosaved so far for the user's in-progress attempt
+func (s *ExamService) GetSavedAnswers(examID uint, userID uint) (*SavedAnswersResponse, error) {
+	userExam, exam, err := s.getActiveAttempt(examID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	answers, err := s.loadSavedAnswers(userExam)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved answers")
+	}
+
+	return &SavedAnswersResponse{
+		Answers:  answers,
+		TimeLeft: timeLeft(userExam, exam),
+	}, nil
+}
+
+// ResumeExam returns the in-progress attempt with its previously saved answers and
+// the real remaining time, without restarting the attempt
+func (s *ExamService) ResumeExam(examID uint, userID uint) (*StartExamResponse, error) {
+	userExam, exam, err := s.getActiveAttempt(examID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	answers, err := s.loadSavedAnswers(userExam)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resume exam")
+	}
+
+	questions := make([]models.QuestionResponse, len(exam.ExamQuestions))
+	for i, eq := range exam.ExamQuestions {
+		questions[i] = eq.Question.ToResponse(false)
+	}
+
+	response := &StartExamResponse{
+		UserExam:     *s.convertUserExamToResponse(userExam, exam),
+		Questions:    questions,
+		TimeLeft:     timeLeft(userExam, exam),
+		SavedAnswers: answers,
+	}
+	if err := s.presentSections(response, exam, userExam, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to resume exam")
+	}
+
+	attempt, err := s.currentAttempt(userExam)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resume exam")
+	}
+	if attempt != nil && attempt.LinearMode {
+		response.LinearMode = true
+		response.AdaptiveMode = attempt.AdaptiveMode
+		response.Questions = []models.QuestionResponse{}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"exam_id":       examID,
+		"user_id":       userID,
+		"saved_answers": len(answers),
+		"time_left":     response.TimeLeft,
+	}).Info("Exam resumed successfully")
+
+	return response, nil
+}
+
+// getActiveAttempt loads a started attempt that is still within its time limit,
+// together with the exam and the questions presented in that attempt
+func (s *ExamService) getActiveAttempt(examID uint, userID uint) (*models.UserExam, *models.Exam, error) {
+	var userExam models.UserExam
+	if err := s.db.Where("user_id = ? AND exam_id = ?", userID, examID).First(&userExam).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, fmt.Errorf("exam not assigned to user")
+		}
+		s.logger.WithError(err).Error("Failed to get user exam")
+		return nil, nil, fmt.Errorf("failed to get exam attempt")
+	}
+
+	if !userExam.CanSubmit() {
+		return nil, nil, fmt.Errorf("exam is not in progress")
+	}
+
+	var exam models.Exam
+	if err := s.db.Preload("Sections", orderSections).Preload("ExamQuestions.Question").Where("id = ?", examID).First(&exam).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get exam")
+		return nil, nil, fmt.Errorf("failed to get exam attempt")
+	}
+
+	deadline := userExam.Deadline(&exam)
+	if deadline != nil && time.Now().After(deadline.Add(config.AppConfig.Exam.GracePeriod)) {
+		return nil, nil, fmt.Errorf("exam time has expired")
+	}
+
+	// Use the attempt's own questions (blueprint draw) in the candidate's order
+	if err := s.presentExamQuestions(&exam, &userExam); err != nil {
+		return nil, nil, fmt.Errorf("failed to get exam attempt")
+	}
+
+	return &userExam, &exam, nil
+}
+
+// loadSavedAnswers reads the autosaved answers of an attempt from Postgres, with
+// the entries still cached in Redis laid over them
+func (s *ExamService) loadSavedAnswers(userExam *models.UserExam) ([]SubmitAnswerRequest, error) {
+	var saved []models.SavedAnswer
+	if err := s.db.Where("user_exam_id = ?", userExam.ID).Order("question_id").Find(&saved).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to load saved answers")
+		return nil, err
+	}
+
+	stored := make([]SubmitAnswerRequest, len(saved))
+	for i, answer := range saved {
+		stored[i] = SubmitAnswerRequest{
+			QuestionID:      answer.QuestionID,
+			SelectedOptions: []string(answer.SelectedOptions),
+			TextAnswers:     []string(answer.TextAnswers),
+			NumericAnswer:   answer.NumericAnswer,
+			Matches:         answer.Matches,
+			Essay:           answer.Essay,
+			TimeSpent:       answer.TimeSpent,
+		}
+	}
+
+	cached, err := s.redisClient.HGetAll(autosaveKey(userExam.UserID, userExam.ExamID))
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to read saved answers from Redis")
+		return stored, nil
+	}
+
+	overlay := []SubmitAnswerRequest{}
+	for _, value := range cached {
+		var answer SubmitAnswerRequest
+		if err := json.Unmarshal([]byte(value), &answer); err != nil {
+			continue
+		}
+		overlay = append(overlay, answer)
+	}
+
+	return mergeAnswers(stored, overlay), nil
+}
+
+// clearSavedAnswers removes the autosave copies once an attempt has been graded
+// or a fresh attempt begins
+func (s *ExamService) clearSavedAnswers(userExam *models.UserExam) {
+	s.redisClient.Del(autosaveKey(userExam.UserID, userExam.ExamID))
+
+	if err := s.db.Where("user_exam_id = ?", userExam.ID).Delete(&models.SavedAnswer{}).Error; err != nil {
+		s.logger.WithError(err).Warn("Failed to clear saved answers")
+	}
+}
+
+// mergeAnswers combines autosaved answers with a final submission; the submitted
+// answer wins when both cover the same question
+func mergeAnswers(saved []SubmitAnswerRequest, submitted []SubmitAnswerRequest) []SubmitAnswerRequest {
+	merged := make(map[uint]SubmitAnswerRequest)
+	for _, answer := range saved {
+		merged[answer.QuestionID] = answer
+	}
+	for _, answer := range submitted {
+		merged[answer.QuestionID] = answer
+	}
+
+	answers := make([]SubmitAnswerRequest, 0, len(merged))
+	for _, answer := range merged {
+		answers = append(answers, answer)
+	}
+	sortAnswers(answers)
+
+	return answers
+}
+
+func sortAnswers(answers []SubmitAnswerRequest) {
+	sort.Slice(answers, func(i, j int) bool {
+		return answers[i].QuestionID < answers[j].QuestionID
+	})
+}
+
+// timeLeft returns the seconds remaining before the attempt's deadline
+func timeLeft(userExam *models.UserExam, exam *models.Exam) int {
+	deadline := userExam.Deadline(exam)
+	if deadline == nil {
+		return 0
+	}
+
+	remaining := int(time.Until(*deadline).Seconds())
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining
+}
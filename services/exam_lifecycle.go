@@ -0,0 +1,229 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type ExamStatusRequest struct {
+	Status models.ExamStatus `json:"status" binding:"required"`
+}
+
+// CheckExamWindow reports why a candidate can't start an exam at now, if they
+// can't. A custom window on the assignment replaces the exam's.
+func CheckExamWindow(exam *models.Exam, userExam *models.UserExam, now time.Time) error {
+	if exam.Status != models.ExamActive || !exam.IsActive {
+		return fmt.Errorf("exam is not open")
+	}
+
+	startTime, endTime := exam.StartTime, exam.EndTime
+	if userExam != nil {
+		startTime, endTime = userExam.Window(exam)
+	}
+	if startTime != nil && now.Before(*startTime) {
+		return fmt.Errorf("exam has not opened yet")
+	}
+	if endTime != nil && !now.Before(*endTime) {
+		return fmt.Errorf("exam has closed")
+	}
+	return nil
+}
+
+// checkTransition validates a lifecycle move of an exam
+func checkTransition(exam *models.Exam, to models.ExamStatus) error {
+	if !to.IsValid() {
+		return fmt.Errorf("invalid exam status %q", to)
+	}
+	if !exam.Status.CanTransitionTo(to) {
+		return fmt.Errorf("invalid status transition from %s to %s", exam.Status, to)
+	}
+	if to == models.ExamScheduled && exam.StartTime == nil {
+		return fmt.Errorf("invalid schedule: exam needs a start time to be scheduled")
+	}
+	return nil
+}
+
+// checkSchedule validates the availability window of an exam request
+func checkSchedule(startTime, endTime *time.Time) error {
+	if startTime != nil && endTime != nil && !endTime.After(*startTime) {
+		return fmt.Errorf("invalid schedule: end time must be after start time")
+	}
+	return nil
+}
+
+// optionalTime treats a zero time from a request as unset
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// TransitionExam moves an exam to another lifecycle state. Closing an exam
+// auto-submits every attempt still in progress.
+func (s *ExamService) TransitionExam(examID uint, to models.ExamStatus) (*models.Exam, error) {
+	var exam models.Exam
+	if err := s.db.Where("id = ?", examID).First(&exam).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("exam not found")
+		}
+		s.logger.WithError(err).Error("Failed to find exam")
+		return nil, fmt.Errorf("failed to update exam status")
+	}
+
+	if err := checkTransition(&exam, to); err != nil {
+		return nil, err
+	}
+
+	from := exam.Status
+	if to == models.ExamClosed {
+		if err := s.closeExam(&exam, time.Now()); err != nil {
+			return nil, fmt.Errorf("failed to update exam status")
+		}
+	} else if err := s.setExamStatus(&exam, to); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"exam_id": exam.ID,
+		"from":    from,
+		"to":      to,
+	}).Info("Exam status changed")
+
+	return &exam, nil
+}
+
+// setExamStatus moves an exam out of its current state. The update is conditional
+// so a concurrent change (e.g. the scheduler) isn't silently overwritten.
+func (s *ExamService) setExamStatus(exam *models.Exam, to models.ExamStatus) error {
+	update := s.db.Model(&models.Exam{}).
+		Where("id = ? AND status = ?", exam.ID, exam.Status).
+		Update("status", to)
+	if update.Error != nil {
+		s.logger.WithError(update.Error).Error("Failed to update exam status")
+		return fmt.Errorf("failed to update exam status")
+	}
+	if update.RowsAffected == 0 {
+		return fmt.Errorf("exam status changed concurrently")
+	}
+
+	exam.Status = to
+	return nil
+}
+
+// ApplyExamSchedule opens scheduled exams whose start time (or the earliest custom
+// window of a candidate) has come and closes exams whose end time has passed, once
+// no candidate with a later window or extra time is still sitting them. It returns
+// how many exams were opened and closed.
+func (s *ExamService) ApplyExamSchedule(now time.Time) (int, int, error) {
+	earlyWindow := s.db.Model(&models.UserExam{}).Select("1").
+		Where("user_exams.exam_id = exams.id AND user_exams.window_start <= ?", now)
+	open := s.db.Model(&models.Exam{}).
+		Where("status = ? AND (start_time <= ? OR EXISTS (?)) AND (end_time IS NULL OR end_time > ?)", models.ExamScheduled, now, earlyWindow, now).
+		Update("status", models.ExamActive)
+	if open.Error != nil {
+		s.logger.WithError(open.Error).Error("Failed to open scheduled exams")
+		return 0, 0, fmt.Errorf("failed to apply exam schedule")
+	}
+
+	var ending []models.Exam
+	if err := s.db.Where("status IN ? AND end_time <= ?", []models.ExamStatus{models.ExamScheduled, models.ExamActive}, now).
+		Find(&ending).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get exams past their end time")
+		return int(open.RowsAffected), 0, fmt.Errorf("failed to apply exam schedule")
+	}
+
+	closed := 0
+	for i := range ending {
+		running, err := s.hasRunningAccommodations(&ending[i], now)
+		if err != nil {
+			continue
+		}
+		if running {
+			continue
+		}
+
+		if err := s.closeExam(&ending[i], now); err != nil {
+			s.logger.WithField("exam_id", ending[i].ID).WithError(err).Error("Failed to close exam")
+			continue
+		}
+		closed++
+	}
+
+	return int(open.RowsAffected), closed, nil
+}
+
+// hasRunningAccommodations reports whether a candidate can still sit an exam past
+// its end time, through a later custom window or an attempt with extra time
+func (s *ExamService) hasRunningAccommodations(exam *models.Exam, now time.Time) (bool, error) {
+	var userExams []models.UserExam
+	if err := s.db.Where("exam_id = ? AND status IN ?", exam.ID, []models.UserExamStatus{models.UserExamAssigned, models.UserExamStarted, models.UserExamCompleted}).
+		Find(&userExams).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get exam assignments")
+		return false, err
+	}
+
+	for i := range userExams {
+		userExam := &userExams[i]
+		if userExam.Status != models.UserExamStarted {
+			if userExam.WindowEnd != nil && now.Before(*userExam.WindowEnd) && userExam.CanStart() {
+				return true, nil
+			}
+			continue
+		}
+		if deadline := userExam.Deadline(exam); deadline != nil && now.Before(*deadline) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// closeExam marks an exam closed and ends everything still running in it:
+// in-progress attempts are auto-submitted as of closedAt (or their own earlier
+// deadline) and assignments that were never started expire.
+func (s *ExamService) closeExam(exam *models.Exam, closedAt time.Time) error {
+	if err := s.setExamStatus(exam, models.ExamClosed); err != nil {
+		return err
+	}
+
+	var userExams []models.UserExam
+	if err := s.db.Preload("Exam").Where("exam_id = ? AND status = ?", exam.ID, models.UserExamStarted).Find(&userExams).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get in-progress attempts")
+		return err
+	}
+
+	for i := range userExams {
+		userExam := &userExams[i]
+		endTime := closedAt
+		if deadline := userExam.Deadline(&userExam.Exam); deadline != nil && deadline.Before(endTime) {
+			endTime = *deadline
+		}
+
+		if err := s.autoSubmit(userExam, endTime); err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"user_exam_id": userExam.ID,
+				"exam_id":      exam.ID,
+				"user_id":      userExam.UserID,
+			}).WithError(err).Error("Failed to auto-submit attempt of closed exam")
+		}
+	}
+
+	if err := s.db.Model(&models.UserExam{}).
+		Where("exam_id = ? AND status = ?", exam.ID, models.UserExamAssigned).
+		Update("status", models.UserExamExpired).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to expire unstarted assignments")
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"exam_id":   exam.ID,
+		"closed_at": closedAt,
+		"attempts":  len(userExams),
+	}).Info("Exam closed")
+
+	return nil
+}
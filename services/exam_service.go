@@ -1,18 +1,30 @@
 package services
 
 import (
+	"errors"
+	"exam-system/config"
 	"exam-system/models"
 	"exam-system/utils"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// errAttemptAlreadyClosed is returned inside the submission transaction when
+// another request has already closed the attempt
+var errAttemptAlreadyClosed = errors.New("attempt already closed")
+
+// errExamChanged is returned inside the start transaction when the exam was
+// updated after its content was loaded for the attempt
+var errExamChanged = errors.New("exam changed")
+
 type ExamService struct {
 	db          *gorm.DB
-	redisClient *utils.RedisClient
+	redisClient utils.RedisStore
 	logger      *logrus.Logger
 }
 
@@ -23,13 +35,36 @@ type CreateExamRequest struct {
 	PassScore   int                   `json:"pass_score" binding:"min=0,max=100"`
 	StartTime   time.Time             `json:"start_time"`
 	EndTime     time.Time             `json:"end_time"`
-	Questions   []ExamQuestionRequest `json:"questions" binding:"required,min=1"`
+	Questions   []ExamQuestionRequest `json:"questions"`
+
+	ScoringPolicy     models.ScoringPolicy   `json:"scoring_policy"`
+	NegativeMarkRatio float64                `json:"negative_mark_ratio" binding:"min=0,max=1"`
+	LatePolicy        models.LatePolicy      `json:"late_policy"`
+	RetakeCooldown    int                    `json:"retake_cooldown" binding:"min=0"` // in minutes
+	KeepScore         models.KeepScorePolicy `json:"keep_score"`
+	ShuffleQuestions  bool                   `json:"shuffle_questions"`
+	ShuffleOptions    bool                   `json:"shuffle_options"`
+	LinearMode        bool                   `json:"linear_mode"` // one question at a time, timed by the server
+
+	// Adaptive exams give each candidate their own run through Questions, picked
+	// one at a time by the ability their answers show
+	AdaptiveMode     bool    `json:"adaptive_mode"`
+	AdaptiveMaxItems int     `json:"adaptive_max_items" binding:"min=0"` // 0 means the whole pool
+	AdaptiveTargetSE float64 `json:"adaptive_target_se" binding:"min=0"` // standard error to stop at, 0 means never
+
+	// Blueprint replaces Questions: each candidate gets their own draw from the bank
+	Blueprint []BlueprintSectionRequest `json:"blueprint" binding:"omitempty,dive"`
+
+	// Sections split the exam into timed parts taken in order
+	Sections []ExamSectionRequest `json:"sections" binding:"omitempty,dive"`
 }
 
 type ExamQuestionRequest struct {
 	QuestionID uint `json:"question_id" binding:"required"`
+	Revision   int  `json:"revision" binding:"min=0"` // revision to pin; by default the one the exam already uses, or the current one
 	Points     int  `json:"points" binding:"min=1"`
 	Order      int  `json:"order" binding:"min=1"`
+	Section    int  `json:"section" binding:"min=0"` // 1-based position in Sections
 }
 
 type UpdateExamRequest struct {
@@ -39,20 +74,59 @@ type UpdateExamRequest struct {
 	PassScore   int                   `json:"pass_score" binding:"min=0,max=100"`
 	StartTime   *time.Time            `json:"start_time"`
 	EndTime     *time.Time            `json:"end_time"`
-	Status      models.ExamStatus     `json:"status" binding:"required"`
-	Questions   []ExamQuestionRequest `json:"questions" binding:"required,min=1"`
+	Status      models.ExamStatus     `json:"status"` // optional lifecycle move, see TransitionExam
+	Questions   []ExamQuestionRequest `json:"questions"`
+
+	ScoringPolicy     models.ScoringPolicy   `json:"scoring_policy"`
+	NegativeMarkRatio float64                `json:"negative_mark_ratio" binding:"min=0,max=1"`
+	LatePolicy        models.LatePolicy      `json:"late_policy"`
+	RetakeCooldown    int                    `json:"retake_cooldown" binding:"min=0"` // in minutes
+	KeepScore         models.KeepScorePolicy `json:"keep_score"`
+	ShuffleQuestions  bool                   `json:"shuffle_questions"`
+	ShuffleOptions    bool                   `json:"shuffle_options"`
+	LinearMode        bool                   `json:"linear_mode"` // one question at a time, timed by the server
+
+	// Adaptive exams give each candidate their own run through Questions, picked
+	// one at a time by the ability their answers show
+	AdaptiveMode     bool    `json:"adaptive_mode"`
+	AdaptiveMaxItems int     `json:"adaptive_max_items" binding:"min=0"` // 0 means the whole pool
+	AdaptiveTargetSE float64 `json:"adaptive_target_se" binding:"min=0"` // standard error to stop at, 0 means never
+
+	// Blueprint replaces Questions: each candidate gets their own draw from the bank
+	Blueprint []BlueprintSectionRequest `json:"blueprint" binding:"omitempty,dive"`
+
+	// Sections split the exam into timed parts taken in order
+	Sections []ExamSectionRequest `json:"sections" binding:"omitempty,dive"`
 }
 
 type AssignExamRequest struct {
 	UserIDs     []uint     `json:"user_ids" binding:"required,min=1"`
 	ExpiresAt   *time.Time `json:"expires_at"`
 	MaxAttempts int        `json:"max_attempts" binding:"min=1"`
+
+	// Accommodations for the listed users
+	TimeMultiplier float64    `json:"time_multiplier" binding:"omitempty,min=1,max=3"` // e.g. 1.25 for 25% extra time
+	ExtraMinutes   int        `json:"extra_minutes" binding:"min=0"`
+	WindowStart    *time.Time `json:"window_start"` // replaces the exam's start time
+	WindowEnd      *time.Time `json:"window_end"`   // replaces the exam's end time
 }
 
 type StartExamResponse struct {
 	UserExam  models.UserExamResponse   `json:"user_exam"`
 	Questions []models.QuestionResponse `json:"questions"`
 	TimeLeft  int                       `json:"time_left"` // in seconds
+
+	SavedAnswers []SubmitAnswerRequest `json:"saved_answers,omitempty"`
+
+	// Sectioned exams only list the questions of sections the candidate can see
+	CurrentSectionID *uint                        `json:"current_section_id,omitempty"`
+	Sections         []models.ExamSectionResponse `json:"sections,omitempty"`
+
+	// Linear attempts leave Questions empty; fetch them one at a time instead
+	LinearMode bool `json:"linear_mode,omitempty"`
+
+	// Adaptive attempts are linear too, each next question picked by the answers so far
+	AdaptiveMode bool `json:"adaptive_mode,omitempty"`
 }
 
 type SubmitExamRequest struct {
@@ -60,9 +134,13 @@ type SubmitExamRequest struct {
 }
 
 type SubmitAnswerRequest struct {
-	QuestionID      uint     `json:"question_id" binding:"required"`
-	SelectedOptions []string `json:"selected_options" binding:"required"`
-	TimeSpent       int      `json:"time_spent" binding:"min=0"` // in seconds
+	QuestionID      uint                  `json:"question_id" binding:"required"`
+	SelectedOptions []string              `json:"selected_options"`           // for ordering questions, every option ID in the chosen order
+	TextAnswers     []string              `json:"text_answers,omitempty"`     // short-answer and cloze questions, one per blank in order
+	NumericAnswer   *models.NumericAnswer `json:"numeric_answer,omitempty"`   // numeric questions
+	Matches         map[string]string     `json:"matches,omitempty"`          // matching questions, option ID -> match choice ID
+	Essay           string                `json:"essay,omitempty"`            // essay questions
+	TimeSpent       int                   `json:"time_spent" binding:"min=0"` // in seconds
 }
 
 type ExamListResponse struct {
@@ -73,7 +151,7 @@ type ExamListResponse struct {
 	TotalPages int                   `json:"total_pages"`
 }
 
-func NewExamService(db *gorm.DB, redisClient *utils.RedisClient, logger *logrus.Logger) *ExamService {
+func NewExamService(db *gorm.DB, redisClient utils.RedisStore, logger *logrus.Logger) *ExamService {
 	return &ExamService{
 		db:          db,
 		redisClient: redisClient,
@@ -82,26 +160,41 @@ func NewExamService(db *gorm.DB, redisClient *utils.RedisClient, logger *logrus.
 }
 
 func (s *ExamService) CreateExam(req CreateExamRequest, createdBy uint) (*models.Exam, error) {
-	// Validate questions exist
-	questionIDs := make([]uint, len(req.Questions))
-	for i, q := range req.Questions {
-		questionIDs[i] = q.QuestionID
+	scoringPolicy, err := resolveScoringPolicy(req.ScoringPolicy, req.NegativeMarkRatio)
+	if err != nil {
+		return nil, err
 	}
 
-	var questionCount int64
-	if err := s.db.Model(&models.Question{}).Where("id IN ? AND is_active = ?", questionIDs, true).Count(&questionCount).Error; err != nil {
-		s.logger.WithError(err).Error("Failed to validate questions")
-		return nil, fmt.Errorf("failed to validate questions")
+	latePolicy, err := resolveLatePolicy(req.LatePolicy)
+	if err != nil {
+		return nil, err
 	}
 
-	if int(questionCount) != len(questionIDs) {
-		return nil, fmt.Errorf("some questions are invalid or inactive")
+	keepScore, err := resolveKeepScorePolicy(req.KeepScore)
+	if err != nil {
+		return nil, err
 	}
 
-	// Calculate total points
-	totalPoints := 0
-	for _, q := range req.Questions {
-		totalPoints += q.Points
+	if err := checkSchedule(optionalTime(req.StartTime), optionalTime(req.EndTime)); err != nil {
+		return nil, err
+	}
+
+	if req.LinearMode && len(req.Sections) > 0 {
+		return nil, fmt.Errorf("invalid sections: linear exams cannot be split into sections")
+	}
+
+	if err := s.checkAdaptiveSettings(req.AdaptiveMode, req.Questions, req.Blueprint, req.Sections); err != nil {
+		return nil, err
+	}
+
+	examSections, blueprintSections, totalPoints, err := s.prepareExamContent(req.Questions, req.Blueprint, req.Sections, req.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.pinRevisions(req.Questions, nil)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create exam
@@ -112,10 +205,22 @@ func (s *ExamService) CreateExam(req CreateExamRequest, createdBy uint) (*models
 		TotalPoints: totalPoints,
 		PassScore:   req.PassScore,
 		Status:      models.ExamDraft,
-		StartTime:   &req.StartTime,
-		EndTime:     &req.EndTime,
+		StartTime:   optionalTime(req.StartTime),
+		EndTime:     optionalTime(req.EndTime),
 		IsActive:    true,
 		CreatedBy:   createdBy,
+
+		ScoringPolicy:     scoringPolicy,
+		NegativeMarkRatio: req.NegativeMarkRatio,
+		LatePolicy:        latePolicy,
+		RetakeCooldown:    req.RetakeCooldown,
+		KeepScore:         keepScore,
+		ShuffleQuestions:  req.ShuffleQuestions,
+		ShuffleOptions:    req.ShuffleOptions,
+		LinearMode:        req.LinearMode,
+		AdaptiveMode:      req.AdaptiveMode,
+		AdaptiveMaxItems:  req.AdaptiveMaxItems,
+		AdaptiveTargetSE:  req.AdaptiveTargetSE,
 	}
 
 	// Start transaction
@@ -132,13 +237,26 @@ func (s *ExamService) CreateExam(req CreateExamRequest, createdBy uint) (*models
 		return nil, fmt.Errorf("failed to create exam")
 	}
 
+	// Create sections first so questions can refer to them
+	for i := range examSections {
+		examSections[i].ExamID = exam.ID
+		if err := tx.Create(&examSections[i]).Error; err != nil {
+			tx.Rollback()
+			s.logger.WithError(err).Error("Failed to create exam section")
+			return nil, fmt.Errorf("failed to create exam")
+		}
+	}
+	exam.Sections = examSections
+
 	// Create exam questions
 	for _, q := range req.Questions {
 		examQuestion := models.ExamQuestion{
 			ExamID:     exam.ID,
 			QuestionID: q.QuestionID,
+			Revision:   revisions[q.QuestionID],
 			Order:      q.Order,
 			Points:     q.Points,
+			SectionID:  sectionIDAt(examSections, q.Section),
 		}
 
 		if err := tx.Create(&examQuestion).Error; err != nil {
@@ -148,6 +266,18 @@ func (s *ExamService) CreateExam(req CreateExamRequest, createdBy uint) (*models
 		}
 	}
 
+	// Create blueprint sections
+	for i := range blueprintSections {
+		blueprintSections[i].ExamID = exam.ID
+		blueprintSections[i].ExamSectionID = sectionIDAt(examSections, req.Blueprint[i].Section)
+		if err := tx.Create(&blueprintSections[i]).Error; err != nil {
+			tx.Rollback()
+			s.logger.WithError(err).Error("Failed to create blueprint section")
+			return nil, fmt.Errorf("failed to create exam")
+		}
+	}
+	exam.BlueprintSections = blueprintSections
+
 	if err := tx.Commit().Error; err != nil {
 		s.logger.WithError(err).Error("Failed to commit exam creation")
 		return nil, fmt.Errorf("failed to create exam")
@@ -182,7 +312,7 @@ func (s *ExamService) GetExams(page, pageSize int, userID uint, isAdmin bool) (*
 
 	// Get paginated results
 	offset := (page - 1) * pageSize
-	if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&exams).Error; err != nil {
+	if err := query.Offset(offset).Limit(pageSize).Order("exams.created_at DESC").Find(&exams).Error; err != nil {
 		s.logger.WithError(err).Error("Failed to get exams")
 		return nil, fmt.Errorf("failed to get exams")
 	}
@@ -211,7 +341,7 @@ func (s *ExamService) GetExams(page, pageSize int, userID uint, isAdmin bool) (*
 
 func (s *ExamService) GetExam(examID uint, userID uint, isAdmin bool) (*models.Exam, *models.UserExam, error) {
 	var exam models.Exam
-	query := s.db.Preload("Creator").Preload("ExamQuestions.Question")
+	query := s.db.Preload("Creator").Preload("Sections", orderSections).Preload("ExamQuestions.Question").Preload("BlueprintSections", orderBlueprintSections)
 
 	if err := query.Where("id = ?", examID).First(&exam).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -220,6 +350,10 @@ func (s *ExamService) GetExam(examID uint, userID uint, isAdmin bool) (*models.E
 		s.logger.WithError(err).Error("Failed to get exam")
 		return nil, nil, fmt.Errorf("failed to get exam")
 	}
+	if err := applyPinnedRevisions(s.db, exam.ExamQuestions); err != nil {
+		s.logger.WithError(err).Error("Failed to get question revisions")
+		return nil, nil, fmt.Errorf("failed to get exam")
+	}
 
 	var userExam *models.UserExam
 	if !isAdmin {
@@ -233,6 +367,31 @@ func (s *ExamService) GetExam(examID uint, userID uint, isAdmin bool) (*models.E
 			return nil, nil, fmt.Errorf("failed to get exam")
 		}
 		userExam = &ue
+
+		// Candidates in the middle of an attempt see its question order, limited
+		// to the sections they have reached
+		if ue.Status == models.UserExamStarted {
+			if err := s.presentExamQuestions(&exam, userExam); err != nil {
+				return nil, nil, fmt.Errorf("failed to get exam")
+			}
+
+			progress, err := s.loadSectionProgress(&exam, userExam, time.Now())
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get exam")
+			}
+			if progress != nil {
+				exam.ExamQuestions = progress.visibleQuestions(exam.ExamQuestions)
+			}
+
+			// Linear attempts serve questions one at a time
+			linear, err := s.inLinearMode(userExam)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get exam")
+			}
+			if linear {
+				exam.ExamQuestions = nil
+			}
+		}
 	}
 
 	return &exam, userExam, nil
@@ -249,30 +408,64 @@ func (s *ExamService) UpdateExam(examID uint, req UpdateExamRequest) (*models.Ex
 	}
 
 	// Check if exam can be updated
-	if exam.Status == models.ExamCompleted {
-		return nil, fmt.Errorf("cannot update completed exam")
+	if exam.Status == models.ExamClosed || exam.Status == models.ExamArchived {
+		return nil, fmt.Errorf("cannot update closed exam")
 	}
 
-	// Validate questions exist
-	questionIDs := make([]uint, len(req.Questions))
-	for i, q := range req.Questions {
-		questionIDs[i] = q.QuestionID
+	// Status changes follow the exam lifecycle
+	newStatus := exam.Status
+	if req.Status != "" && req.Status != exam.Status {
+		if err := checkTransition(&models.Exam{Status: exam.Status, StartTime: req.StartTime}, req.Status); err != nil {
+			return nil, err
+		}
+		newStatus = req.Status
 	}
 
-	var questionCount int64
-	if err := s.db.Model(&models.Question{}).Where("id IN ? AND is_active = ?", questionIDs, true).Count(&questionCount).Error; err != nil {
-		s.logger.WithError(err).Error("Failed to validate questions")
-		return nil, fmt.Errorf("failed to validate questions")
+	if err := checkSchedule(req.StartTime, req.EndTime); err != nil {
+		return nil, err
 	}
 
-	if int(questionCount) != len(questionIDs) {
-		return nil, fmt.Errorf("some questions are invalid or inactive")
+	scoringPolicy, err := resolveScoringPolicy(req.ScoringPolicy, req.NegativeMarkRatio)
+	if err != nil {
+		return nil, err
 	}
 
-	// Calculate total points
-	totalPoints := 0
-	for _, q := range req.Questions {
-		totalPoints += q.Points
+	latePolicy, err := resolveLatePolicy(req.LatePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	keepScore, err := resolveKeepScorePolicy(req.KeepScore)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.LinearMode && len(req.Sections) > 0 {
+		return nil, fmt.Errorf("invalid sections: linear exams cannot be split into sections")
+	}
+
+	if err := s.checkAdaptiveSettings(req.AdaptiveMode, req.Questions, req.Blueprint, req.Sections); err != nil {
+		return nil, err
+	}
+
+	examSections, blueprintSections, totalPoints, err := s.prepareExamContent(req.Questions, req.Blueprint, req.Sections, req.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	// Questions the exam keeps stay on the revision they were pinned to
+	var existing []models.ExamQuestion
+	if err := s.db.Where("exam_id = ?", examID).Find(&existing).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get exam questions")
+		return nil, fmt.Errorf("failed to update exam")
+	}
+	pinned := make(map[uint]int, len(existing))
+	for _, eq := range existing {
+		pinned[eq.QuestionID] = eq.Revision
+	}
+	revisions, err := s.pinRevisions(req.Questions, pinned)
+	if err != nil {
+		return nil, err
 	}
 
 	// Start transaction
@@ -283,15 +476,65 @@ func (s *ExamService) UpdateExam(examID uint, req UpdateExamRequest) (*models.Ex
 		}
 	}()
 
+	// Running attempts refer to the exam's sections, so neither they nor the
+	// questions in them can change until every attempt has ended. The lock on
+	// the exam keeps attempts from starting until the update is done.
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", examID).First(&models.Exam{}).Error; err != nil {
+		tx.Rollback()
+		s.logger.WithError(err).Error("Failed to lock exam")
+		return nil, fmt.Errorf("failed to update exam")
+	}
+	inProgress, err := s.hasAttemptsInProgress(tx, examID)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update exam")
+	}
+	var currentSections []models.ExamSection
+	var currentBlueprint []models.ExamBlueprintSection
+	if inProgress {
+		if err := tx.Where("exam_id = ?", examID).Find(&existing).Error; err != nil {
+			tx.Rollback()
+			s.logger.WithError(err).Error("Failed to get exam questions")
+			return nil, fmt.Errorf("failed to update exam")
+		}
+		if err := tx.Scopes(orderSections).Where("exam_id = ?", examID).Find(&currentSections).Error; err != nil {
+			tx.Rollback()
+			s.logger.WithError(err).Error("Failed to get exam sections")
+			return nil, fmt.Errorf("failed to update exam")
+		}
+		if err := tx.Scopes(orderBlueprintSections).Where("exam_id = ?", examID).Find(&currentBlueprint).Error; err != nil {
+			tx.Rollback()
+			s.logger.WithError(err).Error("Failed to get blueprint sections")
+			return nil, fmt.Errorf("failed to update exam")
+		}
+		if examContentChanged(currentSections, existing, currentBlueprint, examSections, blueprintSections, req, revisions) {
+			tx.Rollback()
+			return nil, fmt.Errorf("cannot change exam questions or sections while attempts are in progress")
+		}
+	}
+
 	// Update exam
 	exam.Title = req.Title
 	exam.Description = req.Description
 	exam.Duration = req.Duration
 	exam.TotalPoints = totalPoints
 	exam.PassScore = req.PassScore
-	exam.Status = req.Status
+	if newStatus != models.ExamClosed {
+		exam.Status = newStatus
+	}
 	exam.StartTime = req.StartTime
 	exam.EndTime = req.EndTime
+	exam.ScoringPolicy = scoringPolicy
+	exam.NegativeMarkRatio = req.NegativeMarkRatio
+	exam.LatePolicy = latePolicy
+	exam.RetakeCooldown = req.RetakeCooldown
+	exam.KeepScore = keepScore
+	exam.ShuffleQuestions = req.ShuffleQuestions
+	exam.ShuffleOptions = req.ShuffleOptions
+	exam.LinearMode = req.LinearMode
+	exam.AdaptiveMode = req.AdaptiveMode
+	exam.AdaptiveMaxItems = req.AdaptiveMaxItems
+	exam.AdaptiveTargetSE = req.AdaptiveTargetSE
 
 	if err := tx.Save(&exam).Error; err != nil {
 		tx.Rollback()
@@ -299,40 +542,150 @@ func (s *ExamService) UpdateExam(examID uint, req UpdateExamRequest) (*models.Ex
 		return nil, fmt.Errorf("failed to update exam")
 	}
 
-	// Delete existing exam questions
-	if err := tx.Where("exam_id = ?", examID).Delete(&models.ExamQuestion{}).Error; err != nil {
+	// Attempts in progress keep the content they started with
+	if inProgress {
+		exam.Sections = currentSections
+		exam.BlueprintSections = currentBlueprint
+	} else if err := s.replaceExamContent(tx, &exam, examSections, blueprintSections, req, revisions); err != nil {
 		tx.Rollback()
-		s.logger.WithError(err).Error("Failed to delete existing exam questions")
 		return nil, fmt.Errorf("failed to update exam")
 	}
 
+	if err := tx.Commit().Error; err != nil {
+		s.logger.WithError(err).Error("Failed to commit exam update")
+		return nil, fmt.Errorf("failed to update exam")
+	}
+
+	// Closing also ends the attempts still in progress
+	if newStatus == models.ExamClosed {
+		if err := s.closeExam(&exam, time.Now()); err != nil {
+			return nil, fmt.Errorf("failed to update exam")
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"exam_id": exam.ID,
+		"title":   exam.Title,
+	}).Info("Exam updated successfully")
+
+	return &exam, nil
+}
+
+// replaceExamContent swaps an exam's sections, questions and blueprint for the
+// ones in an update request
+func (s *ExamService) replaceExamContent(tx *gorm.DB, exam *models.Exam, examSections []models.ExamSection, blueprintSections []models.ExamBlueprintSection, req UpdateExamRequest, revisions map[uint]int) error {
+	// Delete existing exam questions
+	if err := tx.Where("exam_id = ?", exam.ID).Delete(&models.ExamQuestion{}).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to delete existing exam questions")
+		return err
+	}
+
+	// Replace sections
+	if err := tx.Where("exam_id = ?", exam.ID).Delete(&models.ExamSection{}).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to delete existing exam sections")
+		return err
+	}
+
+	// Create new sections first so questions can refer to them
+	for i := range examSections {
+		examSections[i].ExamID = exam.ID
+		if err := tx.Create(&examSections[i]).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to create exam section")
+			return err
+		}
+	}
+	exam.Sections = examSections
+
 	// Create new exam questions
 	for _, q := range req.Questions {
 		examQuestion := models.ExamQuestion{
 			ExamID:     exam.ID,
 			QuestionID: q.QuestionID,
+			Revision:   revisions[q.QuestionID],
 			Order:      q.Order,
 			Points:     q.Points,
+			SectionID:  sectionIDAt(examSections, q.Section),
 		}
 
 		if err := tx.Create(&examQuestion).Error; err != nil {
-			tx.Rollback()
 			s.logger.WithError(err).Error("Failed to create exam question")
-			return nil, fmt.Errorf("failed to update exam")
+			return err
 		}
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		s.logger.WithError(err).Error("Failed to commit exam update")
-		return nil, fmt.Errorf("failed to update exam")
+	// Replace blueprint sections
+	if err := tx.Where("exam_id = ?", exam.ID).Delete(&models.ExamBlueprintSection{}).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to delete existing blueprint sections")
+		return err
 	}
 
-	s.logger.WithFields(logrus.Fields{
-		"exam_id": exam.ID,
-		"title":   exam.Title,
-	}).Info("Exam updated successfully")
+	for i := range blueprintSections {
+		blueprintSections[i].ExamID = exam.ID
+		blueprintSections[i].ExamSectionID = sectionIDAt(examSections, req.Blueprint[i].Section)
+		if err := tx.Create(&blueprintSections[i]).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to create blueprint section")
+			return err
+		}
+	}
+	exam.BlueprintSections = blueprintSections
 
-	return &exam, nil
+	return nil
+}
+
+// hasAttemptsInProgress reports whether any candidate is in the middle of the exam
+func (s *ExamService) hasAttemptsInProgress(db *gorm.DB, examID uint) (bool, error) {
+	var count int64
+	if err := db.Model(&models.UserExam{}).Where("exam_id = ? AND status = ?", examID, models.UserExamStarted).Count(&count).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to check attempts in progress")
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// examContentChanged reports whether an update request would change an exam's
+// sections, questions or blueprint. Sections are compared by position, since
+// questions and blueprint sections refer to them by their 1-based position.
+func examContentChanged(sections []models.ExamSection, examQuestions []models.ExamQuestion, blueprint []models.ExamBlueprintSection, newSections []models.ExamSection, newBlueprint []models.ExamBlueprintSection, req UpdateExamRequest, revisions map[uint]int) bool {
+	if len(sections) != len(newSections) || len(examQuestions) != len(req.Questions) || len(blueprint) != len(newBlueprint) {
+		return true
+	}
+
+	position := make(map[uint]int, len(sections))
+	for i, section := range sections {
+		next := newSections[i]
+		if section.Title != next.Title || section.Instructions != next.Instructions || section.Duration != next.Duration || section.LockOnClose != next.LockOnClose {
+			return true
+		}
+		position[section.ID] = i + 1
+	}
+	sectionPosition := func(id *uint) int {
+		if id == nil {
+			return 0
+		}
+		return position[*id]
+	}
+
+	current := make(map[uint]models.ExamQuestion, len(examQuestions))
+	for _, eq := range examQuestions {
+		current[eq.QuestionID] = eq
+	}
+	for _, q := range req.Questions {
+		eq, ok := current[q.QuestionID]
+		if !ok || eq.Revision != revisions[q.QuestionID] || eq.Order != q.Order || eq.Points != q.Points || sectionPosition(eq.SectionID) != q.Section {
+			return true
+		}
+	}
+
+	for i, section := range blueprint {
+		next := newBlueprint[i]
+		if section.Name != next.Name || section.QuestionCount != next.QuestionCount || section.Difficulty != next.Difficulty ||
+			section.Points != next.Points || !slices.Equal(section.Tags, next.Tags) ||
+			sectionPosition(section.ExamSectionID) != req.Blueprint[i].Section {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (s *ExamService) DeleteExam(examID uint) error {
@@ -392,20 +745,41 @@ func (s *ExamService) AssignExam(examID uint, req AssignExamRequest) error {
 		return fmt.Errorf("some users are invalid or inactive")
 	}
 
+	if err := checkSchedule(req.WindowStart, req.WindowEnd); err != nil {
+		return err
+	}
+
+	timeMultiplier := req.TimeMultiplier
+	if timeMultiplier == 0 {
+		timeMultiplier = 1
+	}
+
 	// Create user exam assignments
 	for _, userID := range req.UserIDs {
 		userExam := models.UserExam{
-			UserID:      userID,
-			ExamID:      examID,
-			Status:      models.UserExamAssigned,
-			ExpiresAt:   req.ExpiresAt,
-			MaxAttempts: req.MaxAttempts,
+			UserID:         userID,
+			ExamID:         examID,
+			Status:         models.UserExamAssigned,
+			ExpiresAt:      req.ExpiresAt,
+			MaxAttempts:    req.MaxAttempts,
+			TimeMultiplier: timeMultiplier,
+			ExtraMinutes:   req.ExtraMinutes,
+			WindowStart:    req.WindowStart,
+			WindowEnd:      req.WindowEnd,
 		}
 
 		// Use ON CONFLICT to handle duplicates
 		if err := s.db.Create(&userExam).Error; err != nil {
-			// If it's a duplicate key error, update the existing record
-			if err := s.db.Where("user_id = ? AND exam_id = ?", userID, examID).Updates(&userExam).Error; err != nil {
+			// If it's a duplicate key error, update the existing record's limits and
+			// accommodations but keep its status, attempt count and history
+			if err := s.db.Model(&models.UserExam{}).Where("user_id = ? AND exam_id = ?", userID, examID).Updates(map[string]interface{}{
+				"expires_at":      req.ExpiresAt,
+				"max_attempts":    req.MaxAttempts,
+				"time_multiplier": timeMultiplier,
+				"extra_minutes":   req.ExtraMinutes,
+				"window_start":    req.WindowStart,
+				"window_end":      req.WindowEnd,
+			}).Error; err != nil {
 				s.logger.WithError(err).Error("Failed to assign exam to user")
 				continue
 			}
@@ -438,41 +812,73 @@ func (s *ExamService) StartExam(examID uint, userID uint) (*StartExamResponse, e
 
 	// Get exam with questions
 	var exam models.Exam
-	if err := s.db.Preload("ExamQuestions.Question").Where("id = ?", examID).First(&exam).Error; err != nil {
+	if err := s.db.Preload("Sections", orderSections).Preload("ExamQuestions.Question").Preload("BlueprintSections", orderBlueprintSections).Where("id = ?", examID).First(&exam).Error; err != nil {
 		s.logger.WithError(err).Error("Failed to get exam")
 		return nil, fmt.Errorf("failed to start exam")
 	}
 
-	// Update user exam status
+	// Attempts can only start while the exam is active and within its window
 	now := time.Now()
-	userExam.Status = models.UserExamStarted
-	userExam.StartedAt = &now
-	userExam.AttemptCount++
+	if err := CheckExamWindow(&exam, &userExam, now); err != nil {
+		return nil, err
+	}
 
-	if err := s.db.Save(&userExam).Error; err != nil {
-		s.logger.WithError(err).Error("Failed to update user exam")
+	// Retakes have to wait out the exam's cool-down
+	if next := userExam.NextAttemptAt(&exam); next != nil && now.Before(*next) {
+		return nil, fmt.Errorf("retake cooldown has not elapsed")
+	}
+
+	// Blueprint exams draw this candidate's questions from the bank
+	seed := newAttemptSeed()
+	var drawn []models.AttemptQuestion
+	if exam.UsesBlueprint() {
+		var err error
+		drawn, err = s.drawAttemptQuestions(&exam, seed)
+		if err != nil {
+			s.logger.WithError(err).WithField("exam_id", examID).Error("Failed to draw blueprint questions")
+			return nil, err
+		}
+
+		exam.ExamQuestions = make([]models.ExamQuestion, len(drawn))
+		for i := range drawn {
+			exam.ExamQuestions[i] = drawn[i].ToExamQuestion(exam.ID)
+		}
+	} else if err := applyPinnedRevisions(s.db, exam.ExamQuestions); err != nil {
+		s.logger.WithError(err).Error("Failed to get question revisions")
 		return nil, fmt.Errorf("failed to start exam")
+	} else if exam.AdaptiveMode {
+		// Adaptive attempts open on the question most informative at the prior
+		// ability; the rest are picked as the candidate answers
+		first, _ := nextAdaptiveItem(exam.ExamQuestions, nil, EstimateAbility(nil).Ability)
+		if first == nil {
+			s.logger.WithField("exam_id", examID).Error("Adaptive exam has no questions to pick from")
+			return nil, fmt.Errorf("failed to start exam")
+		}
+		drawn = []models.AttemptQuestion{adaptiveAttemptQuestion(first, 1)}
+		exam.ExamQuestions = []models.ExamQuestion{drawn[0].ToExamQuestion(exam.ID)}
+	} else {
+		// Fixed exams record their questions too, so questions added to or removed
+		// from the exam later change neither this attempt's order nor its grading
+		drawn = snapshotAttemptQuestions(exam.ExamQuestions)
+	}
+
+	attempt, err := s.startAttempt(&userExam, &exam, seed, drawn, now)
+	if err != nil {
+		return nil, err
 	}
+	exam.ExamQuestions = ShuffleExamQuestions(exam.ExamQuestions, exam.Sections, attempt.Seed, attempt.ShuffleQuestions, attempt.ShuffleOptions)
+
+	// Drop anything autosaved during a previous attempt
+	s.clearSavedAnswers(&userExam)
 
-	// Prepare questions (without correct answers)
+	// Prepare questions (without correct answers) in the attempt's order
 	questions := make([]models.QuestionResponse, len(exam.ExamQuestions))
 	for i, eq := range exam.ExamQuestions {
 		questions[i] = eq.Question.ToResponse(false)
 	}
 
-	// Calculate time left
-	examDuration := time.Duration(exam.Duration) * time.Minute
-	timeLeft := int(examDuration.Seconds())
-
 	// Store exam session in Redis for timer validation
-	sessionKey := fmt.Sprintf("exam_session:%d:%d", userID, examID)
-	sessionData := map[string]interface{}{
-		"started_at": now.Unix(),
-		"duration":   exam.Duration * 60, // in seconds
-	}
-	if err := s.redisClient.SetJSON(sessionKey, sessionData, examDuration); err != nil {
-		s.logger.WithError(err).Warn("Failed to store exam session in Redis")
-	}
+	s.storeExamSession(&userExam, &exam)
 
 	// Convert UserExam to UserExamResponse
 	userExamResponse := s.convertUserExamToResponse(&userExam, &exam)
@@ -480,7 +886,15 @@ func (s *ExamService) StartExam(examID uint, userID uint) (*StartExamResponse, e
 	response := &StartExamResponse{
 		UserExam:  *userExamResponse,
 		Questions: questions,
-		TimeLeft:  timeLeft,
+		TimeLeft:  timeLeft(&userExam, &exam),
+	}
+	if err := s.presentSections(response, &exam, &userExam, now); err != nil {
+		return nil, fmt.Errorf("failed to start exam")
+	}
+	if attempt.LinearMode {
+		response.LinearMode = true
+		response.AdaptiveMode = attempt.AdaptiveMode
+		response.Questions = []models.QuestionResponse{}
 	}
 
 	s.logger.WithFields(logrus.Fields{
@@ -507,49 +921,74 @@ func (s *ExamService) SubmitExam(examID uint, userID uint, req SubmitExamRequest
 		return nil, fmt.Errorf("exam cannot be submitted")
 	}
 
-	// Validate timer using Redis session
-	sessionKey := fmt.Sprintf("exam_session:%d:%d", userID, examID)
-	var sessionData map[string]interface{}
-	if err := s.redisClient.GetJSON(sessionKey, &sessionData); err == nil {
-		startedAt := int64(sessionData["started_at"].(float64))
-		duration := int64(sessionData["duration"].(float64))
-		elapsed := time.Now().Unix() - startedAt
-
-		if elapsed > duration {
-			// Auto-submit due to time expiry
+	// Get exam with questions
+	var exam models.Exam
+	if err := s.db.Preload("Sections", orderSections).Preload("ExamQuestions.Question").Where("id = ?", examID).First(&exam).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get exam")
+		return nil, fmt.Errorf("failed to submit exam")
+	}
+
+	// Grade in the order the candidate was shown
+	if err := s.presentExamQuestions(&exam, &userExam); err != nil {
+		return nil, fmt.Errorf("failed to submit exam")
+	}
+
+	// Enforce the timer server-side from the recorded start time
+	endTime := time.Now()
+	late := false
+	deadline := userExam.Deadline(&exam)
+	if deadline != nil && endTime.After(deadline.Add(config.AppConfig.Exam.GracePeriod)) {
+		if exam.LatePolicy != models.LateTruncate {
 			s.logger.WithFields(logrus.Fields{
 				"exam_id":  examID,
 				"user_id":  userID,
-				"elapsed":  elapsed,
-				"duration": duration,
-			}).Warn("Exam auto-submitted due to time expiry")
+				"deadline": deadline,
+			}).Warn("Rejected late exam submission")
+			return nil, fmt.Errorf("exam time has expired")
 		}
+		endTime = *deadline
+		late = true
 	}
 
-	// Get exam with questions
-	var exam models.Exam
-	if err := s.db.Preload("ExamQuestions.Question").Where("id = ?", examID).First(&exam).Error; err != nil {
-		s.logger.WithError(err).Error("Failed to get exam")
+	// Answers autosaved during the attempt count unless the submission overrides them
+	saved, err := s.loadSavedAnswers(&userExam)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit exam")
+	}
+
+	// Submitted answers only count for sections the candidate can still answer
+	submitted := req.Answers
+	progress, err := s.loadSectionProgress(&exam, &userExam, endTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit exam")
+	}
+	if progress != nil {
+		submitted = progress.answerable(req.Answers, endTime)
+	}
+
+	// Linear attempts only count the answers recorded as each question was served
+	linear, err := s.inLinearMode(&userExam)
+	if err != nil {
 		return nil, fmt.Errorf("failed to submit exam")
 	}
+	if linear {
+		submitted = nil
+	}
 
 	// Process answers and calculate score
-	result, err := s.processExamSubmission(&exam, &userExam, req.Answers)
+	result, err := s.processExamSubmission(&exam, &userExam, mergeAnswers(saved, submitted), endTime)
 	if err != nil {
 		return nil, err
 	}
+	result.SubmittedLate = late
 
-	// Update user exam status
-	now := time.Now()
-	userExam.Status = models.UserExamCompleted
-	userExam.CompletedAt = &now
-
-	if err := s.db.Save(&userExam).Error; err != nil {
-		s.logger.WithError(err).Error("Failed to update user exam")
-		return nil, fmt.Errorf("failed to submit exam")
+	if err := s.finalizeSubmission(&userExam, result); err != nil {
+		return nil, err
 	}
+	s.clearSavedAnswers(&userExam)
 
 	// Clean up Redis session
+	sessionKey := fmt.Sprintf("exam_session:%d:%d", userID, examID)
 	s.redisClient.Del(sessionKey)
 
 	s.logger.WithFields(logrus.Fields{
@@ -557,12 +996,125 @@ func (s *ExamService) SubmitExam(examID uint, userID uint, req SubmitExamRequest
 		"user_id": userID,
 		"score":   result.Score,
 		"passed":  result.Passed,
+		"late":    late,
 	}).Info("Exam submitted successfully")
 
 	return result, nil
 }
 
-func (s *ExamService) processExamSubmission(exam *models.Exam, userExam *models.UserExam, submittedAnswers []SubmitAnswerRequest) (*models.Result, error) {
+// AutoSubmitExpiredAttempts closes every started attempt whose time limit plus the
+// grace period has passed, grading whatever answers the candidate autosaved.
+// It returns the number of attempts that were closed.
+func (s *ExamService) AutoSubmitExpiredAttempts(gracePeriod time.Duration) (int, error) {
+	now := time.Now()
+	userExams, err := s.possiblyExpiredAttempts(now.Add(-gracePeriod))
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get started user exams")
+		return 0, fmt.Errorf("failed to auto-submit exams")
+	}
+
+	closed := 0
+	for i := range userExams {
+		userExam := &userExams[i]
+		deadline := userExam.Deadline(&userExam.Exam)
+		if deadline == nil || !now.After(deadline.Add(gracePeriod)) {
+			continue
+		}
+
+		if err := s.autoSubmit(userExam, *deadline); err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"user_exam_id": userExam.ID,
+				"exam_id":      userExam.ExamID,
+				"user_id":      userExam.UserID,
+			}).WithError(err).Error("Failed to auto-submit expired exam")
+			continue
+		}
+		closed++
+	}
+
+	return closed, nil
+}
+
+// possiblyExpiredAttempts loads the started attempts that may have run past
+// their deadline by the cutoff. Every attempt gets at least its exam's duration,
+// as time multipliers and extra minutes only add to it, so one started after
+// cutoff minus the duration can only have expired with its window; the exact
+// deadline is left to the caller.
+func (s *ExamService) possiblyExpiredAttempts(cutoff time.Time) ([]models.UserExam, error) {
+	var examIDs []uint
+	if err := s.db.Model(&models.UserExam{}).Where("status = ?", models.UserExamStarted).Distinct().Pluck("exam_id", &examIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(examIDs) == 0 {
+		return nil, nil
+	}
+
+	var exams []models.Exam
+	if err := s.db.Where("id IN ?", examIDs).Find(&exams).Error; err != nil {
+		return nil, err
+	}
+
+	userExams := []models.UserExam{}
+	for _, exam := range exams {
+		query := s.db.Where("exam_id = ? AND status = ?", exam.ID, models.UserExamStarted)
+		if exam.EndTime == nil || !exam.EndTime.Before(cutoff) {
+			started := cutoff.Add(-time.Duration(exam.Duration) * time.Minute)
+			query = query.Where("started_at <= ? OR (window_end IS NOT NULL AND window_end < ?)", started, cutoff)
+		}
+
+		var found []models.UserExam
+		if err := query.Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for i := range found {
+			found[i].Exam = exam
+		}
+		userExams = append(userExams, found...)
+	}
+	return userExams, nil
+}
+
+func (s *ExamService) autoSubmit(userExam *models.UserExam, deadline time.Time) error {
+	var exam models.Exam
+	if err := s.db.Preload("Sections", orderSections).Preload("ExamQuestions.Question").Where("id = ?", userExam.ExamID).First(&exam).Error; err != nil {
+		return fmt.Errorf("failed to get exam: %w", err)
+	}
+
+	if err := s.presentExamQuestions(&exam, userExam); err != nil {
+		return fmt.Errorf("failed to get attempt order: %w", err)
+	}
+
+	saved, err := s.loadSavedAnswers(userExam)
+	if err != nil {
+		return fmt.Errorf("failed to load saved answers: %w", err)
+	}
+
+	result, err := s.processExamSubmission(&exam, userExam, saved, deadline)
+	if err != nil {
+		return err
+	}
+	result.AutoSubmitted = true
+
+	if err := s.finalizeSubmission(userExam, result); err != nil {
+		return err
+	}
+	s.clearSavedAnswers(userExam)
+
+	s.redisClient.Del(fmt.Sprintf("exam_session:%d:%d", userExam.UserID, userExam.ExamID))
+
+	s.logger.WithFields(logrus.Fields{
+		"exam_id": userExam.ExamID,
+		"user_id": userExam.UserID,
+		"score":   result.Score,
+		"passed":  result.Passed,
+	}).Info("Exam auto-submitted due to time expiry")
+
+	return nil
+}
+
+// processExamSubmission grades the submitted answers and builds the result for an
+// attempt that ended at endTime; it doesn't persist anything
+func (s *ExamService) processExamSubmission(exam *models.Exam, userExam *models.UserExam, submittedAnswers []SubmitAnswerRequest, endTime time.Time) (*models.Result, error) {
 	// Create answer map for quick lookup
 	answerMap := make(map[uint]SubmitAnswerRequest)
 	for _, answer := range submittedAnswers {
@@ -571,101 +1123,331 @@ func (s *ExamService) processExamSubmission(exam *models.Exam, userExam *models.
 
 	var answers []models.Answer
 	totalPoints := 0
-	earnedPoints := 0
+
+	scoringPolicy := exam.ScoringPolicy
+	if scoringPolicy == "" {
+		scoringPolicy = models.ScoringAllOrNothing
+	}
 
 	// Process each question
 	for _, eq := range exam.ExamQuestions {
 		question := eq.Question
 		totalPoints += eq.Points
 
-		answer := models.Answer{
-			QuestionID:      question.ID,
-			SelectedOptions: []string{},
-			IsCorrect:       false,
-			Points:          0,
-			TimeSpent:       0,
+		// Check if user provided an answer
+		submittedAnswer, exists := answerMap[question.ID]
+		if !exists {
+			submittedAnswer = SubmitAnswerRequest{QuestionID: question.ID}
 		}
 
-		// Check if user provided an answer
-		if submittedAnswer, exists := answerMap[question.ID]; exists {
-			answer.SelectedOptions = submittedAnswer.SelectedOptions
-			answer.TimeSpent = submittedAnswer.TimeSpent
-
-			// Validate answer - you'll need to implement this method in your Question model
-			if s.validateQuestionAnswer(&question, submittedAnswer.SelectedOptions) {
-				answer.IsCorrect = true
-				answer.Points = eq.Points
-				earnedPoints += eq.Points
-			}
+		// Grade against the answer key; unknown option IDs reject the submission
+		answer, err := GradeSubmission(&question, eq.Points, submittedAnswer)
+		if err != nil {
+			return nil, err
 		}
+		answer.Revision = question.Revision
+		answer.TimeSpent = submittedAnswer.TimeSpent
+		ApplyScoringPolicy(&answer, scoringPolicy, exam.NegativeMarkRatio)
 
 		answers = append(answers, answer)
 	}
 
 	// Calculate score percentage
-	score := float64(earnedPoints) / float64(totalPoints) * 100
+	earnedPoints := SumPoints(answers)
+	score := 0.0
+	if totalPoints > 0 {
+		score = earnedPoints / float64(totalPoints) * 100
+	}
 	passed := score >= float64(exam.PassScore)
 
+	// Written essays hold the result back until a grader has marked them
+	status := models.ResultGraded
+	for _, answer := range answers {
+		if answer.PendingGrading {
+			status = models.ResultPendingGrading
+			break
+		}
+	}
+
+	// Adaptive attempts are also scored by the ability their answers show
+	attempt, err := s.currentAttempt(userExam)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit exam")
+	}
+	var ability, abilitySE *float64
+	if attempt != nil && attempt.AdaptiveMode {
+		estimate := estimateAbility(exam.ExamQuestions, answers)
+		theta, se := roundStatistic(estimate.Ability), roundStatistic(estimate.SE)
+		ability, abilitySE = &theta, &se
+	}
+
 	// Calculate duration
-	duration := int(time.Since(*userExam.StartedAt).Seconds())
+	duration := int(endTime.Sub(*userExam.StartedAt).Seconds())
 
 	// Create result
 	result := models.Result{
-		UserID:      userExam.UserID,
-		ExamID:      exam.ID,
-		UserExamID:  userExam.ID,
-		Score:       score,
-		TotalPoints: earnedPoints,
-		MaxPoints:   totalPoints,
-		Passed:      passed,
-		Answers:     models.Answers(answers),
-		StartTime:   *userExam.StartedAt,
-		EndTime:     time.Now(),
-		Duration:    duration,
+		UserID:        userExam.UserID,
+		ExamID:        exam.ID,
+		UserExamID:    userExam.ID,
+		ExamAttemptID: userExam.CurrentAttemptID,
+		Score:         score,
+		TotalPoints:   earnedPoints,
+		MaxPoints:     totalPoints,
+		Passed:        passed,
+		Status:        status,
+		Answers:       models.Answers(answers),
+		SectionScores: SectionSubscores(exam.Sections, exam.ExamQuestions, answers),
+		Ability:       ability,
+		AbilitySE:     abilitySE,
+		StartTime:     *userExam.StartedAt,
+		EndTime:       endTime,
+		Duration:      duration,
+
+		ScoringPolicy:     scoringPolicy,
+		NegativeMarkRatio: exam.NegativeMarkRatio,
+	}
+
+	return &result, nil
+}
+
+// finalizeSubmission marks the attempt completed and stores its result in one
+// transaction. The status flip is conditional so a candidate's submit and the
+// timer worker can't both close the same attempt.
+func (s *ExamService) finalizeSubmission(userExam *models.UserExam, result *models.Result) error {
+	now := time.Now()
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		update := tx.Model(&models.UserExam{}).
+			Where("id = ? AND status = ?", userExam.ID, models.UserExamStarted).
+			Updates(map[string]interface{}{
+				"status":       models.UserExamCompleted,
+				"completed_at": now,
+			})
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errAttemptAlreadyClosed
+		}
+
+		if userExam.CurrentAttemptID != nil {
+			if err := tx.Model(&models.ExamAttempt{}).Where("id = ?", *userExam.CurrentAttemptID).Updates(map[string]interface{}{
+				"status":       models.AttemptCompleted,
+				"completed_at": now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(result).Error
+	})
+	if err == errAttemptAlreadyClosed {
+		return fmt.Errorf("exam cannot be submitted")
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to save exam result")
+		return fmt.Errorf("failed to save exam result")
 	}
 
-	if err := s.db.Create(&result).Error; err != nil {
-		s.logger.WithError(err).Error("Failed to create result")
-		return nil, fmt.Errorf("failed to save exam result")
+	userExam.Status = models.UserExamCompleted
+	userExam.CompletedAt = &now
+
+	return nil
+}
+
+// prepareExamContent validates the sections and either the fixed question list or
+// the blueprint of an exam request, returning the sections, the blueprint sections
+// (if any) and the total points
+func (s *ExamService) prepareExamContent(questions []ExamQuestionRequest, blueprint []BlueprintSectionRequest, sectionRequests []ExamSectionRequest, duration int) ([]models.ExamSection, []models.ExamBlueprintSection, int, error) {
+	if len(questions) > 0 && len(blueprint) > 0 {
+		return nil, nil, 0, fmt.Errorf("exam cannot have both questions and a blueprint")
 	}
 
-	return &result, nil
+	examSections, err := buildExamSections(sectionRequests, duration)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	if len(blueprint) > 0 {
+		for i, req := range blueprint {
+			if err := checkSectionReference(req.Section, len(examSections), fmt.Sprintf("blueprint section %d", i+1)); err != nil {
+				return nil, nil, 0, err
+			}
+		}
+
+		sections, totalPoints, err := buildBlueprintSections(blueprint)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+
+		// Fail now rather than when the first candidate starts
+		if err := s.checkBlueprint(sections); err != nil {
+			return nil, nil, 0, err
+		}
+
+		return examSections, sections, totalPoints, nil
+	}
+
+	if len(questions) == 0 {
+		return nil, nil, 0, fmt.Errorf("exam needs either questions or a blueprint")
+	}
+
+	// Validate questions exist
+	questionIDs := make([]uint, len(questions))
+	for i, q := range questions {
+		questionIDs[i] = q.QuestionID
+		if err := checkSectionReference(q.Section, len(examSections), fmt.Sprintf("question %d", q.QuestionID)); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	var questionCount int64
+	if err := s.db.Model(&models.Question{}).Where("id IN ? AND is_active = ?", questionIDs, true).Count(&questionCount).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to validate questions")
+		return nil, nil, 0, fmt.Errorf("failed to validate questions")
+	}
+
+	if int(questionCount) != len(questionIDs) {
+		return nil, nil, 0, fmt.Errorf("some questions are invalid or inactive")
+	}
+
+	// Calculate total points
+	totalPoints := 0
+	for _, q := range questions {
+		totalPoints += q.Points
+	}
+
+	return examSections, nil, totalPoints, nil
+}
+
+// pinRevisions picks the revision each requested question is pinned to: the one
+// the request names, else the one in pinned, else the question's current one
+func (s *ExamService) pinRevisions(questions []ExamQuestionRequest, pinned map[uint]int) (map[uint]int, error) {
+	if len(questions) == 0 {
+		return map[uint]int{}, nil
+	}
+
+	questionIDs := make([]uint, len(questions))
+	for i, q := range questions {
+		questionIDs[i] = q.QuestionID
+	}
+	current, err := currentRevisions(s.db, questionIDs)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get question revisions")
+		return nil, fmt.Errorf("failed to validate questions")
+	}
+
+	revisions := make(map[uint]int, len(questions))
+	for _, q := range questions {
+		switch {
+		case q.Revision > 0:
+			if q.Revision > current[q.QuestionID] {
+				return nil, fmt.Errorf("invalid questions: question %d has no revision %d", q.QuestionID, q.Revision)
+			}
+			if q.Revision < current[q.QuestionID] && q.Revision != pinned[q.QuestionID] {
+				if err := s.checkRevisionMedia(q.QuestionID, q.Revision); err != nil {
+					return nil, err
+				}
+			}
+			revisions[q.QuestionID] = q.Revision
+		case pinned[q.QuestionID] > 0:
+			revisions[q.QuestionID] = pinned[q.QuestionID]
+		default:
+			revisions[q.QuestionID] = current[q.QuestionID]
+		}
+	}
+	return revisions, nil
+}
+
+// checkRevisionMedia makes sure the media an earlier revision shows is still
+// there; files only old revisions used are cleaned up once nothing uses them
+func (s *ExamService) checkRevisionMedia(questionID uint, revision int) error {
+	var found models.QuestionRevision
+	if err := s.db.Where("question_id = ? AND revision = ?", questionID, revision).First(&found).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("invalid questions: question %d has no revision %d", questionID, revision)
+		}
+		s.logger.WithError(err).Error("Failed to get question revision")
+		return fmt.Errorf("failed to validate questions")
+	}
+
+	ids := found.MediaIDs()
+	if len(ids) == 0 {
+		return nil
+	}
+	var count int64
+	if err := s.db.Model(&models.Media{}).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to load media")
+		return fmt.Errorf("failed to validate questions")
+	}
+	if int(count) != len(ids) {
+		return fmt.Errorf("invalid questions: revision %d of question %d shows media that has been removed", revision, questionID)
+	}
+	return nil
 }
 
-// Helper method to validate question answer
-// This assumes you have correct answer data in your Question model
-func (s *ExamService) validateQuestionAnswer(question *models.Question, selectedOptions []string) bool {
-	// You'll need to implement this based on your Question model structure
-	// This is a placeholder - replace with your actual validation logic
-	// For example, if you have a CorrectAnswers field in your Question model:
-	// return question.ValidateAnswer(selectedOptions)
+// Helper method to validate the scoring policy of an exam request, defaulting to all-or-nothing
+func resolveScoringPolicy(policy models.ScoringPolicy, negativeMarkRatio float64) (models.ScoringPolicy, error) {
+	if policy == "" {
+		policy = models.ScoringAllOrNothing
+	}
+
+	if !policy.IsValid() {
+		return "", fmt.Errorf("invalid scoring policy: %s", policy)
+	}
 
-	// Placeholder implementation - replace with actual logic
-	return len(selectedOptions) > 0
+	if policy == models.ScoringNegativeMarking && negativeMarkRatio <= 0 {
+		return "", fmt.Errorf("invalid scoring policy: negative marking requires a negative_mark_ratio above 0")
+	}
+
+	return policy, nil
+}
+
+// Helper method to validate the late policy of an exam request, defaulting to reject
+func resolveLatePolicy(policy models.LatePolicy) (models.LatePolicy, error) {
+	if policy == "" {
+		return models.LateReject, nil
+	}
+
+	if !policy.IsValid() {
+		return "", fmt.Errorf("invalid late policy: %s", policy)
+	}
+
+	return policy, nil
+}
+
+// Helper method to validate the keep-score policy of an exam request, defaulting to best
+func resolveKeepScorePolicy(policy models.KeepScorePolicy) (models.KeepScorePolicy, error) {
+	if policy == "" {
+		return models.KeepBestScore, nil
+	}
+
+	if !policy.IsValid() {
+		return "", fmt.Errorf("invalid keep score policy: %s", policy)
+	}
+
+	return policy, nil
 }
 
 // Helper method to convert UserExam to UserExamResponse
 func (s *ExamService) convertUserExamToResponse(userExam *models.UserExam, exam *models.Exam) *models.UserExamResponse {
-	response := &models.UserExamResponse{
-		ID:           userExam.ID,
-		Status:       userExam.Status,
-		StartedAt:    userExam.StartedAt,
-		CompletedAt:  userExam.CompletedAt,
-		ExpiresAt:    userExam.ExpiresAt,
-		AttemptCount: userExam.AttemptCount,
-		MaxAttempts:  userExam.MaxAttempts,
-	}
+	return userExam.ToResponse(exam)
+}
 
-	// Calculate time left if exam is started
-	if userExam.StartedAt != nil && userExam.Status == models.UserExamStarted {
-		examDuration := time.Duration(exam.Duration) * time.Minute
-		elapsed := time.Since(*userExam.StartedAt)
-		timeLeft := int((examDuration - elapsed).Seconds())
-		if timeLeft < 0 {
-			timeLeft = 0
-		}
-		response.TimeLeft = &timeLeft
+// storeExamSession records the running attempt's timer in Redis, expiring with it
+func (s *ExamService) storeExamSession(userExam *models.UserExam, exam *models.Exam) {
+	deadline := userExam.Deadline(exam)
+	if deadline == nil {
+		return
 	}
 
-	return response
+	sessionKey := fmt.Sprintf("exam_session:%d:%d", userExam.UserID, userExam.ExamID)
+	sessionData := map[string]interface{}{
+		"started_at": userExam.StartedAt.Unix(),
+		"duration":   int(userExam.AttemptDuration(exam).Seconds()),
+		"deadline":   deadline.Unix(),
+	}
+	if err := s.redisClient.SetJSON(sessionKey, sessionData, time.Until(*deadline)); err != nil {
+		s.logger.WithError(err).Warn("Failed to store exam session in Redis")
+	}
 }
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExamTimerWorker periodically opens and closes exams at their scheduled times and
+// closes attempts that have run past their time limit, so abandoned attempts don't
+// stay started forever
+type ExamTimerWorker struct {
+	examService *ExamService
+	interval    time.Duration
+	gracePeriod time.Duration
+	logger      *logrus.Logger
+	done        chan struct{}
+}
+
+func NewExamTimerWorker(examService *ExamService, interval, gracePeriod time.Duration, logger *logrus.Logger) *ExamTimerWorker {
+	return &ExamTimerWorker{
+		examService: examService,
+		interval:    interval,
+		gracePeriod: gracePeriod,
+		logger:      logger,
+		done:        make(chan struct{}),
+	}
+}
+
+// Start runs the worker in the background until ctx is cancelled
+func (w *ExamTimerWorker) Start(ctx context.Context) {
+	go w.run(ctx)
+}
+
+// Wait blocks until the worker has finished its current sweep and exited
+func (w *ExamTimerWorker) Wait() {
+	<-w.done
+}
+
+func (w *ExamTimerWorker) run(ctx context.Context) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	w.logger.WithFields(logrus.Fields{
+		"interval":     w.interval.String(),
+		"grace_period": w.gracePeriod.String(),
+	}).Info("Exam timer worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Exam timer worker stopped")
+			return
+		case <-ticker.C:
+			w.sweep()
+		}
+	}
+}
+
+func (w *ExamTimerWorker) sweep() {
+	opened, closedExams, err := w.examService.ApplyExamSchedule(time.Now())
+	if err != nil {
+		w.logger.WithError(err).Error("Exam schedule sweep failed")
+	}
+	if opened > 0 || closedExams > 0 {
+		w.logger.WithFields(logrus.Fields{
+			"opened": opened,
+			"closed": closedExams,
+		}).Info("Applied exam schedule")
+	}
+
+	closed, err := w.examService.AutoSubmitExpiredAttempts(w.gracePeriod)
+	if err != nil {
+		w.logger.WithError(err).Error("Exam timer sweep failed")
+		return
+	}
+
+	if closed > 0 {
+		w.logger.WithField("closed", closed).Info("Auto-submitted expired exams")
+	}
+}
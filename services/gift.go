@@ -0,0 +1,390 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GIFT files hold questions separated by blank lines, each written as
+//
+//	::Title:: Question text {answers}
+//
+// The answers can be {T} or {F}; multiple choice with =right and ~wrong options,
+// where ~%50% marks a right option of a multi-select question; short answer
+// with only =answers; matching with =left -> right pairs; numeric with
+// {#answer:tolerance} or {#min..max}; or {} for an essay. Text after the answers
+// makes a missing-word question. Lines starting with // are comments, and
+// $CATEGORY: sets the tags of the questions after it.
+
+// giftFormat is the optional markup tag in front of a question's text
+var giftFormat = regexp.MustCompile(`^\[(html|markdown|plain|moodle)\]\s*`)
+
+// giftWeight is the percentage of credit in front of an answer, e.g. %50%
+var giftWeight = regexp.MustCompile(`^%(-?[0-9.]+)%`)
+
+var giftUnescape = strings.NewReplacer(`\\`, `\`, `\~`, "~", `\=`, "=", `\#`, "#", `\{`, "{", `\}`, "}", `\:`, ":", `\n`, "\n")
+
+// giftAnswer is one =answer or ~answer of a GIFT question
+type giftAnswer struct {
+	Right  bool     // written with =
+	Weight *float64 // the %n% percentage, if given
+	Text   string   // still escaped
+}
+
+// parseGIFT reads the questions of a GIFT file
+func parseGIFT(r io.Reader) ([]importedQuestion, error) {
+	scanner := newLineScanner(r)
+	questions := []importedQuestion{}
+	var categoryTags []string
+	var block []string
+	start := 0
+
+	flush := func() {
+		if len(block) > 0 {
+			if first := strings.TrimSpace(block[0]); strings.HasPrefix(first, "$CATEGORY:") {
+				categoryTags = moodleCategoryTags(strings.TrimPrefix(first, "$CATEGORY:"))
+				block = block[1:]
+				start++
+			}
+		}
+		if len(block) > 0 {
+			imported := convertGIFTQuestion(strings.Join(block, "\n"), categoryTags)
+			imported.Line = start
+			questions = append(questions, imported)
+		}
+		block = nil
+	}
+
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmed, "//") {
+			continue
+		}
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		if len(block) == 0 {
+			start = line
+		}
+		block = append(block, text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid import file: %v", err)
+	}
+	flush()
+
+	return questions, nil
+}
+
+func convertGIFTQuestion(text string, categoryTags []string) importedQuestion {
+	imported := importedQuestion{}
+	req := &imported.Request
+	req.Tags = append([]string{}, categoryTags...)
+	text = strings.TrimSpace(text)
+
+	title := ""
+	if strings.HasPrefix(text, "::") {
+		if end := indexUnescaped(text[2:], "::"); end >= 0 {
+			title = giftUnescape.Replace(text[2 : 2+end])
+			text = strings.TrimSpace(text[4+end:])
+		}
+	}
+
+	req.ContentFormat = models.FormatPlain
+	if match := giftFormat.FindStringSubmatch(text); match != nil {
+		switch match[1] {
+		case "html":
+			req.ContentFormat = models.FormatHTML
+		case "markdown":
+			req.ContentFormat = models.FormatMarkdown
+		}
+		text = text[len(match[0]):]
+	}
+
+	open := indexUnescaped(text, "{")
+	if open < 0 {
+		req.Content = strings.TrimSpace(giftUnescape.Replace(text))
+		req.Title = importTitle(title, req.Content)
+		imported.Err = fmt.Errorf("GIFT question has no answers")
+		return imported
+	}
+	end := indexUnescaped(text[open:], "}")
+	if end < 0 {
+		req.Content = strings.TrimSpace(giftUnescape.Replace(text[:open]))
+		req.Title = importTitle(title, req.Content)
+		imported.Err = fmt.Errorf("GIFT question has an unclosed {")
+		return imported
+	}
+	end += open
+
+	// Text after the answers makes a missing-word question
+	req.Content = strings.TrimSpace(giftUnescape.Replace(text[:open]))
+	if after := strings.TrimSpace(text[end+1:]); after != "" {
+		req.Content += " _____ " + giftUnescape.Replace(after)
+	}
+	req.Title = importTitle(title, req.Content)
+
+	answers := text[open+1 : end]
+	if feedback := indexUnescaped(answers, "####"); feedback >= 0 {
+		req.Explanation = strings.TrimSpace(giftUnescape.Replace(answers[feedback+4:]))
+		answers = answers[:feedback]
+	}
+	imported.Err = convertGIFTAnswers(strings.TrimSpace(answers), &imported)
+
+	return imported
+}
+
+func convertGIFTAnswers(answers string, imported *importedQuestion) error {
+	req := &imported.Request
+
+	if answers == "" {
+		req.Type = models.Essay
+		return nil
+	}
+	if strings.HasPrefix(answers, "#") {
+		return convertGIFTNumeric(answers[1:], imported)
+	}
+
+	value, _ := cutUnescaped(answers, "#")
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "T", "TRUE":
+		req.Type = models.TrueFalse
+		req.Options = trueFalseOptions(true)
+		return nil
+	case "F", "FALSE":
+		req.Type = models.TrueFalse
+		req.Options = trueFalseOptions(false)
+		return nil
+	}
+
+	parsed, err := splitGIFTAnswers(answers, imported)
+	if err != nil {
+		return err
+	}
+
+	allRight := true
+	pairs := false
+	for _, answer := range parsed {
+		allRight = allRight && answer.Right
+		pairs = pairs || indexUnescaped(answer.Text, "->") >= 0
+	}
+
+	switch {
+	case allRight && pairs:
+		req.Type = models.Matching
+		choices := map[string]string{} // right-hand text to choice ID
+		for _, answer := range parsed {
+			left, right := cutUnescaped(answer.Text, "->")
+			left, right = giftText(left), giftText(right)
+			choiceID, ok := choices[right]
+			if !ok {
+				choiceID = "m" + strconv.Itoa(len(choices)+1)
+				choices[right] = choiceID
+				req.MatchChoices = append(req.MatchChoices, models.Option{ID: choiceID, Text: right})
+			}
+			// Pairs without a left-hand side only add a distractor
+			if left != "" {
+				req.Options = append(req.Options, models.Option{ID: importOptionID(len(req.Options)), Text: left, MatchID: choiceID})
+			}
+		}
+
+	case allRight:
+		req.Type = models.ShortAnswer
+		blank := models.Blank{ID: "1"}
+		for i, answer := range parsed {
+			if answer.Weight != nil && *answer.Weight < 100 {
+				imported.Warnings = append(imported.Warnings, fmt.Sprintf("answer %d gives %g%% partial credit and is left out", i+1, *answer.Weight))
+				continue
+			}
+			blank.Accepted = append(blank.Accepted, models.AcceptedAnswer{Text: giftText(answer.Text), Match: models.MatchCaseInsensitive})
+		}
+		req.Blanks = []models.Blank{blank}
+
+	default:
+		// Without an =answer, weighted ~answers are the right options of a
+		// multi-select question
+		req.Type = models.MultipleChoice
+		multiple := true
+		for _, answer := range parsed {
+			if answer.Right {
+				multiple = false
+			}
+		}
+		req.SelectionMode = models.SelectSingle
+		if multiple {
+			req.SelectionMode = models.SelectMultiple
+		}
+
+		for i, answer := range parsed {
+			option := models.Option{ID: importOptionID(i), Text: giftText(answer.Text)}
+			weight := 0.0
+			if answer.Weight != nil {
+				weight = *answer.Weight
+			}
+			switch {
+			case answer.Right:
+				option.IsCorrect = true
+			case multiple:
+				option.IsCorrect = weight > 0
+				if weight < 0 {
+					imported.Warnings = append(imported.Warnings, fmt.Sprintf("answer %s deducts %g%%; penalties come from the exam's scoring policy", option.ID, -weight))
+				}
+			case weight > 0:
+				imported.Warnings = append(imported.Warnings, fmt.Sprintf("answer %s gives %g%% partial credit and is imported as incorrect", option.ID, weight))
+			}
+			req.Options = append(req.Options, option)
+		}
+	}
+
+	return nil
+}
+
+// convertGIFTNumeric reads a numeric answer: "answer:tolerance", "min..max" or a
+// list of =alternatives, of which the first fully correct one is imported
+func convertGIFTNumeric(answers string, imported *importedQuestion) error {
+	req := &imported.Request
+	req.Type = models.Numeric
+
+	alternatives := []giftAnswer{{Right: true, Text: answers}}
+	if strings.HasPrefix(strings.TrimSpace(answers), "=") {
+		parsed, err := splitGIFTAnswers(answers, imported)
+		if err != nil {
+			return err
+		}
+		alternatives = parsed
+	}
+
+	for i, alternative := range alternatives {
+		if !alternative.Right || (alternative.Weight != nil && *alternative.Weight < 100) {
+			continue
+		}
+		if req.Numeric != nil {
+			imported.Warnings = append(imported.Warnings, fmt.Sprintf("answer %d is left out, only one fully correct answer is imported", i+1))
+			continue
+		}
+
+		text := giftText(alternative.Text)
+		key := &models.NumericKey{ToleranceType: models.ToleranceAbsolute}
+		var err error
+		if low, high, ok := strings.Cut(text, ".."); ok {
+			var min, max float64
+			if min, err = strconv.ParseFloat(strings.TrimSpace(low), 64); err == nil {
+				max, err = strconv.ParseFloat(strings.TrimSpace(high), 64)
+			}
+			key.Answer = (min + max) / 2
+			key.Tolerance = math.Abs(max-min) / 2
+		} else if answer, tolerance, ok := strings.Cut(text, ":"); ok {
+			if key.Answer, err = strconv.ParseFloat(strings.TrimSpace(answer), 64); err == nil {
+				key.Tolerance, err = strconv.ParseFloat(strings.TrimSpace(tolerance), 64)
+				key.Tolerance = math.Abs(key.Tolerance)
+			}
+		} else {
+			key.Answer, err = strconv.ParseFloat(text, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("numeric answer %q is not a number", text)
+		}
+		req.Numeric = key
+	}
+	if req.Numeric == nil {
+		return fmt.Errorf("numeric question has no fully correct answer")
+	}
+	return nil
+}
+
+// splitGIFTAnswers splits a list of =answers and ~answers, dropping per-answer
+// feedback
+func splitGIFTAnswers(answers string, imported *importedQuestion) ([]giftAnswer, error) {
+	parsed := []giftAnswer{}
+	feedback := false
+
+	rest := strings.TrimSpace(answers)
+	if rest != "" && rest[0] != '=' && rest[0] != '~' {
+		return nil, fmt.Errorf("GIFT answers must start with = or ~")
+	}
+	for rest != "" {
+		answer := giftAnswer{Right: rest[0] == '='}
+		rest = rest[1:]
+
+		next := indexUnescapedAny(rest, "=~")
+		text := rest
+		if next >= 0 {
+			text, rest = rest[:next], rest[next:]
+		} else {
+			rest = ""
+		}
+
+		text = strings.TrimSpace(text)
+		if match := giftWeight.FindStringSubmatch(text); match != nil {
+			weight, err := strconv.ParseFloat(match[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid answer weight %q", match[0])
+			}
+			answer.Weight = &weight
+			text = text[len(match[0]):]
+		}
+		if before, _ := cutUnescaped(text, "#"); len(before) < len(text) {
+			feedback = true
+			text = before
+		}
+		answer.Text = strings.TrimSpace(text)
+		parsed = append(parsed, answer)
+	}
+
+	if feedback {
+		imported.Warnings = append(imported.Warnings, "answer feedback is not imported")
+	}
+	return parsed, nil
+}
+
+// giftText unescapes the text of an answer
+func giftText(text string) string {
+	return strings.TrimSpace(giftUnescape.Replace(text))
+}
+
+// indexUnescaped finds sep in s outside of backslash escapes, or returns -1
+func indexUnescaped(s, sep string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexUnescapedAny finds the first of chars in s outside of backslash escapes,
+// or returns -1
+func indexUnescapedAny(s, chars string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte(chars, s[i]) >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// cutUnescaped splits s around the first unescaped sep
+func cutUnescaped(s, sep string) (string, string) {
+	if i := indexUnescaped(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):]
+	}
+	return s, ""
+}
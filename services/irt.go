@@ -0,0 +1,348 @@
+package services
+
+import (
+	"exam-system/models"
+	"math"
+)
+
+// Item response theory puts candidates and questions on one scale. A candidate's
+// ability and a question's difficulty are measured in logits, and the chance of
+// a correct answer rises with ability along the question's logistic curve,
+// steeper for questions that discriminate better. Abilities are taken to be
+// standard normal across candidates, which fixes where the scale sits.
+
+const (
+	DefaultCalibrationModel        = models.IRT2PL
+	DefaultMinCalibrationResponses = 30
+
+	abilityBound         = 4.0 // abilities are integrated over [-abilityBound, abilityBound]
+	quadraturePoints     = 81
+	calibrationCycles    = 500
+	calibrationTolerance = 1e-4
+	newtonSteps          = 10
+	minDiscrimination    = 0.1
+	maxDiscrimination    = 4.0
+	difficultyBound      = 6.0
+)
+
+// ItemResponse is one scored answer to a question with known parameters
+type ItemResponse struct {
+	Parameters models.ItemParameters
+	Correct    bool
+}
+
+// AbilityEstimate is an expected a posteriori ability with its standard error
+type AbilityEstimate struct {
+	Ability float64 `json:"ability"`
+	SE      float64 `json:"se"`
+}
+
+// ResponsePattern is one candidate's answers by item: 1 for correct, 0 for
+// wrong and -1 for an item they were not given
+type ResponsePattern []int
+
+// CalibrationFit is the outcome of calibrating a set of items
+type CalibrationFit struct {
+	Items         []models.ItemParameters
+	Cycles        int
+	Converged     bool
+	LogLikelihood float64 // marginal log-likelihood of the responses
+}
+
+// ItemProbability is the chance that a candidate of the given ability answers
+// the item correctly
+func ItemProbability(item models.ItemParameters, ability float64) float64 {
+	return 1 / (1 + math.Exp(-item.Discrimination*(ability-item.Difficulty)))
+}
+
+// ItemInformation is how much an answer to the item tells about an ability
+// near the given one; it peaks where the item's difficulty meets the ability
+func ItemInformation(item models.ItemParameters, ability float64) float64 {
+	p := ItemProbability(item, ability)
+	return item.Discrimination * item.Discrimination * p * (1 - p)
+}
+
+// EstimateAbility returns the expected a posteriori ability given the responses,
+// starting from a standard normal prior. Without responses it is the prior:
+// ability 0 with standard error 1.
+func EstimateAbility(responses []ItemResponse) AbilityEstimate {
+	nodes, logWeights := abilityQuadrature()
+
+	logPosterior := make([]float64, len(nodes))
+	for k, ability := range nodes {
+		logPosterior[k] = logWeights[k]
+		for _, response := range responses {
+			logPosterior[k] += responseLogLikelihood(response.Parameters, ability, response.Correct)
+		}
+	}
+	posterior, _ := normalizeLog(logPosterior)
+
+	estimate := 0.0
+	for k, ability := range nodes {
+		estimate += posterior[k] * ability
+	}
+	spread := 0.0
+	for k, ability := range nodes {
+		spread += posterior[k] * (ability - estimate) * (ability - estimate)
+	}
+
+	return AbilityEstimate{Ability: estimate, SE: math.Sqrt(spread)}
+}
+
+// SelectItem returns the index of the item that is most informative at the
+// ability, the first one on ties, or -1 when there are no items
+func SelectItem(items []models.ItemParameters, ability float64) int {
+	best, bestInformation := -1, -1.0
+	for i, item := range items {
+		if information := ItemInformation(item, ability); information > bestInformation {
+			best, bestInformation = i, information
+		}
+	}
+	return best
+}
+
+// CalibrateItems estimates the parameters of itemCount items from the response
+// patterns by marginal maximum likelihood: an EM algorithm that integrates every
+// candidate's ability over a standard normal and refits each item by Fisher
+// scoring. Under the 1PL model every discrimination stays at 1. Items that every
+// candidate answered correctly, or every candidate got wrong, have no finite
+// estimate and should be left out by the caller; the estimates are bounded so
+// they can't run away regardless.
+func CalibrateItems(patterns []ResponsePattern, itemCount int, model models.IRTModel) CalibrationFit {
+	nodes, logWeights := abilityQuadrature()
+
+	items := make([]models.ItemParameters, itemCount)
+	for i := range items {
+		correct, answered := 0, 0
+		for _, pattern := range patterns {
+			if pattern[i] >= 0 {
+				answered++
+				correct += pattern[i]
+			}
+		}
+		p := (float64(correct) + 0.5) / (float64(answered) + 1)
+		items[i] = models.ItemParameters{
+			Model:          model,
+			Discrimination: 1,
+			Difficulty:     clamp(-math.Log(p/(1-p)), -difficultyBound, difficultyBound),
+		}
+	}
+
+	fit := CalibrationFit{Items: items}
+	answered := make([][]float64, itemCount) // expected answers at each ability node
+	correct := make([][]float64, itemCount)  // expected correct answers at each ability node
+	for i := range items {
+		answered[i] = make([]float64, len(nodes))
+		correct[i] = make([]float64, len(nodes))
+	}
+
+	for fit.Cycles < calibrationCycles {
+		fit.Cycles++
+
+		// E step: share each candidate out over the ability nodes by how well
+		// each node explains their answers
+		logCorrect, logWrong := itemLogLikelihoods(items, nodes)
+		for i := range items {
+			for k := range nodes {
+				answered[i][k], correct[i][k] = 0, 0
+			}
+		}
+		fit.LogLikelihood = 0
+		logPosterior := make([]float64, len(nodes))
+		for _, pattern := range patterns {
+			copy(logPosterior, logWeights)
+			for i, response := range pattern {
+				for k := range nodes {
+					switch response {
+					case 1:
+						logPosterior[k] += logCorrect[i][k]
+					case 0:
+						logPosterior[k] += logWrong[i][k]
+					}
+				}
+			}
+			posterior, logMarginal := normalizeLog(logPosterior)
+			fit.LogLikelihood += logMarginal
+
+			for i, response := range pattern {
+				if response < 0 {
+					continue
+				}
+				for k := range nodes {
+					answered[i][k] += posterior[k]
+					if response == 1 {
+						correct[i][k] += posterior[k]
+					}
+				}
+			}
+		}
+
+		// M step: refit every item to its expected answers
+		change := 0.0
+		for i := range items {
+			before := items[i]
+			fitItem(&items[i], nodes, answered[i], correct[i])
+			change = math.Max(change, math.Abs(items[i].Difficulty-before.Difficulty))
+			change = math.Max(change, math.Abs(items[i].Discrimination-before.Discrimination))
+		}
+		if change < calibrationTolerance {
+			fit.Converged = true
+			break
+		}
+	}
+
+	for i := range items {
+		setStandardErrors(&items[i], nodes, answered[i], correct[i])
+	}
+	return fit
+}
+
+// fitItem maximizes an item's expected log-likelihood by Fisher scoring
+func fitItem(item *models.ItemParameters, nodes, answered, correct []float64) {
+	for step := 0; step < newtonSteps; step++ {
+		gradientA, gradientB := 0.0, 0.0
+		infoAA, infoAB, infoBB := 0.0, 0.0, 0.0
+		for k, ability := range nodes {
+			p := ItemProbability(*item, ability)
+			residual := correct[k] - answered[k]*p
+			weight := answered[k] * p * (1 - p)
+			distance := ability - item.Difficulty
+
+			gradientA += distance * residual
+			gradientB -= item.Discrimination * residual
+			infoAA += distance * distance * weight
+			infoAB -= item.Discrimination * distance * weight
+			infoBB += item.Discrimination * item.Discrimination * weight
+		}
+
+		deltaA, deltaB := 0.0, 0.0
+		if item.Model == models.IRT2PL {
+			determinant := infoAA*infoBB - infoAB*infoAB
+			if determinant <= 0 {
+				return
+			}
+			deltaA = (infoBB*gradientA - infoAB*gradientB) / determinant
+			deltaB = (infoAA*gradientB - infoAB*gradientA) / determinant
+		} else {
+			if infoBB <= 0 {
+				return
+			}
+			deltaB = gradientB / infoBB
+		}
+
+		// Long steps overshoot while the estimates are still far off
+		deltaA = clamp(deltaA, -1, 1)
+		deltaB = clamp(deltaB, -1, 1)
+		item.Discrimination = clamp(item.Discrimination+deltaA, minDiscrimination, maxDiscrimination)
+		item.Difficulty = clamp(item.Difficulty+deltaB, -difficultyBound, difficultyBound)
+
+		if math.Abs(deltaA) < calibrationTolerance/10 && math.Abs(deltaB) < calibrationTolerance/10 {
+			return
+		}
+	}
+}
+
+// setStandardErrors puts the standard errors of the estimates on a calibrated
+// item, from the inverse of its information at the final expected answers
+func setStandardErrors(item *models.ItemParameters, nodes, answered, correct []float64) {
+	infoAA, infoAB, infoBB := 0.0, 0.0, 0.0
+	for k, ability := range nodes {
+		p := ItemProbability(*item, ability)
+		weight := answered[k] * p * (1 - p)
+		distance := ability - item.Difficulty
+		infoAA += distance * distance * weight
+		infoAB -= item.Discrimination * distance * weight
+		infoBB += item.Discrimination * item.Discrimination * weight
+	}
+
+	if item.Model == models.IRT2PL {
+		determinant := infoAA*infoBB - infoAB*infoAB
+		if determinant <= 0 {
+			return
+		}
+		seA := math.Sqrt(infoBB / determinant)
+		seB := math.Sqrt(infoAA / determinant)
+		item.DiscriminationSE = &seA
+		item.DifficultySE = &seB
+		return
+	}
+
+	if infoBB > 0 {
+		seB := 1 / math.Sqrt(infoBB)
+		item.DifficultySE = &seB
+	}
+}
+
+// abilityQuadrature returns evenly spaced ability nodes with the log of their
+// standard normal weights
+func abilityQuadrature() ([]float64, []float64) {
+	nodes := make([]float64, quadraturePoints)
+	logWeights := make([]float64, quadraturePoints)
+	for k := range nodes {
+		nodes[k] = -abilityBound + 2*abilityBound*float64(k)/float64(quadraturePoints-1)
+		logWeights[k] = -nodes[k] * nodes[k] / 2
+	}
+	normalized, _ := normalizeLog(logWeights)
+	for k := range logWeights {
+		logWeights[k] = math.Log(normalized[k])
+	}
+	return nodes, logWeights
+}
+
+// itemLogLikelihoods tabulates the log chance of a correct and a wrong answer to
+// every item at every ability node
+func itemLogLikelihoods(items []models.ItemParameters, nodes []float64) ([][]float64, [][]float64) {
+	logCorrect := make([][]float64, len(items))
+	logWrong := make([][]float64, len(items))
+	for i, item := range items {
+		logCorrect[i] = make([]float64, len(nodes))
+		logWrong[i] = make([]float64, len(nodes))
+		for k, ability := range nodes {
+			logCorrect[i][k] = responseLogLikelihood(item, ability, true)
+			logWrong[i][k] = responseLogLikelihood(item, ability, false)
+		}
+	}
+	return logCorrect, logWrong
+}
+
+// responseLogLikelihood is the log chance of the response at the ability,
+// computed without overflow for items far from the ability
+func responseLogLikelihood(item models.ItemParameters, ability float64, correct bool) float64 {
+	logit := item.Discrimination * (ability - item.Difficulty)
+	if correct {
+		return -softplus(-logit)
+	}
+	return -softplus(logit)
+}
+
+// softplus is log(1 + e^x)
+func softplus(x float64) float64 {
+	if x > 0 {
+		return x + math.Log1p(math.Exp(-x))
+	}
+	return math.Log1p(math.Exp(x))
+}
+
+// normalizeLog turns log weights into probabilities and returns the log of
+// their total
+func normalizeLog(logWeights []float64) ([]float64, float64) {
+	largest := math.Inf(-1)
+	for _, w := range logWeights {
+		largest = math.Max(largest, w)
+	}
+
+	total := 0.0
+	probabilities := make([]float64, len(logWeights))
+	for k, w := range logWeights {
+		probabilities[k] = math.Exp(w - largest)
+		total += probabilities[k]
+	}
+	for k := range probabilities {
+		probabilities[k] /= total
+	}
+	return probabilities, largest + math.Log(total)
+}
+
+func clamp(value, low, high float64) float64 {
+	return math.Max(low, math.Min(high, value))
+}
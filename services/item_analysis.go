@@ -0,0 +1,502 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"math"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Classical item analysis of graded results. Each answer scores the share of its
+// points the candidate earned, from 0 to 1; answers to a dropped question score
+// 1 when they matched the key, so the analysis shows how candidates really did.
+//
+//   - p-value: mean item score, the share of candidates who got the item right
+//   - point-biserial: correlation of the item score with the rest of the exam
+//     (the total without the item, so the item doesn't correlate with itself)
+//   - upper/lower index: p-value of the top 27% of candidates by total score
+//     minus that of the bottom 27%
+//   - distractors: how often each option was picked, overall and in both groups
+//   - reliability: KR-20 when every item is scored right or wrong, Cronbach's
+//     alpha always, both over candidates who answered the same items
+
+const (
+	DefaultEasyAbove = 0.9 // items with a higher p-value are flagged too easy
+	DefaultHardBelow = 0.2 // items with a lower p-value are flagged too hard
+
+	itemGroupShare = 0.27 // share of candidates in the upper and lower groups
+)
+
+type ItemFlag string
+
+const (
+	FlagTooEasy                ItemFlag = "too_easy"
+	FlagTooHard                ItemFlag = "too_hard"
+	FlagNegativeDiscrimination ItemFlag = "negative_discrimination"
+)
+
+type ItemAnalysisOptions struct {
+	EasyAbove float64
+	HardBelow float64
+}
+
+type OptionStatistics struct {
+	OptionID        string  `json:"option_id"`
+	Text            string  `json:"text"`
+	IsCorrect       bool    `json:"is_correct"`
+	Count           int     `json:"count"`
+	Proportion      float64 `json:"proportion"`       // of the candidates who had the item
+	UpperProportion float64 `json:"upper_proportion"` // of the upper group
+	LowerProportion float64 `json:"lower_proportion"` // of the lower group
+	Discrimination  float64 `json:"discrimination"`   // upper minus lower; negative for a working distractor
+}
+
+type ItemStatistics struct {
+	QuestionID      uint                `json:"question_id"`
+	QuestionTitle   string              `json:"question_title"`
+	Type            models.QuestionType `json:"type"`
+	Responses       int                 `json:"responses"` // candidates who had the item
+	Omitted         int                 `json:"omitted"`   // of which left it unanswered
+	PValue          float64             `json:"p_value"`
+	PointBiserial   *float64            `json:"point_biserial"`    // not set without spread in the scores
+	UpperLowerIndex *float64            `json:"upper_lower_index"` // not set with fewer than two candidates
+	UpperPValue     float64             `json:"upper_p_value"`
+	LowerPValue     float64             `json:"lower_p_value"`
+	Options         []OptionStatistics  `json:"options,omitempty"` // choice questions only
+	Flags           []ItemFlag          `json:"flags"`
+}
+
+type ReliabilityStatistics struct {
+	Candidates int      `json:"candidates"`
+	Items      int      `json:"items"`
+	MeanScore  float64  `json:"mean_score"` // in item scores, out of Items
+	StdDev     float64  `json:"std_dev"`
+	KR20       *float64 `json:"kr20,omitempty"`  // only when every item is scored right or wrong
+	Alpha      *float64 `json:"alpha,omitempty"` // Cronbach's alpha
+	SEM        *float64 `json:"sem,omitempty"`   // standard error of measurement, from alpha
+	Note       string   `json:"note,omitempty"`
+}
+
+type ItemAnalysisResponse struct {
+	ExamID      uint                   `json:"exam_id,omitempty"`
+	ExamTitle   string                 `json:"exam_title,omitempty"`
+	Candidates  int                    `json:"candidates"` // graded results analysed
+	EasyAbove   float64                `json:"easy_above"`
+	HardBelow   float64                `json:"hard_below"`
+	Items       []ItemStatistics       `json:"items"`
+	Reliability *ReliabilityStatistics `json:"reliability,omitempty"`
+}
+
+// itemResponse is one candidate's answer to an item, with the criterion the item
+// is correlated with and the total the candidates are ranked by
+type itemResponse struct {
+	score    float64
+	rest     float64
+	total    float64
+	answered bool
+	selected []string
+}
+
+// GetExamItemAnalysis analyses the items of an exam over its graded results
+func (s *ResultService) GetExamItemAnalysis(examID uint, opts ItemAnalysisOptions) (*ItemAnalysisResponse, error) {
+	opts = resolveItemAnalysisOptions(opts)
+
+	var exam models.Exam
+	if err := s.db.Unscoped().Where("id = ?", examID).First(&exam).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("exam not found")
+		}
+		s.logger.WithError(err).Error("Failed to get exam")
+		return nil, fmt.Errorf("failed to get item analysis")
+	}
+
+	var results []models.Result
+	if err := s.db.Where("exam_id = ? AND status = ?", examID, models.ResultGraded).Order("id").Find(&results).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get results")
+		return nil, fmt.Errorf("failed to get item analysis")
+	}
+
+	// Items in the order they first appear, which for fixed exams is the exam's order
+	questionIDs := []uint{}
+	scores := make([]map[uint]float64, len(results))
+	totals := make([]float64, len(results))
+	for i, result := range results {
+		scores[i] = make(map[uint]float64, len(result.Answers))
+		for _, answer := range result.Answers {
+			if !containsID(questionIDs, answer.QuestionID) {
+				questionIDs = append(questionIDs, answer.QuestionID)
+			}
+			scores[i][answer.QuestionID] = itemScore(answer)
+			totals[i] += scores[i][answer.QuestionID]
+		}
+	}
+
+	questions, err := s.loadQuestions(s.db, questionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item analysis")
+	}
+
+	response := &ItemAnalysisResponse{
+		ExamID:     exam.ID,
+		ExamTitle:  exam.Title,
+		Candidates: len(results),
+		EasyAbove:  opts.EasyAbove,
+		HardBelow:  opts.HardBelow,
+		Items:      []ItemStatistics{},
+	}
+	for _, questionID := range questionIDs {
+		responses := []itemResponse{}
+		for i, result := range results {
+			for _, answer := range result.Answers {
+				if answer.QuestionID != questionID {
+					continue
+				}
+				responses = append(responses, itemResponse{
+					score:    scores[i][questionID],
+					rest:     totals[i] - scores[i][questionID],
+					total:    totals[i],
+					answered: isAnswered(answer),
+					selected: answer.SelectedOptions,
+				})
+			}
+		}
+
+		question := questions[questionID]
+		question.ID = questionID
+		response.Items = append(response.Items, analyzeItem(&question, responses, opts))
+	}
+	response.Reliability = examReliability(questionIDs, scores)
+
+	return response, nil
+}
+
+// GetQuestionItemAnalysis analyses a question over the graded results of every
+// exam that used it. As exams differ in length, candidates are ranked by their
+// percentage score, and the item is correlated with their share of the points of
+// the rest of their exam.
+func (s *ResultService) GetQuestionItemAnalysis(questionID uint, opts ItemAnalysisOptions) (*ItemAnalysisResponse, error) {
+	opts = resolveItemAnalysisOptions(opts)
+
+	questions, err := s.loadQuestions(s.db, []uint{questionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item analysis")
+	}
+	question, ok := questions[questionID]
+	if !ok {
+		return nil, fmt.Errorf("question not found")
+	}
+
+	examIDs, err := examsUsingQuestion(s.db, questionID)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get exams using question")
+		return nil, fmt.Errorf("failed to get item analysis")
+	}
+
+	var results []models.Result
+	if len(examIDs) > 0 {
+		if err := s.db.Where("exam_id IN ? AND status = ?", examIDs, models.ResultGraded).Order("id").Find(&results).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to get results")
+			return nil, fmt.Errorf("failed to get item analysis")
+		}
+	}
+
+	responses := []itemResponse{}
+	for _, result := range results {
+		for _, answer := range result.Answers {
+			if answer.QuestionID != questionID {
+				continue
+			}
+
+			rest := 0.0
+			if restMax := float64(result.MaxPoints - answer.MaxPoints); restMax > 0 {
+				rest = (result.TotalPoints - answer.Points) / restMax
+			}
+			responses = append(responses, itemResponse{
+				score:    itemScore(answer),
+				rest:     rest,
+				total:    result.Score,
+				answered: isAnswered(answer),
+				selected: answer.SelectedOptions,
+			})
+		}
+	}
+
+	return &ItemAnalysisResponse{
+		Candidates: len(responses),
+		EasyAbove:  opts.EasyAbove,
+		HardBelow:  opts.HardBelow,
+		Items:      []ItemStatistics{analyzeItem(&question, responses, opts)},
+	}, nil
+}
+
+func resolveItemAnalysisOptions(opts ItemAnalysisOptions) ItemAnalysisOptions {
+	if opts.EasyAbove == 0 {
+		opts.EasyAbove = DefaultEasyAbove
+	}
+	if opts.HardBelow == 0 {
+		opts.HardBelow = DefaultHardBelow
+	}
+	return opts
+}
+
+// itemScore is the share of an answer's points the candidate earned, from 0 to 1
+func itemScore(answer models.Answer) float64 {
+	if answer.Adjustment != nil && answer.Adjustment.Mode == models.RegradeDropQuestion {
+		if answer.IsCorrect {
+			return 1
+		}
+		return 0
+	}
+	if answer.MaxPoints <= 0 {
+		if answer.IsCorrect {
+			return 1
+		}
+		return 0
+	}
+	return math.Max(0, math.Min(1, answer.Points/float64(answer.MaxPoints)))
+}
+
+func isAnswered(answer models.Answer) bool {
+	if answer.Grading != nil {
+		return answer.Grading.Answered
+	}
+	return len(answer.SelectedOptions) > 0 || len(answer.TextAnswers) > 0 || answer.NumericAnswer != nil || len(answer.Matches) > 0 || answer.Essay != ""
+}
+
+// analyzeItem computes the statistics of one item from the candidates' responses
+func analyzeItem(question *models.Question, responses []itemResponse, opts ItemAnalysisOptions) ItemStatistics {
+	stats := ItemStatistics{
+		QuestionID:    question.ID,
+		QuestionTitle: question.Title,
+		Type:          question.Type,
+		Responses:     len(responses),
+		Flags:         []ItemFlag{},
+	}
+	if len(responses) == 0 {
+		return stats
+	}
+
+	itemScores := make([]float64, len(responses))
+	rests := make([]float64, len(responses))
+	for i, response := range responses {
+		itemScores[i] = response.score
+		rests[i] = response.rest
+		if !response.answered {
+			stats.Omitted++
+		}
+	}
+	stats.PValue = roundStatistic(mean(itemScores))
+	if r, ok := correlation(itemScores, rests); ok {
+		r = roundStatistic(r)
+		stats.PointBiserial = &r
+	}
+
+	upper, lower := itemGroups(responses)
+	if len(upper) > 0 && len(lower) > 0 && len(responses) >= 2 {
+		stats.UpperPValue = roundStatistic(groupMean(upper))
+		stats.LowerPValue = roundStatistic(groupMean(lower))
+		index := roundStatistic(stats.UpperPValue - stats.LowerPValue)
+		stats.UpperLowerIndex = &index
+	}
+
+	if question.Type == models.MultipleChoice || question.Type == models.TrueFalse {
+		stats.Options = optionStatistics(question, responses, upper, lower)
+	}
+
+	if stats.PValue > opts.EasyAbove {
+		stats.Flags = append(stats.Flags, FlagTooEasy)
+	}
+	if stats.PValue < opts.HardBelow {
+		stats.Flags = append(stats.Flags, FlagTooHard)
+	}
+	if (stats.PointBiserial != nil && *stats.PointBiserial < 0) || (stats.UpperLowerIndex != nil && *stats.UpperLowerIndex < 0) {
+		stats.Flags = append(stats.Flags, FlagNegativeDiscrimination)
+	}
+
+	return stats
+}
+
+// itemGroups splits the responses into the upper and lower 27% of candidates by
+// total score. Ties at the cut-off go by the order of the results.
+func itemGroups(responses []itemResponse) ([]itemResponse, []itemResponse) {
+	ranked := make([]itemResponse, len(responses))
+	copy(ranked, responses)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].total > ranked[j].total
+	})
+
+	size := int(math.Round(float64(len(ranked)) * itemGroupShare))
+	if size < 1 {
+		size = 1
+	}
+	if size > len(ranked)/2 {
+		size = len(ranked) / 2
+	}
+	return ranked[:size], ranked[len(ranked)-size:]
+}
+
+func groupMean(group []itemResponse) float64 {
+	scores := make([]float64, len(group))
+	for i, response := range group {
+		scores[i] = response.score
+	}
+	return mean(scores)
+}
+
+// optionStatistics counts how often each option of a choice question was picked
+func optionStatistics(question *models.Question, responses, upper, lower []itemResponse) []OptionStatistics {
+	share := func(group []itemResponse, optionID string) float64 {
+		if len(group) == 0 {
+			return 0
+		}
+		count := 0
+		for _, response := range group {
+			if containsString(response.selected, optionID) {
+				count++
+			}
+		}
+		return float64(count) / float64(len(group))
+	}
+
+	options := make([]OptionStatistics, len(question.Options))
+	for i, option := range question.Options {
+		stats := OptionStatistics{
+			OptionID:        option.ID,
+			Text:            option.Text,
+			IsCorrect:       option.IsCorrect,
+			Proportion:      roundStatistic(share(responses, option.ID)),
+			UpperProportion: roundStatistic(share(upper, option.ID)),
+			LowerProportion: roundStatistic(share(lower, option.ID)),
+		}
+		for _, response := range responses {
+			if containsString(response.selected, option.ID) {
+				stats.Count++
+			}
+		}
+		stats.Discrimination = roundStatistic(stats.UpperProportion - stats.LowerProportion)
+		options[i] = stats
+	}
+	return options
+}
+
+// examReliability computes KR-20 and Cronbach's alpha over the candidates who
+// answered every item. Blueprint exams draw different items per candidate, so
+// candidates are only compared when they share the whole item set.
+func examReliability(questionIDs []uint, scores []map[uint]float64) *ReliabilityStatistics {
+	reliability := &ReliabilityStatistics{Items: len(questionIDs)}
+
+	matrix := [][]float64{}
+	for _, candidate := range scores {
+		if len(candidate) != len(questionIDs) {
+			continue
+		}
+		row := make([]float64, len(questionIDs))
+		for j, questionID := range questionIDs {
+			row[j] = candidate[questionID]
+		}
+		matrix = append(matrix, row)
+	}
+	reliability.Candidates = len(matrix)
+	if len(matrix) < len(scores) {
+		reliability.Note = fmt.Sprintf("%d candidates answered a different set of items and are left out", len(scores)-len(matrix))
+	}
+	if len(matrix) < 2 || len(questionIDs) < 2 {
+		if reliability.Note == "" {
+			reliability.Note = "reliability needs at least two candidates and two items"
+		}
+		return reliability
+	}
+
+	k := float64(len(questionIDs))
+	totals := make([]float64, len(matrix))
+	for i, row := range matrix {
+		for _, score := range row {
+			totals[i] += score
+		}
+	}
+	totalVariance := variance(totals)
+	reliability.MeanScore = roundStatistic(mean(totals))
+	reliability.StdDev = roundStatistic(math.Sqrt(totalVariance))
+	if totalVariance == 0 {
+		reliability.Note = "every candidate has the same total score"
+		return reliability
+	}
+
+	itemVariances := 0.0
+	pq := 0.0
+	dichotomous := true
+	for j := range questionIDs {
+		column := make([]float64, len(matrix))
+		for i, row := range matrix {
+			column[i] = row[j]
+			if row[j] != 0 && row[j] != 1 {
+				dichotomous = false
+			}
+		}
+		itemVariances += variance(column)
+		p := mean(column)
+		pq += p * (1 - p)
+	}
+
+	alpha := k / (k - 1) * (1 - itemVariances/totalVariance)
+	sem := math.Sqrt(totalVariance) * math.Sqrt(math.Max(0, 1-alpha))
+	alpha, sem = roundStatistic(alpha), roundStatistic(sem)
+	reliability.Alpha = &alpha
+	reliability.SEM = &sem
+	if dichotomous {
+		kr20 := roundStatistic(k / (k - 1) * (1 - pq/totalVariance))
+		reliability.KR20 = &kr20
+	}
+
+	return reliability
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// variance is the population variance, as KR-20 and alpha use
+func variance(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	m := mean(values)
+	sum := 0.0
+	for _, value := range values {
+		sum += (value - m) * (value - m)
+	}
+	return sum / float64(len(values))
+}
+
+// correlation is Pearson's r, the point-biserial for a right-or-wrong item. It
+// is undefined when either side has no spread.
+func correlation(x, y []float64) (float64, bool) {
+	if len(x) < 2 {
+		return 0, false
+	}
+	mx, my := mean(x), mean(y)
+	var sxy, sxx, syy float64
+	for i := range x {
+		sxy += (x[i] - mx) * (y[i] - my)
+		sxx += (x[i] - mx) * (x[i] - mx)
+		syy += (y[i] - my) * (y[i] - my)
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return sxy / math.Sqrt(sxx*syy), true
+}
+
+// roundStatistic rounds a statistic to three decimal places
+func roundStatistic(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"errors"
+	"exam-system/config"
+	"exam-system/models"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errQuestionAlreadyAnswered is returned inside the answer transaction when another
+// request has already answered the question
+var errQuestionAlreadyAnswered = errors.New("question already answered")
+
+// In linear mode the server hands out one question at a time. It records when each
+// question was served and answered, closes questions whose TimeLimit has run out,
+// and stores the measured time instead of the client-reported TimeSpent.
+
+type LinearQuestionResponse struct {
+	Question     *models.QuestionResponse `json:"question"` // nil once every question has been answered
+	Position     int                      `json:"position"` // 1-based
+	Total        int                      `json:"total"`    // adaptive attempts: the most questions the test can run to until it stops
+	ServedAt     *time.Time               `json:"served_at,omitempty"`
+	TimeLimit    int                      `json:"time_limit"`          // in seconds, 0 means untimed
+	TimeLeft     *int                     `json:"time_left,omitempty"` // in seconds, for timed questions
+	ExamTimeLeft int                      `json:"exam_time_left"`      // in seconds
+	Finished     bool                     `json:"finished"`
+	Adaptive     bool                     `json:"adaptive,omitempty"`
+	StopReason   AdaptiveStop             `json:"stop_reason,omitempty"` // why an adaptive test finished
+}
+
+// MeasureTimeSpent returns the whole seconds between serving and answering a
+// question, capped at its time limit, and whether the answer arrived within the
+// limit plus grace. A zero limit means the question is untimed.
+func MeasureTimeSpent(servedAt, answeredAt time.Time, timeLimit int, grace time.Duration) (int, bool) {
+	spent := int(answeredAt.Sub(servedAt).Seconds())
+	if spent < 0 {
+		spent = 0
+	}
+
+	if timeLimit <= 0 {
+		return spent, true
+	}
+
+	limit := time.Duration(timeLimit) * time.Second
+	inTime := !answeredAt.After(servedAt.Add(limit + grace))
+	if spent > timeLimit {
+		spent = timeLimit
+	}
+	return spent, inTime
+}
+
+// questionTimeLimit is a question's time limit in seconds for the candidate,
+// stretched by their time multiplier
+func questionTimeLimit(userExam *models.UserExam, question *models.Question) int {
+	return int(userExam.Scale(time.Duration(question.TimeLimit) * time.Second).Seconds())
+}
+
+// GetCurrentQuestion serves the question the candidate is on in a linear attempt
+func (s *ExamService) GetCurrentQuestion(examID uint, userID uint) (*LinearQuestionResponse, error) {
+	userExam, exam, attempt, err := s.getLinearAttempt(examID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.serveCurrentQuestion(userExam, exam, attempt, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current question")
+	}
+	return response, nil
+}
+
+// AnswerCurrentQuestion records the answer to the current question of a linear
+// attempt with the server-measured time spent, then serves the next question
+func (s *ExamService) AnswerCurrentQuestion(examID uint, userID uint, req SubmitAnswerRequest) (*LinearQuestionResponse, error) {
+	userExam, exam, attempt, err := s.getLinearAttempt(examID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	timings, err := s.loadQuestionTimings(attempt.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save answer")
+	}
+
+	index, timing, err := s.currentLinearQuestion(userExam, exam, timings, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save answer")
+	}
+	if index == len(exam.ExamQuestions) {
+		return nil, fmt.Errorf("all questions have been answered")
+	}
+
+	current := exam.ExamQuestions[index]
+	if current.QuestionID != req.QuestionID {
+		// The question may have timed out while the answer was on its way, in
+		// which case currentLinearQuestion has just closed it
+		if timing := timings[req.QuestionID]; timing != nil && timing.TimedOut {
+			return nil, fmt.Errorf("question time has expired")
+		}
+		return nil, fmt.Errorf("question is not the current question")
+	}
+	if timing == nil {
+		return nil, fmt.Errorf("question has not been served")
+	}
+
+	answer, err := ValidateResponse(&current.Question, req)
+	if err != nil {
+		return nil, err
+	}
+
+	spent, _ := MeasureTimeSpent(timing.ServedAt, now, questionTimeLimit(userExam, &current.Question), config.AppConfig.Exam.GracePeriod)
+	saved := models.SavedAnswer{
+		UserExamID:      userExam.ID,
+		QuestionID:      req.QuestionID,
+		SelectedOptions: models.StringArray(answer.SelectedOptions),
+		TextAnswers:     models.StringArray(answer.TextAnswers),
+		NumericAnswer:   answer.NumericAnswer,
+		Matches:         models.StringMap(answer.Matches),
+		Essay:           answer.Essay,
+		TimeSpent:       spent,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Conditional so a question can only be answered once
+		update := tx.Model(&models.QuestionTiming{}).
+			Where("id = ? AND answered_at IS NULL", timing.ID).
+			Update("answered_at", now)
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errQuestionAlreadyAnswered
+		}
+
+		return storeSavedAnswer(tx, &saved)
+	})
+	if err == errQuestionAlreadyAnswered {
+		return nil, fmt.Errorf("question has already been answered")
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to save linear answer")
+		return nil, fmt.Errorf("failed to save answer")
+	}
+	s.cacheSavedAnswer(userExam, exam, &saved)
+
+	s.logger.WithFields(logrus.Fields{
+		"exam_id":     examID,
+		"user_id":     userID,
+		"question_id": req.QuestionID,
+		"time_spent":  spent,
+	}).Info("Linear answer recorded")
+
+	response, err := s.serveCurrentQuestion(userExam, exam, attempt, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current question")
+	}
+	return response, nil
+}
+
+// inLinearMode reports whether the user's current attempt runs in linear mode
+func (s *ExamService) inLinearMode(userExam *models.UserExam) (bool, error) {
+	attempt, err := s.currentAttempt(userExam)
+	if err != nil {
+		return false, err
+	}
+	return attempt != nil && attempt.LinearMode, nil
+}
+
+// getLinearAttempt loads an active attempt and makes sure it runs in linear mode
+func (s *ExamService) getLinearAttempt(examID uint, userID uint) (*models.UserExam, *models.Exam, *models.ExamAttempt, error) {
+	userExam, exam, err := s.getActiveAttempt(examID, userID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	attempt, err := s.currentAttempt(userExam)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get exam attempt")
+	}
+	if attempt == nil || !attempt.LinearMode {
+		return nil, nil, nil, fmt.Errorf("exam is not in linear mode")
+	}
+
+	return userExam, exam, attempt, nil
+}
+
+// serveCurrentQuestion finds the candidate's current question, records when it
+// was first served and describes it
+func (s *ExamService) serveCurrentQuestion(userExam *models.UserExam, exam *models.Exam, attempt *models.ExamAttempt, now time.Time) (*LinearQuestionResponse, error) {
+	timings, err := s.loadQuestionTimings(attempt.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	index, timing, err := s.currentLinearQuestion(userExam, exam, timings, now)
+	if err != nil {
+		return nil, err
+	}
+
+	total := len(exam.ExamQuestions)
+	var stop AdaptiveStop
+	if attempt.AdaptiveMode {
+		// Adaptive attempts are given their next question once the last is closed
+		stop, total, err = s.advanceAdaptiveTest(userExam, exam, attempt, index)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	response := &LinearQuestionResponse{
+		Position:     index + 1,
+		Total:        total,
+		ExamTimeLeft: timeLeft(userExam, exam),
+		Adaptive:     attempt.AdaptiveMode,
+	}
+	if index == len(exam.ExamQuestions) {
+		response.Position = len(exam.ExamQuestions)
+		response.Finished = true
+		response.StopReason = stop
+		return response, nil
+	}
+
+	current := exam.ExamQuestions[index]
+	if timing == nil {
+		served := models.QuestionTiming{
+			ExamAttemptID: attempt.ID,
+			QuestionID:    current.QuestionID,
+			ServedAt:      now,
+		}
+		// Two requests racing to serve the same question keep the first timestamp
+		if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&served).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to record served question")
+			return nil, err
+		}
+		if err := s.db.Where("exam_attempt_id = ? AND question_id = ?", attempt.ID, current.QuestionID).First(&served).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to get question timing")
+			return nil, err
+		}
+		timing = &served
+	}
+
+	timeLimit := questionTimeLimit(userExam, &current.Question)
+	question := current.Question.ToResponse(false)
+	response.Question = &question
+	response.ServedAt = &timing.ServedAt
+	response.TimeLimit = timeLimit
+	if timeLimit > 0 {
+		remaining := int(timing.ServedAt.Add(time.Duration(timeLimit) * time.Second).Sub(now).Seconds())
+		if remaining < 0 {
+			remaining = 0
+		}
+		response.TimeLeft = &remaining
+	}
+
+	return response, nil
+}
+
+// currentLinearQuestion returns the index of the first question without an answer
+// (len(exam.ExamQuestions) once all are done) and its timing if it has been served.
+// Served questions whose time limit has run out are closed unanswered on the way.
+func (s *ExamService) currentLinearQuestion(userExam *models.UserExam, exam *models.Exam, timings map[uint]*models.QuestionTiming, now time.Time) (int, *models.QuestionTiming, error) {
+	grace := config.AppConfig.Exam.GracePeriod
+
+	for i, eq := range exam.ExamQuestions {
+		timing := timings[eq.QuestionID]
+		if timing == nil {
+			return i, nil, nil
+		}
+		if timing.AnsweredAt != nil {
+			continue
+		}
+
+		timeLimit := questionTimeLimit(userExam, &eq.Question)
+		if _, inTime := MeasureTimeSpent(timing.ServedAt, now, timeLimit, grace); inTime {
+			return i, timing, nil
+		}
+
+		closedAt := timing.ServedAt.Add(time.Duration(timeLimit) * time.Second)
+		if err := s.db.Model(&models.QuestionTiming{}).
+			Where("id = ? AND answered_at IS NULL", timing.ID).
+			Updates(map[string]interface{}{
+				"answered_at": closedAt,
+				"timed_out":   true,
+			}).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to close timed out question")
+			return 0, nil, err
+		}
+		timing.AnsweredAt = &closedAt
+		timing.TimedOut = true
+
+		s.logger.WithFields(logrus.Fields{
+			"user_exam_id": userExam.ID,
+			"question_id":  eq.QuestionID,
+		}).Info("Question closed after its time limit")
+	}
+
+	return len(exam.ExamQuestions), nil, nil
+}
+
+// loadQuestionTimings returns the timings recorded for an attempt by question ID
+func (s *ExamService) loadQuestionTimings(attemptID uint) (map[uint]*models.QuestionTiming, error) {
+	var rows []models.QuestionTiming
+	if err := s.db.Where("exam_attempt_id = ?", attemptID).Find(&rows).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to load question timings")
+		return nil, err
+	}
+
+	timings := make(map[uint]*models.QuestionTiming, len(rows))
+	for i := range rows {
+		timings[rows[i].QuestionID] = &rows[i]
+	}
+	return timings, nil
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Results with written essays are stored as pending_grading. Graders work through
+// the queue of unmarked essays of an exam, score each one, and finalize the result
+// once every essay is marked, which recomputes its score and pass mark.
+
+type GradingQueueItem struct {
+	ResultID      uint                     `json:"result_id"`
+	UserID        uint                     `json:"user_id"`
+	Username      string                   `json:"username,omitempty"`
+	QuestionID    uint                     `json:"question_id"`
+	QuestionTitle string                   `json:"question_title"`
+	Content       string                   `json:"content"`
+	Essay         string                   `json:"essay"`
+	MaxPoints     int                      `json:"max_points"`
+	Rubric        []models.RubricCriterion `json:"rubric,omitempty"`
+	SubmittedAt   time.Time                `json:"submitted_at"`
+}
+
+type GradingQueueResponse struct {
+	ExamID         uint               `json:"exam_id"`
+	PendingResults int                `json:"pending_results"`
+	Items          []GradingQueueItem `json:"items"` // oldest submissions first
+}
+
+// GetGradingQueue lists the essays of an exam that are still waiting for a grader
+func (s *ResultService) GetGradingQueue(examID uint) (*GradingQueueResponse, error) {
+	var exam models.Exam
+	if err := s.db.Where("id = ?", examID).First(&exam).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("exam not found")
+		}
+		s.logger.WithError(err).Error("Failed to get exam")
+		return nil, fmt.Errorf("failed to get grading queue")
+	}
+
+	var results []models.Result
+	if err := s.db.Preload("User").
+		Where("exam_id = ? AND status = ?", examID, models.ResultPendingGrading).
+		Order("end_time ASC").
+		Find(&results).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get pending results")
+		return nil, fmt.Errorf("failed to get grading queue")
+	}
+
+	pending := []models.Answer{}
+	for _, result := range results {
+		for _, answer := range result.Answers {
+			if answer.PendingGrading {
+				pending = append(pending, answer)
+			}
+		}
+	}
+
+	// Graders see each essay question as the candidate saw it
+	questions, err := s.loadAnsweredQuestions(s.db, pending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get grading queue")
+	}
+
+	response := &GradingQueueResponse{
+		ExamID:         examID,
+		PendingResults: len(results),
+		Items:          []GradingQueueItem{},
+	}
+	for _, result := range results {
+		for _, answer := range result.Answers {
+			if !answer.PendingGrading {
+				continue
+			}
+
+			item := GradingQueueItem{
+				ResultID:    result.ID,
+				UserID:      result.UserID,
+				Username:    result.User.Username,
+				QuestionID:  answer.QuestionID,
+				Essay:       answer.Essay,
+				MaxPoints:   answer.MaxPoints,
+				SubmittedAt: result.EndTime,
+			}
+			if question, ok := questions[answeredKey(&answer)]; ok {
+				item.QuestionTitle = question.Title
+				item.Content = question.Content
+				item.Rubric = question.Rubric
+			}
+			response.Items = append(response.Items, item)
+		}
+	}
+
+	return response, nil
+}
+
+// GradeEssay records a grader's marks for one essay of a pending result. An essay
+// can be re-marked until the result is finalized.
+func (s *ResultService) GradeEssay(resultID uint, questionID uint, req GradeEssayRequest, graderID uint) (*models.Result, error) {
+	var result models.Result
+	var failure error // the reason a grading request is refused, as opposed to a database error
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Locked so two graders marking essays of the same result don't overwrite
+		// each other's marks in the answers column
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", resultID).First(&result).Error; err != nil {
+			return err
+		}
+		if !result.AwaitingGrading() {
+			failure = fmt.Errorf("result is already graded")
+			return failure
+		}
+
+		index := -1
+		for i := range result.Answers {
+			if result.Answers[i].QuestionID == questionID {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			failure = fmt.Errorf("answer not found")
+			return failure
+		}
+
+		// Marks follow the rubric of the revision the candidate answered
+		answer := &result.Answers[index]
+		questions, err := s.loadAnsweredQuestions(tx, []models.Answer{*answer})
+		if err != nil {
+			return err
+		}
+		question, ok := questions[answeredKey(answer)]
+		if !ok {
+			failure = fmt.Errorf("answer not found")
+			return failure
+		}
+
+		if err := ScoreEssay(question.Rubric, answer, req, graderID, time.Now()); err != nil {
+			failure = err
+			return failure
+		}
+
+		return tx.Model(&result).Update("answers", result.Answers).Error
+	})
+	if failure != nil {
+		return nil, failure
+	}
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("result not found")
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to grade answer")
+		return nil, fmt.Errorf("failed to grade answer")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"result_id":   resultID,
+		"question_id": questionID,
+		"grader_id":   graderID,
+	}).Info("Essay graded")
+
+	return &result, nil
+}
+
+// FinalizeResult closes grading of a result once all its essays are marked. The
+// score, section scores and pass mark are recomputed from the marked answers.
+func (s *ResultService) FinalizeResult(resultID uint, graderID uint) (*models.Result, error) {
+	var result models.Result
+	var failure error // the reason a grading request is refused, as opposed to a database error
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", resultID).First(&result).Error; err != nil {
+			return err
+		}
+		if !result.AwaitingGrading() {
+			failure = fmt.Errorf("result is already graded")
+			return failure
+		}
+		for _, answer := range result.Answers {
+			if answer.PendingGrading {
+				failure = fmt.Errorf("result has ungraded answers")
+				return failure
+			}
+		}
+
+		var exam models.Exam
+		if err := tx.Unscoped().Preload("ExamQuestions").Where("id = ?", result.ExamID).First(&exam).Error; err != nil {
+			return err
+		}
+
+		examQuestions, err := resultExamQuestions(tx, &exam, &result)
+		if err != nil {
+			return err
+		}
+
+		earnedPoints := SumPoints(result.Answers)
+		score := 0.0
+		if result.MaxPoints > 0 {
+			score = earnedPoints / float64(result.MaxPoints) * 100
+		}
+		now := time.Now()
+
+		result.TotalPoints = earnedPoints
+		result.Score = score
+		result.Passed = score >= float64(exam.PassScore)
+		result.SectionScores = SectionSubscores(scoredSections(&result), examQuestions, result.Answers)
+		result.Status = models.ResultGraded
+		result.GradedAt = &now
+
+		return tx.Model(&result).Updates(map[string]interface{}{
+			"total_points":   result.TotalPoints,
+			"score":          result.Score,
+			"passed":         result.Passed,
+			"section_scores": result.SectionScores,
+			"status":         result.Status,
+			"graded_at":      result.GradedAt,
+		}).Error
+	})
+	if failure != nil {
+		return nil, failure
+	}
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("result not found")
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to finalize result")
+		return nil, fmt.Errorf("failed to finalize result")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"result_id": resultID,
+		"grader_id": graderID,
+		"score":     result.Score,
+		"passed":    result.Passed,
+	}).Info("Result finalized")
+
+	return &result, nil
+}
+
+// resultExamQuestions returns the questions a result was graded against: those
+// recorded for its attempt, or the exam's questions for results from before
+// attempts recorded them
+func resultExamQuestions(db *gorm.DB, exam *models.Exam, result *models.Result) ([]models.ExamQuestion, error) {
+	if result.ExamAttemptID == nil {
+		return exam.ExamQuestions, nil
+	}
+
+	var drawn []models.AttemptQuestion
+	if err := db.Where("exam_attempt_id = ?", *result.ExamAttemptID).Find(&drawn).Error; err != nil {
+		return nil, err
+	}
+	if len(drawn) == 0 {
+		return exam.ExamQuestions, nil
+	}
+
+	examQuestions := make([]models.ExamQuestion, len(drawn))
+	for i := range drawn {
+		examQuestions[i] = drawn[i].ToExamQuestion(exam.ID)
+	}
+	return examQuestions, nil
+}
+
+// loadQuestions loads questions by ID, including ones since removed from the bank
+func (s *ResultService) loadQuestions(db *gorm.DB, questionIDs []uint) (map[uint]models.Question, error) {
+	questions := make(map[uint]models.Question)
+	if len(questionIDs) == 0 {
+		return questions, nil
+	}
+
+	var rows []models.Question
+	if err := db.Unscoped().Where("id IN ?", questionIDs).Find(&rows).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to load questions")
+		return nil, err
+	}
+	for _, question := range rows {
+		questions[question.ID] = question
+	}
+	return questions, nil
+}
+
+// answeredQuestion identifies a question at the revision an answer was graded against
+type answeredQuestion struct {
+	questionID uint
+	revision   int
+}
+
+// answeredKey is the question revision an answer was graded against. Answers from
+// before versioning refer to the first revision.
+func answeredKey(answer *models.Answer) answeredQuestion {
+	revision := answer.Revision
+	if revision == 0 {
+		revision = 1
+	}
+	return answeredQuestion{answer.QuestionID, revision}
+}
+
+// loadAnsweredQuestions loads the questions of the given answers at the revision
+// each answer was graded against, including questions since removed from the bank
+func (s *ResultService) loadAnsweredQuestions(db *gorm.DB, answers []models.Answer) (map[answeredQuestion]*models.Question, error) {
+	questionIDs := []uint{}
+	for _, answer := range answers {
+		if !containsID(questionIDs, answer.QuestionID) {
+			questionIDs = append(questionIDs, answer.QuestionID)
+		}
+	}
+
+	current, err := s.loadQuestions(db, questionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	answered := make(map[answeredQuestion]*models.Question)
+	questions := []*models.Question{}
+	revisions := []int{}
+	for i := range answers {
+		key := answeredKey(&answers[i])
+		question, ok := current[key.questionID]
+		if _, seen := answered[key]; seen || !ok {
+			continue
+		}
+		answered[key] = &question
+		questions = append(questions, &question)
+		revisions = append(revisions, key.revision)
+	}
+	if err := applyRevisions(db, questions, revisions); err != nil {
+		s.logger.WithError(err).Error("Failed to load question revisions")
+		return nil, err
+	}
+	return answered, nil
+}
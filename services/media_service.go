@@ -0,0 +1,264 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"exam-system/models"
+	"exam-system/storage"
+	"exam-system/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type MediaService struct {
+	db      *gorm.DB
+	storage storage.Storage
+	logger  *logrus.Logger
+}
+
+// mediaType is a file type accepted for upload
+type mediaType struct {
+	kind      models.MediaKind
+	maxSize   int64 // in bytes
+	extension string
+}
+
+// mediaTypes are the accepted file types, keyed by the content type sniffed from
+// the file itself; the type the client claims is ignored. SVG is left out as it
+// can carry script.
+var mediaTypes = map[string]mediaType{
+	"image/png":  {models.MediaImage, 5 << 20, ".png"},
+	"image/jpeg": {models.MediaImage, 5 << 20, ".jpg"},
+	"image/gif":  {models.MediaImage, 5 << 20, ".gif"},
+	"image/webp": {models.MediaImage, 5 << 20, ".webp"},
+	"audio/mpeg": {models.MediaAudio, 20 << 20, ".mp3"},
+	"audio/wav":  {models.MediaAudio, 20 << 20, ".wav"},
+	"audio/ogg":  {models.MediaAudio, 20 << 20, ".ogg"},
+	"video/mp4":  {models.MediaVideo, 50 << 20, ".mp4"},
+	"video/webm": {models.MediaVideo, 50 << 20, ".webm"},
+}
+
+// MediaContent is a media file ready to be sent to a browser
+type MediaContent struct {
+	Media       *models.Media
+	RedirectURL string        // set when the storage backend serves the file itself
+	Body        io.ReadCloser // otherwise the file, to be closed by the caller
+}
+
+func NewMediaService(db *gorm.DB, store storage.Storage, logger *logrus.Logger) *MediaService {
+	return &MediaService{
+		db:      db,
+		storage: store,
+		logger:  logger,
+	}
+}
+
+// DetectMediaType returns the content type of a file from its first bytes
+func DetectMediaType(head []byte) string {
+	contentType := http.DetectContentType(head)
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+
+	switch contentType {
+	case "audio/wave":
+		return "audio/wav"
+	case "application/ogg":
+		return "audio/ogg"
+	case "application/octet-stream":
+		// MP3 files without an ID3 tag start straight with an MPEG frame sync
+		if len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0 {
+			return "audio/mpeg"
+		}
+	}
+	return contentType
+}
+
+// UploadMedia checks the type and size of an uploaded file and stores it. The
+// file is removed again if it hasn't been attached to a question within the
+// orphan grace period.
+func (s *MediaService) UploadMedia(file io.Reader, filename string, size int64, uploadedBy uint) (*models.Media, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid media: file is empty")
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		s.logger.WithError(err).Error("Failed to read upload")
+		return nil, fmt.Errorf("failed to upload media")
+	}
+	head = head[:n]
+
+	contentType := DetectMediaType(head)
+	accepted, ok := mediaTypes[contentType]
+	if !ok {
+		return nil, fmt.Errorf("invalid media: unsupported file type %s", contentType)
+	}
+	if size > accepted.maxSize {
+		return nil, fmt.Errorf("invalid media: %s files are limited to %d MB", accepted.kind, accepted.maxSize>>20)
+	}
+
+	hash := sha256.New()
+	body := io.LimitReader(io.TeeReader(io.MultiReader(bytes.NewReader(head), file), hash), size)
+	key := fmt.Sprintf("media/%s%s", uuid.New().String(), accepted.extension)
+
+	ctx := context.Background()
+	if err := s.storage.Put(ctx, key, body, size, contentType); err != nil {
+		s.logger.WithError(err).Error("Failed to store media")
+		return nil, fmt.Errorf("failed to upload media")
+	}
+
+	media := models.Media{
+		Key:         key,
+		Filename:    filepath.Base(filename),
+		ContentType: contentType,
+		Kind:        accepted.kind,
+		Size:        size,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		UploadedBy:  uploadedBy,
+	}
+	if err := s.db.Create(&media).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to create media")
+		if err := s.storage.Delete(ctx, key); err != nil {
+			s.logger.WithError(err).Warn("Failed to remove stored media")
+		}
+		return nil, fmt.Errorf("failed to upload media")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"media_id":     media.ID,
+		"content_type": media.ContentType,
+		"size":         media.Size,
+		"uploaded_by":  uploadedBy,
+	}).Info("Media uploaded")
+
+	return &media, nil
+}
+
+// OpenSignedMedia checks a signed media link and opens the file it points to, or
+// hands out the storage backend's own link when it has one
+func (s *MediaService) OpenSignedMedia(mediaID uint, expires int64, signature string) (*MediaContent, error) {
+	if err := utils.VerifyMediaSignature(mediaID, expires, signature, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var media models.Media
+	if err := s.db.Where("id = ?", mediaID).First(&media).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("media not found")
+		}
+		s.logger.WithError(err).Error("Failed to get media")
+		return nil, fmt.Errorf("failed to get media")
+	}
+
+	ctx := context.Background()
+	if presigner, ok := s.storage.(storage.Presigner); ok {
+		// The backend's link lasts as long as ours, rounded up to whole seconds
+		expiry := time.Until(time.Unix(expires, 0)) + time.Second
+		link, err := presigner.PresignGet(ctx, media.Key, expiry)
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to presign media")
+			return nil, fmt.Errorf("failed to get media")
+		}
+		return &MediaContent{Media: &media, RedirectURL: link}, nil
+	}
+
+	body, err := s.storage.Open(ctx, media.Key)
+	if err == storage.ErrNotFound {
+		return nil, fmt.Errorf("media not found")
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to open media")
+		return nil, fmt.Errorf("failed to get media")
+	}
+	return &MediaContent{Media: &media, Body: body}, nil
+}
+
+// DeleteMedia removes an uploaded file that no question uses
+func (s *MediaService) DeleteMedia(mediaID uint) error {
+	var media models.Media
+	if err := s.db.Where("id = ?", mediaID).First(&media).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("media not found")
+		}
+		s.logger.WithError(err).Error("Failed to get media")
+		return fmt.Errorf("failed to delete media")
+	}
+
+	deleted, err := s.deleteUnlinked(&media)
+	if err != nil {
+		return fmt.Errorf("failed to delete media")
+	}
+	if !deleted {
+		return fmt.Errorf("media is attached to questions")
+	}
+	return nil
+}
+
+// CleanupOrphans removes media no question or revision links to: uploads never
+// attached, attachments replaced in an edit and files of deleted questions. A
+// revision keeps its media while an exam, an attempt or a result uses it. Files
+// uploaded within the grace period are kept so authors can finish the question
+// they are writing.
+func (s *MediaService) CleanupOrphans(now time.Time, grace time.Duration) (int, error) {
+	if err := releaseRevisionMedia(s.db, nil); err != nil {
+		s.logger.WithError(err).Error("Failed to release revision media")
+		return 0, err
+	}
+
+	var orphans []models.Media
+	if err := s.db.Where("created_at < ?", now.Add(-grace)).
+		Where("NOT EXISTS (SELECT 1 FROM question_media WHERE question_media.media_id = media.id)").
+		Where("NOT EXISTS (SELECT 1 FROM revision_media WHERE revision_media.media_id = media.id)").
+		Find(&orphans).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to find orphaned media")
+		return 0, err
+	}
+
+	removed := 0
+	for i := range orphans {
+		deleted, err := s.deleteUnlinked(&orphans[i])
+		if err != nil {
+			return removed, err
+		}
+		if deleted {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// deleteUnlinked deletes media unless a question or revision links to it,
+// checked in the same statement so a question saved meanwhile keeps its file
+func (s *MediaService) deleteUnlinked(media *models.Media) (bool, error) {
+	result := s.db.Where("id = ?", media.ID).
+		Where("NOT EXISTS (SELECT 1 FROM question_media WHERE question_media.media_id = ?)", media.ID).
+		Where("NOT EXISTS (SELECT 1 FROM revision_media WHERE revision_media.media_id = ?)", media.ID).
+		Delete(&models.Media{})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to delete media")
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	// A file left behind by a failed delete only costs space, so it isn't an error
+	if err := s.storage.Delete(context.Background(), media.Key); err != nil {
+		s.logger.WithError(err).WithField("key", media.Key).Warn("Failed to remove stored media")
+	}
+
+	s.logger.WithField("media_id", media.ID).Info("Media deleted")
+	return true, nil
+}
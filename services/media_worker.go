@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MediaCleanupWorker periodically removes media files no question uses any more
+type MediaCleanupWorker struct {
+	mediaService *MediaService
+	interval     time.Duration
+	grace        time.Duration
+	logger       *logrus.Logger
+	done         chan struct{}
+}
+
+func NewMediaCleanupWorker(mediaService *MediaService, interval, grace time.Duration, logger *logrus.Logger) *MediaCleanupWorker {
+	return &MediaCleanupWorker{
+		mediaService: mediaService,
+		interval:     interval,
+		grace:        grace,
+		logger:       logger,
+		done:         make(chan struct{}),
+	}
+}
+
+// Start runs the worker in the background until ctx is cancelled
+func (w *MediaCleanupWorker) Start(ctx context.Context) {
+	go w.run(ctx)
+}
+
+// Wait blocks until the worker has finished its current sweep and exited
+func (w *MediaCleanupWorker) Wait() {
+	<-w.done
+}
+
+func (w *MediaCleanupWorker) run(ctx context.Context) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	w.logger.WithFields(logrus.Fields{
+		"interval": w.interval.String(),
+		"grace":    w.grace.String(),
+	}).Info("Media cleanup worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Media cleanup worker stopped")
+			return
+		case <-ticker.C:
+			removed, err := w.mediaService.CleanupOrphans(time.Now(), w.grace)
+			if err != nil {
+				w.logger.WithError(err).Error("Media cleanup sweep failed")
+				continue
+			}
+			if removed > 0 {
+				w.logger.WithField("removed", removed).Info("Removed orphaned media")
+			}
+		}
+	}
+}
@@ -0,0 +1,772 @@
+package services
+
+import (
+	"encoding/xml"
+	"exam-system/models"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Moodle XML is read question by question. Category entries set the tags of the
+// questions after them; answer fractions decide which options are correct.
+// Exports write the same elements back, tags included, and leave a comment for
+// whatever Moodle can't hold.
+
+type moodleText struct {
+	Format string   `xml:"format,attr,omitempty"`
+	Text   string   `xml:"text"`
+	Files  []string `xml:"file,omitempty"` // embedded as base64, referenced as @@PLUGINFILE@@
+}
+
+type moodleAnswer struct {
+	Fraction  string `xml:"fraction,attr"`
+	Format    string `xml:"format,attr,omitempty"`
+	Text      string `xml:"text"`
+	Tolerance string `xml:"tolerance,omitempty"`
+}
+
+type moodleSubquestion struct {
+	Format string `xml:"format,attr,omitempty"`
+	Text   string `xml:"text"`
+	Answer string `xml:"answer>text"`
+}
+
+type moodleUnit struct {
+	Name       string `xml:"unit_name"`
+	Multiplier string `xml:"multiplier"`
+}
+
+type moodleUnits struct {
+	Units []moodleUnit `xml:"unit"`
+}
+
+type moodleQuestion struct {
+	Type            string              `xml:"type,attr"`
+	Category        *moodleText         `xml:"category,omitempty"` // category entries only
+	Name            string              `xml:"name>text"`
+	QuestionText    moodleText          `xml:"questiontext"`
+	GeneralFeedback moodleText          `xml:"generalfeedback"`
+	DefaultGrade    string              `xml:"defaultgrade,omitempty"`
+	Single          string              `xml:"single,omitempty"`
+	UseCase         string              `xml:"usecase,omitempty"`
+	UnitGradingType string              `xml:"unitgradingtype,omitempty"`
+	UnitPenalty     string              `xml:"unitpenalty,omitempty"`
+	GraderInfo      *moodleText         `xml:"graderinfo,omitempty"` // essay marking notes
+	Answers         []moodleAnswer      `xml:"answer"`
+	Subquestions    []moodleSubquestion `xml:"subquestion"`
+	Units           *moodleUnits        `xml:"units,omitempty"`
+	Tags            []string            `xml:"tags>tag>text,omitempty"`
+}
+
+// moodleAnswerLabel matches an "A. " or "b) " label typed in front of an answer
+var moodleAnswerLabel = regexp.MustCompile(`^([A-Za-z])[.)]\s+`)
+
+// parseMoodleXML reads the questions of a Moodle XML quiz export
+func parseMoodleXML(r io.Reader) ([]importedQuestion, error) {
+	decoder := xml.NewDecoder(r)
+	questions := []importedQuestion{}
+	var categoryTags []string
+	sawQuiz := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid import file: %v", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "quiz" {
+			sawQuiz = true
+			continue
+		}
+		if start.Name.Local != "question" {
+			if err := decoder.Skip(); err != nil {
+				return nil, fmt.Errorf("invalid import file: %v", err)
+			}
+			continue
+		}
+
+		line, _ := decoder.InputPos()
+		var question moodleQuestion
+		if err := decoder.DecodeElement(&question, &start); err != nil {
+			return nil, fmt.Errorf("invalid import file: %v", err)
+		}
+
+		if question.Type == "category" {
+			path := ""
+			if question.Category != nil {
+				path = question.Category.Text
+			}
+			categoryTags = moodleCategoryTags(path)
+			continue
+		}
+		imported := convertMoodleQuestion(&question, categoryTags)
+		imported.Line = line
+		questions = append(questions, imported)
+	}
+
+	if !sawQuiz {
+		return nil, fmt.Errorf("invalid import file: not a Moodle XML quiz")
+	}
+	return questions, nil
+}
+
+// moodleCategoryTags turns a category path such as "$course$/top/Algebra/Linear"
+// into tags, leaving out Moodle's context and default categories
+func moodleCategoryTags(path string) []string {
+	tags := []string{}
+	for _, segment := range strings.Split(path, "/") {
+		segment = strings.TrimSpace(segment)
+		if segment == "" || segment == "top" || strings.HasPrefix(segment, "$") || strings.HasPrefix(segment, "Default for ") {
+			continue
+		}
+		tags = append(tags, segment)
+	}
+	return tags
+}
+
+func convertMoodleQuestion(question *moodleQuestion, categoryTags []string) importedQuestion {
+	imported := importedQuestion{}
+	req := &imported.Request
+
+	format := moodleContentFormat(question)
+	req.ContentFormat = format
+	req.Content = moodleContent(question.QuestionText, format)
+	req.Explanation = moodleContent(question.GeneralFeedback, format)
+	req.Title = importTitle(question.Name, req.Content)
+
+	tags := append([]string{}, categoryTags...)
+	for _, tag := range question.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !containsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	req.Tags = tags
+
+	if grade, err := strconv.ParseFloat(strings.TrimSpace(question.DefaultGrade), 64); err == nil {
+		req.Points = int(math.Round(grade))
+	}
+	if len(question.QuestionText.Files) > 0 || len(question.GeneralFeedback.Files) > 0 {
+		imported.Warnings = append(imported.Warnings, "embedded files are not imported, upload them as media and attach them")
+	}
+
+	var err error
+	switch question.Type {
+	case "multichoice":
+		err = convertMoodleMultichoice(question, &imported, format)
+	case "truefalse":
+		err = convertMoodleTrueFalse(question, &imported)
+	case "shortanswer":
+		err = convertMoodleShortAnswer(question, &imported)
+	case "numerical":
+		err = convertMoodleNumerical(question, &imported)
+	case "matching":
+		err = convertMoodleMatching(question, &imported, format)
+	case "essay":
+		req.Type = models.Essay
+	default:
+		err = fmt.Errorf("unsupported Moodle question type %q", question.Type)
+	}
+	imported.Err = err
+
+	return imported
+}
+
+func convertMoodleMultichoice(question *moodleQuestion, imported *importedQuestion, format models.ContentFormat) error {
+	req := &imported.Request
+	req.Type = models.MultipleChoice
+	req.SelectionMode = models.SelectMultiple
+	single := strings.TrimSpace(question.Single) != "false"
+	if single {
+		req.SelectionMode = models.SelectSingle
+	}
+
+	// Labels like "A. " are dropped when every answer carries its own letter in order
+	labelled := len(question.Answers) > 0
+	for i, answer := range question.Answers {
+		match := moodleAnswerLabel.FindStringSubmatch(strings.TrimSpace(answer.Text))
+		if match == nil || strings.ToLower(match[1]) != string(rune('a'+i)) {
+			labelled = false
+			break
+		}
+	}
+
+	for i, answer := range question.Answers {
+		fraction, err := moodleFraction(answer.Fraction)
+		if err != nil {
+			return err
+		}
+
+		text := strings.TrimSpace(answer.Text)
+		if labelled {
+			text = moodleAnswerLabel.ReplaceAllString(text, "")
+		}
+		option := models.Option{
+			ID:   importOptionID(i),
+			Text: moodleContent(moodleText{Format: answer.Format, Text: text}, format),
+		}
+
+		if single {
+			option.IsCorrect = fraction >= 100
+			if fraction > 0 && fraction < 100 {
+				imported.Warnings = append(imported.Warnings, fmt.Sprintf("answer %s gives %g%% partial credit and is imported as incorrect", option.ID, fraction))
+			}
+		} else {
+			option.IsCorrect = fraction > 0
+			if fraction < 0 {
+				imported.Warnings = append(imported.Warnings, fmt.Sprintf("answer %s deducts %g%%; penalties come from the exam's scoring policy", option.ID, -fraction))
+			}
+		}
+		req.Options = append(req.Options, option)
+	}
+	return nil
+}
+
+func convertMoodleTrueFalse(question *moodleQuestion, imported *importedQuestion) error {
+	req := &imported.Request
+	req.Type = models.TrueFalse
+
+	trueIsCorrect := false
+	found := false
+	for _, answer := range question.Answers {
+		fraction, err := moodleFraction(answer.Fraction)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer.Text)) {
+		case "true":
+			found = true
+			trueIsCorrect = fraction >= 100
+		case "false":
+			found = true
+			trueIsCorrect = fraction < 100
+		}
+	}
+	if !found {
+		return fmt.Errorf("true/false question has no true or false answer")
+	}
+
+	req.Options = trueFalseOptions(trueIsCorrect)
+	return nil
+}
+
+func convertMoodleShortAnswer(question *moodleQuestion, imported *importedQuestion) error {
+	req := &imported.Request
+	req.Type = models.ShortAnswer
+	caseSensitive := strings.TrimSpace(question.UseCase) == "1"
+
+	blank := models.Blank{ID: "1"}
+	for i, answer := range question.Answers {
+		fraction, err := moodleFraction(answer.Fraction)
+		if err != nil {
+			return err
+		}
+		text := strings.TrimSpace(answer.Text)
+		if fraction < 100 {
+			if fraction > 0 {
+				imported.Warnings = append(imported.Warnings, fmt.Sprintf("answer %d gives %g%% partial credit and is left out", i+1, fraction))
+			}
+			continue
+		}
+		blank.Accepted = append(blank.Accepted, moodleAcceptedAnswer(text, caseSensitive))
+	}
+	req.Blanks = []models.Blank{blank}
+	return nil
+}
+
+// moodleAcceptedAnswer converts a Moodle short answer, where * is a wildcard and
+// \* a literal star
+func moodleAcceptedAnswer(text string, caseSensitive bool) models.AcceptedAnswer {
+	if !strings.Contains(strings.ReplaceAll(text, `\*`, ""), "*") {
+		text = strings.ReplaceAll(text, `\*`, "*")
+		if caseSensitive {
+			return models.AcceptedAnswer{Text: text, Match: models.MatchWhitespace}
+		}
+		return models.AcceptedAnswer{Text: text, Match: models.MatchCaseInsensitive}
+	}
+
+	parts := strings.Split(strings.ReplaceAll(text, `\*`, "\x00"), "*")
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(regexp.QuoteMeta(part), "\x00", `\*`)
+	}
+	pattern := `\s*` + strings.Join(parts, ".*") + `\s*`
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return models.AcceptedAnswer{Text: pattern, Match: models.MatchRegex}
+}
+
+func convertMoodleNumerical(question *moodleQuestion, imported *importedQuestion) error {
+	req := &imported.Request
+	req.Type = models.Numeric
+
+	for i, answer := range question.Answers {
+		fraction, err := moodleFraction(answer.Fraction)
+		if err != nil {
+			return err
+		}
+		text := strings.TrimSpace(answer.Text)
+		if fraction < 100 || text == "*" {
+			if fraction > 0 {
+				imported.Warnings = append(imported.Warnings, fmt.Sprintf("answer %d gives %g%% partial credit and is left out", i+1, fraction))
+			}
+			continue
+		}
+		if req.Numeric != nil {
+			imported.Warnings = append(imported.Warnings, fmt.Sprintf("answer %d is left out, only one fully correct answer is imported", i+1))
+			continue
+		}
+
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("answer %d is not a number: %q", i+1, text)
+		}
+		tolerance := 0.0
+		if t := strings.TrimSpace(answer.Tolerance); t != "" {
+			if tolerance, err = strconv.ParseFloat(t, 64); err != nil {
+				return fmt.Errorf("answer %d has an invalid tolerance: %q", i+1, t)
+			}
+		}
+		req.Numeric = &models.NumericKey{
+			Answer:        value,
+			Tolerance:     math.Abs(tolerance),
+			ToleranceType: models.ToleranceAbsolute,
+		}
+	}
+	if req.Numeric == nil {
+		return fmt.Errorf("numerical question has no fully correct answer")
+	}
+
+	// Moodle multipliers scale the answer into a unit; ours scale a unit into the
+	// answer's unit
+	var units []moodleUnit
+	if question.Units != nil {
+		units = question.Units.Units
+	}
+	for _, unit := range units {
+		multiplier, err := strconv.ParseFloat(strings.TrimSpace(unit.Multiplier), 64)
+		if err != nil || multiplier == 0 {
+			return fmt.Errorf("unit %q has an invalid multiplier", unit.Name)
+		}
+		req.Numeric.Units = append(req.Numeric.Units, models.NumericUnit{
+			Symbol:     strings.TrimSpace(unit.Name),
+			Multiplier: 1 / multiplier,
+		})
+	}
+	if len(req.Numeric.Units) > 0 && strings.TrimSpace(question.UnitGradingType) != "" && strings.TrimSpace(question.UnitGradingType) != "0" {
+		req.Numeric.UnitRequired = true
+		imported.Warnings = append(imported.Warnings, "a wrong or missing unit makes the answer wrong instead of applying Moodle's unit penalty")
+	}
+	return nil
+}
+
+func convertMoodleMatching(question *moodleQuestion, imported *importedQuestion, format models.ContentFormat) error {
+	req := &imported.Request
+	req.Type = models.Matching
+
+	choices := map[string]string{} // answer text to choice ID
+	for _, sub := range question.Subquestions {
+		answer := strings.TrimSpace(sub.Answer)
+		choiceID, ok := choices[answer]
+		if !ok {
+			choiceID = "m" + strconv.Itoa(len(choices)+1)
+			choices[answer] = choiceID
+			req.MatchChoices = append(req.MatchChoices, models.Option{ID: choiceID, Text: answer})
+		}
+
+		// Subquestions without text only add a distractor answer
+		if strings.TrimSpace(sub.Text) == "" {
+			continue
+		}
+		req.Options = append(req.Options, models.Option{
+			ID:      importOptionID(len(req.Options)),
+			Text:    moodleContent(moodleText{Format: sub.Format, Text: sub.Text}, format),
+			MatchID: choiceID,
+		})
+	}
+	return nil
+}
+
+// moodleContentFormat picks one format for all the texts of a question: HTML if
+// any of them is HTML, otherwise the format of the question text
+func moodleContentFormat(question *moodleQuestion) models.ContentFormat {
+	formats := []string{question.QuestionText.Format, question.GeneralFeedback.Format}
+	for _, answer := range question.Answers {
+		formats = append(formats, answer.Format)
+	}
+	for _, sub := range question.Subquestions {
+		formats = append(formats, sub.Format)
+	}
+	for _, format := range formats {
+		if format == "html" {
+			return models.FormatHTML
+		}
+	}
+	if question.QuestionText.Format == "markdown" {
+		return models.FormatMarkdown
+	}
+	return models.FormatPlain
+}
+
+// moodleContent converts a Moodle text to the question's format
+func moodleContent(text moodleText, format models.ContentFormat) string {
+	content := strings.TrimSpace(text.Text)
+	if format == models.FormatHTML && text.Format != "html" {
+		return models.FormatPlain.Render(content)
+	}
+	return content
+}
+
+// moodleFraction reads the percentage of credit an answer is worth
+func moodleFraction(fraction string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(fraction), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid answer fraction %q", fraction)
+	}
+	return value, nil
+}
+
+// importOptionID names imported options a, b, c, ... and numbers them past z
+func importOptionID(index int) string {
+	if index < 26 {
+		return string(rune('a' + index))
+	}
+	return strconv.Itoa(index + 1)
+}
+
+// importTitle uses the name a question was given, or the start of its text
+func importTitle(name, content string) string {
+	title := strings.Join(strings.Fields(name), " ")
+	if title == "" {
+		title = strings.Join(strings.Fields(html.UnescapeString(htmlTag.ReplaceAllString(content, " "))), " ")
+	}
+
+	runes := []rune(title)
+	if len(runes) > 100 {
+		title = string(runes[:99]) + "…"
+	}
+	return title
+}
+
+// htmlTag matches an HTML tag, for reducing HTML to its text
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// moodleWriter writes a Moodle XML quiz. Nothing is written until the first
+// question or Close, so a failed query can still be answered with an error.
+type moodleWriter struct {
+	w       io.Writer
+	encoder *xml.Encoder
+	started bool
+}
+
+func newMoodleWriter(w io.Writer) *moodleWriter {
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return &moodleWriter{w: w, encoder: encoder}
+}
+
+func (m *moodleWriter) begin() error {
+	if m.started {
+		return nil
+	}
+	m.started = true
+
+	if _, err := io.WriteString(m.w, xml.Header); err != nil {
+		return err
+	}
+	return m.encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: "quiz"}})
+}
+
+func (m *moodleWriter) Write(question *models.Question) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+
+	exported, notes := toMoodleQuestion(question)
+	for _, note := range notes {
+		if err := m.encoder.EncodeToken(xml.Comment(fmt.Sprintf(" question %d: %s ", question.ID, note))); err != nil {
+			return err
+		}
+	}
+	if exported == nil {
+		return m.encoder.Flush()
+	}
+	return m.encoder.EncodeElement(exported, xml.StartElement{Name: xml.Name{Local: "question"}})
+}
+
+func (m *moodleWriter) Close() error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	if err := m.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: "quiz"}}); err != nil {
+		return err
+	}
+	if err := m.encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(m.w, "\n")
+	return err
+}
+
+// toMoodleQuestion describes a question as Moodle XML, with notes on what is left
+// out. Questions Moodle has no type for come back nil.
+func toMoodleQuestion(question *models.Question) (*moodleQuestion, []string) {
+	format := moodleTextFormat(question.Format())
+	exported := &moodleQuestion{
+		Name:            question.Title,
+		QuestionText:    moodleText{Format: format, Text: question.Content},
+		GeneralFeedback: moodleText{Format: format, Text: question.Explanation},
+		DefaultGrade:    strconv.Itoa(question.Points),
+		Tags:            question.Tags,
+	}
+	notes := []string{}
+	if len(question.MediaIDs()) > 0 {
+		notes = append(notes, "attachments are left out")
+	}
+
+	switch question.Type {
+	case models.MultipleChoice:
+		exported.Type = "multichoice"
+		exported.Single = "true"
+		share := 100.0
+		if question.Selection() == models.SelectMultiple {
+			exported.Single = "false"
+			share = 100 / float64(len(question.GetCorrectAnswers()))
+		}
+		for _, opt := range question.Options {
+			fraction := 0.0
+			if opt.IsCorrect {
+				fraction = share
+			}
+			exported.Answers = append(exported.Answers, moodleAnswer{Fraction: moodleFractionText(fraction), Format: format, Text: opt.Text})
+		}
+		if question.MinSelections > 0 || question.MaxSelections > 0 {
+			notes = append(notes, "selection limits are left out")
+		}
+
+	case models.TrueFalse:
+		exported.Type = "truefalse"
+		trueIsCorrect := moodleTrueIsCorrect(question)
+		exported.Answers = []moodleAnswer{
+			{Fraction: moodleFractionText(moodleCredit(trueIsCorrect)), Text: "true"},
+			{Fraction: moodleFractionText(moodleCredit(!trueIsCorrect)), Text: "false"},
+		}
+
+	case models.ShortAnswer:
+		exported.Type = "shortanswer"
+		var accepted []models.AcceptedAnswer
+		if len(question.Blanks) > 0 {
+			accepted = question.Blanks[0].Accepted
+		}
+		answers, caseSensitive, answerNotes := moodleShortAnswers(accepted)
+		notes = append(notes, answerNotes...)
+		if len(answers) == 0 {
+			return nil, append(notes, "no answer can be written as a Moodle short answer, the question is left out")
+		}
+		exported.UseCase = "0"
+		if caseSensitive {
+			exported.UseCase = "1"
+		}
+		for _, answer := range answers {
+			exported.Answers = append(exported.Answers, moodleAnswer{Fraction: "100", Format: "plain_text", Text: strings.ReplaceAll(answer, "*", `\*`)})
+		}
+
+	case models.Cloze:
+		// Moodle's embedded answers question writes the blanks into its text
+		exported.Type = "cloze"
+		blanks := make(map[string]models.Blank, len(question.Blanks))
+		for _, blank := range question.Blanks {
+			blanks[blank.ID] = blank
+		}
+		exported.QuestionText.Text = clozePlaceholder.ReplaceAllStringFunc(question.Content, func(placeholder string) string {
+			blank := blanks[clozePlaceholder.FindStringSubmatch(placeholder)[1]]
+			answers, caseSensitive, answerNotes := moodleShortAnswers(blank.Accepted)
+			notes = append(notes, answerNotes...)
+			return moodleClozeBlank(answers, caseSensitive)
+		})
+
+	case models.Numeric:
+		exported.Type = "numerical"
+		key := question.Numeric
+		if key == nil {
+			return nil, append(notes, "numeric question has no answer key, the question is left out")
+		}
+		tolerance := key.Tolerance
+		if key.ToleranceType == models.ToleranceRelative {
+			tolerance = key.Tolerance * math.Abs(key.Answer)
+		}
+		exported.Answers = []moodleAnswer{{
+			Fraction:  "100",
+			Format:    "plain_text",
+			Text:      strconv.FormatFloat(key.Answer, 'g', -1, 64),
+			Tolerance: strconv.FormatFloat(tolerance, 'g', -1, 64),
+		}}
+		// Our multipliers scale a unit into the answer's unit; Moodle's scale the
+		// answer into a unit
+		if len(key.Units) > 0 {
+			exported.Units = &moodleUnits{}
+			for _, unit := range key.Units {
+				exported.Units.Units = append(exported.Units.Units, moodleUnit{
+					Name:       unit.Symbol,
+					Multiplier: strconv.FormatFloat(1/unit.Multiplier, 'g', -1, 64),
+				})
+			}
+			exported.UnitGradingType = "0"
+			if key.UnitRequired {
+				exported.UnitGradingType = "1"
+				exported.UnitPenalty = "1"
+			}
+		}
+		if key.SignificantFigures > 0 {
+			notes = append(notes, "the significant figures rule is left out")
+		}
+
+	case models.Matching:
+		exported.Type = "matching"
+		choices := make(map[string]string, len(question.MatchChoices))
+		used := make(map[string]bool, len(question.MatchChoices))
+		for _, choice := range question.MatchChoices {
+			choices[choice.ID] = choice.Text
+		}
+		for _, opt := range question.Options {
+			used[opt.MatchID] = true
+			exported.Subquestions = append(exported.Subquestions, moodleSubquestion{Format: format, Text: opt.Text, Answer: choices[opt.MatchID]})
+		}
+		// Distractors are subquestions without text
+		for _, choice := range question.MatchChoices {
+			if !used[choice.ID] {
+				exported.Subquestions = append(exported.Subquestions, moodleSubquestion{Format: format, Answer: choice.Text})
+			}
+		}
+
+	case models.Essay:
+		exported.Type = "essay"
+		if len(question.Rubric) > 0 {
+			exported.GraderInfo = &moodleText{Format: "plain_text", Text: moodleRubricText(question.Rubric)}
+			notes = append(notes, "the rubric is exported as grader information")
+		}
+
+	default:
+		return nil, append(notes, fmt.Sprintf("%s questions have no Moodle XML equivalent, the question is left out", question.Type))
+	}
+
+	return exported, notes
+}
+
+// moodleTextFormat names a content format the way Moodle does
+func moodleTextFormat(format models.ContentFormat) string {
+	switch format {
+	case models.FormatHTML:
+		return "html"
+	case models.FormatMarkdown:
+		return "markdown"
+	}
+	return "plain_text"
+}
+
+// moodleFractionText writes a percentage of credit rounded the way Moodle stores
+// it, e.g. 33.33333
+func moodleFractionText(fraction float64) string {
+	return strconv.FormatFloat(math.Round(fraction*1e5)/1e5, 'f', -1, 64)
+}
+
+func moodleCredit(correct bool) float64 {
+	if correct {
+		return 100
+	}
+	return 0
+}
+
+// moodleTrueIsCorrect reads which way a true/false question is answered. The
+// "true" option is the one with that ID, or else the first one.
+func moodleTrueIsCorrect(question *models.Question) bool {
+	for _, opt := range question.Options {
+		if opt.ID == "true" {
+			return opt.IsCorrect
+		}
+	}
+	return len(question.Options) > 0 && question.Options[0].IsCorrect
+}
+
+// moodleShortAnswers picks the accepted answers Moodle short answers can hold.
+// Moodle has one case setting per question, so answers are case sensitive only
+// when all of them are; regular expressions are left out.
+func moodleShortAnswers(accepted []models.AcceptedAnswer) ([]string, bool, []string) {
+	answers := []string{}
+	notes := []string{}
+	caseSensitive := true
+	mixedCase := false
+	for _, answer := range accepted {
+		switch answer.Match {
+		case models.MatchRegex:
+			notes = append(notes, fmt.Sprintf("regular expression %q is left out", answer.Text))
+			continue
+		case models.MatchCaseInsensitive, models.MatchAccentInsensitive:
+			if caseSensitive && len(answers) > 0 {
+				mixedCase = true
+			}
+			caseSensitive = false
+			if answer.Match == models.MatchAccentInsensitive {
+				notes = append(notes, fmt.Sprintf("answer %q is matched with its accents", answer.Text))
+			}
+		default:
+			if !caseSensitive {
+				mixedCase = true
+			}
+		}
+		answers = append(answers, answer.Text)
+	}
+	if mixedCase {
+		notes = append(notes, "case is ignored for every answer")
+	}
+	return answers, caseSensitive && len(answers) > 0, notes
+}
+
+// moodleClozeEscape escapes the characters Moodle's embedded answers syntax uses,
+// and the * wildcard
+var moodleClozeEscape = strings.NewReplacer(`\`, `\\`, `}`, `\}`, `#`, `\#`, `~`, `\~`, `/`, `\/`, `"`, `\"`, `*`, `\*`)
+
+// moodleClozeBlank writes a blank as an embedded short answer, e.g.
+// {1:SHORTANSWER:=Paris~=paris}
+func moodleClozeBlank(answers []string, caseSensitive bool) string {
+	kind := "SHORTANSWER"
+	if caseSensitive {
+		kind = "SHORTANSWER_C"
+	}
+	for i, answer := range answers {
+		answers[i] = "=" + moodleClozeEscape.Replace(answer)
+	}
+	return fmt.Sprintf("{1:%s:%s}", kind, strings.Join(answers, "~"))
+}
+
+// moodleRubricText lists the criteria of an essay rubric for graders
+func moodleRubricText(rubric models.Rubric) string {
+	lines := make([]string, len(rubric))
+	for i, criterion := range rubric {
+		lines[i] = fmt.Sprintf("%s (%g-%g)", criterion.Title, criterion.MinPoints, criterion.MaxPoints)
+		if criterion.Description != "" {
+			lines[i] += ": " + criterion.Description
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// numericLiteral is the number format candidates may type: digits with an optional
+// decimal point and exponent. Hex, NaN, Inf and digit separators are rejected.
+var numericLiteral = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// toleranceSlack absorbs float rounding at the edges of the tolerance band
+const toleranceSlack = 1e-9
+
+// ParseNumericAnswer parses a typed number. A single comma is read as the decimal
+// separator, as in Vietnamese "9,81". It returns the value and the literal in
+// canonical form.
+func ParseNumericAnswer(text string) (float64, string, error) {
+	literal := strings.TrimSpace(text)
+	if !strings.Contains(literal, ".") && strings.Count(literal, ",") == 1 {
+		literal = strings.Replace(literal, ",", ".", 1)
+	}
+	if !numericLiteral.MatchString(literal) {
+		return 0, "", fmt.Errorf("%q is not a number", text)
+	}
+
+	value, err := strconv.ParseFloat(literal, 64)
+	if err != nil || math.IsInf(value, 0) {
+		return 0, "", fmt.Errorf("%q is not a number", text)
+	}
+	return value, literal, nil
+}
+
+// CountSignificantFigures counts the significant figures of a number as typed.
+// Leading zeros never count; trailing zeros only count after a decimal point, so
+// "1200" has two and "1200." or "1.200e3" have four.
+func CountSignificantFigures(literal string) int {
+	mantissa := strings.TrimLeft(literal, "+-")
+	if i := strings.IndexAny(mantissa, "eE"); i >= 0 {
+		mantissa = mantissa[:i]
+	}
+
+	hasPoint := strings.Contains(mantissa, ".")
+	digits := strings.TrimLeft(strings.Replace(mantissa, ".", "", 1), "0")
+	if digits == "" {
+		// Zero itself: the zeros after the point are significant, if any
+		if i := strings.Index(mantissa, "."); i >= 0 && i < len(mantissa)-1 {
+			return len(mantissa) - i - 1
+		}
+		return 1
+	}
+	if !hasPoint {
+		digits = strings.TrimRight(digits, "0")
+	}
+	return len(digits)
+}
+
+// GradeNumericAnswer grades a numeric answer against the question's key. The
+// number is converted to the key's unit and must land within the tolerance; a
+// unit outside the accepted list, a missing required unit or the wrong count of
+// significant figures makes the answer incorrect.
+func GradeNumericAnswer(question *models.Question, points int, submitted *models.NumericAnswer) (models.Answer, error) {
+	answer := models.Answer{
+		QuestionID:      question.ID,
+		SelectedOptions: []string{},
+		IsCorrect:       false,
+		Points:          0,
+		MaxPoints:       points,
+	}
+
+	key := question.Numeric
+	if key == nil {
+		return answer, fmt.Errorf("question %d has no numeric answer key", question.ID)
+	}
+
+	low, high := toleranceBand(key)
+	breakdown := &models.GradingBreakdown{
+		Rule:           models.GradingNumeric,
+		CorrectOptions: []string{},
+		Numeric: &models.NumericGrade{
+			Expected: key.Answer,
+			Min:      low,
+			Max:      high,
+		},
+	}
+	answer.Grading = breakdown
+
+	if submitted == nil || strings.TrimSpace(submitted.Number) == "" {
+		return answer, nil
+	}
+
+	value, literal, err := ParseNumericAnswer(submitted.Number)
+	if err != nil {
+		return answer, fmt.Errorf("invalid answer for question %d: %v", question.ID, err)
+	}
+	unit := strings.TrimSpace(submitted.Unit)
+	answer.NumericAnswer = &models.NumericAnswer{Number: literal, Unit: unit}
+	breakdown.Answered = true
+
+	grade := breakdown.Numeric
+	multiplier, unitAccepted := numericUnitMultiplier(key, unit)
+	grade.UnitAccepted = unitAccepted
+	grade.Value = value * multiplier
+	grade.SignificantFigures = CountSignificantFigures(literal)
+	grade.FiguresAccepted = key.SignificantFigures == 0 || grade.SignificantFigures == key.SignificantFigures
+
+	answer.IsCorrect = grade.UnitAccepted && grade.FiguresAccepted &&
+		grade.Value >= low-toleranceSlack && grade.Value <= high+toleranceSlack
+	if answer.IsCorrect {
+		answer.Points = float64(points)
+		breakdown.Credit = 1
+	}
+
+	return answer, nil
+}
+
+// toleranceBand returns the lowest and highest accepted values of a numeric key
+func toleranceBand(key *models.NumericKey) (float64, float64) {
+	margin := key.Tolerance
+	if key.ToleranceType == models.ToleranceRelative {
+		margin = key.Tolerance * math.Abs(key.Answer)
+	}
+	return key.Answer - margin, key.Answer + margin
+}
+
+// numericUnitMultiplier finds the conversion factor of the unit an answer was
+// given in and whether that unit is accepted
+func numericUnitMultiplier(key *models.NumericKey, unit string) (float64, bool) {
+	if unit == "" {
+		return 1, !key.UnitRequired
+	}
+	for _, accepted := range key.Units {
+		if accepted.Symbol == unit {
+			return accepted.Multiplier, true
+		}
+	}
+	return 1, false
+}
+
+// validateNumericKey checks the answer key of a numeric question
+func validateNumericKey(key *models.NumericKey) error {
+	if key == nil {
+		return fmt.Errorf("invalid answer key: numeric questions need a numeric answer key")
+	}
+	if math.IsNaN(key.Answer) || math.IsInf(key.Answer, 0) {
+		return fmt.Errorf("invalid answer key: answer must be a finite number")
+	}
+	if key.Tolerance < 0 {
+		return fmt.Errorf("invalid answer key: tolerance cannot be negative")
+	}
+
+	switch key.ToleranceType {
+	case "", models.ToleranceAbsolute:
+	case models.ToleranceRelative:
+		if key.Tolerance > 1 {
+			return fmt.Errorf("invalid answer key: relative tolerance must be between 0 and 1")
+		}
+	default:
+		return fmt.Errorf("invalid answer key: unknown tolerance type %q", key.ToleranceType)
+	}
+
+	seen := make(map[string]bool)
+	for _, unit := range key.Units {
+		if strings.TrimSpace(unit.Symbol) == "" {
+			return fmt.Errorf("invalid answer key: unit symbol cannot be empty")
+		}
+		if seen[unit.Symbol] {
+			return fmt.Errorf("invalid answer key: duplicate unit %q", unit.Symbol)
+		}
+		seen[unit.Symbol] = true
+		if unit.Multiplier <= 0 {
+			return fmt.Errorf("invalid answer key: unit %q needs a positive multiplier", unit.Symbol)
+		}
+	}
+	if key.UnitRequired && len(key.Units) == 0 {
+		return fmt.Errorf("invalid answer key: a required unit needs at least one accepted unit")
+	}
+
+	if key.SignificantFigures < 0 || key.SignificantFigures > 15 {
+		return fmt.Errorf("invalid answer key: significant figures must be between 0 and 15")
+	}
+
+	return nil
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"exam-system/models"
+	"exam-system/utils"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// QTI exports are IMS QTI 2.1 content packages: one assessmentItem file per
+// question under items/, listed by an imsmanifest.xml written last. Choices are
+// renamed O1, O2, ... and matching choices M1, M2, ..., since our IDs aren't
+// always valid QTI identifiers. Media attachments are left out.
+
+const (
+	qtiTemplates = "http://www.imsglobal.org/question/qti_v2p1/rptemplates/"
+	qtiItemType  = "imsqti_item_xmlv2p1"
+)
+
+type qtiMapEntry struct {
+	Key           string `xml:"mapKey,attr"`
+	Value         string `xml:"mappedValue,attr"`
+	CaseSensitive bool   `xml:"caseSensitive,attr"`
+}
+
+type qtiMapping struct {
+	DefaultValue string        `xml:"defaultValue,attr"`
+	Entries      []qtiMapEntry `xml:"mapEntry"`
+}
+
+type qtiResponseDeclaration struct {
+	Identifier  string      `xml:"identifier,attr"`
+	Cardinality string      `xml:"cardinality,attr"`
+	BaseType    string      `xml:"baseType,attr"`
+	Correct     []string    `xml:"correctResponse>value,omitempty"`
+	Mapping     *qtiMapping `xml:"mapping,omitempty"`
+}
+
+type qtiOutcomeDeclaration struct {
+	Identifier  string   `xml:"identifier,attr"`
+	Cardinality string   `xml:"cardinality,attr"`
+	BaseType    string   `xml:"baseType,attr"`
+	Default     []string `xml:"defaultValue>value,omitempty"`
+}
+
+// qtiMarkup is an element whose content is written as XML
+type qtiMarkup struct {
+	Template string `xml:"template,attr,omitempty"`
+	XML      string `xml:",innerxml"`
+}
+
+type qtiItem struct {
+	XMLName       xml.Name                 `xml:"http://www.imsglobal.org/xsd/imsqti_v2p1 assessmentItem"`
+	Identifier    string                   `xml:"identifier,attr"`
+	Title         string                   `xml:"title,attr"`
+	Adaptive      bool                     `xml:"adaptive,attr"`
+	TimeDependent bool                     `xml:"timeDependent,attr"`
+	Responses     []qtiResponseDeclaration `xml:"responseDeclaration"`
+	Outcomes      []qtiOutcomeDeclaration  `xml:"outcomeDeclaration"`
+	Body          qtiMarkup                `xml:"itemBody"`
+	Processing    *qtiMarkup               `xml:"responseProcessing,omitempty"`
+}
+
+type qtiFile struct {
+	Href string `xml:"href,attr"`
+}
+
+type qtiResource struct {
+	Identifier string  `xml:"identifier,attr"`
+	Type       string  `xml:"type,attr"`
+	Href       string  `xml:"href,attr"`
+	File       qtiFile `xml:"file"`
+}
+
+type qtiResources struct {
+	Items []qtiResource `xml:"resource"`
+}
+
+type qtiManifest struct {
+	XMLName       xml.Name     `xml:"http://www.imsglobal.org/xsd/imscp_v1p1 manifest"`
+	Identifier    string       `xml:"identifier,attr"`
+	Schema        string       `xml:"metadata>schema"`
+	SchemaVersion string       `xml:"metadata>schemaversion"`
+	Organizations string       `xml:"organizations"`
+	Resources     qtiResources `xml:"resources"`
+}
+
+// qtiWriter writes a QTI package as a zip archive. Only the manifest entries
+// are kept until Close, not the questions.
+type qtiWriter struct {
+	archive   *zip.Writer
+	resources []qtiResource
+}
+
+func newQTIWriter(w io.Writer) *qtiWriter {
+	return &qtiWriter{archive: zip.NewWriter(w)}
+}
+
+func (q *qtiWriter) Write(question *models.Question) error {
+	item := toQTIItem(question)
+	href := "items/" + item.Identifier + ".xml"
+	if err := q.writeXML(href, item); err != nil {
+		return err
+	}
+
+	q.resources = append(q.resources, qtiResource{
+		Identifier: item.Identifier,
+		Type:       qtiItemType,
+		Href:       href,
+		File:       qtiFile{Href: href},
+	})
+	return nil
+}
+
+func (q *qtiWriter) Close() error {
+	manifest := qtiManifest{
+		Identifier:    "MANIFEST-questions",
+		Schema:        "QTIv2.1 Package",
+		SchemaVersion: "1.0.0",
+		Resources:     qtiResources{Items: q.resources},
+	}
+	if err := q.writeXML("imsmanifest.xml", manifest); err != nil {
+		return err
+	}
+	return q.archive.Close()
+}
+
+func (q *qtiWriter) writeXML(name string, value interface{}) error {
+	file, err := q.archive.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(file)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	_, err = io.WriteString(file, "\n")
+	return err
+}
+
+// toQTIItem describes a question as a QTI assessment item scored 0 to 1, with
+// the question's points as MAXSCORE
+func toQTIItem(question *models.Question) *qtiItem {
+	format := question.Format()
+	item := &qtiItem{
+		Identifier: "q" + strconv.FormatUint(uint64(question.ID), 10),
+		Title:      question.Title,
+		Outcomes: []qtiOutcomeDeclaration{
+			{Identifier: "SCORE", Cardinality: "single", BaseType: "float", Default: []string{"0"}},
+			{Identifier: "MAXSCORE", Cardinality: "single", BaseType: "float", Default: []string{strconv.Itoa(question.Points)}},
+		},
+	}
+
+	var body strings.Builder
+	content := utils.HTMLToXHTML(format.Render(question.Content))
+	optionIDs := make(map[string]string, len(question.Options))
+	for i, opt := range question.Options {
+		optionIDs[opt.ID] = qtiIdentifier("O", i)
+	}
+
+	switch question.Type {
+	case models.MultipleChoice, models.TrueFalse:
+		response := qtiResponseDeclaration{Identifier: "RESPONSE", Cardinality: "single", BaseType: "identifier"}
+		maxChoices := 1
+		if question.Selection() == models.SelectMultiple {
+			response.Cardinality = "multiple"
+			maxChoices = question.MaxSelections
+		}
+		for _, opt := range question.Options {
+			if opt.IsCorrect {
+				response.Correct = append(response.Correct, optionIDs[opt.ID])
+			}
+		}
+		item.Responses = append(item.Responses, response)
+
+		writeQTIBlock(&body, content)
+		fmt.Fprintf(&body, `<choiceInteraction responseIdentifier="RESPONSE" shuffle="false" maxChoices="%d" minChoices="%d">`, maxChoices, question.MinSelections)
+		for _, opt := range question.Options {
+			fmt.Fprintf(&body, `<simpleChoice identifier="%s">%s</simpleChoice>`, optionIDs[opt.ID], utils.HTMLToXHTML(format.Render(opt.Text)))
+		}
+		body.WriteString(`</choiceInteraction>`)
+		item.Processing = &qtiMarkup{Template: qtiTemplates + "match_correct"}
+
+	case models.ShortAnswer:
+		var accepted []models.AcceptedAnswer
+		if len(question.Blanks) > 0 {
+			accepted = question.Blanks[0].Accepted
+		}
+		item.Responses = append(item.Responses, qtiTextResponse("RESPONSE", accepted))
+
+		writeQTIBlock(&body, content)
+		body.WriteString(`<p><textEntryInteraction responseIdentifier="RESPONSE"/></p>`)
+		item.Processing = &qtiMarkup{Template: qtiTemplates + "map_response"}
+
+	case models.Cloze:
+		// Every blank is its own response; the score is the share of blanks right
+		blanks := make(map[string]models.Blank, len(question.Blanks))
+		for _, blank := range question.Blanks {
+			blanks[blank.ID] = blank
+		}
+		identifiers := make(map[string]string)
+		for i, id := range ClozeBlankIDs(question.Content) {
+			identifiers[id] = qtiIdentifier("RESPONSE_", i)
+			item.Responses = append(item.Responses, qtiTextResponse(identifiers[id], blanks[id].Accepted))
+		}
+		content = clozePlaceholder.ReplaceAllStringFunc(content, func(placeholder string) string {
+			return fmt.Sprintf(`<textEntryInteraction responseIdentifier="%s"/>`, identifiers[clozePlaceholder.FindStringSubmatch(placeholder)[1]])
+		})
+		writeQTIBlock(&body, content)
+
+		var sum strings.Builder
+		for _, response := range item.Responses {
+			fmt.Fprintf(&sum, `<mapResponse identifier="%s"/>`, response.Identifier)
+		}
+		item.Processing = &qtiMarkup{XML: fmt.Sprintf(
+			`<setOutcomeValue identifier="SCORE"><divide><sum>%s</sum><baseValue baseType="float">%d</baseValue></divide></setOutcomeValue>`,
+			sum.String(), len(item.Responses))}
+
+	case models.Numeric:
+		response := qtiResponseDeclaration{Identifier: "RESPONSE", Cardinality: "single", BaseType: "float"}
+		tolerance := `toleranceMode="exact"`
+		if key := question.Numeric; key != nil {
+			response.Correct = []string{strconv.FormatFloat(key.Answer, 'g', -1, 64)}
+			if key.Tolerance > 0 {
+				mode, value := "absolute", key.Tolerance
+				if key.ToleranceType == models.ToleranceRelative {
+					mode, value = "relative", key.Tolerance*100 // QTI takes a percentage
+				}
+				tolerance = fmt.Sprintf(`toleranceMode="%s" tolerance="%s"`, mode, strconv.FormatFloat(value, 'g', -1, 64))
+			}
+		}
+		item.Responses = append(item.Responses, response)
+
+		writeQTIBlock(&body, content)
+		body.WriteString(`<p><textEntryInteraction responseIdentifier="RESPONSE"/></p>`)
+		item.Processing = &qtiMarkup{XML: fmt.Sprintf(
+			`<responseCondition><responseIf><equal %s><variable identifier="RESPONSE"/><correct identifier="RESPONSE"/></equal>`+
+				`<setOutcomeValue identifier="SCORE"><baseValue baseType="float">1</baseValue></setOutcomeValue></responseIf></responseCondition>`,
+			tolerance)}
+
+	case models.Ordering:
+		response := qtiResponseDeclaration{Identifier: "RESPONSE", Cardinality: "ordered", BaseType: "identifier"}
+		for _, opt := range question.Options {
+			response.Correct = append(response.Correct, optionIDs[opt.ID])
+		}
+		item.Responses = append(item.Responses, response)
+
+		// The authored order is the answer, so candidates get the items shuffled
+		writeQTIBlock(&body, content)
+		body.WriteString(`<orderInteraction responseIdentifier="RESPONSE" shuffle="true">`)
+		for _, opt := range question.Options {
+			fmt.Fprintf(&body, `<simpleChoice identifier="%s">%s</simpleChoice>`, optionIDs[opt.ID], utils.HTMLToXHTML(format.Render(opt.Text)))
+		}
+		body.WriteString(`</orderInteraction>`)
+		item.Processing = &qtiMarkup{Template: qtiTemplates + "match_correct"}
+
+	case models.Matching:
+		choiceIDs := make(map[string]string, len(question.MatchChoices))
+		for i, choice := range question.MatchChoices {
+			choiceIDs[choice.ID] = qtiIdentifier("M", i)
+		}
+		response := qtiResponseDeclaration{Identifier: "RESPONSE", Cardinality: "multiple", BaseType: "directedPair"}
+		for _, opt := range question.Options {
+			response.Correct = append(response.Correct, optionIDs[opt.ID]+" "+choiceIDs[opt.MatchID])
+		}
+		item.Responses = append(item.Responses, response)
+
+		// A choice may be matched to more than one option
+		writeQTIBlock(&body, content)
+		fmt.Fprintf(&body, `<matchInteraction responseIdentifier="RESPONSE" shuffle="true" maxAssociations="%d"><simpleMatchSet>`, len(question.Options))
+		for _, opt := range question.Options {
+			fmt.Fprintf(&body, `<simpleAssociableChoice identifier="%s" matchMax="1">%s</simpleAssociableChoice>`, optionIDs[opt.ID], utils.HTMLToXHTML(format.Render(opt.Text)))
+		}
+		body.WriteString(`</simpleMatchSet><simpleMatchSet>`)
+		for _, choice := range question.MatchChoices {
+			fmt.Fprintf(&body, `<simpleAssociableChoice identifier="%s" matchMax="0">%s</simpleAssociableChoice>`, choiceIDs[choice.ID], utils.HTMLToXHTML(format.Render(choice.Text)))
+		}
+		body.WriteString(`</simpleMatchSet></matchInteraction>`)
+		item.Processing = &qtiMarkup{Template: qtiTemplates + "match_correct"}
+
+	case models.Essay:
+		// Essays are scored by a grader, so there is no response processing
+		item.Responses = append(item.Responses, qtiResponseDeclaration{Identifier: "RESPONSE", Cardinality: "single", BaseType: "string"})
+		writeQTIBlock(&body, content)
+		body.WriteString(`<extendedTextInteraction responseIdentifier="RESPONSE"/>`)
+		if len(question.Rubric) > 0 {
+			body.WriteString(`<rubricBlock view="scorer"><ul>`)
+			for _, criterion := range question.Rubric {
+				text := fmt.Sprintf("%s (%g-%g)", criterion.Title, criterion.MinPoints, criterion.MaxPoints)
+				if criterion.Description != "" {
+					text += ": " + criterion.Description
+				}
+				fmt.Fprintf(&body, `<li>%s</li>`, qtiEscape(text))
+			}
+			body.WriteString(`</ul></rubricBlock>`)
+		}
+	}
+
+	if question.Explanation != "" {
+		body.WriteString(`<rubricBlock view="tutor">`)
+		writeQTIBlock(&body, utils.HTMLToXHTML(format.Render(question.Explanation)))
+		body.WriteString(`</rubricBlock>`)
+	}
+	item.Body.XML = body.String()
+
+	return item
+}
+
+// qtiTextResponse declares a typed response, mapping every accepted answer to
+// full credit. Regular expressions have no QTI mapping and are left out.
+func qtiTextResponse(identifier string, accepted []models.AcceptedAnswer) qtiResponseDeclaration {
+	response := qtiResponseDeclaration{
+		Identifier:  identifier,
+		Cardinality: "single",
+		BaseType:    "string",
+		Mapping:     &qtiMapping{DefaultValue: "0"},
+	}
+	for _, answer := range accepted {
+		if answer.Match == models.MatchRegex {
+			continue
+		}
+		if len(response.Correct) == 0 {
+			response.Correct = []string{answer.Text}
+		}
+		response.Mapping.Entries = append(response.Mapping.Entries, qtiMapEntry{
+			Key:           answer.Text,
+			Value:         "1",
+			CaseSensitive: answer.Match == "" || answer.Match == models.MatchExact || answer.Match == models.MatchWhitespace,
+		})
+	}
+	return response
+}
+
+// writeQTIBlock wraps XHTML content in a div, as item bodies take block content
+func writeQTIBlock(body *strings.Builder, content string) {
+	body.WriteString("<div>")
+	body.WriteString(content)
+	body.WriteString("</div>")
+}
+
+// qtiIdentifier numbers the choices or responses of an item from 1
+func qtiIdentifier(prefix string, index int) string {
+	return prefix + strconv.Itoa(index+1)
+}
+
+// qtiEscape escapes text for XML content
+func qtiEscape(text string) string {
+	var out bytes.Buffer
+	xml.EscapeText(&out, []byte(text))
+	return out.String()
+}
@@ -0,0 +1,390 @@
+package services
+
+import (
+	"encoding/json"
+	"exam-system/models"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Exports stream the questions matching a listing filter in batches, so a large
+// bank is never held in memory. The native JSON format carries every authored
+// field and is read back by ImportQuestions, for moving banks between
+// environments; Moodle XML and QTI packages are for other systems and leave out
+// what those can't express. Media IDs differ between banks, so native exports
+// describe the files their attachments show and imports find them by checksum.
+
+type ExportFormat string
+
+const (
+	ExportJSON      ExportFormat = "json"
+	ExportMoodleXML ExportFormat = "moodle_xml"
+	ExportQTI       ExportFormat = "qti" // IMS QTI 2.1 content package
+)
+
+// IsValid reports whether f is a known export format
+func (f ExportFormat) IsValid() bool {
+	switch f {
+	case ExportJSON, ExportMoodleXML, ExportQTI:
+		return true
+	}
+	return false
+}
+
+// ContentType is the media type of an export file
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportMoodleXML:
+		return "application/xml"
+	case ExportQTI:
+		return "application/zip"
+	}
+	return "application/json"
+}
+
+// Extension is the file extension of an export file
+func (f ExportFormat) Extension() string {
+	switch f {
+	case ExportMoodleXML:
+		return ".xml"
+	case ExportQTI:
+		return ".zip"
+	}
+	return ".json"
+}
+
+// exportBatchSize is how many questions an export loads at a time
+const exportBatchSize = 100
+
+// The native format is identified by nativeFormat; nativeVersion goes up when a
+// change would keep older servers from reading an export
+const (
+	nativeFormat  = "exam-system/questions"
+	nativeVersion = 2 // version 1 exports don't describe their media
+)
+
+// NativeQuestion is a question in the native JSON format: the fields of a create
+// request plus its state in the bank
+type NativeQuestion struct {
+	ID uint `json:"id,omitempty"` // in the exporting bank, ignored on import
+	CreateQuestionRequest
+	IsActive *bool         `json:"is_active,omitempty"` // active when left out
+	Media    []NativeMedia `json:"media,omitempty"`     // files the attachments show
+}
+
+// NativeMedia describes a file the attachments of a native export show
+type NativeMedia struct {
+	ID          uint   `json:"id"` // the attachments' media_id, in the exporting bank
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Checksum    string `json:"checksum"` // hex SHA-256 of the file
+}
+
+// questionWriter writes the questions of an export one at a time
+type questionWriter interface {
+	Write(question *models.Question) error
+	Close() error
+}
+
+// ExportQuestions writes the questions matching the filter to w, oldest first
+func (s *QuestionService) ExportQuestions(w io.Writer, format ExportFormat, filter QuestionFilter) error {
+	var writer questionWriter
+	switch format {
+	case ExportJSON:
+		writer = &nativeWriter{w: w, db: s.db}
+	case ExportMoodleXML:
+		writer = newMoodleWriter(w)
+	case ExportQTI:
+		writer = newQTIWriter(w)
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+
+	count := 0
+	var batch []models.Question
+	err := applyQuestionFilter(s.db.Model(&models.Question{}), filter).
+		FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				if err := writer.Write(&batch[i]); err != nil {
+					return err
+				}
+				count++
+			}
+			return nil
+		}).Error
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		s.logger.WithError(err).WithField("format", format).Error("Failed to export questions")
+		return fmt.Errorf("failed to export questions")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"format": format,
+		"count":  count,
+	}).Info("Questions exported")
+
+	return nil
+}
+
+// ToNativeQuestion describes a question in the native JSON format
+func ToNativeQuestion(question *models.Question) NativeQuestion {
+	active := question.IsActive
+	return NativeQuestion{
+		ID: question.ID,
+		CreateQuestionRequest: CreateQuestionRequest{
+			Title:         question.Title,
+			Content:       question.Content,
+			ContentFormat: question.Format(),
+			Type:          question.Type,
+			Difficulty:    question.Difficulty,
+			Options:       question.Options,
+			Blanks:        question.Blanks,
+			Numeric:       question.Numeric,
+			MatchChoices:  question.MatchChoices,
+			Rubric:        question.Rubric,
+			Attachments:   question.Attachments,
+			SelectionMode: question.SelectionMode,
+			MinSelections: question.MinSelections,
+			MaxSelections: question.MaxSelections,
+			Tags:          question.Tags,
+			Points:        question.Points,
+			TimeLimit:     question.TimeLimit,
+			Explanation:   question.Explanation,
+		},
+		IsActive: &active,
+	}
+}
+
+// nativeWriter writes a JSON document with the questions in an array, one
+// question per line. Nothing is written until the first question or Close, so a
+// failed query can still be answered with an error.
+type nativeWriter struct {
+	w       io.Writer
+	db      *gorm.DB
+	started bool
+	count   int
+}
+
+func (n *nativeWriter) begin() error {
+	if n.started {
+		return nil
+	}
+	n.started = true
+
+	_, err := fmt.Fprintf(n.w, "{\"format\":%q,\"version\":%d,\"exported_at\":%q,\"questions\":[",
+		nativeFormat, nativeVersion, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func (n *nativeWriter) Write(question *models.Question) error {
+	if err := n.begin(); err != nil {
+		return err
+	}
+
+	native := ToNativeQuestion(question)
+	media, err := n.media(question)
+	if err != nil {
+		return err
+	}
+	native.Media = media
+	data, err := json.Marshal(native)
+	if err != nil {
+		return err
+	}
+	separator := "\n"
+	if n.count > 0 {
+		separator = ",\n"
+	}
+	n.count++
+
+	if _, err := io.WriteString(n.w, separator); err != nil {
+		return err
+	}
+	_, err = n.w.Write(data)
+	return err
+}
+
+// media describes the files the question's attachments show
+func (n *nativeWriter) media(question *models.Question) ([]NativeMedia, error) {
+	ids := question.MediaIDs()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var rows []models.Media
+	if err := n.db.Where("id IN ?", ids).Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	media := make([]NativeMedia, len(rows))
+	for i, row := range rows {
+		media[i] = NativeMedia{
+			ID:          row.ID,
+			Filename:    row.Filename,
+			ContentType: row.ContentType,
+			Size:        row.Size,
+			Checksum:    row.Checksum,
+		}
+	}
+	return media, nil
+}
+
+func (n *nativeWriter) Close() error {
+	if err := n.begin(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(n.w, "\n]}\n")
+	return err
+}
+
+// parseNativeJSON reads the questions of a native JSON export. The questions
+// array is decoded one question at a time; a question that doesn't decode is
+// reported on its own.
+func parseNativeJSON(r io.Reader) ([]importedQuestion, error) {
+	decoder := json.NewDecoder(r)
+	if err := expectJSONDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+
+	questions := []importedQuestion{}
+	sawFormat := false
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid import file: %v", err)
+		}
+		key, _ := token.(string)
+
+		switch key {
+		case "format":
+			var format string
+			if err := decoder.Decode(&format); err != nil || format != nativeFormat {
+				return nil, fmt.Errorf("invalid import file: not an exam-system question export")
+			}
+			sawFormat = true
+		case "version":
+			var version int
+			if err := decoder.Decode(&version); err != nil {
+				return nil, fmt.Errorf("invalid import file: %v", err)
+			}
+			if version > nativeVersion {
+				return nil, fmt.Errorf("invalid import file: export version %d is newer than this server reads", version)
+			}
+		case "questions":
+			if err := expectJSONDelim(decoder, '['); err != nil {
+				return nil, err
+			}
+			for decoder.More() {
+				var raw json.RawMessage
+				if err := decoder.Decode(&raw); err != nil {
+					return nil, fmt.Errorf("invalid import file: %v", err)
+				}
+				questions = append(questions, nativeImportedQuestion(raw))
+			}
+			if err := expectJSONDelim(decoder, ']'); err != nil {
+				return nil, err
+			}
+		default:
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return nil, fmt.Errorf("invalid import file: %v", err)
+			}
+		}
+	}
+
+	if !sawFormat {
+		return nil, fmt.Errorf("invalid import file: not an exam-system question export")
+	}
+	return questions, nil
+}
+
+func nativeImportedQuestion(raw json.RawMessage) importedQuestion {
+	var question NativeQuestion
+	if err := json.Unmarshal(raw, &question); err != nil {
+		return importedQuestion{Err: fmt.Errorf("question could not be read: %v", err)}
+	}
+	return importedQuestion{
+		Request:  question.CreateQuestionRequest,
+		Inactive: question.IsActive != nil && !*question.IsActive,
+		Media:    question.Media,
+	}
+}
+
+// matchImportedMedia points the attachments of a question from a native export
+// at the same files in this bank, found by checksum. Attachments whose file isn't
+// in this bank are left out with a warning: their media IDs belong to the
+// exporting bank and could name an unrelated file here.
+func (s *QuestionService) matchImportedMedia(req *CreateQuestionRequest, exported []NativeMedia) ([]string, error) {
+	described := make(map[uint]NativeMedia, len(exported))
+	checksums := []string{}
+	for _, media := range exported {
+		described[media.ID] = media
+		if media.Checksum != "" {
+			checksums = append(checksums, media.Checksum)
+		}
+	}
+
+	local := make(map[string]uint)
+	if len(checksums) > 0 {
+		var rows []models.Media
+		if err := s.db.Where("checksum IN ?", checksums).Order("id").Find(&rows).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to load media")
+			return nil, err
+		}
+		for _, row := range rows {
+			if _, ok := local[row.Checksum]; !ok {
+				local[row.Checksum] = row.ID
+			}
+		}
+	}
+
+	warnings := []string{}
+	match := func(attachment *models.Attachment) bool {
+		media, ok := described[attachment.MediaID]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("attachment of media %d is left out, the export doesn't describe its file", attachment.MediaID))
+			return false
+		}
+		id, ok := local[media.Checksum]
+		if !ok || media.Checksum == "" {
+			warnings = append(warnings, fmt.Sprintf("attachment %q is left out, upload the file and attach it again", media.Filename))
+			return false
+		}
+		attachment.MediaID = id
+		return true
+	}
+
+	kept := req.Attachments[:0]
+	for i := range req.Attachments {
+		if match(&req.Attachments[i]) {
+			kept = append(kept, req.Attachments[i])
+		}
+	}
+	req.Attachments = kept
+	for _, items := range [][]models.Option{req.Options, req.MatchChoices} {
+		for i := range items {
+			if items[i].Attachment != nil && !match(items[i].Attachment) {
+				items[i].Attachment = nil
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// expectJSONDelim reads the next token and makes sure it is the given delimiter
+func expectJSONDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("invalid import file: %v", err)
+	}
+	if token != delim {
+		return fmt.Errorf("invalid import file: expected %q", delim)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"bufio"
+	"exam-system/models"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Imports run in two steps: a dry run validates every question of the file and
+// reports what would be created, then the same file is imported for real. Each
+// question is reported on its own, so one bad question doesn't hide the others.
+
+type ImportFormat string
+
+const (
+	ImportMoodleXML  ImportFormat = "moodle_xml"
+	ImportNativeJSON ImportFormat = "json" // written by ExportQuestions
+	ImportCSV        ImportFormat = "csv"  // one question per row under a header row
+	ImportXLSX       ImportFormat = "xlsx" // the first sheet, laid out like a CSV file
+	ImportAiken      ImportFormat = "aiken"
+	ImportGIFT       ImportFormat = "gift"
+)
+
+// ImportMode decides what happens to the valid questions of a file that also has
+// invalid ones
+type ImportMode string
+
+const (
+	ImportSkipInvalid  ImportMode = "skip_invalid"   // create the valid questions
+	ImportAllOrNothing ImportMode = "all_or_nothing" // create nothing
+)
+
+// IsValid reports whether m is a known import mode; empty means skip_invalid
+func (m ImportMode) IsValid() bool {
+	return m == "" || m == ImportSkipInvalid || m == ImportAllOrNothing
+}
+
+// maxImportQuestions caps the questions of one import file
+const maxImportQuestions = 2000
+
+type ImportStatus string
+
+const (
+	ImportValid   ImportStatus = "valid"   // passed validation in a dry run
+	ImportCreated ImportStatus = "created" // stored in the question bank
+	ImportSkipped ImportStatus = "skipped" // valid, but not created because an all-or-nothing import had invalid questions
+	ImportInvalid ImportStatus = "invalid" // not imported, see Error
+)
+
+type ImportOptions struct {
+	Format     ImportFormat
+	Mode       ImportMode
+	DryRun     bool
+	Difficulty models.QuestionDifficulty // for formats that don't carry one, medium when empty
+}
+
+type ImportItem struct {
+	Index      int                 `json:"index"`          // 1-based position among the questions of the file
+	Line       int                 `json:"line,omitempty"` // where the question starts: the row of a spreadsheet, the line of a text file
+	Title      string              `json:"title"`
+	Type       models.QuestionType `json:"type,omitempty"`
+	Status     ImportStatus        `json:"status"`
+	QuestionID uint                `json:"question_id,omitempty"`
+	Error      string              `json:"error,omitempty"`
+	Warnings   []string            `json:"warnings,omitempty"` // parts of the question that couldn't be imported as written
+}
+
+type ImportReport struct {
+	Format  ImportFormat `json:"format"`
+	Mode    ImportMode   `json:"mode"`
+	DryRun  bool         `json:"dry_run"`
+	Total   int          `json:"total"`
+	Valid   int          `json:"valid"`
+	Invalid int          `json:"invalid"`
+	Created int          `json:"created"`
+	Items   []ImportItem `json:"items"`
+}
+
+// importedQuestion is a question read from an import file, or why it couldn't be read
+type importedQuestion struct {
+	Request  CreateQuestionRequest
+	Line     int           // where the question starts in the file, 0 when unknown
+	Inactive bool          // exported while deactivated
+	Media    []NativeMedia // files the attachments of a native export show
+	Warnings []string
+	Err      error
+}
+
+// ImportQuestions validates the questions of an import file and, unless it is a
+// dry run, creates the valid ones in one transaction. In all-or-nothing mode a
+// file with any invalid question creates nothing.
+func (s *QuestionService) ImportQuestions(file io.Reader, opts ImportOptions, createdBy uint) (*ImportReport, error) {
+	if !opts.Mode.IsValid() {
+		return nil, fmt.Errorf("invalid import mode %q", opts.Mode)
+	}
+
+	var parsed []importedQuestion
+	var err error
+	switch opts.Format {
+	case ImportMoodleXML:
+		parsed, err = parseMoodleXML(file)
+	case ImportNativeJSON:
+		parsed, err = parseNativeJSON(file)
+	case ImportCSV:
+		parsed, err = parseCSV(file)
+	case ImportXLSX:
+		parsed, err = parseXLSX(file)
+	case ImportAiken:
+		parsed, err = parseAiken(file)
+	case ImportGIFT:
+		parsed, err = parseGIFT(file)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", opts.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("invalid import file: no questions found")
+	}
+	if len(parsed) > maxImportQuestions {
+		return nil, fmt.Errorf("invalid import file: more than %d questions", maxImportQuestions)
+	}
+
+	if opts.Mode == "" {
+		opts.Mode = ImportSkipInvalid
+	}
+	report := &ImportReport{
+		Format: opts.Format,
+		Mode:   opts.Mode,
+		DryRun: opts.DryRun,
+		Total:  len(parsed),
+		Items:  make([]ImportItem, len(parsed)),
+	}
+	questions := make([]*models.Question, len(parsed))
+
+	for i, imported := range parsed {
+		item := &report.Items[i]
+		item.Index = i + 1
+		item.Line = imported.Line
+		item.Title = imported.Request.Title
+		item.Type = imported.Request.Type
+		item.Warnings = imported.Warnings
+
+		if imported.Err != nil {
+			item.Status = ImportInvalid
+			item.Error = imported.Err.Error()
+			report.Invalid++
+			continue
+		}
+
+		req := imported.Request
+		if opts.Format == ImportNativeJSON {
+			warnings, err := s.matchImportedMedia(&req, imported.Media)
+			if err != nil {
+				return nil, fmt.Errorf("failed to import questions")
+			}
+			item.Warnings = append(item.Warnings, warnings...)
+		}
+		applyImportDefaults(&req, opts)
+		question := questionFromRequest(req, createdBy)
+		question.IsActive = !imported.Inactive
+		if err := checkImportedQuestion(&question); err != nil {
+			item.Status = ImportInvalid
+			item.Error = err.Error()
+			report.Invalid++
+			continue
+		}
+		if err := s.validateQuestion(&question); err != nil {
+			item.Status = ImportInvalid
+			item.Error = err.Error()
+			report.Invalid++
+			continue
+		}
+
+		item.Status = ImportValid
+		report.Valid++
+		questions[i] = &question
+	}
+
+	if opts.DryRun || report.Valid == 0 {
+		return report, nil
+	}
+	if opts.Mode == ImportAllOrNothing && report.Invalid > 0 {
+		for i := range report.Items {
+			if report.Items[i].Status == ImportValid {
+				report.Items[i].Status = ImportSkipped
+			}
+		}
+		return report, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, question := range questions {
+			if question == nil {
+				continue
+			}
+			if err := insertQuestion(tx, question); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to import questions")
+		return nil, fmt.Errorf("failed to import questions")
+	}
+
+	for i, question := range questions {
+		if question == nil {
+			continue
+		}
+		report.Items[i].Status = ImportCreated
+		report.Items[i].QuestionID = question.ID
+		report.Created++
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"format":     opts.Format,
+		"mode":       opts.Mode,
+		"created":    report.Created,
+		"invalid":    report.Invalid,
+		"created_by": createdBy,
+	}).Info("Questions imported")
+
+	return report, nil
+}
+
+// applyImportDefaults fills in what an import file left out, the way the create
+// endpoint's defaults would
+func applyImportDefaults(req *CreateQuestionRequest, opts ImportOptions) {
+	if req.Difficulty == "" {
+		req.Difficulty = opts.Difficulty
+	}
+	if req.Difficulty == "" {
+		req.Difficulty = models.Medium
+	}
+	if req.Points < 1 {
+		req.Points = 1
+	}
+	if req.TimeLimit < 10 {
+		req.TimeLimit = 60
+	}
+	if len(req.Tags) == 0 {
+		req.Tags = []string{"imported"}
+	}
+}
+
+// trueFalseOptions is the answer key of a true/false question
+func trueFalseOptions(trueIsCorrect bool) []models.Option {
+	return []models.Option{
+		{ID: "true", Text: "True", IsCorrect: trueIsCorrect},
+		{ID: "false", Text: "False", IsCorrect: !trueIsCorrect},
+	}
+}
+
+// newLineScanner reads a text import file line by line, allowing long lines
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	return scanner
+}
+
+// checkImportedQuestion applies the checks the create endpoint's request binding
+// makes, which imported questions don't go through
+func checkImportedQuestion(question *models.Question) error {
+	if strings.TrimSpace(question.Title) == "" {
+		return fmt.Errorf("question title cannot be empty")
+	}
+	if utf8.RuneCountInString(question.Title) > 255 {
+		return fmt.Errorf("question title is longer than 255 characters")
+	}
+	if strings.TrimSpace(question.Content) == "" {
+		return fmt.Errorf("question content cannot be empty")
+	}
+	switch question.Difficulty {
+	case models.Easy, models.Medium, models.Hard:
+	default:
+		return fmt.Errorf("invalid difficulty %q", question.Difficulty)
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Questions are versioned: every edit that changes a question's content records a
+// new QuestionRevision and bumps Question.Revision. Exam questions and blueprint
+// draws pin the revision they use, and graded answers record it, so editing a
+// question never changes how a published exam reads or grades, nor how an old
+// result displays. Draft and scheduled exams, which nobody has sat yet, follow
+// the edits.
+
+type RevisionDiffResponse struct {
+	QuestionID uint                    `json:"question_id"`
+	From       int                     `json:"from"`
+	To         int                     `json:"to"`
+	Changes    []models.RevisionChange `json:"changes"`
+}
+
+// GetQuestionRevisions lists the revisions of a question, newest first
+func (s *QuestionService) GetQuestionRevisions(questionID uint) ([]models.QuestionRevision, error) {
+	if _, err := s.GetQuestion(questionID, true); err != nil {
+		return nil, err
+	}
+
+	revisions := []models.QuestionRevision{}
+	if err := s.db.Where("question_id = ?", questionID).Order("revision DESC").Find(&revisions).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get question revisions")
+		return nil, fmt.Errorf("failed to get question revisions")
+	}
+
+	return revisions, nil
+}
+
+// GetQuestionRevision returns one revision of a question
+func (s *QuestionService) GetQuestionRevision(questionID uint, revision int) (*models.QuestionRevision, error) {
+	if _, err := s.GetQuestion(questionID, true); err != nil {
+		return nil, err
+	}
+
+	var found models.QuestionRevision
+	if err := s.db.Where("question_id = ? AND revision = ?", questionID, revision).First(&found).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("revision not found")
+		}
+		s.logger.WithError(err).Error("Failed to get question revision")
+		return nil, fmt.Errorf("failed to get question revision")
+	}
+
+	return &found, nil
+}
+
+// DiffQuestionRevisions lists what changed from one revision of a question to
+// another. Without to it compares against the current revision, and without from
+// against the revision before to.
+func (s *QuestionService) DiffQuestionRevisions(questionID uint, from, to int) (*RevisionDiffResponse, error) {
+	if to == 0 {
+		question, err := s.GetQuestion(questionID, true)
+		if err != nil {
+			return nil, err
+		}
+		to = question.Revision
+	}
+	if from == 0 {
+		from = to - 1
+	}
+
+	fromRevision, err := s.GetQuestionRevision(questionID, from)
+	if err != nil {
+		return nil, err
+	}
+	toRevision, err := s.GetQuestionRevision(questionID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevisionDiffResponse{
+		QuestionID: questionID,
+		From:       from,
+		To:         to,
+		Changes:    models.DiffRevisions(fromRevision, toRevision),
+	}, nil
+}
+
+// RestoreQuestionRevision brings back the content of an earlier revision. The
+// restore is an edit like any other: it records a new revision rather than
+// rewinding, so answers given against the revisions in between keep theirs.
+func (s *QuestionService) RestoreQuestionRevision(questionID uint, revision int, restoredBy uint) (*models.Question, error) {
+	restored, err := s.GetQuestionRevision(questionID, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	var question models.Question
+	if err := s.db.Where("id = ?", questionID).First(&question).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to find question")
+		return nil, fmt.Errorf("failed to restore question revision")
+	}
+	current := question.Revision
+
+	restored.Apply(&question)
+	question.Revision = current
+	if err := s.validateQuestion(&question); err != nil {
+		return nil, err
+	}
+
+	saved, err := s.saveRevision(&question, restoredBy, &revision)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to restore question revision")
+		return nil, fmt.Errorf("failed to restore question revision")
+	}
+	if !saved {
+		return &question, nil
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"question_id":   question.ID,
+		"revision":      question.Revision,
+		"restored_from": revision,
+		"restored_by":   restoredBy,
+	}).Info("Question revision restored")
+
+	return &question, nil
+}
+
+// saveRevision stores an edited question. When its content differs from the
+// stored revision it becomes the next revision, and the draft and scheduled
+// exams using the question move to it. It reports whether a revision was added.
+func (s *QuestionService) saveRevision(question *models.Question, editedBy uint, restoredFrom *int) (bool, error) {
+	added := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var previous models.QuestionRevision
+		err := tx.Where("question_id = ? AND revision = ?", question.ID, question.Revision).First(&previous).Error
+		if err == gorm.ErrRecordNotFound {
+			// Questions stored outside the service have no first revision yet; the
+			// stored row still holds it
+			var stored models.Question
+			if err := tx.Where("id = ?", question.ID).First(&stored).Error; err != nil {
+				return err
+			}
+			previous = models.NewQuestionRevision(&stored, stored.CreatedBy)
+			if err := createRevision(tx, &previous); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		next := models.NewQuestionRevision(question, editedBy)
+		if !previous.SameContent(&next) {
+			added = true
+			question.Revision = previous.Revision + 1
+			next.Revision = question.Revision
+			next.RestoredFrom = restoredFrom
+			if err := createRevision(tx, &next); err != nil {
+				return err
+			}
+
+			unsat := tx.Model(&models.Exam{}).Select("id").Where("status IN ?", []models.ExamStatus{models.ExamDraft, models.ExamScheduled})
+			if err := tx.Model(&models.ExamQuestion{}).
+				Where("question_id = ? AND exam_id IN (?)", question.ID, unsat).
+				Update("revision", question.Revision).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Save(question).Error; err != nil {
+			return err
+		}
+		return linkQuestionMedia(tx, question)
+	})
+	if err != nil {
+		added = false
+	}
+	return added, err
+}
+
+// recordFirstRevision stores revision 1 of a newly created question
+func recordFirstRevision(tx *gorm.DB, question *models.Question) error {
+	revision := models.NewQuestionRevision(question, question.CreatedBy)
+	return createRevision(tx, &revision)
+}
+
+// createRevision stores a revision and links it to the media it shows, which
+// then stays until releaseRevisionMedia finds nothing uses the revision
+func createRevision(tx *gorm.DB, revision *models.QuestionRevision) error {
+	if err := tx.Create(revision).Error; err != nil {
+		return err
+	}
+
+	ids := revision.MediaIDs()
+	if len(ids) == 0 {
+		return nil
+	}
+	links := make([]models.RevisionMedia, len(ids))
+	for i, id := range ids {
+		links[i] = models.RevisionMedia{RevisionID: revision.ID, MediaID: id}
+	}
+	return tx.Create(&links).Error
+}
+
+// releaseRevisionMedia drops the media links of revisions nothing shows any
+// more, so their files can be cleaned up: revisions that are neither the current
+// revision of a question in the bank nor used by an exam, an attempt or a result.
+// Without question IDs it looks at every question.
+func releaseRevisionMedia(db *gorm.DB, questionIDs []uint) error {
+	query := db.Model(&models.QuestionRevision{}).
+		Select("id", "question_id", "revision").
+		Where("EXISTS (SELECT 1 FROM revision_media WHERE revision_media.revision_id = question_revisions.id)").
+		Where("NOT EXISTS (SELECT 1 FROM questions WHERE questions.id = question_revisions.question_id AND questions.revision = question_revisions.revision AND questions.deleted_at IS NULL)").
+		Where("NOT EXISTS (SELECT 1 FROM exam_questions WHERE exam_questions.question_id = question_revisions.question_id AND exam_questions.revision = question_revisions.revision)").
+		Where("NOT EXISTS (SELECT 1 FROM attempt_questions WHERE attempt_questions.question_id = question_revisions.question_id AND attempt_questions.revision = question_revisions.revision)")
+	if questionIDs != nil {
+		query = query.Where("question_id IN ?", questionIDs)
+	}
+
+	var unused []models.QuestionRevision
+	if err := query.Find(&unused).Error; err != nil {
+		return err
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+
+	answered, err := answeredRevisions(db, unused)
+	if err != nil {
+		return err
+	}
+
+	var released []uint
+	for _, revision := range unused {
+		if !answered[answeredQuestion{revision.QuestionID, revision.Revision}] {
+			released = append(released, revision.ID)
+		}
+	}
+	if len(released) == 0 {
+		return nil
+	}
+	return db.Where("revision_id IN ?", released).Delete(&models.RevisionMedia{}).Error
+}
+
+// answeredRevisions returns which of the revisions results hold answers to,
+// looking at the results of the exams that listed or drew their questions
+func answeredRevisions(db *gorm.DB, revisions []models.QuestionRevision) (map[answeredQuestion]bool, error) {
+	questionIDs := make([]uint, 0, len(revisions))
+	for _, revision := range revisions {
+		if !containsID(questionIDs, revision.QuestionID) {
+			questionIDs = append(questionIDs, revision.QuestionID)
+		}
+	}
+
+	var results []models.Result
+	if err := db.Select("id", "answers").
+		Where("exam_id IN (SELECT exam_id FROM exam_questions WHERE question_id IN ?) OR exam_id IN (SELECT exam_attempts.exam_id FROM exam_attempts JOIN attempt_questions ON attempt_questions.exam_attempt_id = exam_attempts.id WHERE attempt_questions.question_id IN ?)", questionIDs, questionIDs).
+		Find(&results).Error; err != nil {
+		return nil, err
+	}
+
+	answered := make(map[answeredQuestion]bool)
+	for _, result := range results {
+		for i := range result.Answers {
+			if containsID(questionIDs, result.Answers[i].QuestionID) {
+				answered[answeredKey(&result.Answers[i])] = true
+			}
+		}
+	}
+	return answered, nil
+}
+
+// currentRevisions returns the current revision of each of the questions
+func currentRevisions(db *gorm.DB, questionIDs []uint) (map[uint]int, error) {
+	var questions []models.Question
+	if err := db.Select("id", "revision").Where("id IN ?", questionIDs).Find(&questions).Error; err != nil {
+		return nil, err
+	}
+
+	revisions := make(map[uint]int, len(questions))
+	for _, question := range questions {
+		revisions[question.ID] = question.Revision
+	}
+	return revisions, nil
+}
+
+// applyPinnedRevisions puts each exam question's pinned revision on its loaded
+// question, wherever the question has been edited since
+func applyPinnedRevisions(db *gorm.DB, examQuestions []models.ExamQuestion) error {
+	questions := make([]*models.Question, len(examQuestions))
+	revisions := make([]int, len(examQuestions))
+	for i := range examQuestions {
+		questions[i] = &examQuestions[i].Question
+		revisions[i] = examQuestions[i].Revision
+	}
+	return applyRevisions(db, questions, revisions)
+}
+
+// applyRevisions replaces the content of each question with the given revision of
+// it. Zero leaves a question as it is; revisions that were never recorded, from
+// questions stored outside the service, leave it as it is too.
+func applyRevisions(db *gorm.DB, questions []*models.Question, revisions []int) error {
+	type key struct {
+		questionID uint
+		revision   int
+	}
+
+	wanted := []key{}
+	questionIDs := []uint{}
+	for i, question := range questions {
+		if revisions[i] == 0 || revisions[i] == question.Revision {
+			continue
+		}
+		wanted = append(wanted, key{question.ID, revisions[i]})
+		if !containsID(questionIDs, question.ID) {
+			questionIDs = append(questionIDs, question.ID)
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	var stored []models.QuestionRevision
+	if err := db.Where("question_id IN ?", questionIDs).Find(&stored).Error; err != nil {
+		return err
+	}
+	found := make(map[key]*models.QuestionRevision, len(stored))
+	for i := range stored {
+		found[key{stored[i].QuestionID, stored[i].Revision}] = &stored[i]
+	}
+
+	for i, question := range questions {
+		if revision, ok := found[key{question.ID, revisions[i]}]; ok {
+			revision.Apply(question)
+		}
+	}
+	return nil
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
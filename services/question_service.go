@@ -2,8 +2,10 @@ package services
 
 import (
 	"exam-system/models"
+	"exam-system/utils"
 	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -16,28 +18,46 @@ type QuestionService struct {
 }
 
 type CreateQuestionRequest struct {
-	Title       string                     `json:"title" binding:"required"`
-	Content     string                     `json:"content" binding:"required"`
-	Type        models.QuestionType        `json:"type" binding:"required"`
-	Difficulty  models.QuestionDifficulty  `json:"difficulty" binding:"required"`
-	Options     []models.Option            `json:"options" binding:"required,min=2"`
-	Tags        []string                   `json:"tags" binding:"required,min=1"`
-	Points      int                        `json:"points" binding:"min=1"`
-	TimeLimit   int                        `json:"time_limit" binding:"min=10"`
-	Explanation string                     `json:"explanation"`
+	Title         string                    `json:"title" binding:"required"`
+	Content       string                    `json:"content" binding:"required"`
+	ContentFormat models.ContentFormat      `json:"content_format"` // plain, markdown or html; defaults to plain
+	Type          models.QuestionType       `json:"type" binding:"required"`
+	Difficulty    models.QuestionDifficulty `json:"difficulty" binding:"required"`
+	Options       []models.Option           `json:"options"`
+	Blanks        []models.Blank            `json:"blanks"`         // short-answer and cloze questions
+	Numeric       *models.NumericKey        `json:"numeric"`        // numeric questions
+	MatchChoices  []models.Option           `json:"match_choices"`  // matching questions
+	Rubric        []models.RubricCriterion  `json:"rubric"`         // essay questions, optional
+	Attachments   []models.Attachment       `json:"attachments"`    // uploaded media shown with the content; options take one attachment each
+	SelectionMode models.SelectionMode      `json:"selection_mode"` // multiple-choice questions; inferred from the correct options when empty
+	MinSelections int                       `json:"min_selections" binding:"min=0"`
+	MaxSelections int                       `json:"max_selections" binding:"min=0"`
+	Tags          []string                  `json:"tags" binding:"required,min=1"`
+	Points        int                       `json:"points" binding:"min=1"`
+	TimeLimit     int                       `json:"time_limit" binding:"min=10"`
+	Explanation   string                    `json:"explanation"`
 }
 
 type UpdateQuestionRequest struct {
-	Title       string                     `json:"title" binding:"required"`
-	Content     string                     `json:"content" binding:"required"`
-	Type        models.QuestionType        `json:"type" binding:"required"`
-	Difficulty  models.QuestionDifficulty  `json:"difficulty" binding:"required"`
-	Options     []models.Option            `json:"options" binding:"required,min=2"`
-	Tags        []string                   `json:"tags" binding:"required,min=1"`
-	Points      int                        `json:"points" binding:"min=1"`
-	TimeLimit   int                        `json:"time_limit" binding:"min=10"`
-	Explanation string                     `json:"explanation"`
-	IsActive    bool                       `json:"is_active"`
+	Title         string                    `json:"title" binding:"required"`
+	Content       string                    `json:"content" binding:"required"`
+	ContentFormat models.ContentFormat      `json:"content_format"` // plain, markdown or html; defaults to plain
+	Type          models.QuestionType       `json:"type" binding:"required"`
+	Difficulty    models.QuestionDifficulty `json:"difficulty" binding:"required"`
+	Options       []models.Option           `json:"options"`
+	Blanks        []models.Blank            `json:"blanks"`         // short-answer and cloze questions
+	Numeric       *models.NumericKey        `json:"numeric"`        // numeric questions
+	MatchChoices  []models.Option           `json:"match_choices"`  // matching questions
+	Rubric        []models.RubricCriterion  `json:"rubric"`         // essay questions, optional
+	Attachments   []models.Attachment       `json:"attachments"`    // uploaded media shown with the content; options take one attachment each
+	SelectionMode models.SelectionMode      `json:"selection_mode"` // multiple-choice questions; inferred from the correct options when empty
+	MinSelections int                       `json:"min_selections" binding:"min=0"`
+	MaxSelections int                       `json:"max_selections" binding:"min=0"`
+	Tags          []string                  `json:"tags" binding:"required,min=1"`
+	Points        int                       `json:"points" binding:"min=1"`
+	TimeLimit     int                       `json:"time_limit" binding:"min=10"`
+	Explanation   string                    `json:"explanation"`
+	IsActive      bool                      `json:"is_active"`
 }
 
 type QuestionListResponse struct {
@@ -49,11 +69,11 @@ type QuestionListResponse struct {
 }
 
 type QuestionFilter struct {
-	Tags       []string                   `json:"tags"`
-	Difficulty models.QuestionDifficulty  `json:"difficulty"`
-	Type       models.QuestionType        `json:"type"`
-	Search     string                     `json:"search"`
-	IsActive   *bool                      `json:"is_active"`
+	Tags       []string                  `json:"tags"`
+	Difficulty models.QuestionDifficulty `json:"difficulty"`
+	Type       models.QuestionType       `json:"type"`
+	Search     string                    `json:"search"`
+	IsActive   *bool                     `json:"is_active"`
 }
 
 func NewQuestionService(db *gorm.DB, logger *logrus.Logger) *QuestionService {
@@ -64,26 +84,15 @@ func NewQuestionService(db *gorm.DB, logger *logrus.Logger) *QuestionService {
 }
 
 func (s *QuestionService) CreateQuestion(req CreateQuestionRequest, createdBy uint) (*models.Question, error) {
-	// Validate options
-	if err := s.validateOptions(req.Options, req.Type); err != nil {
+	question := questionFromRequest(req, createdBy)
+	if err := s.validateQuestion(&question); err != nil {
 		return nil, err
 	}
 
-	question := models.Question{
-		Title:       req.Title,
-		Content:     req.Content,
-		Type:        req.Type,
-		Difficulty:  req.Difficulty,
-		Options:     models.Options(req.Options),
-		Tags:        models.StringArray(req.Tags),
-		Points:      req.Points,
-		TimeLimit:   req.TimeLimit,
-		Explanation: req.Explanation,
-		IsActive:    true,
-		CreatedBy:   createdBy,
-	}
-
-	if err := s.db.Create(&question).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return insertQuestion(tx, &question)
+	})
+	if err != nil {
 		s.logger.WithError(err).Error("Failed to create question")
 		return nil, fmt.Errorf("failed to create question")
 	}
@@ -97,36 +106,57 @@ func (s *QuestionService) CreateQuestion(req CreateQuestionRequest, createdBy ui
 	return &question, nil
 }
 
-func (s *QuestionService) GetQuestions(page, pageSize int, filter QuestionFilter) (*QuestionListResponse, error) {
-	var questions []models.Question
-	var total int64
-
-	query := s.db.Model(&models.Question{}).Preload("Creator")
-
-	// Apply filters
-	if len(filter.Tags) > 0 {
-		// Use PostgreSQL JSONB contains operator
-		for _, tag := range filter.Tags {
-			query = query.Where("tags @> ?", fmt.Sprintf(`["%s"]`, tag))
-		}
+// questionFromRequest builds a new, not yet validated question from a request
+func questionFromRequest(req CreateQuestionRequest, createdBy uint) models.Question {
+	return models.Question{
+		Title:         req.Title,
+		Content:       req.Content,
+		ContentFormat: req.ContentFormat,
+		Type:          req.Type,
+		Difficulty:    req.Difficulty,
+		Options:       models.Options(req.Options),
+		MatchChoices:  models.Options(req.MatchChoices),
+		Blanks:        models.Blanks(req.Blanks),
+		Numeric:       req.Numeric,
+		Rubric:        models.Rubric(req.Rubric),
+		Attachments:   models.Attachments(req.Attachments),
+		SelectionMode: req.SelectionMode,
+		MinSelections: req.MinSelections,
+		MaxSelections: req.MaxSelections,
+		Tags:          models.StringArray(req.Tags),
+		Points:        req.Points,
+		TimeLimit:     req.TimeLimit,
+		Explanation:   req.Explanation,
+		IsActive:      true,
+		Revision:      1,
+		CreatedBy:     createdBy,
 	}
+}
 
-	if filter.Difficulty != "" {
-		query = query.Where("difficulty = ?", filter.Difficulty)
+// insertQuestion stores a validated question with its first revision and media links
+func insertQuestion(tx *gorm.DB, question *models.Question) error {
+	// is_active has a column default, which Create uses in place of false
+	active := question.IsActive
+	if err := tx.Create(question).Error; err != nil {
+		return err
 	}
-
-	if filter.Type != "" {
-		query = query.Where("type = ?", filter.Type)
+	if !active {
+		question.IsActive = false
+		if err := tx.Model(question).Update("is_active", false).Error; err != nil {
+			return err
+		}
 	}
-
-	if filter.Search != "" {
-		searchPattern := "%" + filter.Search + "%"
-		query = query.Where("title ILIKE ? OR content ILIKE ?", searchPattern, searchPattern)
+	if err := recordFirstRevision(tx, question); err != nil {
+		return err
 	}
+	return linkQuestionMedia(tx, question)
+}
 
-	if filter.IsActive != nil {
-		query = query.Where("is_active = ?", *filter.IsActive)
-	}
+func (s *QuestionService) GetQuestions(page, pageSize int, filter QuestionFilter) (*QuestionListResponse, error) {
+	var questions []models.Question
+	var total int64
+
+	query := applyQuestionFilter(s.db.Model(&models.Question{}).Preload("Creator"), filter)
 
 	// Get total count
 	if err := query.Count(&total).Error; err != nil {
@@ -158,6 +188,35 @@ func (s *QuestionService) GetQuestions(page, pageSize int, filter QuestionFilter
 	}, nil
 }
 
+// applyQuestionFilter narrows a question query down to the filter
+func applyQuestionFilter(query *gorm.DB, filter QuestionFilter) *gorm.DB {
+	if len(filter.Tags) > 0 {
+		// Use PostgreSQL JSONB contains operator
+		for _, tag := range filter.Tags {
+			query = query.Where("tags @> ?", fmt.Sprintf(`["%s"]`, tag))
+		}
+	}
+
+	if filter.Difficulty != "" {
+		query = query.Where("difficulty = ?", filter.Difficulty)
+	}
+
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+
+	if filter.Search != "" {
+		searchPattern := "%" + filter.Search + "%"
+		query = query.Where("title ILIKE ? OR content ILIKE ?", searchPattern, searchPattern)
+	}
+
+	if filter.IsActive != nil {
+		query = query.Where("is_active = ?", *filter.IsActive)
+	}
+
+	return query
+}
+
 func (s *QuestionService) GetQuestion(questionID uint, includeCorrectAnswers bool) (*models.Question, error) {
 	var question models.Question
 	if err := s.db.Preload("Creator").Where("id = ?", questionID).First(&question).Error; err != nil {
@@ -171,7 +230,9 @@ func (s *QuestionService) GetQuestion(questionID uint, includeCorrectAnswers boo
 	return &question, nil
 }
 
-func (s *QuestionService) UpdateQuestion(questionID uint, req UpdateQuestionRequest) (*models.Question, error) {
+// UpdateQuestion edits a question. A change to its content records a new
+// revision; exams already open to candidates keep the revision they pinned.
+func (s *QuestionService) UpdateQuestion(questionID uint, req UpdateQuestionRequest, editedBy uint) (*models.Question, error) {
 	var question models.Question
 	if err := s.db.Where("id = ?", questionID).First(&question).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -181,24 +242,33 @@ func (s *QuestionService) UpdateQuestion(questionID uint, req UpdateQuestionRequ
 		return nil, fmt.Errorf("failed to update question")
 	}
 
-	// Validate options
-	if err := s.validateOptions(req.Options, req.Type); err != nil {
-		return nil, err
-	}
-
 	// Update question fields
 	question.Title = req.Title
 	question.Content = req.Content
+	question.ContentFormat = req.ContentFormat
 	question.Type = req.Type
 	question.Difficulty = req.Difficulty
 	question.Options = models.Options(req.Options)
+	question.MatchChoices = models.Options(req.MatchChoices)
+	question.Blanks = models.Blanks(req.Blanks)
+	question.Numeric = req.Numeric
+	question.Rubric = models.Rubric(req.Rubric)
+	question.Attachments = models.Attachments(req.Attachments)
+	question.SelectionMode = req.SelectionMode
+	question.MinSelections = req.MinSelections
+	question.MaxSelections = req.MaxSelections
 	question.Tags = models.StringArray(req.Tags)
 	question.Points = req.Points
 	question.TimeLimit = req.TimeLimit
 	question.Explanation = req.Explanation
 	question.IsActive = req.IsActive
 
-	if err := s.db.Save(&question).Error; err != nil {
+	if err := s.validateQuestion(&question); err != nil {
+		return nil, err
+	}
+
+	// Media dropped in the edit is left unlinked for the cleanup worker
+	if _, err := s.saveRevision(&question, editedBy, nil); err != nil {
 		s.logger.WithError(err).Error("Failed to update question")
 		return nil, fmt.Errorf("failed to update question")
 	}
@@ -206,6 +276,8 @@ func (s *QuestionService) UpdateQuestion(questionID uint, req UpdateQuestionRequ
 	s.logger.WithFields(logrus.Fields{
 		"question_id": question.ID,
 		"title":       question.Title,
+		"revision":    question.Revision,
+		"edited_by":   editedBy,
 	}).Info("Question updated successfully")
 
 	return &question, nil
@@ -221,22 +293,31 @@ func (s *QuestionService) DeleteQuestion(questionID uint) error {
 		return fmt.Errorf("failed to delete question")
 	}
 
-	// Check if question is used in any active exams
+	// Check if question is used in any exam that can still be sat
 	var examQuestionCount int64
 	if err := s.db.Model(&models.ExamQuestion{}).
 		Joins("JOIN exams ON exams.id = exam_questions.exam_id").
-		Where("exam_questions.question_id = ? AND exams.status IN ?", questionID, []string{"active", "draft"}).
+		Where("exam_questions.question_id = ? AND exams.status IN ?", questionID, []models.ExamStatus{models.ExamDraft, models.ExamScheduled, models.ExamActive}).
 		Count(&examQuestionCount).Error; err != nil {
 		s.logger.WithError(err).Error("Failed to check question usage")
 		return fmt.Errorf("failed to delete question")
 	}
 
 	if examQuestionCount > 0 {
-		return fmt.Errorf("cannot delete question as it is used in active or draft exams")
+		return fmt.Errorf("cannot delete question as it is used in draft, scheduled or active exams")
 	}
 
-	// Soft delete the question
-	if err := s.db.Delete(&question).Error; err != nil {
+	// Soft delete the question; only revisions an exam, attempt or result uses keep their media
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&question).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("question_id = ?", question.ID).Delete(&models.QuestionMedia{}).Error; err != nil {
+			return err
+		}
+		return releaseRevisionMedia(tx, []uint{question.ID})
+	})
+	if err != nil {
 		s.logger.WithError(err).Error("Failed to delete question")
 		return fmt.Errorf("failed to delete question")
 	}
@@ -309,6 +390,190 @@ func (s *QuestionService) GetAllTags() ([]string, error) {
 	return tags, nil
 }
 
+// validateQuestion checks a question's answer key against the rules of its type
+func (s *QuestionService) validateQuestion(question *models.Question) error {
+	questionType := question.Type
+	if !questionType.IsValid() {
+		return fmt.Errorf("invalid question type %q", questionType)
+	}
+	if err := prepareContent(question); err != nil {
+		return err
+	}
+	if err := s.resolveAttachments(question); err != nil {
+		return err
+	}
+
+	hasOptions := len(question.Options) > 0 || len(question.MatchChoices) > 0
+	if questionType != models.Essay && len(question.Rubric) > 0 {
+		return fmt.Errorf("invalid answer key: only essay questions take a rubric")
+	}
+	if questionType != models.MultipleChoice && (question.SelectionMode != "" || question.MinSelections != 0 || question.MaxSelections != 0) {
+		return fmt.Errorf("invalid answer key: only multiple-choice questions take a selection mode or limits")
+	}
+
+	switch {
+	case questionType == models.Essay:
+		if hasOptions || len(question.Blanks) > 0 || question.Numeric != nil {
+			return fmt.Errorf("invalid answer key: essay questions take an optional rubric, not options, blanks or a numeric key")
+		}
+		return validateRubric(question.Rubric)
+	case questionType == models.Numeric:
+		if hasOptions || len(question.Blanks) > 0 {
+			return fmt.Errorf("invalid answer key: numeric questions take a numeric key, not options or blanks")
+		}
+		return validateNumericKey(question.Numeric)
+	case questionType.IsTextAnswer():
+		if hasOptions || question.Numeric != nil {
+			return fmt.Errorf("invalid answer key: %s questions take blanks, not options or a numeric key", questionType)
+		}
+		return validateBlanks(question.Content, question.Blanks, questionType)
+	}
+
+	if len(question.Blanks) > 0 || question.Numeric != nil {
+		return fmt.Errorf("invalid answer key: %s questions take options, not blanks or a numeric key", questionType)
+	}
+	if questionType == models.Ordering || questionType == models.Matching {
+		return validateArrangement(question)
+	}
+	if len(question.MatchChoices) > 0 {
+		return fmt.Errorf("invalid answer key: only matching questions take match choices")
+	}
+	if err := s.validateOptions(question.Options, questionType); err != nil {
+		return err
+	}
+	if questionType == models.MultipleChoice {
+		return validateSelectionLimits(question)
+	}
+	return nil
+}
+
+// resolveAttachments makes sure the media a question shows has been uploaded and
+// records its kind and content type on the attachments
+func (s *QuestionService) resolveAttachments(question *models.Question) error {
+	ids := question.MediaIDs()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var rows []models.Media
+	if err := s.db.Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to load media")
+		return fmt.Errorf("failed to load media")
+	}
+	media := make(map[uint]models.Media, len(rows))
+	for _, row := range rows {
+		media[row.ID] = row
+	}
+
+	resolve := func(attachment *models.Attachment) error {
+		found, ok := media[attachment.MediaID]
+		if !ok {
+			return fmt.Errorf("invalid attachment: media %d not found", attachment.MediaID)
+		}
+		attachment.Kind = found.Kind
+		attachment.ContentType = found.ContentType
+		return nil
+	}
+
+	for i := range question.Attachments {
+		if err := resolve(&question.Attachments[i]); err != nil {
+			return err
+		}
+	}
+	for _, items := range []models.Options{question.Options, question.MatchChoices} {
+		for i := range items {
+			if items[i].Attachment == nil {
+				continue
+			}
+			if err := resolve(items[i].Attachment); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// linkQuestionMedia records which media a question uses, replacing its old links
+func linkQuestionMedia(tx *gorm.DB, question *models.Question) error {
+	if err := tx.Where("question_id = ?", question.ID).Delete(&models.QuestionMedia{}).Error; err != nil {
+		return err
+	}
+
+	ids := question.MediaIDs()
+	if len(ids) == 0 {
+		return nil
+	}
+	links := make([]models.QuestionMedia, len(ids))
+	for i, id := range ids {
+		links[i] = models.QuestionMedia{QuestionID: question.ID, MediaID: id}
+	}
+	return tx.Create(&links).Error
+}
+
+// prepareContent checks the content format of a question and sanitizes HTML
+// content before it is stored, so script never reaches the database. Markdown and
+// plain text are kept as written and made safe when rendered.
+func prepareContent(question *models.Question) error {
+	if !question.ContentFormat.IsValid() {
+		return fmt.Errorf("invalid content format %q", question.ContentFormat)
+	}
+	question.ContentFormat = question.Format()
+	if question.ContentFormat != models.FormatHTML {
+		return nil
+	}
+
+	question.Content = utils.SanitizeHTML(question.Content)
+	question.Explanation = utils.SanitizeHTML(question.Explanation)
+	for i := range question.Options {
+		question.Options[i].Text = utils.SanitizeHTML(question.Options[i].Text)
+	}
+	for i := range question.MatchChoices {
+		question.MatchChoices[i].Text = utils.SanitizeHTML(question.MatchChoices[i].Text)
+	}
+	if strings.TrimSpace(question.Content) == "" {
+		return fmt.Errorf("invalid content format: content is empty once unsafe HTML is removed")
+	}
+	return nil
+}
+
+// validateSelectionLimits checks the selection mode of a multiple-choice question
+// against its answer key. A question without a mode gets the one its correct
+// options imply, as existing questions did when modes were introduced.
+func validateSelectionLimits(question *models.Question) error {
+	if question.SelectionMode == "" {
+		question.SelectionMode = question.Selection()
+	}
+	if !question.SelectionMode.IsValid() {
+		return fmt.Errorf("invalid answer key: unknown selection mode %q", question.SelectionMode)
+	}
+
+	correctCount := len(question.GetCorrectAnswers())
+	if question.SelectionMode == models.SelectSingle {
+		if correctCount != 1 {
+			return fmt.Errorf("invalid answer key: single-select questions must have exactly one correct answer")
+		}
+		if question.MinSelections != 0 || question.MaxSelections != 0 {
+			return fmt.Errorf("invalid answer key: single-select questions take no selection limits")
+		}
+		return nil
+	}
+
+	if question.MinSelections < 0 || question.MaxSelections < 0 {
+		return fmt.Errorf("invalid answer key: selection limits cannot be negative")
+	}
+	if question.MaxSelections > len(question.Options) {
+		return fmt.Errorf("invalid answer key: max_selections cannot exceed the number of options")
+	}
+	if question.MaxSelections > 0 && question.MinSelections > question.MaxSelections {
+		return fmt.Errorf("invalid answer key: min_selections cannot exceed max_selections")
+	}
+	// The correct answer itself has to be a valid selection
+	if question.MinSelections > correctCount || (question.MaxSelections > 0 && question.MaxSelections < correctCount) {
+		return fmt.Errorf("invalid answer key: selection limits must allow picking all %d correct options", correctCount)
+	}
+	return nil
+}
+
 func (s *QuestionService) validateOptions(options []models.Option, questionType models.QuestionType) error {
 	if len(options) < 2 {
 		return fmt.Errorf("question must have at least 2 options")
@@ -342,4 +607,3 @@ func (s *QuestionService) validateOptions(options []models.Option, questionType
 
 	return nil
 }
-
@@ -0,0 +1,533 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A regrade recomputes stored results after an answer key is corrected. Answers
+// are graded again against the current revision of their question under the
+// scoring policy of their result, optionally accepting more options or dropping
+// the question, and every result whose score moves is recorded with its before
+// and after values. Essays keep the marks their grader gave them.
+
+type RegradeRequest struct {
+	QuestionID    *uint              `json:"question_id"` // limits an exam regrade to one question
+	Mode          models.RegradeMode `json:"mode"`
+	AcceptOptions []string           `json:"accept_options"` // with accept_options, the options accepted besides the key
+	Reason        string             `json:"reason" binding:"max=1000"`
+	DryRun        bool               `json:"dry_run"`
+}
+
+type RegradedResult struct {
+	ResultID     uint    `json:"result_id"`
+	UserID       uint    `json:"user_id"`
+	Username     string  `json:"username,omitempty"`
+	ExamID       uint    `json:"exam_id"`
+	ScoreBefore  float64 `json:"score_before"`
+	ScoreAfter   float64 `json:"score_after"`
+	PointsBefore float64 `json:"points_before"`
+	PointsAfter  float64 `json:"points_after"`
+	PassedBefore bool    `json:"passed_before"`
+	PassedAfter  bool    `json:"passed_after"`
+}
+
+type RegradeReport struct {
+	RegradeID       uint               `json:"regrade_id,omitempty"` // audit record, not set for dry runs
+	ExamID          *uint              `json:"exam_id,omitempty"`
+	QuestionID      *uint              `json:"question_id,omitempty"`
+	Mode            models.RegradeMode `json:"mode"`
+	DryRun          bool               `json:"dry_run"`
+	ResultsRegraded int                `json:"results_regraded"`
+	ResultsChanged  int                `json:"results_changed"`
+	NowPassing      int                `json:"now_passing"`
+	NowFailing      int                `json:"now_failing"`
+	Changes         []RegradedResult   `json:"changes"`      // every result whose score moved
+	PassChanges     []RegradedResult   `json:"pass_changes"` // the candidates whose pass/fail status flipped
+	Warnings        []string           `json:"warnings,omitempty"`
+}
+
+type regradeScope struct {
+	examIDs    []uint
+	examID     *uint
+	questionID *uint
+}
+
+// RegradeExam regrades the results of an exam, or only their answers to one
+// question when the request names it
+func (s *ResultService) RegradeExam(examID uint, req RegradeRequest, regradedBy uint) (*RegradeReport, error) {
+	var exam models.Exam
+	if err := s.db.Where("id = ?", examID).First(&exam).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("exam not found")
+		}
+		s.logger.WithError(err).Error("Failed to get exam")
+		return nil, fmt.Errorf("failed to regrade results")
+	}
+
+	if req.QuestionID != nil {
+		examIDs, err := examsUsingQuestion(s.db, *req.QuestionID)
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to get exams using question")
+			return nil, fmt.Errorf("failed to regrade results")
+		}
+		if !containsID(examIDs, examID) {
+			return nil, fmt.Errorf("invalid regrade: question %d is not part of the exam", *req.QuestionID)
+		}
+	}
+
+	return s.regrade(regradeScope{examIDs: []uint{examID}, examID: &examID, questionID: req.QuestionID}, req, regradedBy)
+}
+
+// RegradeQuestion regrades the answers to a question in every exam that uses it
+func (s *ResultService) RegradeQuestion(questionID uint, req RegradeRequest, regradedBy uint) (*RegradeReport, error) {
+	var question models.Question
+	if err := s.db.Unscoped().Where("id = ?", questionID).First(&question).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("question not found")
+		}
+		s.logger.WithError(err).Error("Failed to get question")
+		return nil, fmt.Errorf("failed to regrade results")
+	}
+
+	examIDs, err := examsUsingQuestion(s.db, questionID)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get exams using question")
+		return nil, fmt.Errorf("failed to regrade results")
+	}
+
+	return s.regrade(regradeScope{examIDs: examIDs, questionID: &questionID}, req, regradedBy)
+}
+
+// GetRegrades lists the regrades that changed results of an exam, newest first,
+// each with the changes it made to the exam's results
+func (s *ResultService) GetRegrades(examID uint) ([]models.Regrade, error) {
+	var exam models.Exam
+	if err := s.db.Unscoped().Where("id = ?", examID).First(&exam).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("exam not found")
+		}
+		s.logger.WithError(err).Error("Failed to get exam")
+		return nil, fmt.Errorf("failed to get regrades")
+	}
+
+	regrades := []models.Regrade{}
+	touched := s.db.Model(&models.ResultChange{}).Select("regrade_id").Where("exam_id = ?", examID)
+	if err := s.db.Preload("Changes", "exam_id = ?", examID).
+		Where("exam_id = ? OR id IN (?)", examID, touched).
+		Order("created_at DESC, id DESC").
+		Find(&regrades).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get regrades")
+		return nil, fmt.Errorf("failed to get regrades")
+	}
+
+	return regrades, nil
+}
+
+func (s *ResultService) regrade(scope regradeScope, req RegradeRequest, regradedBy uint) (*RegradeReport, error) {
+	if req.Mode == "" {
+		req.Mode = models.RegradeCurrentKey
+	}
+	adjustment, err := s.regradeAdjustment(scope, req)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RegradeReport{
+		ExamID:      scope.examID,
+		QuestionID:  scope.questionID,
+		Mode:        req.Mode,
+		DryRun:      req.DryRun,
+		Changes:     []RegradedResult{},
+		PassChanges: []RegradedResult{},
+	}
+	if len(scope.examIDs) == 0 {
+		return report, nil
+	}
+
+	audit := models.Regrade{
+		ExamID:        scope.examID,
+		QuestionID:    scope.questionID,
+		Mode:          req.Mode,
+		AcceptOptions: req.AcceptOptions,
+		Reason:        req.Reason,
+		RegradedBy:    regradedBy,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if !req.DryRun {
+			if err := tx.Omit("Changes").Create(&audit).Error; err != nil {
+				return err
+			}
+			if adjustment != nil {
+				adjustment.RegradeID = audit.ID
+			}
+		}
+
+		// Locked so essays being marked meanwhile don't overwrite the regraded answers
+		var results []models.Result
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("User").
+			Where("exam_id IN ?", scope.examIDs).
+			Order("id").
+			Find(&results).Error; err != nil {
+			return err
+		}
+
+		questionIDs := []uint{}
+		for _, result := range results {
+			for _, answer := range result.Answers {
+				if !containsID(questionIDs, answer.QuestionID) {
+					questionIDs = append(questionIDs, answer.QuestionID)
+				}
+			}
+		}
+		questions, err := s.loadQuestions(tx, questionIDs)
+		if err != nil {
+			return err
+		}
+
+		exams := make(map[uint]*models.Exam)
+		for i := range results {
+			result := &results[i]
+
+			exam, ok := exams[result.ExamID]
+			if !ok {
+				exam = &models.Exam{}
+				if err := tx.Unscoped().Preload("ExamQuestions").Where("id = ?", result.ExamID).First(exam).Error; err != nil {
+					return err
+				}
+				exams[result.ExamID] = exam
+			}
+
+			answers, regraded := s.regradeAnswers(result, questions, scope, adjustment, report)
+			if !regraded {
+				continue
+			}
+			report.ResultsRegraded++
+
+			examQuestions, err := resultExamQuestions(tx, exam, result)
+			if err != nil {
+				return err
+			}
+
+			change := models.ResultChange{
+				ResultID:     result.ID,
+				UserID:       result.UserID,
+				ExamID:       result.ExamID,
+				ScoreBefore:  result.Score,
+				PointsBefore: result.TotalPoints,
+				PassedBefore: result.Passed,
+			}
+
+			earnedPoints := SumPoints(answers)
+			score := 0.0
+			if result.MaxPoints > 0 {
+				score = earnedPoints / float64(result.MaxPoints) * 100
+			}
+			result.Answers = answers
+			result.TotalPoints = earnedPoints
+			result.Score = score
+			result.Passed = score >= float64(exam.PassScore)
+			result.SectionScores = SectionSubscores(scoredSections(result), examQuestions, answers)
+			if err := regradeAbility(tx, result, questions); err != nil {
+				return err
+			}
+
+			change.ScoreAfter = result.Score
+			change.PointsAfter = result.TotalPoints
+			change.PassedAfter = result.Passed
+			if change.PointsBefore != change.PointsAfter || change.ScoreBefore != change.ScoreAfter || change.PassChanged() {
+				report.addChange(change, result.User.Username)
+				audit.Changes = append(audit.Changes, change)
+			}
+
+			if req.DryRun {
+				continue
+			}
+			if err := tx.Model(result).Updates(map[string]interface{}{
+				"answers":        result.Answers,
+				"total_points":   result.TotalPoints,
+				"score":          result.Score,
+				"passed":         result.Passed,
+				"section_scores": result.SectionScores,
+				"ability":        result.Ability,
+				"ability_se":     result.AbilitySE,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		if req.DryRun {
+			return nil
+		}
+
+		for i := range audit.Changes {
+			audit.Changes[i].RegradeID = audit.ID
+		}
+		if len(audit.Changes) > 0 {
+			if err := tx.Create(&audit.Changes).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&audit).Updates(map[string]interface{}{
+			"results_regraded": report.ResultsRegraded,
+			"results_changed":  report.ResultsChanged,
+			"pass_changes":     len(report.PassChanges),
+		}).Error; err != nil {
+			return err
+		}
+
+		return repinRegradedQuestions(tx, scope)
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to regrade results")
+		return nil, fmt.Errorf("failed to regrade results")
+	}
+
+	if !req.DryRun {
+		report.RegradeID = audit.ID
+		s.logger.WithFields(logrus.Fields{
+			"regrade_id":      audit.ID,
+			"exam_id":         scope.examID,
+			"question_id":     scope.questionID,
+			"mode":            req.Mode,
+			"results_changed": report.ResultsChanged,
+			"pass_changes":    len(report.PassChanges),
+			"regraded_by":     regradedBy,
+		}).Info("Results regraded")
+	}
+
+	return report, nil
+}
+
+// regradeAdjustment checks the mode of a regrade request and returns the answer
+// key override it puts on the regraded answers, if any
+func (s *ResultService) regradeAdjustment(scope regradeScope, req RegradeRequest) (*models.RegradeAdjustment, error) {
+	if !req.Mode.IsValid() {
+		return nil, fmt.Errorf("invalid regrade: unknown mode %q", req.Mode)
+	}
+	if req.Mode != models.RegradeAcceptOptions && len(req.AcceptOptions) > 0 {
+		return nil, fmt.Errorf("invalid regrade: accept_options only applies to the accept_options mode")
+	}
+	if req.Mode == models.RegradeCurrentKey {
+		return nil, nil
+	}
+	if scope.questionID == nil {
+		return nil, fmt.Errorf("invalid regrade: %s needs a question", req.Mode)
+	}
+
+	questions, err := s.loadQuestions(s.db, []uint{*scope.questionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to regrade results")
+	}
+	question, ok := questions[*scope.questionID]
+	if !ok {
+		return nil, fmt.Errorf("question not found")
+	}
+	if question.Type == models.Essay {
+		return nil, fmt.Errorf("invalid regrade: essay questions are marked by graders")
+	}
+
+	if req.Mode == models.RegradeAcceptOptions {
+		if question.Selection() != models.SelectSingle {
+			return nil, fmt.Errorf("invalid regrade: accepting more answers needs a single-answer question")
+		}
+		if len(req.AcceptOptions) == 0 {
+			return nil, fmt.Errorf("invalid regrade: accept_options is empty")
+		}
+		for _, optionID := range req.AcceptOptions {
+			if !question.HasOption(optionID) {
+				return nil, fmt.Errorf("invalid regrade: question %d has no option %q", question.ID, optionID)
+			}
+		}
+	}
+
+	return &models.RegradeAdjustment{Mode: req.Mode, AcceptOptions: req.AcceptOptions}, nil
+}
+
+// regradeAnswers grades the answers of a result in the regrade's scope again and
+// reports whether any of them were in scope. A regrade of one question sets or
+// clears that question's override; a regrade of a whole exam keeps the overrides
+// earlier regrades made. Answers that no longer fit their question are kept as
+// they were and reported as warnings.
+func (s *ResultService) regradeAnswers(result *models.Result, questions map[uint]models.Question, scope regradeScope, adjustment *models.RegradeAdjustment, report *RegradeReport) ([]models.Answer, bool) {
+	answers := make([]models.Answer, len(result.Answers))
+	copy(answers, result.Answers)
+
+	regraded := false
+	for i, answer := range answers {
+		if scope.questionID != nil && answer.QuestionID != *scope.questionID {
+			continue
+		}
+		regraded = true
+
+		question, ok := questions[answer.QuestionID]
+		if !ok {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("result %d: question %d no longer exists", result.ID, answer.QuestionID))
+			continue
+		}
+		if question.Type == models.Essay {
+			continue
+		}
+
+		override := answer.Adjustment
+		if scope.questionID != nil {
+			override = adjustment
+		}
+
+		regradedAnswer, err := RegradeAnswer(&question, answer, result.ScoringPolicy, result.NegativeMarkRatio, override)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("result %d: %v", result.ID, err))
+			continue
+		}
+		answers[i] = regradedAnswer
+	}
+
+	return answers, regraded
+}
+
+// regradeAbility estimates the ability of a result from an adaptive attempt
+// again from its regraded answers, the way submitting the attempt did
+func regradeAbility(tx *gorm.DB, result *models.Result, questions map[uint]models.Question) error {
+	if result.ExamAttemptID == nil {
+		return nil
+	}
+	var attempt models.ExamAttempt
+	if err := tx.Select("id", "adaptive_mode").Where("id = ?", *result.ExamAttemptID).First(&attempt).Error; err != nil {
+		return err
+	}
+	if !attempt.AdaptiveMode {
+		return nil
+	}
+
+	administered := make([]models.ExamQuestion, 0, len(result.Answers))
+	for _, answer := range result.Answers {
+		if question, ok := questions[answer.QuestionID]; ok {
+			administered = append(administered, models.ExamQuestion{QuestionID: question.ID, Question: question})
+		}
+	}
+	estimate := estimateAbility(administered, result.Answers)
+	theta, se := roundStatistic(estimate.Ability), roundStatistic(estimate.SE)
+	result.Ability, result.AbilitySE = &theta, &se
+	return nil
+}
+
+// RegradeAnswer grades a stored answer again against the question's current
+// answer key under the result's scoring policy, then applies the override. An
+// accepted option counts as the correct answer; a dropped question earns full
+// credit whatever the answer.
+func RegradeAnswer(question *models.Question, stored models.Answer, policy models.ScoringPolicy, negativeMarkRatio float64, adjustment *models.RegradeAdjustment) (models.Answer, error) {
+	if policy == "" {
+		policy = models.ScoringAllOrNothing
+	}
+
+	answer, err := GradeSubmission(question, stored.MaxPoints, SubmitAnswerRequest{
+		QuestionID:      stored.QuestionID,
+		SelectedOptions: stored.SelectedOptions,
+		TextAnswers:     stored.TextAnswers,
+		NumericAnswer:   stored.NumericAnswer,
+		Matches:         stored.Matches,
+		Essay:           stored.Essay,
+	})
+	if err != nil {
+		return stored, err
+	}
+	answer.Revision = question.Revision
+	answer.TimeSpent = stored.TimeSpent
+	ApplyScoringPolicy(&answer, policy, negativeMarkRatio)
+
+	if adjustment != nil {
+		switch adjustment.Mode {
+		case models.RegradeAcceptOptions:
+			if !answer.IsCorrect && len(answer.SelectedOptions) == 1 && containsString(adjustment.AcceptOptions, answer.SelectedOptions[0]) {
+				answer.IsCorrect = true
+				answer.Points = float64(answer.MaxPoints)
+				if answer.Grading != nil {
+					answer.Grading.Credit = 1
+				}
+			}
+		case models.RegradeDropQuestion:
+			answer.Points = float64(answer.MaxPoints)
+			if answer.Grading != nil {
+				answer.Grading.Credit = 1
+			}
+		}
+		answer.Adjustment = adjustment
+	}
+
+	return answer, nil
+}
+
+func (r *RegradeReport) addChange(change models.ResultChange, username string) {
+	regraded := RegradedResult{
+		ResultID:     change.ResultID,
+		UserID:       change.UserID,
+		Username:     username,
+		ExamID:       change.ExamID,
+		ScoreBefore:  change.ScoreBefore,
+		ScoreAfter:   change.ScoreAfter,
+		PointsBefore: change.PointsBefore,
+		PointsAfter:  change.PointsAfter,
+		PassedBefore: change.PassedBefore,
+		PassedAfter:  change.PassedAfter,
+	}
+
+	r.ResultsChanged++
+	r.Changes = append(r.Changes, regraded)
+	if change.PassChanged() {
+		r.PassChanges = append(r.PassChanges, regraded)
+		if change.PassedAfter {
+			r.NowPassing++
+		} else {
+			r.NowFailing++
+		}
+	}
+}
+
+// examsUsingQuestion returns the exams that list a question or drew it for an attempt
+func examsUsingQuestion(db *gorm.DB, questionID uint) ([]uint, error) {
+	var listed []uint
+	if err := db.Model(&models.ExamQuestion{}).Where("question_id = ?", questionID).Distinct().Pluck("exam_id", &listed).Error; err != nil {
+		return nil, err
+	}
+
+	var drawn []uint
+	if err := db.Model(&models.AttemptQuestion{}).
+		Joins("JOIN exam_attempts ON exam_attempts.id = attempt_questions.exam_attempt_id").
+		Where("attempt_questions.question_id = ?", questionID).
+		Distinct().
+		Pluck("exam_attempts.exam_id", &drawn).Error; err != nil {
+		return nil, err
+	}
+
+	for _, examID := range drawn {
+		if !containsID(listed, examID) {
+			listed = append(listed, examID)
+		}
+	}
+	return listed, nil
+}
+
+// repinRegradedQuestions moves the regraded exams to the revision their results
+// were regraded against, so answers submitted from now on are graded the same way
+func repinRegradedQuestions(tx *gorm.DB, scope regradeScope) error {
+	current := gorm.Expr("(SELECT revision FROM questions WHERE questions.id = exam_questions.question_id)")
+	listed := tx.Model(&models.ExamQuestion{}).Where("exam_id IN ?", scope.examIDs)
+	if scope.questionID != nil {
+		listed = listed.Where("question_id = ?", *scope.questionID)
+	}
+	if err := listed.Update("revision", current).Error; err != nil {
+		return err
+	}
+
+	attempts := tx.Model(&models.ExamAttempt{}).Select("id").Where("exam_id IN ?", scope.examIDs)
+	drawn := tx.Model(&models.AttemptQuestion{}).Where("exam_attempt_id IN (?)", attempts)
+	if scope.questionID != nil {
+		drawn = drawn.Where("question_id = ?", *scope.questionID)
+	}
+	return drawn.Update("revision", gorm.Expr("(SELECT revision FROM questions WHERE questions.id = attempt_questions.question_id)")).Error
+}
@@ -29,13 +29,13 @@ type StatisticsResponse struct {
 }
 
 type OverallStatistics struct {
-	TotalExams       int     `json:"total_exams"`
-	TotalUsers       int     `json:"total_users"`
-	TotalAttempts    int     `json:"total_attempts"`
-	AverageScore     float64 `json:"average_score"`
-	PassRate         float64 `json:"pass_rate"`
-	TotalTimeSpent   int     `json:"total_time_spent"` // in seconds
-	AverageDuration  int     `json:"average_duration"` // in seconds
+	TotalExams      int     `json:"total_exams"`
+	TotalUsers      int     `json:"total_users"`
+	TotalAttempts   int     `json:"total_attempts"`
+	AverageScore    float64 `json:"average_score"`
+	PassRate        float64 `json:"pass_rate"`
+	TotalTimeSpent  int     `json:"total_time_spent"` // in seconds
+	AverageDuration int     `json:"average_duration"` // in seconds
 }
 
 func NewResultService(db *gorm.DB, logger *logrus.Logger) *ResultService {
@@ -95,7 +95,7 @@ func (s *ResultService) GetResults(page, pageSize int, userID uint, examID *uint
 
 func (s *ResultService) GetResult(resultID uint, userID uint, isAdmin bool) (*models.Result, error) {
 	var result models.Result
-	query := s.db.Preload("User").Preload("Exam").Preload("UserExam")
+	query := s.db.Preload("User").Preload("Exam")
 
 	if !isAdmin {
 		query = query.Where("user_id = ?", userID)
@@ -125,6 +125,8 @@ func (s *ResultService) GetExamResults(examID uint, page, pageSize int) (*Result
 	return s.GetResults(page, pageSize, 0, &examID, true)
 }
 
+// GetStatistics aggregates graded results; results awaiting grading have no final
+// score yet and are left out
 func (s *ResultService) GetStatistics() (*StatisticsResponse, error) {
 	// Get exam statistics
 	examStats, err := s.getExamStatistics()
@@ -178,7 +180,7 @@ func (s *ResultService) getExamStatistics() ([]models.ExamStatistics, error) {
 			COALESCE(MIN(r.score), 0) as lowest_score,
 			COALESCE(AVG(r.duration), 0) as average_duration
 		FROM exams e
-		LEFT JOIN results r ON e.id = r.exam_id
+		LEFT JOIN results r ON e.id = r.exam_id AND r.status = 'graded'
 		WHERE e.deleted_at IS NULL
 		GROUP BY e.id, e.title
 		ORDER BY total_attempts DESC
@@ -228,7 +230,7 @@ func (s *ResultService) getUserStatistics() ([]models.UserStatistics, error) {
 			COALESCE(MIN(r.score), 0) as lowest_score,
 			COALESCE(SUM(r.duration), 0) as total_time_spent
 		FROM users u
-		LEFT JOIN results r ON u.id = r.user_id
+		LEFT JOIN results r ON u.id = r.user_id AND r.status = 'graded'
 		WHERE u.deleted_at IS NULL AND u.role = 'user'
 		GROUP BY u.id, u.username
 		HAVING COUNT(r.id) > 0
@@ -283,6 +285,7 @@ func (s *ResultService) getQuestionStatistics() ([]models.QuestionStatistics, er
 				(jsonb_array_elements(r.answers)->>'is_correct')::boolean as is_correct,
 				(jsonb_array_elements(r.answers)->>'time_spent')::int as time_spent
 			FROM results r
+			WHERE r.status = 'graded'
 		) a ON q.id = a.question_id
 		WHERE q.deleted_at IS NULL
 		GROUP BY q.id, q.title
@@ -329,6 +332,7 @@ func (s *ResultService) getOverallStatistics() (OverallStatistics, error) {
 			COALESCE(SUM(r.duration), 0) as total_time_spent,
 			COALESCE(AVG(r.duration), 0) as average_duration
 		FROM results r
+		WHERE r.status = 'graded'
 	`).Row()
 
 	err := row.Scan(
@@ -344,6 +348,9 @@ func (s *ResultService) getOverallStatistics() (OverallStatistics, error) {
 	return stats, err
 }
 
+// loadQuestionDetailsForResult loads the answered questions at the revision each
+// answer was graded against, so the result shows them as the candidate saw them.
+// Answers from before versioning show the first revision.
 func (s *ResultService) loadQuestionDetailsForResult(result *models.Result) error {
 	// Get all question IDs from answers
 	questionIDs := make([]uint, len(result.Answers))
@@ -351,28 +358,34 @@ func (s *ResultService) loadQuestionDetailsForResult(result *models.Result) erro
 		questionIDs[i] = answer.QuestionID
 	}
 
-	// Load questions
+	// Load questions, including ones retired from the bank since
 	var questions []models.Question
-	if err := s.db.Where("id IN ?", questionIDs).Find(&questions).Error; err != nil {
+	if err := s.db.Unscoped().Where("id IN ?", questionIDs).Find(&questions).Error; err != nil {
 		return err
 	}
 
 	// Create question map for quick lookup
-	questionMap := make(map[uint]models.Question)
-	for _, q := range questions {
-		questionMap[q.ID] = q
+	questionMap := make(map[uint]*models.Question)
+	for i := range questions {
+		questionMap[questions[i].ID] = &questions[i]
 	}
 
-	// Update result answers with question details and correct answers
-	for i, answer := range result.Answers {
+	answered := []*models.Question{}
+	revisions := []int{}
+	for _, answer := range result.Answers {
 		if question, exists := questionMap[answer.QuestionID]; exists {
-			// This would be used in the response conversion
-			// We store the question reference for later use
-			_ = question
+			revision := answer.Revision
+			if revision == 0 {
+				revision = 1
+			}
+			answered = append(answered, question)
+			revisions = append(revisions, revision)
 		}
-		result.Answers[i] = answer
+	}
+	if err := applyRevisions(s.db, answered, revisions); err != nil {
+		return err
 	}
 
+	result.Questions = questionMap
 	return nil
 }
-
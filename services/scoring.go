@@ -0,0 +1,254 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"math"
+)
+
+// GradeAnswer grades a single submitted answer against the question's answer key.
+// An empty selection is treated as unanswered and earns no points; an option ID
+// that doesn't exist on the question, or more picks than the question allows, is
+// rejected with an error.
+func GradeAnswer(question *models.Question, points int, selectedOptions []string) (models.Answer, error) {
+	answer := models.Answer{
+		QuestionID:      question.ID,
+		SelectedOptions: []string{},
+		IsCorrect:       false,
+		Points:          0,
+		MaxPoints:       points,
+	}
+
+	// Reject option IDs that aren't part of the question and drop duplicates
+	selected, err := ValidateSelection(question, selectedOptions)
+	if err != nil {
+		return answer, err
+	}
+	answer.SelectedOptions = selected
+
+	var rule models.GradingRule
+	switch question.Selection() {
+	case models.SelectSingle:
+		rule = models.GradingSingleMatch
+	case models.SelectMultiple:
+		rule = models.GradingExactSet
+	default:
+		return answer, fmt.Errorf("unsupported question type %q for question %d", question.Type, question.ID)
+	}
+
+	if err := checkSelectionCount(question, len(answer.SelectedOptions)); err != nil {
+		return answer, err
+	}
+
+	breakdown := buildBreakdown(question, answer.SelectedOptions)
+	breakdown.Rule = rule
+	breakdown.BelowMinimum = breakdown.Answered && len(answer.SelectedOptions) < question.MinSelections
+	answer.Grading = breakdown
+
+	if !breakdown.Answered {
+		return answer, nil
+	}
+
+	switch rule {
+	case models.GradingExactSet:
+		answer.IsCorrect = question.ValidateAnswer(answer.SelectedOptions)
+	case models.GradingSingleMatch:
+		answer.IsCorrect = len(answer.SelectedOptions) == 1 && breakdown.CorrectSelected == 1
+	}
+
+	if answer.IsCorrect {
+		answer.Points = float64(points)
+		breakdown.Credit = 1
+	}
+
+	return answer, nil
+}
+
+// checkSelectionCount rejects more picks than a question allows. Picking fewer
+// than the minimum isn't rejected, since autosaves send a selection in progress,
+// but earns no credit.
+func checkSelectionCount(question *models.Question, count int) error {
+	if question.Selection() == models.SelectSingle && count > 1 {
+		return fmt.Errorf("invalid answer for question %d: pick only one option", question.ID)
+	}
+	if question.MaxSelections > 0 && count > question.MaxSelections {
+		return fmt.Errorf("invalid answer for question %d: pick at most %d options", question.ID, question.MaxSelections)
+	}
+	return nil
+}
+
+// GradeSubmission grades a submitted answer with the grader for its question's
+// type. Each type reads its own field of the request, so clients that only send
+// selected_options keep working; filling in another type's field is rejected.
+func GradeSubmission(question *models.Question, points int, submitted SubmitAnswerRequest) (models.Answer, error) {
+	if err := checkAnswerFields(question, submitted); err != nil {
+		return models.Answer{QuestionID: question.ID, SelectedOptions: []string{}, MaxPoints: points}, err
+	}
+
+	switch {
+	case question.Type == models.Numeric:
+		return GradeNumericAnswer(question, points, submitted.NumericAnswer)
+	case question.Type.IsTextAnswer():
+		return GradeTextAnswer(question, points, submitted.TextAnswers)
+	case question.Type == models.Ordering:
+		return GradeOrderingAnswer(question, points, submitted.SelectedOptions)
+	case question.Type == models.Matching:
+		return GradeMatchingAnswer(question, points, submitted.Matches)
+	case question.Type == models.Essay:
+		return GradeEssayAnswer(question, points, submitted.Essay)
+	}
+	return GradeAnswer(question, points, submitted.SelectedOptions)
+}
+
+// checkAnswerFields rejects an answer given in a field the question's type doesn't use
+func checkAnswerFields(question *models.Question, submitted SubmitAnswerRequest) error {
+	numeric := question.Type == models.Numeric
+	text := question.Type.IsTextAnswer()
+	matching := question.Type == models.Matching
+	essay := question.Type == models.Essay
+
+	expected := "selected options"
+	switch {
+	case numeric:
+		expected = "a numeric answer"
+	case text:
+		expected = "text answers"
+	case matching:
+		expected = "matches"
+	case essay:
+		expected = "an essay"
+	}
+
+	if (len(submitted.SelectedOptions) > 0 && (numeric || text || matching || essay)) ||
+		(len(submitted.TextAnswers) > 0 && !text) ||
+		(submitted.NumericAnswer != nil && !numeric) ||
+		(len(submitted.Matches) > 0 && !matching) ||
+		(submitted.Essay != "" && !essay) {
+		return fmt.Errorf("invalid answer for question %d: expected %s", question.ID, expected)
+	}
+	return nil
+}
+
+// ValidateResponse checks that an answer being saved fits its question and returns
+// it cleaned up: duplicate options dropped, and only the field the type uses kept
+func ValidateResponse(question *models.Question, req SubmitAnswerRequest) (SubmitAnswerRequest, error) {
+	answer, err := GradeSubmission(question, 0, req)
+	if err != nil {
+		return req, err
+	}
+
+	req.SelectedOptions = answer.SelectedOptions
+	req.TextAnswers = answer.TextAnswers
+	req.NumericAnswer = answer.NumericAnswer
+	req.Matches = answer.Matches
+	req.Essay = answer.Essay
+	return req, nil
+}
+
+// ValidateSelection checks that every selected option exists on the question and
+// returns the selection with duplicates removed
+func ValidateSelection(question *models.Question, selectedOptions []string) ([]string, error) {
+	selected := []string{}
+	seen := make(map[string]bool)
+	for _, optionID := range selectedOptions {
+		if !question.HasOption(optionID) {
+			return nil, fmt.Errorf("invalid option %q for question %d", optionID, question.ID)
+		}
+		if seen[optionID] {
+			continue
+		}
+		seen[optionID] = true
+		selected = append(selected, optionID)
+	}
+	return selected, nil
+}
+
+// ApplyScoringPolicy re-scores a graded answer under an exam's scoring policy.
+// Partial credit and wrong-option penalties only apply to questions with more
+// than one correct option or graded item; single-answer questions stay
+// all-or-nothing.
+func ApplyScoringPolicy(answer *models.Answer, policy models.ScoringPolicy, negativeMarkRatio float64) {
+	breakdown := answer.Grading
+	// Graders award essay points themselves, so no policy applies to them
+	if breakdown == nil || !breakdown.Answered || breakdown.Rule == models.GradingManual {
+		return
+	}
+
+	credit := breakdown.Credit
+	correctCount := len(breakdown.CorrectOptions)
+	if isPerItemRule(breakdown.Rule) {
+		// Each blank, ordering item or matching option counts like a correct option
+		correctCount = breakdown.CorrectSelected + breakdown.WrongSelected + breakdown.MissedOptions
+	}
+	multiAnswer := correctCount > 1
+
+	switch policy {
+	case models.ScoringPartialCredit:
+		if multiAnswer {
+			credit = 0
+			// A wrong item only loses its own share, unlike a wrong option
+			if breakdown.WrongSelected == 0 || isPerItemRule(breakdown.Rule) {
+				credit = float64(breakdown.CorrectSelected) / float64(correctCount)
+			}
+		}
+	case models.ScoringWrongPenalty:
+		if multiAnswer {
+			credit = math.Max(0, float64(breakdown.CorrectSelected-breakdown.WrongSelected)/float64(correctCount))
+		}
+	case models.ScoringNegativeMarking:
+		if !answer.IsCorrect {
+			credit = -negativeMarkRatio
+		}
+	}
+
+	if breakdown.BelowMinimum && credit > 0 {
+		credit = 0
+	}
+
+	breakdown.Credit = credit
+	answer.Points = roundPoints(credit * float64(answer.MaxPoints))
+}
+
+// SumPoints totals the points of graded answers; negative marking can't take
+// the exam total below zero
+func SumPoints(answers []models.Answer) float64 {
+	total := 0.0
+	for _, answer := range answers {
+		total += answer.Points
+	}
+	return roundPoints(math.Max(0, total))
+}
+
+// roundPoints rounds fractional points to two decimal places
+func roundPoints(points float64) float64 {
+	return math.Round(points*100) / 100
+}
+
+// buildBreakdown counts correct, wrong and missed selections for an answer
+func buildBreakdown(question *models.Question, selectedOptions []string) *models.GradingBreakdown {
+	correctAnswers := question.GetCorrectAnswers()
+	if correctAnswers == nil {
+		correctAnswers = []string{}
+	}
+
+	correctMap := make(map[string]bool)
+	for _, correct := range correctAnswers {
+		correctMap[correct] = true
+	}
+
+	breakdown := &models.GradingBreakdown{
+		Answered:       len(selectedOptions) > 0,
+		CorrectOptions: correctAnswers,
+	}
+
+	for _, selected := range selectedOptions {
+		if correctMap[selected] {
+			breakdown.CorrectSelected++
+		} else {
+			breakdown.WrongSelected++
+		}
+	}
+	breakdown.MissedOptions = len(correctAnswers) - breakdown.CorrectSelected
+
+	return breakdown
+}
@@ -0,0 +1,429 @@
+package services
+
+import (
+	"errors"
+	"exam-system/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// errSectionMoved is returned when another request moved the attempt to a
+// different section first
+var errSectionMoved = errors.New("section moved")
+
+type ExamSectionRequest struct {
+	Title        string `json:"title" binding:"required"`
+	Instructions string `json:"instructions"`
+	Duration     int    `json:"duration" binding:"min=0"` // in minutes, 0 means no limit of its own
+	LockOnClose  bool   `json:"lock_on_close"`
+}
+
+type SectionProgressResponse struct {
+	CurrentSectionID *uint                        `json:"current_section_id"`
+	Sections         []models.ExamSectionResponse `json:"sections"`
+	Questions        []models.QuestionResponse    `json:"questions"` // questions the candidate can currently see
+}
+
+// orderSections is a preload scope that keeps exam sections in order
+func orderSections(db *gorm.DB) *gorm.DB {
+	return db.Order("\"order\"")
+}
+
+// buildExamSections validates the sections of an exam request
+func buildExamSections(requests []ExamSectionRequest, examDuration int) ([]models.ExamSection, error) {
+	sections := make([]models.ExamSection, len(requests))
+	totalDuration := 0
+
+	for i, req := range requests {
+		sections[i] = models.ExamSection{
+			Title:        req.Title,
+			Instructions: req.Instructions,
+			Order:        i + 1,
+			Duration:     req.Duration,
+			LockOnClose:  req.LockOnClose,
+		}
+		totalDuration += req.Duration
+	}
+
+	if totalDuration > examDuration {
+		return nil, fmt.Errorf("invalid sections: section durations add up to %d minutes but the exam lasts %d", totalDuration, examDuration)
+	}
+
+	return sections, nil
+}
+
+// checkSectionReference validates the 1-based section a question or blueprint
+// section is placed in
+func checkSectionReference(section int, sectionCount int, what string) error {
+	if sectionCount == 0 {
+		if section != 0 {
+			return fmt.Errorf("invalid sections: %s refers to section %d but the exam has no sections", what, section)
+		}
+		return nil
+	}
+
+	if section < 1 || section > sectionCount {
+		return fmt.Errorf("invalid sections: %s must be placed in a section between 1 and %d", what, sectionCount)
+	}
+	return nil
+}
+
+// sectionIDAt resolves a 1-based section reference to the ID of a created section
+func sectionIDAt(sections []models.ExamSection, section int) *uint {
+	if section < 1 || section > len(sections) {
+		return nil
+	}
+	id := sections[section-1].ID
+	return &id
+}
+
+// sectionLength is how long a timed section stays open for a candidate with the
+// given time multiplier
+func sectionLength(section *models.ExamSection, multiplier float64) time.Duration {
+	return models.ScaleDuration(time.Duration(section.Duration)*time.Minute, multiplier)
+}
+
+// AdvanceSections moves past every timed section whose time has run out by now.
+// It returns the index of the open section and when it opened; the last section
+// is never left behind.
+func AdvanceSections(sections []models.ExamSection, multiplier float64, index int, openedAt time.Time, now time.Time) (int, time.Time) {
+	for index < len(sections)-1 && sections[index].Duration > 0 {
+		closesAt := openedAt.Add(sectionLength(&sections[index], multiplier))
+		if now.Before(closesAt) {
+			break
+		}
+		index++
+		openedAt = closesAt
+	}
+	return index, openedAt
+}
+
+// SectionSubscores totals graded answers per section
+func SectionSubscores(sections []models.ExamSection, examQuestions []models.ExamQuestion, answers []models.Answer) models.SectionScores {
+	if len(sections) == 0 {
+		return nil
+	}
+
+	sectionOf := make(map[uint]uint)
+	for _, eq := range examQuestions {
+		if eq.SectionID != nil {
+			sectionOf[eq.QuestionID] = *eq.SectionID
+		}
+	}
+
+	points := make(map[uint]float64)
+	maxPoints := make(map[uint]int)
+	for _, answer := range answers {
+		sectionID, ok := sectionOf[answer.QuestionID]
+		if !ok {
+			continue
+		}
+		points[sectionID] += answer.Points
+		maxPoints[sectionID] += answer.MaxPoints
+	}
+
+	scores := make(models.SectionScores, len(sections))
+	for i, section := range sections {
+		earned := roundPoints(points[section.ID])
+		if earned < 0 {
+			earned = 0
+		}
+
+		score := 0.0
+		if maxPoints[section.ID] > 0 {
+			score = roundPoints(earned / float64(maxPoints[section.ID]) * 100)
+		}
+
+		scores[i] = models.SectionScore{
+			SectionID: section.ID,
+			Title:     section.Title,
+			Points:    earned,
+			MaxPoints: maxPoints[section.ID],
+			Score:     score,
+		}
+	}
+
+	return scores
+}
+
+// scoredSections returns the sections a result was scored by. Edits made once
+// no attempts are running give an exam's sections new IDs, so rescoring a result
+// goes by the sections stored with it rather than the exam's current ones.
+func scoredSections(result *models.Result) []models.ExamSection {
+	sections := make([]models.ExamSection, len(result.SectionScores))
+	for i, score := range result.SectionScores {
+		sections[i] = models.ExamSection{ID: score.SectionID, Title: score.Title, Order: i + 1}
+	}
+	return sections
+}
+
+// sectionProgress tracks where a candidate is in a sectioned exam
+type sectionProgress struct {
+	sections   []models.ExamSection
+	multiplier float64 // the candidate's time accommodation
+	current    int
+	openedAt   time.Time
+	sectionOf  map[uint]int // question ID -> index into sections
+	attempt    *models.ExamAttempt
+}
+
+// loadSectionProgress works out the open section of the user's current attempt,
+// closing sections whose time has run out. exam.ExamQuestions must already hold
+// the attempt's questions. It returns nil for exams without sections.
+func (s *ExamService) loadSectionProgress(exam *models.Exam, userExam *models.UserExam, now time.Time) (*sectionProgress, error) {
+	if len(exam.Sections) == 0 || userExam.CurrentAttemptID == nil {
+		return nil, nil
+	}
+
+	attempt, err := s.currentAttempt(userExam)
+	if err != nil {
+		return nil, err
+	}
+
+	var index int
+	var openedAt time.Time
+	for {
+		openedAt = attempt.StartedAt
+		if attempt.SectionStartedAt != nil {
+			openedAt = *attempt.SectionStartedAt
+		}
+
+		// Keep the index within the exam's sections even if the exam was restructured
+		index = attempt.SectionIndex
+		if index >= len(exam.Sections) {
+			index = len(exam.Sections) - 1
+		}
+		if index < 0 {
+			index = 0
+		}
+
+		index, openedAt = AdvanceSections(exam.Sections, userExam.TimeMultiplier, index, openedAt, now)
+		if index == attempt.SectionIndex {
+			break
+		}
+		err := s.moveToSection(attempt, index, openedAt)
+		if err == nil {
+			break
+		}
+		if err != errSectionMoved {
+			return nil, err
+		}
+
+		// Another request moved the attempt first; carry on from where it left it
+		if attempt, err = s.currentAttempt(userExam); err != nil {
+			return nil, err
+		}
+	}
+
+	progress := &sectionProgress{
+		sections:   exam.Sections,
+		multiplier: userExam.TimeMultiplier,
+		current:    index,
+		openedAt:   openedAt,
+		sectionOf:  make(map[uint]int),
+		attempt:    attempt,
+	}
+
+	sectionIndex := make(map[uint]int)
+	for i, section := range exam.Sections {
+		sectionIndex[section.ID] = i
+	}
+	for _, eq := range exam.ExamQuestions {
+		if eq.SectionID != nil {
+			progress.sectionOf[eq.QuestionID] = sectionIndex[*eq.SectionID]
+		}
+	}
+
+	return progress, nil
+}
+
+// moveToSection records a section change on the attempt. The update is conditional
+// on the old index so concurrent requests can't skip a section twice; the one
+// that loses gets errSectionMoved.
+func (s *ExamService) moveToSection(attempt *models.ExamAttempt, index int, openedAt time.Time) error {
+	result := s.db.Model(&models.ExamAttempt{}).
+		Where("id = ? AND section_index = ?", attempt.ID, attempt.SectionIndex).
+		Updates(map[string]interface{}{
+			"section_index":      index,
+			"section_started_at": openedAt,
+		})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to update exam attempt section")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errSectionMoved
+	}
+
+	attempt.SectionIndex = index
+	attempt.SectionStartedAt = &openedAt
+	return nil
+}
+
+// closesAt returns when the open section runs out of time, or nil if it isn't timed
+func (p *sectionProgress) closesAt() *time.Time {
+	section := &p.sections[p.current]
+	if section.Duration <= 0 {
+		return nil
+	}
+	closesAt := p.openedAt.Add(sectionLength(section, p.multiplier))
+	return &closesAt
+}
+
+// checkAnswerable reports why a question can't be answered right now, if it can't
+func (p *sectionProgress) checkAnswerable(questionID uint, now time.Time) error {
+	index, ok := p.sectionOf[questionID]
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case index > p.current:
+		return fmt.Errorf("section is not open yet")
+	case index < p.current && p.sections[index].LockOnClose:
+		return fmt.Errorf("section is closed")
+	case index == p.current:
+		if closesAt := p.closesAt(); closesAt != nil && !now.Before(*closesAt) {
+			return fmt.Errorf("section time has expired")
+		}
+	}
+	return nil
+}
+
+// visible reports whether the candidate may currently see a question
+func (p *sectionProgress) visible(questionID uint) bool {
+	index, ok := p.sectionOf[questionID]
+	if !ok {
+		return true
+	}
+	if index > p.current {
+		return false
+	}
+	return index == p.current || !p.sections[index].LockOnClose
+}
+
+// visibleQuestions filters the attempt's questions down to those the candidate may see
+func (p *sectionProgress) visibleQuestions(examQuestions []models.ExamQuestion) []models.ExamQuestion {
+	visible := []models.ExamQuestion{}
+	for _, eq := range examQuestions {
+		if p.visible(eq.QuestionID) {
+			visible = append(visible, eq)
+		}
+	}
+	return visible
+}
+
+// responses describes every section with its status, questions and, for the open
+// section, the time it has left
+func (p *sectionProgress) responses(examQuestions []models.ExamQuestion, now time.Time) []models.ExamSectionResponse {
+	responses := make([]models.ExamSectionResponse, len(p.sections))
+	for i, section := range p.sections {
+		response := section.ToResponse()
+
+		switch {
+		case i < p.current:
+			response.Status = models.SectionClosed
+		case i == p.current:
+			response.Status = models.SectionOpen
+			if closesAt := p.closesAt(); closesAt != nil {
+				timeLeft := int(closesAt.Sub(now).Seconds())
+				if timeLeft < 0 {
+					timeLeft = 0
+				}
+				response.TimeLeft = &timeLeft
+			}
+		default:
+			response.Status = models.SectionUpcoming
+		}
+
+		// Candidates only learn which questions a section holds once they can see it
+		if i <= p.current {
+			for _, eq := range examQuestions {
+				if eq.SectionID != nil && *eq.SectionID == section.ID && p.visible(eq.QuestionID) {
+					response.QuestionIDs = append(response.QuestionIDs, eq.QuestionID)
+				}
+			}
+		}
+
+		responses[i] = response
+	}
+	return responses
+}
+
+func (p *sectionProgress) currentSectionID() *uint {
+	id := p.sections[p.current].ID
+	return &id
+}
+
+// NextSection closes the open section of the user's attempt and opens the next one
+func (s *ExamService) NextSection(examID uint, userID uint) (*SectionProgressResponse, error) {
+	userExam, exam, err := s.getActiveAttempt(examID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	progress, err := s.loadSectionProgress(exam, userExam, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move to next section")
+	}
+	if progress == nil {
+		return nil, fmt.Errorf("exam has no sections")
+	}
+	if progress.current >= len(progress.sections)-1 {
+		return nil, fmt.Errorf("already in the last section")
+	}
+
+	if err := s.moveToSection(progress.attempt, progress.current+1, now); err != nil {
+		if err == errSectionMoved {
+			return nil, fmt.Errorf("section has already changed")
+		}
+		return nil, fmt.Errorf("failed to move to next section")
+	}
+	progress.current++
+	progress.openedAt = now
+
+	return progress.toResponse(exam.ExamQuestions, now), nil
+}
+
+func (p *sectionProgress) toResponse(examQuestions []models.ExamQuestion, now time.Time) *SectionProgressResponse {
+	visible := p.visibleQuestions(examQuestions)
+	questions := make([]models.QuestionResponse, len(visible))
+	for i, eq := range visible {
+		questions[i] = eq.Question.ToResponse(false)
+	}
+
+	return &SectionProgressResponse{
+		CurrentSectionID: p.currentSectionID(),
+		Sections:         p.responses(examQuestions, now),
+		Questions:        questions,
+	}
+}
+
+// answerable drops submitted answers to questions the candidate can no longer change
+func (p *sectionProgress) answerable(answers []SubmitAnswerRequest, now time.Time) []SubmitAnswerRequest {
+	kept := []SubmitAnswerRequest{}
+	for _, answer := range answers {
+		if p.checkAnswerable(answer.QuestionID, now) == nil {
+			kept = append(kept, answer)
+		}
+	}
+	return kept
+}
+
+// presentSections limits a start or resume response to the sections the
+// candidate has reached
+func (s *ExamService) presentSections(response *StartExamResponse, exam *models.Exam, userExam *models.UserExam, now time.Time) error {
+	progress, err := s.loadSectionProgress(exam, userExam, now)
+	if err != nil || progress == nil {
+		return err
+	}
+
+	view := progress.toResponse(exam.ExamQuestions, now)
+	response.CurrentSectionID = view.CurrentSectionID
+	response.Sections = view.Sections
+	response.Questions = view.Questions
+	return nil
+}
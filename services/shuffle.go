@@ -0,0 +1,89 @@
+package services
+
+import (
+	"exam-system/models"
+	"math/rand"
+	"sort"
+)
+
+// ShuffleExamQuestions returns the exam's questions in the order a candidate sees
+// them. Questions are first put in authoring order, grouped by section, then
+// shuffled with a random source seeded from the attempt, so the same seed always
+// yields the same permutation. Questions never move out of their section, and
+// option IDs are never changed, only their order. Ordering and matching questions
+// are always shuffled when presented, with a per-question seed derived here.
+func ShuffleExamQuestions(examQuestions []models.ExamQuestion, sections []models.ExamSection, seed int64, shuffleQuestions bool, shuffleOptions bool) []models.ExamQuestion {
+	presented := make([]models.ExamQuestion, len(examQuestions))
+	copy(presented, examQuestions)
+
+	sectionRank := make(map[uint]int)
+	for i, section := range sections {
+		sectionRank[section.ID] = i
+	}
+	rank := func(eq *models.ExamQuestion) int {
+		if eq.SectionID == nil {
+			return 0
+		}
+		return sectionRank[*eq.SectionID]
+	}
+
+	sort.SliceStable(presented, func(i, j int) bool {
+		if ri, rj := rank(&presented[i]), rank(&presented[j]); ri != rj {
+			return ri < rj
+		}
+		if presented[i].Order != presented[j].Order {
+			return presented[i].Order < presented[j].Order
+		}
+		return presented[i].QuestionID < presented[j].QuestionID
+	})
+
+	rng := rand.New(rand.NewSource(seed))
+
+	if shuffleQuestions {
+		for start := 0; start < len(presented); {
+			end := start + 1
+			for end < len(presented) && rank(&presented[end]) == rank(&presented[start]) {
+				end++
+			}
+			group := presented[start:end]
+			rng.Shuffle(len(group), func(i, j int) {
+				group[i], group[j] = group[j], group[i]
+			})
+			start = end
+		}
+	}
+
+	// Derived without drawing from rng so the permutations above stay the same.
+	// Without an attempt seed they're left to shuffle at random: a fixed seed
+	// would give every candidate the same, predictable order.
+	if seed != 0 {
+		for i := range presented {
+			presented[i].Question.ShuffleSeed = seed ^ int64(presented[i].QuestionID)*2654435761
+		}
+	}
+
+	if shuffleOptions {
+		for i := range presented {
+			question := &presented[i].Question
+			// True/false keeps its conventional order; ordering and matching
+			// items are shuffled on presentation from ShuffleSeed
+			if question.Type == models.TrueFalse || question.Type == models.Ordering || question.Type == models.Matching {
+				continue
+			}
+
+			options := make(models.Options, len(question.Options))
+			copy(options, question.Options)
+			rng.Shuffle(len(options), func(a, b int) {
+				options[a], options[b] = options[b], options[a]
+			})
+			question.Options = options
+		}
+	}
+
+	return presented
+}
+
+// newAttemptSeed picks the seed that fixes an attempt's question and option order
+func newAttemptSeed() int64 {
+	return rand.Int63()
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"exam-system/models"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Spreadsheets list one question per row under a header row naming the columns:
+//
+//	title, content, content_format, type, difficulty, option_a ... option_z,
+//	correct, tolerance, tags, points, time_limit, explanation
+//
+// Only content is required; the type defaults to multiple_choice. Multiple-choice
+// questions take their options from the option_ columns and the letters of the
+// right ones from correct, e.g. "B" or "A,C". True/false questions take true or
+// false, short-answer questions the accepted answers separated by "|", numeric
+// questions the number with an optional absolute tolerance, and ordering
+// questions list their items in order in the option_ columns. Essays need no
+// answer. Tags are separated by commas; other columns are ignored.
+
+// rowReader returns the next row of a spreadsheet, or io.EOF after the last one
+type rowReader func() ([]string, error)
+
+// spreadsheetColumnAliases maps other common header names to ours
+var spreadsheetColumnAliases = map[string]string{
+	"question": "content",
+	"answer":   "correct",
+	"answers":  "correct",
+}
+
+// parseCSV reads a CSV file. Excel's byte order mark is skipped, and the file may
+// use semicolons, as Excel does where the decimal separator is a comma.
+func parseCSV(r io.Reader) ([]importedQuestion, error) {
+	buffered := bufio.NewReader(r)
+	if bom, _ := buffered.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		buffered.Discard(3)
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+	head, _ := buffered.Peek(buffered.Size())
+	if header, _, _ := bytes.Cut(head, []byte("\n")); bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	return parseSpreadsheet(reader.Read)
+}
+
+// parseXLSX reads the first sheet of an Excel workbook
+func parseXLSX(r io.Reader) ([]importedQuestion, error) {
+	workbook, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid import file: not an XLSX workbook")
+	}
+	defer workbook.Close()
+
+	sheets := workbook.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("invalid import file: the workbook has no sheets")
+	}
+	rows, err := workbook.Rows(sheets[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid import file: %v", err)
+	}
+	defer rows.Close()
+
+	return parseSpreadsheet(func() ([]string, error) {
+		if !rows.Next() {
+			if err := rows.Error(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		return rows.Columns()
+	})
+}
+
+// parseSpreadsheet reads the questions under a header row, one per row. Blank
+// rows are skipped.
+func parseSpreadsheet(next rowReader) ([]importedQuestion, error) {
+	questions := []importedQuestion{}
+
+	header, err := next()
+	if err == io.EOF {
+		return questions, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid import file: %v", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.Join(strings.Fields(strings.TrimPrefix(name, "\ufeff")), "_"))
+		if alias, ok := spreadsheetColumnAliases[name]; ok {
+			name = alias
+		}
+		if _, seen := columns[name]; name != "" && !seen {
+			columns[name] = i
+		}
+	}
+	if _, ok := columns["content"]; !ok {
+		return nil, fmt.Errorf("invalid import file: the header row has no content column")
+	}
+
+	for row := 2; ; row++ {
+		cells, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid import file: %v", err)
+		}
+		if strings.TrimSpace(strings.Join(cells, "")) == "" {
+			continue
+		}
+
+		imported := spreadsheetQuestion(columns, cells)
+		imported.Line = row
+		questions = append(questions, imported)
+
+		// ImportQuestions turns the file down once it is over the limit
+		if len(questions) > maxImportQuestions {
+			break
+		}
+	}
+
+	return questions, nil
+}
+
+// spreadsheetQuestion maps the cells of a row to a create request
+func spreadsheetQuestion(columns map[string]int, cells []string) importedQuestion {
+	cell := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(cells) {
+			return strings.TrimSpace(cells[i])
+		}
+		return ""
+	}
+
+	imported := importedQuestion{}
+	req := &imported.Request
+	req.Content = cell("content")
+	req.Title = importTitle(cell("title"), req.Content)
+	req.ContentFormat = models.ContentFormat(strings.ToLower(cell("content_format")))
+	req.Type = models.QuestionType(strings.ToLower(cell("type")))
+	if req.Type == "" {
+		req.Type = models.MultipleChoice
+	}
+	req.Difficulty = models.QuestionDifficulty(strings.ToLower(cell("difficulty")))
+	req.Tags = splitImportList(cell("tags"))
+	req.Explanation = cell("explanation")
+
+	var err error
+	if req.Points, err = spreadsheetInt(cell("points"), "points"); err != nil {
+		imported.Err = err
+		return imported
+	}
+	if req.TimeLimit, err = spreadsheetInt(cell("time_limit"), "time_limit"); err != nil {
+		imported.Err = err
+		return imported
+	}
+
+	// Options are named after their column's letter, so correct can refer to them
+	options := []models.Option{}
+	for letter := 'a'; letter <= 'z'; letter++ {
+		if text := cell("option_" + string(letter)); text != "" {
+			options = append(options, models.Option{ID: string(letter), Text: text})
+		}
+	}
+	correct := cell("correct")
+
+	switch req.Type {
+	case models.MultipleChoice:
+		req.Options = options
+		imported.Err = markCorrectOptions(req.Options, correct)
+		return imported
+	case models.Ordering:
+		req.Options = options
+		return imported
+	}
+
+	if len(options) > 0 {
+		imported.Warnings = append(imported.Warnings, fmt.Sprintf("option columns are ignored for %s questions", req.Type))
+	}
+
+	switch req.Type {
+	case models.TrueFalse:
+		switch strings.ToLower(correct) {
+		case "true", "t", "yes", "1", "đúng":
+			req.Options = trueFalseOptions(true)
+		case "false", "f", "no", "0", "sai":
+			req.Options = trueFalseOptions(false)
+		default:
+			imported.Err = fmt.Errorf("correct answer of a true/false question must be true or false")
+		}
+	case models.ShortAnswer:
+		blank := models.Blank{ID: "1"}
+		for _, answer := range strings.Split(correct, "|") {
+			if answer = strings.TrimSpace(answer); answer != "" {
+				blank.Accepted = append(blank.Accepted, models.AcceptedAnswer{Text: answer, Match: models.MatchCaseInsensitive})
+			}
+		}
+		req.Blanks = []models.Blank{blank}
+	case models.Numeric:
+		value, err := strconv.ParseFloat(correct, 64)
+		if err != nil {
+			imported.Err = fmt.Errorf("correct answer %q is not a number", correct)
+			break
+		}
+		tolerance := 0.0
+		if t := cell("tolerance"); t != "" {
+			if tolerance, err = strconv.ParseFloat(t, 64); err != nil {
+				imported.Err = fmt.Errorf("tolerance %q is not a number", t)
+				break
+			}
+		}
+		req.Numeric = &models.NumericKey{Answer: value, Tolerance: tolerance, ToleranceType: models.ToleranceAbsolute}
+	case models.Essay:
+	default:
+		if req.Type.IsValid() {
+			imported.Err = fmt.Errorf("%s questions can't be imported from a spreadsheet", req.Type)
+		}
+	}
+
+	return imported
+}
+
+// spreadsheetInt reads a whole number cell; blank cells are left to the defaults
+func spreadsheetInt(value, column string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a whole number, got %q", column, value)
+	}
+	return number, nil
+}
+
+// markCorrectOptions marks the options named by letters such as "A,C" correct
+func markCorrectOptions(options []models.Option, letters string) error {
+	for _, letter := range strings.FieldsFunc(letters, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' '
+	}) {
+		id := strings.ToLower(strings.TrimRight(letter, ".)"))
+		found := false
+		for i := range options {
+			if options[i].ID == id {
+				options[i].IsCorrect = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("correct answer %q is not one of the options", letter)
+		}
+	}
+	return nil
+}
+
+// splitImportList splits a list of tags written as "a, b" or "a; b"
+func splitImportList(value string) []string {
+	items := []string{}
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		if item = strings.TrimSpace(item); item != "" && !containsString(items, item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
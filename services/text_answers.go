@@ -0,0 +1,224 @@
+package services
+
+import (
+	"exam-system/models"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxTextAnswerLength caps a single typed answer, in characters
+const maxTextAnswerLength = 1000
+
+// clozePlaceholder finds the {{id}} markers of blanks in a cloze question's content
+var clozePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_-]+)\s*\}\}`)
+
+// ClozeBlankIDs returns the blank IDs referenced in a cloze question's content,
+// in order of first appearance
+func ClozeBlankIDs(content string) []string {
+	ids := []string{}
+	seen := make(map[string]bool)
+	for _, match := range clozePlaceholder.FindAllStringSubmatch(content, -1) {
+		if seen[match[1]] {
+			continue
+		}
+		seen[match[1]] = true
+		ids = append(ids, match[1])
+	}
+	return ids
+}
+
+// MatchAcceptedAnswer reports whether a typed answer matches an accepted answer
+// under the accepted answer's match mode
+func MatchAcceptedAnswer(accepted models.AcceptedAnswer, input string) bool {
+	if accepted.Match == models.MatchRegex {
+		pattern, err := compileAnswerPattern(accepted.Text)
+		if err != nil {
+			return false
+		}
+		return pattern.MatchString(strings.TrimSpace(input))
+	}
+
+	return normalizeAnswerText(input, accepted.Match) == normalizeAnswerText(accepted.Text, accepted.Match)
+}
+
+// compileAnswerPattern compiles an accepted-answer regex so it has to match the
+// whole answer rather than a substring of it
+func compileAnswerPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+// normalizeAnswerText reduces a typed answer to the form compared under mode
+func normalizeAnswerText(text string, mode models.MatchMode) string {
+	text = strings.TrimSpace(text)
+
+	switch mode {
+	case models.MatchWhitespace:
+		return strings.Join(strings.Fields(text), " ")
+	case models.MatchCaseInsensitive:
+		return strings.ToLower(strings.Join(strings.Fields(text), " "))
+	case models.MatchAccentInsensitive:
+		return stripAccents(strings.ToLower(strings.Join(strings.Fields(text), " ")))
+	}
+	return text
+}
+
+// stripAccents removes diacritics, so Vietnamese "Hà Nội" compares equal to
+// "ha noi". The stroke in đ isn't a combining mark and is mapped separately.
+func stripAccents(text string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	stripped, _, err := transform.String(t, text)
+	if err != nil {
+		return text
+	}
+	return strings.NewReplacer("đ", "d", "Đ", "D").Replace(stripped)
+}
+
+// GradeTextAnswer grades the typed answers of a short-answer or cloze question,
+// one per blank in order. The answer is correct only if every blank matches one
+// of its accepted answers; empty answers count as unanswered blanks.
+func GradeTextAnswer(question *models.Question, points int, textAnswers []string) (models.Answer, error) {
+	answer := models.Answer{
+		QuestionID:      question.ID,
+		SelectedOptions: []string{},
+		IsCorrect:       false,
+		Points:          0,
+		MaxPoints:       points,
+	}
+
+	texts, err := validateTextAnswers(question, textAnswers)
+	if err != nil {
+		return answer, err
+	}
+	answer.TextAnswers = texts
+
+	breakdown := &models.GradingBreakdown{
+		Rule:           models.GradingTextMatch,
+		CorrectOptions: []string{},
+		Blanks:         make([]models.BlankGrade, len(question.Blanks)),
+	}
+	answer.Grading = breakdown
+
+	for i, blank := range question.Blanks {
+		grade := models.BlankGrade{ID: blank.ID, Accepted: make([]string, len(blank.Accepted))}
+		for j, accepted := range blank.Accepted {
+			grade.Accepted[j] = accepted.Text
+		}
+
+		input := ""
+		if i < len(texts) {
+			input = texts[i]
+		}
+
+		switch {
+		case strings.TrimSpace(input) == "":
+			breakdown.MissedOptions++
+		case matchesBlank(blank, input):
+			grade.Correct = true
+			breakdown.CorrectSelected++
+		default:
+			breakdown.WrongSelected++
+		}
+		breakdown.Blanks[i] = grade
+	}
+
+	breakdown.Answered = breakdown.CorrectSelected+breakdown.WrongSelected > 0
+	if !breakdown.Answered {
+		return answer, nil
+	}
+
+	answer.IsCorrect = len(question.Blanks) > 0 && breakdown.CorrectSelected == len(question.Blanks)
+	if answer.IsCorrect {
+		answer.Points = float64(points)
+		breakdown.Credit = 1
+	}
+
+	return answer, nil
+}
+
+// matchesBlank reports whether input matches any accepted answer of the blank
+func matchesBlank(blank models.Blank, input string) bool {
+	for _, accepted := range blank.Accepted {
+		if MatchAcceptedAnswer(accepted, input) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTextAnswers checks typed answers against the question's blanks
+func validateTextAnswers(question *models.Question, textAnswers []string) ([]string, error) {
+	if len(textAnswers) > len(question.Blanks) {
+		return nil, fmt.Errorf("invalid answer for question %d: expected at most %d text answers", question.ID, len(question.Blanks))
+	}
+	for _, text := range textAnswers {
+		if utf8.RuneCountInString(text) > maxTextAnswerLength {
+			return nil, fmt.Errorf("invalid answer for question %d: text answers are limited to %d characters", question.ID, maxTextAnswerLength)
+		}
+	}
+
+	texts := make([]string, len(textAnswers))
+	copy(texts, textAnswers)
+	return texts, nil
+}
+
+// validateBlanks checks the answer key of a short-answer or cloze question
+func validateBlanks(content string, blanks []models.Blank, questionType models.QuestionType) error {
+	if len(blanks) == 0 {
+		return fmt.Errorf("invalid answer key: question must have at least one blank")
+	}
+
+	seen := make(map[string]bool)
+	for _, blank := range blanks {
+		if blank.ID == "" {
+			return fmt.Errorf("invalid answer key: blank ID cannot be empty")
+		}
+		if seen[blank.ID] {
+			return fmt.Errorf("invalid answer key: duplicate blank %q", blank.ID)
+		}
+		seen[blank.ID] = true
+
+		if len(blank.Accepted) == 0 {
+			return fmt.Errorf("invalid answer key: blank %q must have at least one accepted answer", blank.ID)
+		}
+		for _, accepted := range blank.Accepted {
+			if strings.TrimSpace(accepted.Text) == "" {
+				return fmt.Errorf("invalid answer key: accepted answer of blank %q cannot be empty", blank.ID)
+			}
+			if !accepted.Match.IsValid() {
+				return fmt.Errorf("invalid answer key: unknown match mode %q", accepted.Match)
+			}
+			if accepted.Match == models.MatchRegex {
+				if _, err := compileAnswerPattern(accepted.Text); err != nil {
+					return fmt.Errorf("invalid answer key: bad pattern for blank %q: %v", blank.ID, err)
+				}
+			}
+		}
+	}
+
+	switch questionType {
+	case models.ShortAnswer:
+		if len(blanks) != 1 {
+			return fmt.Errorf("invalid answer key: short-answer questions must have exactly one blank")
+		}
+	case models.Cloze:
+		// Blanks are answered in the order they appear in the content
+		ids := ClozeBlankIDs(content)
+		if len(ids) != len(blanks) {
+			return fmt.Errorf("invalid answer key: content has %d placeholders but %d blanks are defined", len(ids), len(blanks))
+		}
+		for i, id := range ids {
+			if blanks[i].ID != id {
+				return fmt.Errorf("invalid answer key: blank %q must be listed in content order", id)
+			}
+		}
+	}
+
+	return nil
+}
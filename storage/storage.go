@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"exam-system/config"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when a stored file does not exist
+var ErrNotFound = errors.New("stored file not found")
+
+// Storage keeps uploaded media files. Keys are slash-separated paths chosen by
+// the caller, such as "media/2f1c....png".
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner is implemented by backends that can hand out time-limited download
+// links of their own, so files don't have to be streamed through the API
+type Presigner interface {
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// New creates the storage backend selected in the media configuration
+func New(cfg config.MediaConfig) (Storage, error) {
+	switch cfg.Storage {
+	case "", "local":
+		return NewLocalStorage(cfg.LocalDir)
+	case "s3":
+		return NewS3Storage(cfg)
+	}
+	return nil, fmt.Errorf("unknown media storage %q", cfg.Storage)
+}
@@ -4,7 +4,6 @@ import (
 	"exam-system/config"
 	"exam-system/models"
 	"exam-system/services"
-	"exam-system/utils"
 	"testing"
 	"time"
 
@@ -46,6 +45,22 @@ func (m *MockRedisClient) GetJSON(key string, dest interface{}) error {
 	return args.Error(1)
 }
 
+func (m *MockRedisClient) HSetJSON(key, field string, value interface{}) error {
+	args := m.Called(key, field, value)
+	return args.Error(0)
+}
+
+func (m *MockRedisClient) HGetAll(key string) (map[string]string, error) {
+	args := m.Called(key)
+	cached, _ := args.Get(0).(map[string]string)
+	return cached, args.Error(1)
+}
+
+func (m *MockRedisClient) Expire(key string, expiration time.Duration) error {
+	args := m.Called(key, expiration)
+	return args.Error(0)
+}
+
 func (m *MockRedisClient) IsRateLimited(key string, limit int, window time.Duration) (bool, error) {
 	args := m.Called(key, limit, window)
 	return args.Bool(0), args.Error(1)
@@ -221,6 +236,8 @@ func TestAuthService_Login(t *testing.T) {
 			IsActive:  false,
 		}
 		db.Create(&inactiveUser)
+		// is_active defaults to true, so the zero value is not written on create
+		db.Model(&inactiveUser).Update("is_active", false)
 
 		req := services.LoginRequest{
 			Email:    "inactive@example.com",
@@ -322,4 +339,3 @@ func TestAuthService_Logout(t *testing.T) {
 		mockRedis.AssertExpectations(t)
 	})
 }
-
@@ -1,9 +1,13 @@
 package tests
 
 import (
+	"encoding/json"
+	"errors"
 	"exam-system/config"
 	"exam-system/models"
 	"exam-system/services"
+	"fmt"
+	"math/rand"
 	"testing"
 	"time"
 
@@ -21,7 +25,8 @@ func setupExamTestDB() *gorm.DB {
 	}
 
 	// Migrate the schema
-	db.AutoMigrate(&models.User{}, &models.Question{}, &models.Exam{}, &models.ExamQuestion{}, &models.UserExam{}, &models.Result{})
+	db.AutoMigrate(&models.User{}, &models.Question{}, &models.QuestionRevision{}, &models.Media{}, &models.QuestionMedia{}, &models.RevisionMedia{}, &models.Exam{}, &models.ExamQuestion{}, &models.UserExam{}, &models.Result{},
+		&models.ExamAttempt{}, &models.AttemptQuestion{}, &models.ExamSection{}, &models.ExamBlueprintSection{}, &models.SavedAnswer{}, &models.QuestionTiming{})
 
 	return db
 }
@@ -257,6 +262,7 @@ func TestExamService_StartExam(t *testing.T) {
 
 	t.Run("successful exam start", func(t *testing.T) {
 		mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+		mockRedis.On("Del", fmt.Sprintf("exam_answers:%d:%d", user.ID, exam.ID)).Return(nil)
 
 		response, err := examService.StartExam(exam.ID, user.ID)
 
@@ -272,6 +278,24 @@ func TestExamService_StartExam(t *testing.T) {
 		mockRedis.AssertExpectations(t)
 	})
 
+	t.Run("resume and submit the started exam", func(t *testing.T) {
+		answersKey := fmt.Sprintf("exam_answers:%d:%d", user.ID, exam.ID)
+		mockRedis.On("HGetAll", answersKey).Return(map[string]string{}, nil)
+		mockRedis.On("Del", fmt.Sprintf("exam_session:%d:%d", user.ID, exam.ID)).Return(nil)
+
+		resumed, err := examService.ResumeExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		assert.Len(t, resumed.Questions, 1)
+
+		result, err := examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{
+			Answers: []services.SubmitAnswerRequest{{QuestionID: question.ID, SelectedOptions: []string{"b"}}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2.0, result.TotalPoints)
+
+		mockRedis.AssertExpectations(t)
+	})
+
 	t.Run("exam not assigned to user", func(t *testing.T) {
 		otherUser := models.User{
 			Email:     "other@example.com",
@@ -292,81 +316,2236 @@ func TestExamService_StartExam(t *testing.T) {
 	})
 }
 
-func TestExamService_AssignExam(t *testing.T) {
+// setupTimedExam creates an active 60 minute exam of two questions, each worth a
+// point, and assigns it to a new candidate
+func setupTimedExam(db *gorm.DB, admin models.User, username string) (models.Exam, []models.Question, models.User) {
+	user := models.User{
+		Email:     username + "@example.com",
+		Username:  username,
+		Password:  "hashedpassword",
+		FirstName: "Timed",
+		LastName:  "Candidate",
+		Role:      models.RoleUser,
+		IsActive:  true,
+	}
+	db.Create(&user)
+
+	exam := models.Exam{
+		Title:       "Timed Exam",
+		Duration:    60,
+		TotalPoints: 2,
+		PassScore:   50,
+		Status:      models.ExamActive,
+		IsActive:    true,
+		CreatedBy:   admin.ID,
+	}
+	db.Create(&exam)
+
+	questions := []models.Question{createTestQuestion(db, admin.ID), createTestQuestion(db, admin.ID)}
+	for i, question := range questions {
+		db.Create(&models.ExamQuestion{ExamID: exam.ID, QuestionID: question.ID, Order: i + 1, Points: 1})
+	}
+
+	db.Create(&models.UserExam{UserID: user.ID, ExamID: exam.ID, Status: models.UserExamAssigned, MaxAttempts: 1})
+	return exam, questions, user
+}
+
+// backdateAttempt moves the start of the candidate's attempt into the past
+func backdateAttempt(db *gorm.DB, examID, userID uint, elapsed time.Duration) time.Time {
+	startedAt := time.Now().Add(-elapsed)
+	db.Model(&models.UserExam{}).Where("exam_id = ? AND user_id = ?", examID, userID).Update("started_at", startedAt)
+	return startedAt
+}
+
+func TestExamService_SubmitExam_TimeLimit(t *testing.T) {
 	setupTestConfig()
+	config.AppConfig.Exam.GracePeriod = 2 * time.Minute
 	db := setupExamTestDB()
 	mockRedis := &MockRedisClient{}
 	logger := logrus.New()
 
 	examService := services.NewExamService(db, mockRedis, logger)
 
-	// Create test data
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+
+	t.Run("accepted within the grace period", func(t *testing.T) {
+		exam, questions, user := setupTimedExam(db, admin, "ontime")
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		backdateAttempt(db, exam.ID, user.ID, 61*time.Minute)
+
+		result, err := examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{
+			Answers: []services.SubmitAnswerRequest{{QuestionID: questions[0].ID, SelectedOptions: []string{"b"}}},
+		})
+
+		assert.NoError(t, err)
+		assert.False(t, result.SubmittedLate)
+		assert.Equal(t, 1.0, result.TotalPoints)
+	})
+
+	t.Run("rejected after the grace period", func(t *testing.T) {
+		exam, _, user := setupTimedExam(db, admin, "late")
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		backdateAttempt(db, exam.ID, user.ID, 65*time.Minute)
+
+		result, err := examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{})
+
+		assert.EqualError(t, err, "exam time has expired")
+		assert.Nil(t, result)
+	})
+
+	t.Run("cut off at the deadline under the truncate policy", func(t *testing.T) {
+		exam, questions, user := setupTimedExam(db, admin, "truncated")
+		db.Model(&exam).Update("late_policy", models.LateTruncate)
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		startedAt := backdateAttempt(db, exam.ID, user.ID, 65*time.Minute)
+
+		result, err := examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{
+			Answers: []services.SubmitAnswerRequest{{QuestionID: questions[1].ID, SelectedOptions: []string{"b"}}},
+		})
+
+		assert.NoError(t, err)
+		assert.True(t, result.SubmittedLate)
+		assert.WithinDuration(t, startedAt.Add(60*time.Minute), result.EndTime, time.Second)
+		assert.Equal(t, 1.0, result.TotalPoints)
+	})
+}
+
+func TestExamService_AutoSubmitExpiredAttempts(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+
 	admin := createTestUser(db, models.RoleAdmin)
+	exam, questions, user := setupTimedExam(db, admin, "expiring")
+	_, err := examService.StartExam(exam.ID, user.ID)
+	assert.NoError(t, err)
+
+	var userExam models.UserExam
+	db.Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).First(&userExam)
+
+	t.Run("attempt within its time limit stays open", func(t *testing.T) {
+		backdateAttempt(db, exam.ID, user.ID, 30*time.Minute)
+
+		closed, err := examService.AutoSubmitExpiredAttempts(5 * time.Minute)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, closed)
+	})
+
+	t.Run("attempt within the grace period stays open", func(t *testing.T) {
+		backdateAttempt(db, exam.ID, user.ID, 62*time.Minute)
+
+		closed, err := examService.AutoSubmitExpiredAttempts(5 * time.Minute)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, closed)
+	})
+
+	t.Run("expired attempt is graded with its saved answers", func(t *testing.T) {
+		db.Create(&models.SavedAnswer{UserExamID: userExam.ID, QuestionID: questions[0].ID, SelectedOptions: models.StringArray{"b"}})
+		startedAt := backdateAttempt(db, exam.ID, user.ID, 70*time.Minute)
+
+		closed, err := examService.AutoSubmitExpiredAttempts(5 * time.Minute)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, closed)
+
+		var result models.Result
+		assert.NoError(t, db.Where("user_exam_id = ?", userExam.ID).First(&result).Error)
+		assert.True(t, result.AutoSubmitted)
+		assert.Equal(t, 1.0, result.TotalPoints)
+		assert.WithinDuration(t, startedAt.Add(60*time.Minute), result.EndTime, time.Second)
+
+		db.First(&userExam, userExam.ID)
+		assert.Equal(t, models.UserExamCompleted, userExam.Status)
+
+		// Nothing is left to close on the next sweep
+		closed, err = examService.AutoSubmitExpiredAttempts(5 * time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, closed)
+	})
+}
+
+// assignCandidate assigns an exam to a new candidate
+func assignCandidate(db *gorm.DB, exam models.Exam, username string) models.User {
 	user := models.User{
-		Email:     "user@example.com",
-		Username:  "regularuser",
+		Email:     username + "@example.com",
+		Username:  username,
 		Password:  "hashedpassword",
-		FirstName: "Regular",
-		LastName:  "User",
+		FirstName: "Assigned",
+		LastName:  "Candidate",
 		Role:      models.RoleUser,
 		IsActive:  true,
 	}
 	db.Create(&user)
+	db.Create(&models.UserExam{UserID: user.ID, ExamID: exam.ID, Status: models.UserExamAssigned, MaxAttempts: 1})
+	return user
+}
 
-	exam := models.Exam{
-		Title:       "Test Exam",
-		Description: "A test exam",
-		Duration:    60,
-		TotalPoints: 2,
-		PassScore:   70,
-		Status:      models.ExamActive,
-		IsActive:    true,
-		CreatedBy:   admin.ID,
+func TestExamService_ApplyExamSchedule(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+	now := time.Now()
+	hourAgo, inAnHour := now.Add(-time.Hour), now.Add(time.Hour)
+	statusOf := func(exam models.Exam) models.ExamStatus {
+		db.First(&exam, exam.ID)
+		return exam.Status
 	}
-	db.Create(&exam)
 
-	t.Run("successful exam assignment", func(t *testing.T) {
-		expiresAt := time.Now().Add(24 * time.Hour)
-		req := services.AssignExamRequest{
-			UserIDs:     []uint{user.ID},
-			ExpiresAt:   &expiresAt,
-			MaxAttempts: 2,
-		}
+	t.Run("opens scheduled exams whose start time has come", func(t *testing.T) {
+		due, _, _ := setupTimedExam(db, admin, "due")
+		db.Model(&due).Updates(map[string]interface{}{"status": models.ExamScheduled, "start_time": hourAgo, "end_time": inAnHour})
+		early, _, earlyUser := setupTimedExam(db, admin, "earlywindow")
+		db.Model(&early).Updates(map[string]interface{}{"status": models.ExamScheduled, "start_time": inAnHour})
+		db.Model(&models.UserExam{}).Where("exam_id = ? AND user_id = ?", early.ID, earlyUser.ID).Update("window_start", hourAgo)
+		later, _, _ := setupTimedExam(db, admin, "later")
+		db.Model(&later).Updates(map[string]interface{}{"status": models.ExamScheduled, "start_time": inAnHour})
 
-		err := examService.AssignExam(exam.ID, req)
+		opened, closed, err := examService.ApplyExamSchedule(now)
 
 		assert.NoError(t, err)
+		assert.Equal(t, 2, opened)
+		assert.Equal(t, 0, closed)
+		assert.Equal(t, models.ExamActive, statusOf(due))
+		assert.Equal(t, models.ExamActive, statusOf(early))
+		assert.Equal(t, models.ExamScheduled, statusOf(later))
+	})
 
-		// Verify assignment was created
+	t.Run("waits for candidates whose window runs later", func(t *testing.T) {
+		exam, _, user := setupTimedExam(db, admin, "stillsitting")
+		db.Model(&models.UserExam{}).Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).Update("window_end", inAnHour)
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		backdateAttempt(db, exam.ID, user.ID, 10*time.Minute)
+		db.Model(&exam).Update("end_time", now.Add(-time.Minute))
+
+		_, closed, err := examService.ApplyExamSchedule(now)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, closed)
+		assert.Equal(t, models.ExamActive, statusOf(exam))
+	})
+
+	t.Run("closes exams past their end time", func(t *testing.T) {
+		exam, questions, user := setupTimedExam(db, admin, "overrun")
+		unstarted := assignCandidate(db, exam, "nostart")
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		startedAt := backdateAttempt(db, exam.ID, user.ID, 70*time.Minute)
 		var userExam models.UserExam
-		err = db.Where("user_id = ? AND exam_id = ?", user.ID, exam.ID).First(&userExam).Error
+		db.Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).First(&userExam)
+		db.Create(&models.SavedAnswer{UserExamID: userExam.ID, QuestionID: questions[0].ID, SelectedOptions: models.StringArray{"b"}})
+		db.Model(&exam).Update("end_time", now.Add(-time.Minute))
+
+		_, closed, err := examService.ApplyExamSchedule(now)
+
 		assert.NoError(t, err)
-		assert.Equal(t, models.UserExamAssigned, userExam.Status)
-		assert.Equal(t, 2, userExam.MaxAttempts)
+		assert.Equal(t, 1, closed)
+		assert.Equal(t, models.ExamClosed, statusOf(exam))
+
+		// The running attempt is graded as of its own deadline
+		var result models.Result
+		assert.NoError(t, db.Where("user_exam_id = ?", userExam.ID).First(&result).Error)
+		assert.True(t, result.AutoSubmitted)
+		assert.Equal(t, 1.0, result.TotalPoints)
+		assert.WithinDuration(t, startedAt.Add(60*time.Minute), result.EndTime, time.Second)
+
+		var expired models.UserExam
+		db.Where("exam_id = ? AND user_id = ?", exam.ID, unstarted.ID).First(&expired)
+		assert.Equal(t, models.UserExamExpired, expired.Status)
 	})
+}
 
-	t.Run("assign exam to non-existent user", func(t *testing.T) {
-		req := services.AssignExamRequest{
-			UserIDs:     []uint{999}, // Non-existent user
-			MaxAttempts: 1,
-		}
+func TestExamService_TransitionExam(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
 
-		err := examService.AssignExam(exam.ID, req)
+	examService := services.NewExamService(db, mockRedis, logger)
 
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "invalid or inactive")
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+
+	t.Run("closing submits running attempts and expires unstarted ones", func(t *testing.T) {
+		exam, _, user := setupTimedExam(db, admin, "closing")
+		unstarted := assignCandidate(db, exam, "closingidle")
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+
+		closed, err := examService.TransitionExam(exam.ID, models.ExamClosed)
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.ExamClosed, closed.Status)
+
+		var userExams []models.UserExam
+		db.Where("exam_id = ?", exam.ID).Order("id").Find(&userExams)
+		assert.Equal(t, models.UserExamCompleted, userExams[0].Status)
+		assert.Equal(t, unstarted.ID, userExams[1].UserID)
+		assert.Equal(t, models.UserExamExpired, userExams[1].Status)
+
+		var result models.Result
+		assert.NoError(t, db.Where("user_exam_id = ?", userExams[0].ID).First(&result).Error)
+		assert.True(t, result.AutoSubmitted)
 	})
 
-	t.Run("assign non-existent exam", func(t *testing.T) {
-		req := services.AssignExamRequest{
-			UserIDs:     []uint{user.ID},
-			MaxAttempts: 1,
-		}
+	t.Run("rejects transitions the lifecycle doesn't allow", func(t *testing.T) {
+		exam, _, _ := setupTimedExam(db, admin, "backwards")
 
-		err := examService.AssignExam(999, req) // Non-existent exam
+		_, err := examService.TransitionExam(exam.ID, models.ExamDraft)
+
+		assert.EqualError(t, err, "invalid status transition from active to draft")
+	})
+
+	t.Run("doesn't overwrite a concurrent status change", func(t *testing.T) {
+		exam, _, _ := setupTimedExam(db, admin, "raced")
+		db.Model(&exam).Update("status", models.ExamDraft)
+
+		// Archive the exam just before the transition writes its own status
+		raced := false
+		db.Callback().Update().Before("gorm:update").Register("test:concurrent_archive", func(tx *gorm.DB) {
+			if raced || tx.Statement.Table != "exams" {
+				return
+			}
+			raced = true
+			tx.Statement.ConnPool.ExecContext(tx.Statement.Context, "UPDATE exams SET status = ? WHERE id = ?", models.ExamArchived, exam.ID)
+		})
+		defer db.Callback().Update().Remove("test:concurrent_archive")
+
+		_, err := examService.TransitionExam(exam.ID, models.ExamActive)
+
+		assert.EqualError(t, err, "exam status changed concurrently")
+		db.First(&exam, exam.ID)
+		assert.Equal(t, models.ExamArchived, exam.Status)
+	})
+}
+
+func TestExamService_GrantExtraTime(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+
+	t.Run("extends the deadline of a started attempt", func(t *testing.T) {
+		exam, questions, user := setupTimedExam(db, admin, "granted")
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		startedAt := backdateAttempt(db, exam.ID, user.ID, 70*time.Minute)
+
+		response, err := examService.GrantExtraTime(exam.ID, services.GrantExtraTimeRequest{UserID: user.ID, Minutes: 15})
+		assert.NoError(t, err)
+		assert.NotNil(t, response)
+
+		var userExam models.UserExam
+		db.Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).First(&userExam)
+		assert.Equal(t, 15, userExam.GrantedMinutes)
+		assert.WithinDuration(t, startedAt.Add(75*time.Minute), *userExam.Deadline(&exam), time.Second)
+
+		var attempt models.ExamAttempt
+		db.First(&attempt, *userExam.CurrentAttemptID)
+		assert.Equal(t, 15, attempt.GrantedMinutes)
+
+		// The timer worker leaves the attempt running
+		closed, err := examService.AutoSubmitExpiredAttempts(0)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, closed)
+
+		result, err := examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{
+			Answers: []services.SubmitAnswerRequest{{QuestionID: questions[0].ID, SelectedOptions: []string{"b"}}},
+		})
+		assert.NoError(t, err)
+		assert.False(t, result.SubmittedLate)
+		assert.Equal(t, 1.0, result.TotalPoints)
+	})
+
+	t.Run("only applies to attempts in progress", func(t *testing.T) {
+		exam, _, user := setupTimedExam(db, admin, "notstarted")
+
+		_, err := examService.GrantExtraTime(exam.ID, services.GrantExtraTimeRequest{UserID: user.ID, Minutes: 15})
+		assert.EqualError(t, err, "exam is not in progress")
+
+		_, err = examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		_, err = examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{})
+		assert.NoError(t, err)
+
+		_, err = examService.GrantExtraTime(exam.ID, services.GrantExtraTimeRequest{UserID: user.ID, Minutes: 15})
+		assert.EqualError(t, err, "exam is not in progress")
+	})
+}
+
+func TestExamService_SaveAnswer(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HSetJSON", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	mockRedis.On("Expire", mock.AnythingOfType("string"), mock.AnythingOfType("time.Duration")).Return(nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+	exam, questions, user := setupTimedExam(db, admin, "autosaver")
+	_, err := examService.StartExam(exam.ID, user.ID)
+	assert.NoError(t, err)
+
+	t.Run("question outside the exam", func(t *testing.T) {
+		saved, err := examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: 999, SelectedOptions: []string{"b"}})
+
+		assert.EqualError(t, err, "question is not part of this exam")
+		assert.Nil(t, saved)
+	})
+
+	t.Run("unknown option", func(t *testing.T) {
+		saved, err := examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: questions[0].ID, SelectedOptions: []string{"z"}})
 
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "not found")
+		assert.Contains(t, err.Error(), "invalid option")
+		assert.Nil(t, saved)
+	})
+
+	t.Run("attempt not started", func(t *testing.T) {
+		other, _, candidate := setupTimedExam(db, admin, "notstarted")
+
+		saved, err := examService.SaveAnswer(other.ID, candidate.ID, services.SubmitAnswerRequest{QuestionID: questions[0].ID, SelectedOptions: []string{"b"}})
+
+		assert.EqualError(t, err, "exam is not in progress")
+		assert.Nil(t, saved)
+	})
+
+	t.Run("answer is stored and replaced", func(t *testing.T) {
+		_, err := examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: questions[0].ID, SelectedOptions: []string{"a"}})
+		assert.NoError(t, err)
+		saved, err := examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: questions[0].ID, SelectedOptions: []string{"b"}, TimeSpent: 20})
+		assert.NoError(t, err)
+		assert.Equal(t, models.StringArray{"b"}, saved.SelectedOptions)
+
+		var stored []models.SavedAnswer
+		db.Where("user_exam_id = ?", saved.UserExamID).Find(&stored)
+		assert.Len(t, stored, 1)
+		assert.Equal(t, models.StringArray{"b"}, stored[0].SelectedOptions)
+		assert.Equal(t, 20, stored[0].TimeSpent)
+		mockRedis.AssertCalled(t, "HSetJSON", fmt.Sprintf("exam_answers:%d:%d", user.ID, exam.ID), fmt.Sprint(questions[0].ID), mock.Anything)
 	})
 }
 
+func TestExamService_GetSavedAnswers(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HSetJSON", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	mockRedis.On("Expire", mock.AnythingOfType("string"), mock.AnythingOfType("time.Duration")).Return(nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+	exam, questions, user := setupTimedExam(db, admin, "resumer")
+	_, err := examService.StartExam(exam.ID, user.ID)
+	assert.NoError(t, err)
+
+	_, err = examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: questions[0].ID, SelectedOptions: []string{"b"}})
+	assert.NoError(t, err)
+	_, err = examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: questions[1].ID, SelectedOptions: []string{"a"}})
+	assert.NoError(t, err)
+
+	key := fmt.Sprintf("exam_answers:%d:%d", user.ID, exam.ID)
+
+	t.Run("Redis lost earlier answers", func(t *testing.T) {
+		// The hash was evicted and recreated by a later save, which changed the answer
+		latest, _ := json.Marshal(services.SubmitAnswerRequest{QuestionID: questions[1].ID, SelectedOptions: []string{"c"}})
+		mockRedis.On("HGetAll", key).Return(map[string]string{fmt.Sprint(questions[1].ID): string(latest)}, nil).Once()
+
+		response, err := examService.GetSavedAnswers(exam.ID, user.ID)
+
+		assert.NoError(t, err)
+		assert.Len(t, response.Answers, 2)
+		assert.Equal(t, questions[0].ID, response.Answers[0].QuestionID)
+		assert.Equal(t, []string{"b"}, response.Answers[0].SelectedOptions)
+		assert.Equal(t, []string{"c"}, response.Answers[1].SelectedOptions)
+	})
+
+	t.Run("Redis unavailable", func(t *testing.T) {
+		mockRedis.On("HGetAll", key).Return(nil, errors.New("connection refused")).Once()
+
+		response, err := examService.GetSavedAnswers(exam.ID, user.ID)
+
+		assert.NoError(t, err)
+		assert.Len(t, response.Answers, 2)
+		assert.Equal(t, []string{"b"}, response.Answers[0].SelectedOptions)
+		assert.Equal(t, []string{"a"}, response.Answers[1].SelectedOptions)
+	})
+}
+
+func TestExamService_SubmitExam_SavedAnswers(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HSetJSON", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	mockRedis.On("Expire", mock.AnythingOfType("string"), mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+	exam, questions, user := setupTimedExam(db, admin, "submitter")
+	_, err := examService.StartExam(exam.ID, user.ID)
+	assert.NoError(t, err)
+
+	_, err = examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: questions[0].ID, SelectedOptions: []string{"b"}, TimeSpent: 30})
+	assert.NoError(t, err)
+	_, err = examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: questions[1].ID, SelectedOptions: []string{"a"}})
+	assert.NoError(t, err)
+
+	// The submission only covers the second question and corrects its answer
+	result, err := examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{
+		Answers: []services.SubmitAnswerRequest{{QuestionID: questions[1].ID, SelectedOptions: []string{"b"}}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, result.TotalPoints)
+	assert.Len(t, result.Answers, 2)
+	for _, answer := range result.Answers {
+		assert.Equal(t, []string{"b"}, answer.SelectedOptions)
+		if answer.QuestionID == questions[0].ID {
+			assert.Equal(t, 30, answer.TimeSpent)
+		}
+	}
+
+	// Autosaved copies are cleared once the attempt is graded
+	var remaining int64
+	db.Model(&models.SavedAnswer{}).Where("user_exam_id = ?", result.UserExamID).Count(&remaining)
+	assert.Equal(t, int64(0), remaining)
+}
+
+func TestExamService_AttemptKeepsItsQuestions(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+	exam, questions, user := setupTimedExam(db, admin, "snapshot")
+	db.Model(&exam).Updates(map[string]interface{}{"shuffle_questions": true, "shuffle_options": true})
+
+	_, err := examService.StartExam(exam.ID, user.ID)
+	assert.NoError(t, err)
+	var attempt models.ExamAttempt
+	db.Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).First(&attempt)
+
+	before, err := examService.GetAttemptPermutation(exam.ID, attempt.ID)
+	assert.NoError(t, err)
+	assert.Len(t, before.Questions, 2)
+
+	// The exam is edited while the attempt is running
+	added := createTestQuestion(db, admin.ID)
+	db.Create(&models.ExamQuestion{ExamID: exam.ID, QuestionID: added.ID, Order: 3, Points: 1})
+	db.Where("exam_id = ? AND question_id = ?", exam.ID, questions[0].ID).Delete(&models.ExamQuestion{})
+
+	after, err := examService.GetAttemptPermutation(exam.ID, attempt.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, before.Questions, after.Questions)
+
+	result, err := examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{
+		Answers: []services.SubmitAnswerRequest{
+			{QuestionID: questions[0].ID, SelectedOptions: []string{"b"}},
+			{QuestionID: questions[1].ID, SelectedOptions: []string{"b"}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.MaxPoints)
+	assert.Equal(t, 2.0, result.TotalPoints)
+	assert.Len(t, result.Answers, 2)
+}
+
+func TestExamService_AttemptKeepsItsSections(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+	exam, sections, questions, user := setupSectionedExam(db, admin, "sectionorder")
+
+	// Sections come first, so the first section's question leads despite its order
+	db.Model(&models.ExamQuestion{}).Where("exam_id = ? AND question_id = ?", exam.ID, questions[0].ID).Update("order", 2)
+	db.Model(&models.ExamQuestion{}).Where("exam_id = ? AND question_id = ?", exam.ID, questions[1].ID).Update("order", 1)
+
+	_, err := examService.StartExam(exam.ID, user.ID)
+	assert.NoError(t, err)
+	_, err = examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{})
+	assert.NoError(t, err)
+
+	var attempt models.ExamAttempt
+	db.Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).First(&attempt)
+	assert.Equal(t, models.SectionIDs{sections[0].ID, sections[1].ID}, attempt.SectionIDs)
+
+	before, err := examService.GetAttemptPermutation(exam.ID, attempt.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, questions[0].ID, before.Questions[0].QuestionID)
+	assert.Equal(t, questions[1].ID, before.Questions[1].QuestionID)
+
+	// Editing the exam afterwards gives it new sections, in the other order
+	req := sectionedExamUpdate(exam, questions)
+	req.Sections[0], req.Sections[1] = req.Sections[1], req.Sections[0]
+	req.Questions[0].Section, req.Questions[1].Section = 2, 1
+	updated, err := examService.UpdateExam(exam.ID, req)
+	assert.NoError(t, err)
+	assert.NotEqual(t, sections[0].ID, updated.Sections[0].ID)
+
+	after, err := examService.GetAttemptPermutation(exam.ID, attempt.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, before.Questions, after.Questions)
+}
+
+// setupSectionedExam splits a timed exam into a 10 minute section that locks
+// when it closes and an untimed section, each holding one of the two questions
+func setupSectionedExam(db *gorm.DB, admin models.User, username string) (models.Exam, []models.ExamSection, []models.Question, models.User) {
+	exam, questions, user := setupTimedExam(db, admin, username)
+
+	sections := []models.ExamSection{
+		{ExamID: exam.ID, Title: "Theory", Order: 1, Duration: 10, LockOnClose: true},
+		{ExamID: exam.ID, Title: "Practical", Order: 2},
+	}
+	db.Create(&sections)
+	for i, question := range questions {
+		db.Model(&models.ExamQuestion{}).Where("exam_id = ? AND question_id = ?", exam.ID, question.ID).Update("section_id", sections[i].ID)
+	}
+
+	return exam, sections, questions, user
+}
+
+// sectionedExamUpdate is an update request that keeps the exam set up by
+// setupSectionedExam as it is
+func sectionedExamUpdate(exam models.Exam, questions []models.Question) services.UpdateExamRequest {
+	return services.UpdateExamRequest{
+		Title:     exam.Title,
+		Duration:  exam.Duration,
+		PassScore: exam.PassScore,
+		Questions: []services.ExamQuestionRequest{
+			{QuestionID: questions[0].ID, Points: 1, Order: 1, Section: 1},
+			{QuestionID: questions[1].ID, Points: 1, Order: 2, Section: 2},
+		},
+		Sections: []services.ExamSectionRequest{
+			{Title: "Theory", Duration: 10, LockOnClose: true},
+			{Title: "Practical"},
+		},
+	}
+}
+
+func TestExamService_UpdateExam_AttemptsInProgress(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+	exam, sections, questions, user := setupSectionedExam(db, admin, "inprogress")
+
+	_, err := examService.StartExam(exam.ID, user.ID)
+	assert.NoError(t, err)
+
+	t.Run("sections can't change", func(t *testing.T) {
+		req := sectionedExamUpdate(exam, questions)
+		req.Sections = req.Sections[:1]
+		req.Questions[1].Section = 1
+
+		updated, err := examService.UpdateExam(exam.ID, req)
+
+		assert.EqualError(t, err, "cannot change exam questions or sections while attempts are in progress")
+		assert.Nil(t, updated)
+	})
+
+	t.Run("questions can't change", func(t *testing.T) {
+		req := sectionedExamUpdate(exam, questions)
+		req.Questions[1].Points = 3
+
+		_, err := examService.UpdateExam(exam.ID, req)
+
+		assert.EqualError(t, err, "cannot change exam questions or sections while attempts are in progress")
+	})
+
+	t.Run("other settings can change", func(t *testing.T) {
+		req := sectionedExamUpdate(exam, questions)
+		req.Title = "Renamed Exam"
+
+		updated, err := examService.UpdateExam(exam.ID, req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Renamed Exam", updated.Title)
+
+		var kept []models.ExamSection
+		db.Where("exam_id = ?", exam.ID).Order("\"order\"").Find(&kept)
+		assert.Len(t, kept, 2)
+		assert.Equal(t, sections[0].ID, kept[0].ID)
+		assert.Equal(t, sections[1].ID, kept[1].ID)
+	})
+
+	t.Run("section index past the last section is clamped", func(t *testing.T) {
+		db.Model(&models.ExamAttempt{}).Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).Update("section_index", 5)
+
+		resumed, err := examService.ResumeExam(exam.ID, user.ID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, sections[1].ID, *resumed.CurrentSectionID)
+	})
+
+	t.Run("content can change once attempts end", func(t *testing.T) {
+		_, err := examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{})
+		assert.NoError(t, err)
+
+		req := sectionedExamUpdate(exam, questions)
+		req.Sections = req.Sections[:1]
+		req.Questions[1].Section = 1
+
+		updated, err := examService.UpdateExam(exam.ID, req)
+
+		assert.NoError(t, err)
+		assert.Len(t, updated.Sections, 1)
+	})
+
+	t.Run("a start racing an update fails", func(t *testing.T) {
+		late := assignCandidate(db, exam, "latecomer")
+
+		// Update the exam once the start has loaded it, just before it takes the lock
+		raced := false
+		db.Callback().Query().Before("gorm:query").Register("test:concurrent_update", func(tx *gorm.DB) {
+			if _, locking := tx.Statement.Clauses["FOR"]; raced || !locking || tx.Statement.Table != "exams" {
+				return
+			}
+			raced = true
+			tx.Statement.ConnPool.ExecContext(tx.Statement.Context, "UPDATE exams SET updated_at = ? WHERE id = ?", time.Now().Add(time.Second), exam.ID)
+		})
+		defer db.Callback().Query().Remove("test:concurrent_update")
+
+		_, err := examService.StartExam(exam.ID, late.ID)
+
+		assert.EqualError(t, err, "exam changed while starting")
+		var attempts int64
+		db.Model(&models.ExamAttempt{}).Where("exam_id = ? AND user_id = ?", exam.ID, late.ID).Count(&attempts)
+		assert.Zero(t, attempts)
+	})
+}
+
+func TestExamService_NextSection(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+	mockRedis.On("HSetJSON", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	mockRedis.On("Expire", mock.AnythingOfType("string"), mock.AnythingOfType("time.Duration")).Return(nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+
+	t.Run("opens the next section and locks the closed one", func(t *testing.T) {
+		exam, sections, questions, user := setupSectionedExam(db, admin, "navigator")
+		started, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, sections[0].ID, *started.CurrentSectionID)
+		assert.Len(t, started.Questions, 1)
+
+		// The upcoming section can't be answered yet
+		_, err = examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: questions[1].ID, SelectedOptions: []string{"b"}})
+		assert.EqualError(t, err, "section is not open yet")
+
+		progress, err := examService.NextSection(exam.ID, user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, sections[1].ID, *progress.CurrentSectionID)
+		assert.Equal(t, models.SectionClosed, progress.Sections[0].Status)
+		assert.Equal(t, models.SectionOpen, progress.Sections[1].Status)
+		assert.Len(t, progress.Questions, 1)
+		assert.Equal(t, questions[1].ID, progress.Questions[0].ID)
+
+		_, err = examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: questions[0].ID, SelectedOptions: []string{"b"}})
+		assert.EqualError(t, err, "section is closed")
+		_, err = examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: questions[1].ID, SelectedOptions: []string{"b"}})
+		assert.NoError(t, err)
+
+		_, err = examService.NextSection(exam.ID, user.ID)
+		assert.EqualError(t, err, "already in the last section")
+
+		// Answers to the locked section are dropped from the final submission
+		result, err := examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{
+			Answers: []services.SubmitAnswerRequest{{QuestionID: questions[0].ID, SelectedOptions: []string{"b"}}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, result.TotalPoints)
+		assert.Len(t, result.SectionScores, 2)
+		assert.Equal(t, 0.0, result.SectionScores[0].Points)
+		assert.Equal(t, 1.0, result.SectionScores[1].Points)
+	})
+
+	t.Run("moves on when a timed section runs out", func(t *testing.T) {
+		exam, sections, questions, user := setupSectionedExam(db, admin, "outoftime")
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		startedAt := backdateAttempt(db, exam.ID, user.ID, 11*time.Minute)
+		db.Model(&models.ExamAttempt{}).Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).Updates(map[string]interface{}{"started_at": startedAt, "section_started_at": startedAt})
+
+		resumed, err := examService.ResumeExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, sections[1].ID, *resumed.CurrentSectionID)
+		assert.Equal(t, models.SectionClosed, resumed.Sections[0].Status)
+
+		var attempt models.ExamAttempt
+		db.Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).First(&attempt)
+		assert.Equal(t, 1, attempt.SectionIndex)
+		assert.WithinDuration(t, startedAt.Add(10*time.Minute), *attempt.SectionStartedAt, time.Second)
+
+		_, err = examService.SaveAnswer(exam.ID, user.ID, services.SubmitAnswerRequest{QuestionID: questions[0].ID, SelectedOptions: []string{"b"}})
+		assert.EqualError(t, err, "section is closed")
+	})
+
+	t.Run("a move that loses the race fails", func(t *testing.T) {
+		exam, sections, _, user := setupSectionedExam(db, admin, "doubleclick")
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+
+		// Another request opens the next section just before this one writes
+		openedAt := time.Now().Add(-time.Minute)
+		raced := false
+		db.Callback().Update().Before("gorm:update").Register("test:concurrent_next", func(tx *gorm.DB) {
+			if raced || tx.Statement.Table != "exam_attempts" {
+				return
+			}
+			raced = true
+			tx.Statement.ConnPool.ExecContext(tx.Statement.Context, "UPDATE exam_attempts SET section_index = 1, section_started_at = ? WHERE exam_id = ? AND user_id = ?", openedAt, exam.ID, user.ID)
+		})
+		defer db.Callback().Update().Remove("test:concurrent_next")
+
+		_, err = examService.NextSection(exam.ID, user.ID)
+		assert.EqualError(t, err, "section has already changed")
+
+		resumed, err := examService.ResumeExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, sections[1].ID, *resumed.CurrentSectionID)
+		var attempt models.ExamAttempt
+		db.Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).First(&attempt)
+		assert.WithinDuration(t, openedAt, *attempt.SectionStartedAt, time.Second)
+	})
+
+	t.Run("exam without sections", func(t *testing.T) {
+		exam, _, user := setupTimedExam(db, admin, "unsectioned")
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+
+		_, err = examService.NextSection(exam.ID, user.ID)
+		assert.EqualError(t, err, "exam has no sections")
+	})
+}
+
+// backdateServedAt moves the time a linear attempt's question was served into the past
+func backdateServedAt(db *gorm.DB, questionID uint, elapsed time.Duration) time.Time {
+	servedAt := time.Now().Add(-elapsed)
+	db.Model(&models.QuestionTiming{}).Where("question_id = ?", questionID).Update("served_at", servedAt)
+	return servedAt
+}
+
+func TestExamService_LinearMode(t *testing.T) {
+	setupTestConfig()
+	config.AppConfig.Exam.GracePeriod = 5 * time.Second
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+	mockRedis.On("HSetJSON", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	mockRedis.On("Expire", mock.AnythingOfType("string"), mock.AnythingOfType("time.Duration")).Return(nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+	exam, questions, user := setupTimedExam(db, admin, "linear")
+	db.Model(&exam).Update("linear_mode", true)
+
+	started, err := examService.StartExam(exam.ID, user.ID)
+	assert.NoError(t, err)
+	assert.True(t, started.LinearMode)
+	assert.Empty(t, started.Questions)
+
+	var attempt models.ExamAttempt
+	db.Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).First(&attempt)
+
+	t.Run("serving a question records when it was served", func(t *testing.T) {
+		current, err := examService.GetCurrentQuestion(exam.ID, user.ID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, questions[0].ID, current.Question.ID)
+		assert.Equal(t, 1, current.Position)
+		assert.Equal(t, 60, current.TimeLimit)
+
+		var timing models.QuestionTiming
+		assert.NoError(t, db.Where("exam_attempt_id = ? AND question_id = ?", attempt.ID, questions[0].ID).First(&timing).Error)
+		assert.WithinDuration(t, time.Now(), timing.ServedAt, time.Second)
+		assert.Nil(t, timing.AnsweredAt)
+	})
+
+	t.Run("answers store the server-measured time", func(t *testing.T) {
+		backdateServedAt(db, questions[0].ID, 20*time.Second)
+
+		next, err := examService.AnswerCurrentQuestion(exam.ID, user.ID, services.SubmitAnswerRequest{
+			QuestionID:      questions[0].ID,
+			SelectedOptions: []string{"b"},
+			TimeSpent:       999,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, questions[1].ID, next.Question.ID)
+
+		var saved models.SavedAnswer
+		db.Where("question_id = ?", questions[0].ID).First(&saved)
+		assert.InDelta(t, 20, saved.TimeSpent, 1)
+	})
+
+	t.Run("questions past their time limit are closed as timed out", func(t *testing.T) {
+		servedAt := backdateServedAt(db, questions[1].ID, 2*time.Minute)
+
+		current, err := examService.GetCurrentQuestion(exam.ID, user.ID)
+
+		assert.NoError(t, err)
+		assert.True(t, current.Finished)
+		assert.Nil(t, current.Question)
+
+		var timing models.QuestionTiming
+		db.Where("exam_attempt_id = ? AND question_id = ?", attempt.ID, questions[1].ID).First(&timing)
+		assert.True(t, timing.TimedOut)
+		assert.WithinDuration(t, servedAt.Add(time.Minute), *timing.AnsweredAt, time.Second)
+	})
+
+	t.Run("submission ignores answers sent with it", func(t *testing.T) {
+		result, err := examService.SubmitExam(exam.ID, user.ID, services.SubmitExamRequest{
+			Answers: []services.SubmitAnswerRequest{
+				{QuestionID: questions[0].ID, SelectedOptions: []string{"a"}, TimeSpent: 1},
+				{QuestionID: questions[1].ID, SelectedOptions: []string{"b"}, TimeSpent: 1},
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, result.TotalPoints)
+		for _, answer := range result.Answers {
+			if answer.QuestionID == questions[0].ID {
+				assert.True(t, answer.IsCorrect)
+				assert.InDelta(t, 20, answer.TimeSpent, 1)
+			} else {
+				assert.False(t, answer.IsCorrect)
+			}
+		}
+	})
+}
+
+func TestExamService_AssignExam(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	// Create test data
+	admin := createTestUser(db, models.RoleAdmin)
+	user := models.User{
+		Email:     "user@example.com",
+		Username:  "regularuser",
+		Password:  "hashedpassword",
+		FirstName: "Regular",
+		LastName:  "User",
+		Role:      models.RoleUser,
+		IsActive:  true,
+	}
+	db.Create(&user)
+
+	exam := models.Exam{
+		Title:       "Test Exam",
+		Description: "A test exam",
+		Duration:    60,
+		TotalPoints: 2,
+		PassScore:   70,
+		Status:      models.ExamActive,
+		IsActive:    true,
+		CreatedBy:   admin.ID,
+	}
+	db.Create(&exam)
+
+	t.Run("successful exam assignment", func(t *testing.T) {
+		expiresAt := time.Now().Add(24 * time.Hour)
+		req := services.AssignExamRequest{
+			UserIDs:     []uint{user.ID},
+			ExpiresAt:   &expiresAt,
+			MaxAttempts: 2,
+		}
+
+		err := examService.AssignExam(exam.ID, req)
+
+		assert.NoError(t, err)
+
+		// Verify assignment was created
+		var userExam models.UserExam
+		err = db.Where("user_id = ? AND exam_id = ?", user.ID, exam.ID).First(&userExam).Error
+		assert.NoError(t, err)
+		assert.Equal(t, models.UserExamAssigned, userExam.Status)
+		assert.Equal(t, 2, userExam.MaxAttempts)
+	})
+
+	t.Run("assign exam to non-existent user", func(t *testing.T) {
+		req := services.AssignExamRequest{
+			UserIDs:     []uint{999}, // Non-existent user
+			MaxAttempts: 1,
+		}
+
+		err := examService.AssignExam(exam.ID, req)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid or inactive")
+	})
+
+	t.Run("assign non-existent exam", func(t *testing.T) {
+		req := services.AssignExamRequest{
+			UserIDs:     []uint{user.ID},
+			MaxAttempts: 1,
+		}
+
+		err := examService.AssignExam(999, req) // Non-existent exam
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not found")
+	})
+}
+
+func TestGradeAnswer(t *testing.T) {
+	singleChoice := models.Question{
+		ID:   1,
+		Type: models.MultipleChoice,
+		Options: models.Options{
+			{ID: "a", Text: "3", IsCorrect: false},
+			{ID: "b", Text: "4", IsCorrect: true},
+			{ID: "c", Text: "5", IsCorrect: false},
+		},
+	}
+	multiSelect := models.Question{
+		ID:   2,
+		Type: models.MultipleChoice,
+		Options: models.Options{
+			{ID: "a", Text: "2", IsCorrect: true},
+			{ID: "b", Text: "3", IsCorrect: true},
+			{ID: "c", Text: "4", IsCorrect: false},
+			{ID: "d", Text: "5", IsCorrect: true},
+		},
+	}
+	trueFalse := models.Question{
+		ID:   3,
+		Type: models.TrueFalse,
+		Options: models.Options{
+			{ID: "true", Text: "True", IsCorrect: true},
+			{ID: "false", Text: "False", IsCorrect: false},
+		},
+	}
+	limited := multiSelect
+	limited.MaxSelections = 3
+
+	tests := []struct {
+		name            string
+		question        models.Question
+		selected        []string
+		wantCorrect     bool
+		wantPoints      float64
+		wantRule        models.GradingRule
+		wantAnswered    bool
+		wantCorrectSel  int
+		wantWrongSel    int
+		wantMissed      int
+		wantErrContains string
+	}{
+		{name: "multiple choice correct", question: singleChoice, selected: []string{"b"}, wantCorrect: true, wantPoints: 2, wantRule: models.GradingSingleMatch, wantAnswered: true, wantCorrectSel: 1},
+		{name: "multiple choice wrong", question: singleChoice, selected: []string{"a"}, wantRule: models.GradingSingleMatch, wantAnswered: true, wantWrongSel: 1, wantMissed: 1},
+		{name: "single-select extra option rejected", question: singleChoice, selected: []string{"a", "b"}, wantErrContains: "pick only one option"},
+		{name: "multiple choice unanswered", question: singleChoice, selected: []string{}, wantRule: models.GradingSingleMatch, wantMissed: 1},
+		{name: "multi-select exact set", question: multiSelect, selected: []string{"d", "a", "b"}, wantCorrect: true, wantPoints: 2, wantRule: models.GradingExactSet, wantAnswered: true, wantCorrectSel: 3},
+		{name: "multi-select subset", question: multiSelect, selected: []string{"a", "b"}, wantRule: models.GradingExactSet, wantAnswered: true, wantCorrectSel: 2, wantMissed: 1},
+		{name: "multi-select duplicates don't pad", question: multiSelect, selected: []string{"a", "a", "b"}, wantRule: models.GradingExactSet, wantAnswered: true, wantCorrectSel: 2, wantMissed: 1},
+		{name: "multi-select superset", question: multiSelect, selected: []string{"a", "b", "c", "d"}, wantRule: models.GradingExactSet, wantAnswered: true, wantCorrectSel: 3, wantWrongSel: 1},
+		{name: "true/false correct", question: trueFalse, selected: []string{"true"}, wantCorrect: true, wantPoints: 2, wantRule: models.GradingSingleMatch, wantAnswered: true, wantCorrectSel: 1},
+		{name: "true/false wrong", question: trueFalse, selected: []string{"false"}, wantRule: models.GradingSingleMatch, wantAnswered: true, wantWrongSel: 1, wantMissed: 1},
+		{name: "true/false both selected rejected", question: trueFalse, selected: []string{"true", "false"}, wantErrContains: "pick only one option"},
+		{name: "multi-select above maximum rejected", question: limited, selected: []string{"a", "b", "c", "d"}, wantErrContains: "pick at most 3 options"},
+		{name: "unknown option rejected", question: singleChoice, selected: []string{"z"}, wantErrContains: "invalid option"},
+		{name: "unknown true/false option rejected", question: trueFalse, selected: []string{"maybe"}, wantErrContains: "invalid option"},
+		{name: "unsupported question type", question: models.Question{ID: 4, Type: "essay"}, selected: []string{}, wantErrContains: "unsupported question type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, err := services.GradeAnswer(&tt.question, 2, tt.selected)
+
+			if tt.wantErrContains != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErrContains)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.question.ID, answer.QuestionID)
+			assert.Equal(t, tt.wantCorrect, answer.IsCorrect)
+			assert.Equal(t, tt.wantPoints, answer.Points)
+			assert.Equal(t, 2, answer.MaxPoints)
+			if assert.NotNil(t, answer.Grading) {
+				assert.Equal(t, tt.wantRule, answer.Grading.Rule)
+				assert.Equal(t, tt.wantAnswered, answer.Grading.Answered)
+				assert.Equal(t, tt.wantCorrectSel, answer.Grading.CorrectSelected)
+				assert.Equal(t, tt.wantWrongSel, answer.Grading.WrongSelected)
+				assert.Equal(t, tt.wantMissed, answer.Grading.MissedOptions)
+				assert.ElementsMatch(t, tt.question.GetCorrectAnswers(), answer.Grading.CorrectOptions)
+			}
+		})
+	}
+}
+
+func TestApplyScoringPolicy(t *testing.T) {
+	multiSelect := models.Question{
+		ID:   1,
+		Type: models.MultipleChoice,
+		Options: models.Options{
+			{ID: "a", Text: "2", IsCorrect: true},
+			{ID: "b", Text: "3", IsCorrect: true},
+			{ID: "c", Text: "4", IsCorrect: false},
+			{ID: "d", Text: "5", IsCorrect: true},
+		},
+	}
+	singleChoice := models.Question{
+		ID:   2,
+		Type: models.MultipleChoice,
+		Options: models.Options{
+			{ID: "a", Text: "3", IsCorrect: false},
+			{ID: "b", Text: "4", IsCorrect: true},
+		},
+	}
+	atLeastTwo := multiSelect
+	atLeastTwo.MinSelections = 2
+
+	tests := []struct {
+		name       string
+		question   models.Question
+		selected   []string
+		policy     models.ScoringPolicy
+		ratio      float64
+		wantPoints float64
+	}{
+		{name: "all or nothing exact", question: multiSelect, selected: []string{"a", "b", "d"}, policy: models.ScoringAllOrNothing, wantPoints: 3},
+		{name: "all or nothing subset", question: multiSelect, selected: []string{"a", "b"}, policy: models.ScoringAllOrNothing, wantPoints: 0},
+		{name: "partial credit subset", question: multiSelect, selected: []string{"a", "b"}, policy: models.ScoringPartialCredit, wantPoints: 2},
+		{name: "partial credit with wrong option", question: multiSelect, selected: []string{"a", "c"}, policy: models.ScoringPartialCredit, wantPoints: 0},
+		{name: "partial credit single answer stays binary", question: singleChoice, selected: []string{"a"}, policy: models.ScoringPartialCredit, wantPoints: 0},
+		{name: "wrong penalty cancels a correct option", question: multiSelect, selected: []string{"a", "b", "c"}, policy: models.ScoringWrongPenalty, wantPoints: 1},
+		{name: "wrong penalty floors at zero", question: multiSelect, selected: []string{"c"}, policy: models.ScoringWrongPenalty, wantPoints: 0},
+		{name: "negative marking wrong answer", question: singleChoice, selected: []string{"a"}, policy: models.ScoringNegativeMarking, ratio: 0.25, wantPoints: -0.75},
+		{name: "negative marking correct answer", question: singleChoice, selected: []string{"b"}, policy: models.ScoringNegativeMarking, ratio: 0.25, wantPoints: 3},
+		{name: "negative marking unanswered", question: singleChoice, selected: []string{}, policy: models.ScoringNegativeMarking, ratio: 0.25, wantPoints: 0},
+		{name: "partial credit below minimum", question: atLeastTwo, selected: []string{"a"}, policy: models.ScoringPartialCredit, wantPoints: 0},
+		{name: "partial credit at minimum", question: atLeastTwo, selected: []string{"a", "b"}, policy: models.ScoringPartialCredit, wantPoints: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, err := services.GradeAnswer(&tt.question, 3, tt.selected)
+			assert.NoError(t, err)
+
+			services.ApplyScoringPolicy(&answer, tt.policy, tt.ratio)
+
+			assert.InDelta(t, tt.wantPoints, answer.Points, 0.001)
+		})
+	}
+
+	t.Run("negative marking total floors at zero", func(t *testing.T) {
+		answers := []models.Answer{{Points: -0.75}, {Points: -0.75}, {Points: 1}}
+		assert.Equal(t, 0.0, services.SumPoints(answers))
+	})
+}
+
+func TestExamService_Retake(t *testing.T) {
+	setupTestConfig()
+	db := setupExamTestDB()
+	mockRedis := &MockRedisClient{}
+	logger := logrus.New()
+
+	examService := services.NewExamService(db, mockRedis, logger)
+
+	mockRedis.On("SetJSON", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("time.Duration")).Return(nil)
+	mockRedis.On("Del", mock.AnythingOfType("string")).Return(nil)
+	mockRedis.On("HGetAll", mock.AnythingOfType("string")).Return(map[string]string{}, nil)
+
+	admin := createTestUser(db, models.RoleAdmin)
+	exam, questions, user := setupTimedExam(db, admin, "retaker")
+	db.Model(&exam).Updates(map[string]interface{}{"retake_cooldown": 30, "keep_score": models.KeepBestScore})
+	db.Model(&models.UserExam{}).Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).Update("max_attempts", 3)
+
+	answering := func(option string) services.SubmitExamRequest {
+		return services.SubmitExamRequest{Answers: []services.SubmitAnswerRequest{
+			{QuestionID: questions[0].ID, SelectedOptions: []string{option}},
+			{QuestionID: questions[1].ID, SelectedOptions: []string{option}},
+		}}
+	}
+	attempts := func() []models.ExamAttempt {
+		var rows []models.ExamAttempt
+		db.Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).Order("attempt_number").Find(&rows)
+		return rows
+	}
+
+	_, err := examService.StartExam(exam.ID, user.ID)
+	assert.NoError(t, err)
+	first, err := examService.SubmitExam(exam.ID, user.ID, answering("b"))
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, first.Score)
+
+	t.Run("cool-down holds back an early retake", func(t *testing.T) {
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.EqualError(t, err, "retake cooldown has not elapsed")
+		assert.Len(t, attempts(), 1)
+
+		list, err := examService.GetAttempts(exam.ID, user.ID)
+		assert.NoError(t, err)
+		assert.NotNil(t, list.NextAttemptAt)
+	})
+
+	t.Run("second attempt after the cool-down", func(t *testing.T) {
+		db.Model(&models.UserExam{}).Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).Update("completed_at", time.Now().Add(-31*time.Minute))
+
+		started, err := examService.StartExam(exam.ID, user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.UserExamStarted, started.UserExam.Status)
+
+		rows := attempts()
+		assert.Len(t, rows, 2)
+		assert.Equal(t, 1, rows[0].AttemptNumber)
+		assert.Equal(t, models.AttemptCompleted, rows[0].Status)
+		assert.Equal(t, 2, rows[1].AttemptNumber)
+		assert.Equal(t, models.AttemptStarted, rows[1].Status)
+
+		second, err := examService.SubmitExam(exam.ID, user.ID, answering("a"))
+		assert.NoError(t, err)
+		assert.Equal(t, 0.0, second.Score)
+		assert.Equal(t, rows[1].ID, *second.ExamAttemptID)
+	})
+
+	t.Run("attempts and kept score", func(t *testing.T) {
+		list, err := examService.GetAttempts(exam.ID, user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, list.AttemptCount)
+		assert.Equal(t, 3, list.MaxAttempts)
+		assert.Len(t, list.Attempts, 2)
+		assert.Equal(t, 100.0, *list.Attempts[0].Result.Score)
+		assert.Equal(t, 0.0, *list.Attempts[1].Result.Score)
+		assert.Equal(t, 100.0, *list.KeptScore)
+		assert.True(t, *list.Passed)
+
+		db.Model(&exam).Update("keep_score", models.KeepLastScore)
+		list, err = examService.GetAttempts(exam.ID, user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 0.0, *list.KeptScore)
+		assert.False(t, *list.Passed)
+	})
+
+	t.Run("a start that loses the race opens no attempt", func(t *testing.T) {
+		db.Model(&models.UserExam{}).Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).Update("completed_at", time.Now().Add(-31*time.Minute))
+
+		// Another request starts the third attempt just before this one records it
+		raced := false
+		db.Callback().Update().Before("gorm:update").Register("test:concurrent_start", func(tx *gorm.DB) {
+			if raced || tx.Statement.Table != "user_exams" {
+				return
+			}
+			raced = true
+			tx.Statement.ConnPool.ExecContext(tx.Statement.Context, "UPDATE user_exams SET status = ?, attempt_count = 3 WHERE exam_id = ? AND user_id = ?", models.UserExamStarted, exam.ID, user.ID)
+		})
+		defer db.Callback().Update().Remove("test:concurrent_start")
+
+		_, err := examService.StartExam(exam.ID, user.ID)
+
+		assert.EqualError(t, err, "exam cannot be started")
+		assert.Len(t, attempts(), 2)
+	})
+
+	t.Run("no attempts left", func(t *testing.T) {
+		db.Model(&models.UserExam{}).Where("exam_id = ? AND user_id = ?", exam.ID, user.ID).Updates(map[string]interface{}{"status": models.UserExamCompleted, "attempt_count": 2, "max_attempts": 2})
+
+		_, err := examService.StartExam(exam.ID, user.ID)
+		assert.EqualError(t, err, "exam cannot be started")
+		assert.Len(t, attempts(), 2)
+	})
+}
+
+func TestKeptScore(t *testing.T) {
+	scores := []float64{60, 85, 70}
+
+	tests := []struct {
+		name      string
+		policy    models.KeepScorePolicy
+		scores    []float64
+		wantScore float64
+		wantOK    bool
+	}{
+		{name: "best", policy: models.KeepBestScore, scores: scores, wantScore: 85, wantOK: true},
+		{name: "last", policy: models.KeepLastScore, scores: scores, wantScore: 70, wantOK: true},
+		{name: "average", policy: models.KeepAverageScore, scores: scores, wantScore: 71.67, wantOK: true},
+		{name: "no completed attempts", policy: models.KeepBestScore, scores: nil, wantScore: 0, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, ok := services.KeptScore(tt.policy, tt.scores)
+
+			assert.Equal(t, tt.wantOK, ok)
+			assert.InDelta(t, tt.wantScore, score, 0.001)
+		})
+	}
+}
+
+func TestUserExam_CanStart(t *testing.T) {
+	completedAt := time.Now().Add(-10 * time.Minute)
+	exam := &models.Exam{RetakeCooldown: 30}
+
+	retake := models.UserExam{Status: models.UserExamCompleted, AttemptCount: 1, MaxAttempts: 2, CompletedAt: &completedAt}
+	assert.True(t, retake.CanStart())
+	assert.WithinDuration(t, completedAt.Add(30*time.Minute), *retake.NextAttemptAt(exam), time.Second)
+
+	exhausted := models.UserExam{Status: models.UserExamCompleted, AttemptCount: 2, MaxAttempts: 2, CompletedAt: &completedAt}
+	assert.False(t, exhausted.CanStart())
+
+	inProgress := models.UserExam{Status: models.UserExamStarted, AttemptCount: 1, MaxAttempts: 2}
+	assert.False(t, inProgress.CanStart())
+	assert.Nil(t, inProgress.NextAttemptAt(exam))
+}
+
+func TestShuffleExamQuestions(t *testing.T) {
+	examQuestions := make([]models.ExamQuestion, 0, 6)
+	for i := 6; i >= 1; i-- {
+		examQuestions = append(examQuestions, models.ExamQuestion{
+			QuestionID: uint(i),
+			Order:      i,
+			Question: models.Question{
+				ID:   uint(i),
+				Type: models.MultipleChoice,
+				Options: models.Options{
+					{ID: "a", Text: "1"},
+					{ID: "b", Text: "2", IsCorrect: true},
+					{ID: "c", Text: "3"},
+					{ID: "d", Text: "4"},
+				},
+			},
+		})
+	}
+
+	questionIDs := func(questions []models.ExamQuestion) []uint {
+		ids := make([]uint, len(questions))
+		for i, eq := range questions {
+			ids[i] = eq.QuestionID
+		}
+		return ids
+	}
+
+	t.Run("no shuffling keeps authoring order", func(t *testing.T) {
+		presented := services.ShuffleExamQuestions(examQuestions, nil, 42, false, false)
+		assert.Equal(t, []uint{1, 2, 3, 4, 5, 6}, questionIDs(presented))
+		assert.Equal(t, "a", presented[0].Question.Options[0].ID)
+	})
+
+	t.Run("same seed gives the same permutation", func(t *testing.T) {
+		first := services.ShuffleExamQuestions(examQuestions, nil, 42, true, true)
+		second := services.ShuffleExamQuestions(examQuestions, nil, 42, true, true)
+		assert.Equal(t, questionIDs(first), questionIDs(second))
+		for i := range first {
+			assert.Equal(t, first[i].Question.Options, second[i].Question.Options)
+		}
+	})
+
+	t.Run("shuffled options keep their IDs and answer key", func(t *testing.T) {
+		presented := services.ShuffleExamQuestions(examQuestions, nil, 7, false, true)
+		for _, eq := range presented {
+			assert.ElementsMatch(t, []string{"a", "b", "c", "d"}, []string{
+				eq.Question.Options[0].ID, eq.Question.Options[1].ID, eq.Question.Options[2].ID, eq.Question.Options[3].ID,
+			})
+			assert.True(t, eq.Question.ValidateAnswer([]string{"b"}))
+		}
+		// The source questions are left untouched
+		assert.Equal(t, "a", examQuestions[0].Question.Options[0].ID)
+	})
+}
+
+func TestDrawBlueprint(t *testing.T) {
+	bank := []models.Question{
+		{ID: 1, Tags: models.StringArray{"go"}, Difficulty: models.Easy, IsActive: true},
+		{ID: 2, Tags: models.StringArray{"go"}, Difficulty: models.Easy, IsActive: true},
+		{ID: 3, Tags: models.StringArray{"go", "concurrency"}, Difficulty: models.Hard, IsActive: true},
+		{ID: 4, Tags: models.StringArray{"sql"}, Difficulty: models.Medium, IsActive: true},
+		{ID: 5, Tags: models.StringArray{"go"}, Difficulty: models.Hard, IsActive: false},
+	}
+
+	t.Run("overlapping sections never reuse a question", func(t *testing.T) {
+		sections := []models.ExamBlueprintSection{
+			{Name: "Any Go", QuestionCount: 2, Tags: models.StringArray{"go"}, Points: 1},
+			{Name: "Hard Go", QuestionCount: 1, Tags: models.StringArray{"go"}, Difficulty: models.Hard, Points: 3},
+		}
+
+		for seed := int64(0); seed < 20; seed++ {
+			drawn, err := services.DrawBlueprint(sections, bank, rand.New(rand.NewSource(seed)))
+			assert.NoError(t, err)
+			assert.Len(t, drawn, 3)
+
+			// The only active hard Go question has to go to the hard section
+			assert.Equal(t, uint(3), drawn[2].QuestionID)
+			assert.Equal(t, 3, drawn[2].Points)
+			assert.ElementsMatch(t, []uint{1, 2}, []uint{drawn[0].QuestionID, drawn[1].QuestionID})
+		}
+	})
+
+	t.Run("same seed gives the same draw", func(t *testing.T) {
+		sections := []models.ExamBlueprintSection{{QuestionCount: 2, Tags: models.StringArray{"go"}, Points: 1}}
+
+		first, err := services.DrawBlueprint(sections, bank, rand.New(rand.NewSource(9)))
+		assert.NoError(t, err)
+		second, err := services.DrawBlueprint(sections, bank, rand.New(rand.NewSource(9)))
+		assert.NoError(t, err)
+
+		assert.Equal(t, first[0].QuestionID, second[0].QuestionID)
+		assert.Equal(t, first[1].QuestionID, second[1].QuestionID)
+	})
+
+	t.Run("not enough matching questions", func(t *testing.T) {
+		sections := []models.ExamBlueprintSection{{Name: "SQL", QuestionCount: 2, Tags: models.StringArray{"sql"}, Points: 1}}
+
+		_, err := services.DrawBlueprint(sections, bank, rand.New(rand.NewSource(1)))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "blueprint cannot be satisfied")
+	})
+
+	t.Run("overlap leaves a section short", func(t *testing.T) {
+		sections := []models.ExamBlueprintSection{
+			{Name: "Any Go", QuestionCount: 3, Tags: models.StringArray{"go"}, Points: 1},
+			{Name: "Hard Go", QuestionCount: 1, Tags: models.StringArray{"go"}, Difficulty: models.Hard, Points: 1},
+		}
+
+		_, err := services.DrawBlueprint(sections, bank, rand.New(rand.NewSource(1)))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "blueprint cannot be satisfied")
+	})
+}
+
+func TestAdvanceSections(t *testing.T) {
+	sections := []models.ExamSection{
+		{ID: 1, Order: 1, Duration: 10},
+		{ID: 2, Order: 2, Duration: 0},
+		{ID: 3, Order: 3, Duration: 20},
+	}
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("stays in a section with time left", func(t *testing.T) {
+		index, openedAt := services.AdvanceSections(sections, 1, 0, start, start.Add(9*time.Minute))
+		assert.Equal(t, 0, index)
+		assert.Equal(t, start, openedAt)
+	})
+
+	t.Run("moves on when a timed section runs out", func(t *testing.T) {
+		index, openedAt := services.AdvanceSections(sections, 1, 0, start, start.Add(25*time.Minute))
+		assert.Equal(t, 1, index)
+		assert.Equal(t, start.Add(10*time.Minute), openedAt)
+	})
+
+	t.Run("untimed section waits for the candidate", func(t *testing.T) {
+		index, _ := services.AdvanceSections(sections, 1, 1, start, start.Add(5*time.Hour))
+		assert.Equal(t, 1, index)
+	})
+
+	t.Run("never moves past the last section", func(t *testing.T) {
+		index, openedAt := services.AdvanceSections(sections, 1, 2, start, start.Add(time.Hour))
+		assert.Equal(t, 2, index)
+		assert.Equal(t, start, openedAt)
+	})
+
+	t.Run("time multiplier stretches timed sections", func(t *testing.T) {
+		index, openedAt := services.AdvanceSections(sections, 1.5, 0, start, start.Add(14*time.Minute))
+		assert.Equal(t, 0, index)
+		assert.Equal(t, start, openedAt)
+
+		index, openedAt = services.AdvanceSections(sections, 1.5, 0, start, start.Add(16*time.Minute))
+		assert.Equal(t, 1, index)
+		assert.Equal(t, start.Add(15*time.Minute), openedAt)
+	})
+}
+
+func TestSectionSubscores(t *testing.T) {
+	theory, practical := uint(1), uint(2)
+	sections := []models.ExamSection{
+		{ID: theory, Title: "Theory"},
+		{ID: practical, Title: "Practical"},
+	}
+	examQuestions := []models.ExamQuestion{
+		{QuestionID: 10, SectionID: &theory},
+		{QuestionID: 11, SectionID: &theory},
+		{QuestionID: 20, SectionID: &practical},
+	}
+	answers := []models.Answer{
+		{QuestionID: 10, Points: 2, MaxPoints: 2},
+		{QuestionID: 11, Points: 0, MaxPoints: 2},
+		{QuestionID: 20, Points: 3, MaxPoints: 4},
+	}
+
+	scores := services.SectionSubscores(sections, examQuestions, answers)
+	assert.Len(t, scores, 2)
+	assert.Equal(t, "Theory", scores[0].Title)
+	assert.Equal(t, 2.0, scores[0].Points)
+	assert.Equal(t, 4, scores[0].MaxPoints)
+	assert.Equal(t, 50.0, scores[0].Score)
+	assert.Equal(t, 3.0, scores[1].Points)
+	assert.Equal(t, 75.0, scores[1].Score)
+
+	assert.Nil(t, services.SectionSubscores(nil, examQuestions, answers))
+}
+
+func TestMeasureTimeSpent(t *testing.T) {
+	served := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	grace := 5 * time.Second
+
+	t.Run("answer within the limit", func(t *testing.T) {
+		spent, inTime := services.MeasureTimeSpent(served, served.Add(42*time.Second), 60, grace)
+		assert.Equal(t, 42, spent)
+		assert.True(t, inTime)
+	})
+
+	t.Run("grace covers network latency", func(t *testing.T) {
+		spent, inTime := services.MeasureTimeSpent(served, served.Add(63*time.Second), 60, grace)
+		assert.Equal(t, 60, spent)
+		assert.True(t, inTime)
+	})
+
+	t.Run("answer after the limit", func(t *testing.T) {
+		spent, inTime := services.MeasureTimeSpent(served, served.Add(2*time.Minute), 60, grace)
+		assert.Equal(t, 60, spent)
+		assert.False(t, inTime)
+	})
+
+	t.Run("untimed question", func(t *testing.T) {
+		spent, inTime := services.MeasureTimeSpent(served, served.Add(10*time.Minute), 0, grace)
+		assert.Equal(t, 600, spent)
+		assert.True(t, inTime)
+	})
+}
+
+func TestExamStatus_CanTransitionTo(t *testing.T) {
+	assert.True(t, models.ExamDraft.CanTransitionTo(models.ExamScheduled))
+	assert.True(t, models.ExamScheduled.CanTransitionTo(models.ExamActive))
+	assert.True(t, models.ExamActive.CanTransitionTo(models.ExamClosed))
+	assert.True(t, models.ExamClosed.CanTransitionTo(models.ExamArchived))
+
+	assert.False(t, models.ExamActive.CanTransitionTo(models.ExamDraft))
+	assert.False(t, models.ExamClosed.CanTransitionTo(models.ExamActive))
+	assert.False(t, models.ExamArchived.CanTransitionTo(models.ExamDraft))
+	assert.False(t, models.ExamDraft.CanTransitionTo(models.ExamStatus("completed")))
+}
+
+func TestCheckExamWindow(t *testing.T) {
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	opens := now.Add(-time.Hour)
+	closes := now.Add(time.Hour)
+
+	exam := models.Exam{Status: models.ExamActive, IsActive: true, StartTime: &opens, EndTime: &closes}
+	assert.NoError(t, services.CheckExamWindow(&exam, nil, now))
+
+	err := services.CheckExamWindow(&exam, nil, opens.Add(-time.Minute))
+	assert.EqualError(t, err, "exam has not opened yet")
+
+	err = services.CheckExamWindow(&exam, nil, closes)
+	assert.EqualError(t, err, "exam has closed")
+
+	draft := models.Exam{Status: models.ExamDraft, IsActive: true}
+	assert.EqualError(t, services.CheckExamWindow(&draft, nil, now), "exam is not open")
+
+	// Active exams without a window are always open
+	open := models.Exam{Status: models.ExamActive, IsActive: true}
+	assert.NoError(t, services.CheckExamWindow(&open, nil, now))
+
+	// A candidate's own window replaces the exam's
+	lateStart, lateEnd := closes.Add(time.Hour), closes.Add(3*time.Hour)
+	userExam := models.UserExam{WindowStart: &lateStart, WindowEnd: &lateEnd}
+	assert.EqualError(t, services.CheckExamWindow(&exam, &userExam, now), "exam has not opened yet")
+	assert.NoError(t, services.CheckExamWindow(&exam, &userExam, lateStart.Add(time.Minute)))
+}
+
+func TestUserExam_Deadline(t *testing.T) {
+	startedAt := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	exam := models.Exam{Duration: 60}
+
+	t.Run("not started", func(t *testing.T) {
+		userExam := models.UserExam{TimeMultiplier: 1}
+		assert.Nil(t, userExam.Deadline(&exam))
+	})
+
+	t.Run("time multiplier and extra minutes", func(t *testing.T) {
+		userExam := models.UserExam{StartedAt: &startedAt, TimeMultiplier: 1.5, ExtraMinutes: 10}
+		assert.Equal(t, startedAt.Add(100*time.Minute), *userExam.Deadline(&exam))
+	})
+
+	t.Run("capped at the end of the window", func(t *testing.T) {
+		windowEnd := startedAt.Add(30 * time.Minute)
+		userExam := models.UserExam{StartedAt: &startedAt, TimeMultiplier: 1, WindowEnd: &windowEnd}
+		assert.Equal(t, windowEnd, *userExam.Deadline(&exam))
+	})
+
+	t.Run("granted time runs past the window", func(t *testing.T) {
+		windowEnd := startedAt.Add(30 * time.Minute)
+		userExam := models.UserExam{StartedAt: &startedAt, TimeMultiplier: 1, WindowEnd: &windowEnd, GrantedMinutes: 15}
+		assert.Equal(t, windowEnd.Add(15*time.Minute), *userExam.Deadline(&exam))
+	})
+}
+
+func TestMatchAcceptedAnswer(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepted models.AcceptedAnswer
+		input    string
+		want     bool
+	}{
+		{"exact match", models.AcceptedAnswer{Text: "Paris"}, " Paris ", true},
+		{"exact is case sensitive", models.AcceptedAnswer{Text: "Paris"}, "paris", false},
+		{"whitespace collapses runs", models.AcceptedAnswer{Text: "New York", Match: models.MatchWhitespace}, "New   York", true},
+		{"whitespace is case sensitive", models.AcceptedAnswer{Text: "New York", Match: models.MatchWhitespace}, "new york", false},
+		{"case insensitive", models.AcceptedAnswer{Text: "Paris", Match: models.MatchCaseInsensitive}, "PARIS", true},
+		{"case insensitive keeps accents", models.AcceptedAnswer{Text: "Hà Nội", Match: models.MatchCaseInsensitive}, "ha noi", false},
+		{"accent insensitive", models.AcceptedAnswer{Text: "Hà Nội", Match: models.MatchAccentInsensitive}, "ha  noi", true},
+		{"accent insensitive maps đ", models.AcceptedAnswer{Text: "Đà Nẵng", Match: models.MatchAccentInsensitive}, "da nang", true},
+		{"regex matches whole answer", models.AcceptedAnswer{Text: `(?i)colou?r`, Match: models.MatchRegex}, "Color", true},
+		{"regex rejects partial match", models.AcceptedAnswer{Text: `colou?r`, Match: models.MatchRegex}, "colors", false},
+		{"invalid regex never matches", models.AcceptedAnswer{Text: `(`, Match: models.MatchRegex}, "(", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, services.MatchAcceptedAnswer(tt.accepted, tt.input))
+		})
+	}
+}
+
+func TestGradeTextAnswer(t *testing.T) {
+	cloze := models.Question{
+		ID:      7,
+		Type:    models.Cloze,
+		Content: "{{1}} is the capital of Vietnam, {{2}} of France.",
+		Blanks: models.Blanks{
+			{ID: "1", Accepted: []models.AcceptedAnswer{{Text: "Hà Nội", Match: models.MatchAccentInsensitive}}},
+			{ID: "2", Accepted: []models.AcceptedAnswer{{Text: "Paris", Match: models.MatchCaseInsensitive}}},
+		},
+	}
+
+	t.Run("every blank correct", func(t *testing.T) {
+		answer, err := services.GradeTextAnswer(&cloze, 4, []string{"Ha Noi", "paris"})
+		assert.NoError(t, err)
+		assert.True(t, answer.IsCorrect)
+		assert.Equal(t, 4.0, answer.Points)
+		assert.Equal(t, models.GradingTextMatch, answer.Grading.Rule)
+		assert.Equal(t, 2, answer.Grading.CorrectSelected)
+	})
+
+	t.Run("one blank wrong", func(t *testing.T) {
+		answer, err := services.GradeTextAnswer(&cloze, 4, []string{"Hanoi", "Paris"})
+		assert.NoError(t, err)
+		assert.False(t, answer.IsCorrect)
+		assert.Equal(t, 0.0, answer.Points)
+		assert.Equal(t, 1, answer.Grading.CorrectSelected)
+		assert.Equal(t, 1, answer.Grading.WrongSelected)
+
+		services.ApplyScoringPolicy(&answer, models.ScoringPartialCredit, 0)
+		assert.Equal(t, 2.0, answer.Points)
+	})
+
+	t.Run("unanswered", func(t *testing.T) {
+		answer, err := services.GradeTextAnswer(&cloze, 4, []string{" ", ""})
+		assert.NoError(t, err)
+		assert.False(t, answer.Grading.Answered)
+		assert.Equal(t, 2, answer.Grading.MissedOptions)
+	})
+
+	t.Run("too many answers", func(t *testing.T) {
+		_, err := services.GradeTextAnswer(&cloze, 4, []string{"a", "b", "c"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid answer")
+	})
+
+	t.Run("options are rejected", func(t *testing.T) {
+		_, err := services.GradeSubmission(&cloze, 4, services.SubmitAnswerRequest{QuestionID: 7, SelectedOptions: []string{"a"}})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid answer")
+	})
+}
+
+func TestParseNumericAnswer(t *testing.T) {
+	value, literal, err := services.ParseNumericAnswer(" 9,81 ")
+	assert.NoError(t, err)
+	assert.Equal(t, 9.81, value)
+	assert.Equal(t, "9.81", literal)
+
+	value, _, err = services.ParseNumericAnswer("-1.5e3")
+	assert.NoError(t, err)
+	assert.Equal(t, -1500.0, value)
+
+	for _, invalid := range []string{"", "abc", "1,000.5", "0x10", "NaN", "Inf", "1e999"} {
+		_, _, err := services.ParseNumericAnswer(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCountSignificantFigures(t *testing.T) {
+	tests := map[string]int{
+		"9.81":    3,
+		"0.0050":  2,
+		"1200":    2,
+		"1200.":   4,
+		"1.200e3": 4,
+		"-2.50":   3,
+		"0":       1,
+		"0.00":    2,
+	}
+	for literal, want := range tests {
+		assert.Equal(t, want, services.CountSignificantFigures(literal), literal)
+	}
+}
+
+func TestGradeNumericAnswer(t *testing.T) {
+	question := models.Question{
+		ID:   8,
+		Type: models.Numeric,
+		Numeric: &models.NumericKey{
+			Answer:        9.81,
+			Tolerance:     0.01,
+			ToleranceType: models.ToleranceRelative,
+			Units: []models.NumericUnit{
+				{Symbol: "m/s²", Multiplier: 1},
+				{Symbol: "cm/s²", Multiplier: 0.01},
+			},
+		},
+	}
+
+	grade := func(number, unit string) models.Answer {
+		answer, err := services.GradeSubmission(&question, 2, services.SubmitAnswerRequest{
+			QuestionID:    8,
+			NumericAnswer: &models.NumericAnswer{Number: number, Unit: unit},
+		})
+		assert.NoError(t, err)
+		return answer
+	}
+
+	assert.True(t, grade("9.81", "m/s²").IsCorrect)
+	assert.True(t, grade("9,8", "").IsCorrect, "within 1% and a bare number uses the key's unit")
+	assert.True(t, grade("981", "cm/s²").IsCorrect)
+	assert.False(t, grade("9.5", "m/s²").IsCorrect)
+	assert.False(t, grade("9.81", "ft/s²").IsCorrect)
+
+	t.Run("required unit", func(t *testing.T) {
+		question.Numeric.UnitRequired = true
+		defer func() { question.Numeric.UnitRequired = false }()
+
+		answer := grade("9.81", "")
+		assert.False(t, answer.IsCorrect)
+		assert.False(t, answer.Grading.Numeric.UnitAccepted)
+	})
+
+	t.Run("significant figures", func(t *testing.T) {
+		question.Numeric.SignificantFigures = 3
+		defer func() { question.Numeric.SignificantFigures = 0 }()
+
+		assert.True(t, grade("9.81", "").IsCorrect)
+		answer := grade("9.810", "")
+		assert.False(t, answer.IsCorrect)
+		assert.Equal(t, 4, answer.Grading.Numeric.SignificantFigures)
+	})
+
+	t.Run("unanswered", func(t *testing.T) {
+		answer, err := services.GradeSubmission(&question, 2, services.SubmitAnswerRequest{QuestionID: 8})
+		assert.NoError(t, err)
+		assert.False(t, answer.Grading.Answered)
+	})
+
+	t.Run("not a number", func(t *testing.T) {
+		_, err := services.GradeSubmission(&question, 2, services.SubmitAnswerRequest{
+			QuestionID:    8,
+			NumericAnswer: &models.NumericAnswer{Number: "about ten"},
+		})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid answer")
+	})
+
+	t.Run("options are rejected", func(t *testing.T) {
+		_, err := services.GradeSubmission(&question, 2, services.SubmitAnswerRequest{QuestionID: 8, SelectedOptions: []string{"a"}})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "expected a numeric answer")
+	})
+}
+
+func TestNumericAnswer_UnmarshalJSON(t *testing.T) {
+	var req services.SubmitAnswerRequest
+	assert.NoError(t, json.Unmarshal([]byte(`{"question_id": 8, "numeric_answer": {"number": 2.50, "unit": "m"}}`), &req))
+	assert.Equal(t, "2.50", req.NumericAnswer.Number)
+	assert.Equal(t, "m", req.NumericAnswer.Unit)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"question_id": 8, "numeric_answer": {"number": "9,81"}}`), &req))
+	assert.Equal(t, "9,81", req.NumericAnswer.Number)
+
+	// Clients that only know selected_options keep working
+	var legacy services.SubmitAnswerRequest
+	assert.NoError(t, json.Unmarshal([]byte(`{"question_id": 1, "selected_options": ["b"]}`), &legacy))
+	assert.Nil(t, legacy.NumericAnswer)
+	assert.Equal(t, []string{"b"}, legacy.SelectedOptions)
+}
+
+func TestGradeOrderingAnswer(t *testing.T) {
+	question := models.Question{
+		ID:   9,
+		Type: models.Ordering,
+		Options: models.Options{
+			{ID: "plan", Text: "Plan"},
+			{ID: "build", Text: "Build"},
+			{ID: "test", Text: "Test"},
+			{ID: "ship", Text: "Ship"},
+		},
+	}
+
+	answer, err := services.GradeOrderingAnswer(&question, 4, []string{"plan", "build", "test", "ship"})
+	assert.NoError(t, err)
+	assert.True(t, answer.IsCorrect)
+	assert.Equal(t, 4.0, answer.Points)
+
+	answer, err = services.GradeOrderingAnswer(&question, 4, []string{"plan", "test", "build", "ship"})
+	assert.NoError(t, err)
+	assert.False(t, answer.IsCorrect)
+	assert.Equal(t, 2, answer.Grading.CorrectSelected)
+	assert.Equal(t, 2, answer.Grading.WrongSelected)
+
+	// Partial credit is per correctly placed item
+	services.ApplyScoringPolicy(&answer, models.ScoringPartialCredit, 0)
+	assert.Equal(t, 2.0, answer.Points)
+
+	_, err = services.GradeOrderingAnswer(&question, 4, []string{"plan", "plan"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "placed twice")
+
+	_, err = services.GradeOrderingAnswer(&question, 4, []string{"deploy"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid option")
+}
+
+func TestGradeMatchingAnswer(t *testing.T) {
+	question := models.Question{
+		ID:   10,
+		Type: models.Matching,
+		Options: models.Options{
+			{ID: "fr", Text: "France", MatchID: "paris"},
+			{ID: "vn", Text: "Vietnam", MatchID: "hanoi"},
+			{ID: "jp", Text: "Japan", MatchID: "tokyo"},
+		},
+		MatchChoices: models.Options{
+			{ID: "paris", Text: "Paris"},
+			{ID: "hanoi", Text: "Hà Nội"},
+			{ID: "tokyo", Text: "Tokyo"},
+			{ID: "rome", Text: "Rome"},
+		},
+	}
+
+	grade := func(matches map[string]string) models.Answer {
+		answer, err := services.GradeSubmission(&question, 3, services.SubmitAnswerRequest{QuestionID: 10, Matches: matches})
+		assert.NoError(t, err)
+		return answer
+	}
+
+	assert.True(t, grade(map[string]string{"fr": "paris", "vn": "hanoi", "jp": "tokyo"}).IsCorrect)
+
+	answer := grade(map[string]string{"fr": "paris", "vn": "rome"})
+	assert.False(t, answer.IsCorrect)
+	assert.Equal(t, 1, answer.Grading.CorrectSelected)
+	assert.Equal(t, 1, answer.Grading.WrongSelected)
+	assert.Equal(t, 1, answer.Grading.MissedOptions)
+	services.ApplyScoringPolicy(&answer, models.ScoringPartialCredit, 0)
+	assert.Equal(t, 1.0, answer.Points)
+
+	_, err := services.GradeSubmission(&question, 3, services.SubmitAnswerRequest{QuestionID: 10, Matches: map[string]string{"fr": "london"}})
+	assert.Error(t, err)
+
+	_, err = services.GradeSubmission(&question, 3, services.SubmitAnswerRequest{QuestionID: 10, SelectedOptions: []string{"fr"}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected matches")
+}
+
+func TestQuestion_ToResponse_ShufflesArrangements(t *testing.T) {
+	question := models.Question{
+		ID:   11,
+		Type: models.Ordering,
+		Options: models.Options{
+			{ID: "1", Text: "One"}, {ID: "2", Text: "Two"}, {ID: "3", Text: "Three"}, {ID: "4", Text: "Four"},
+			{ID: "5", Text: "Five"}, {ID: "6", Text: "Six"}, {ID: "7", Text: "Seven"}, {ID: "8", Text: "Eight"},
+		},
+		ShuffleSeed: 42,
+	}
+	ids := func(options []models.OptionResponse) []string {
+		out := []string{}
+		for _, opt := range options {
+			out = append(out, opt.ID)
+		}
+		return out
+	}
+	authored := []string{"1", "2", "3", "4", "5", "6", "7", "8"}
+
+	// The same seed presents the same order, and it isn't the answer
+	first := ids(question.ToResponse(false).Options)
+	assert.Equal(t, first, ids(question.ToResponse(false).Options))
+	assert.NotEqual(t, authored, first)
+	assert.ElementsMatch(t, authored, first)
+
+	// Admins see the authored order
+	assert.Equal(t, authored, ids(question.ToResponse(true).Options))
+
+	matching := models.Question{
+		Type:         models.Matching,
+		Options:      models.Options{{ID: "fr", Text: "France", MatchID: "paris"}},
+		MatchChoices: models.Options{{ID: "paris", Text: "Paris"}},
+	}
+	assert.Empty(t, matching.ToResponse(false).Options[0].MatchID)
+	assert.Equal(t, "paris", matching.ToResponse(true).Options[0].MatchID)
+}
+
+func TestQuestion_ToResponse_RendersContent(t *testing.T) {
+	t.Run("markdown keeps math for the client", func(t *testing.T) {
+		question := models.Question{
+			Content:       "Solve **this**: $a*b*c$ and $$x_1 < x_2$$",
+			ContentFormat: models.FormatMarkdown,
+			Options:       models.Options{{ID: "a", Text: "`x = 2`"}},
+			Explanation:   "[see](javascript:alert(1))",
+		}
+
+		response := question.ToResponse(true)
+		assert.Equal(t, question.Content, response.Content)
+		assert.Equal(t, models.FormatMarkdown, response.ContentFormat)
+		assert.Contains(t, response.ContentHTML, "<strong>this</strong>")
+		assert.Contains(t, response.ContentHTML, "$a*b*c$")
+		assert.Contains(t, response.ContentHTML, "$$x_1 &lt; x_2$$")
+		assert.Equal(t, "<p><code>x = 2</code></p>\n", response.Options[0].TextHTML)
+		assert.NotContains(t, response.ExplanationHTML, "javascript")
+		assert.Empty(t, question.ToResponse(false).ExplanationHTML)
+	})
+
+	t.Run("markdown strips raw script", func(t *testing.T) {
+		question := models.Question{
+			Content:       "Hi <script>alert(1)</script><img src=x onerror=alert(1)>",
+			ContentFormat: models.FormatMarkdown,
+		}
+
+		html := question.ToResponse(false).ContentHTML
+		assert.NotContains(t, html, "<script")
+		assert.NotContains(t, html, "onerror")
+	})
+
+	t.Run("plain text is escaped", func(t *testing.T) {
+		question := models.Question{Content: "Is 1 < 2?\n<b>yes</b>"}
+
+		response := question.ToResponse(false)
+		assert.Equal(t, models.FormatPlain, response.ContentFormat)
+		assert.Equal(t, "Is 1 &lt; 2?<br>&lt;b&gt;yes&lt;/b&gt;", response.ContentHTML)
+	})
+}
+
+func TestGradeEssayAnswer(t *testing.T) {
+	question := models.Question{ID: 12, Type: models.Essay}
+
+	answer, err := services.GradeSubmission(&question, 10, services.SubmitAnswerRequest{QuestionID: 12, Essay: "Online learning is flexible."})
+	assert.NoError(t, err)
+	assert.True(t, answer.PendingGrading)
+	assert.Equal(t, models.GradingManual, answer.Grading.Rule)
+	assert.Equal(t, 0.0, answer.Points)
+
+	// No policy touches an essay, not even negative marking
+	services.ApplyScoringPolicy(&answer, models.ScoringNegativeMarking, 0.5)
+	assert.Equal(t, 0.0, answer.Points)
+
+	// A blank essay needs no grader
+	blank, err := services.GradeSubmission(&question, 10, services.SubmitAnswerRequest{QuestionID: 12, Essay: "   "})
+	assert.NoError(t, err)
+	assert.False(t, blank.PendingGrading)
+
+	_, err = services.GradeSubmission(&question, 10, services.SubmitAnswerRequest{QuestionID: 12, SelectedOptions: []string{"a"}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected an essay")
+}
+
+func TestScoreEssay(t *testing.T) {
+	rubric := models.Rubric{
+		{ID: "content", Title: "Content", MinPoints: 0, MaxPoints: 6},
+		{ID: "language", Title: "Language", MinPoints: 1, MaxPoints: 4},
+	}
+	now := time.Now()
+	pending := func() models.Answer {
+		answer, err := services.GradeEssayAnswer(&models.Question{ID: 12, Type: models.Essay}, 5, "An essay")
+		assert.NoError(t, err)
+		return answer
+	}
+
+	t.Run("rubric scaled to the exam points", func(t *testing.T) {
+		answer := pending()
+		err := services.ScoreEssay(rubric, &answer, services.GradeEssayRequest{
+			Criteria: []models.CriterionScore{
+				{CriterionID: "content", Points: 5, Comment: "Well argued"},
+				{CriterionID: "language", Points: 3},
+			},
+			Comment: "Good work",
+		}, 7, now)
+		assert.NoError(t, err)
+		assert.False(t, answer.PendingGrading)
+		assert.Equal(t, 4.0, answer.Points)
+		assert.Equal(t, uint(7), answer.Grading.Manual.GraderID)
+		assert.Equal(t, "Well argued", answer.Grading.Manual.Criteria[0].Comment)
+	})
+
+	t.Run("criterion out of range", func(t *testing.T) {
+		answer := pending()
+		err := services.ScoreEssay(rubric, &answer, services.GradeEssayRequest{
+			Criteria: []models.CriterionScore{{CriterionID: "content", Points: 5}, {CriterionID: "language", Points: 0}},
+		}, 7, now)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid grade")
+		assert.True(t, answer.PendingGrading)
+	})
+
+	t.Run("criterion missing", func(t *testing.T) {
+		answer := pending()
+		err := services.ScoreEssay(rubric, &answer, services.GradeEssayRequest{
+			Criteria: []models.CriterionScore{{CriterionID: "content", Points: 5}},
+		}, 7, now)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not scored")
+	})
+
+	t.Run("points without a rubric", func(t *testing.T) {
+		answer := pending()
+		points := 5.0
+		err := services.ScoreEssay(nil, &answer, services.GradeEssayRequest{Points: &points}, 7, now)
+		assert.NoError(t, err)
+		assert.True(t, answer.IsCorrect)
+		assert.Equal(t, 5.0, answer.Points)
+
+		points = 6
+		assert.Error(t, services.ScoreEssay(nil, &answer, services.GradeEssayRequest{Points: &points}, 7, now))
+	})
+}
+
+func TestResult_ToResponse_AwaitingGrading(t *testing.T) {
+	result := models.Result{
+		Score:       40,
+		TotalPoints: 4,
+		MaxPoints:   10,
+		Status:      models.ResultPendingGrading,
+		Answers: models.Answers{
+			{QuestionID: 11, SelectedOptions: []string{"a"}, IsCorrect: true, Points: 4, MaxPoints: 4},
+			{
+				QuestionID:     12,
+				Essay:          "An essay",
+				MaxPoints:      6,
+				PendingGrading: true,
+				Grading: &models.GradingBreakdown{
+					Rule:     models.GradingManual,
+					Answered: true,
+					Manual:   &models.ManualGrade{GraderID: 1, Comment: "Well argued"},
+				},
+			},
+		},
+		SectionScores: models.SectionScores{{SectionID: 1, Title: "Writing", Points: 0, MaxPoints: 6}},
+	}
+
+	response := result.ToResponse(true, false)
+	assert.True(t, response.AwaitingGrading)
+	assert.Nil(t, response.Score)
+	assert.Nil(t, response.Passed)
+	assert.Nil(t, response.SectionScores)
+	assert.True(t, response.Answers[1].PendingGrading)
+	for _, answer := range response.Answers {
+		assert.Nil(t, answer.IsCorrect)
+		assert.Nil(t, answer.Points)
+		assert.Nil(t, answer.Feedback)
+	}
+
+	result.Status = models.ResultGraded
+	response = result.ToResponse(true, false)
+	assert.False(t, response.AwaitingGrading)
+	assert.Equal(t, 40.0, *response.Score)
+	assert.Len(t, response.SectionScores, 1)
+	assert.True(t, *response.Answers[0].IsCorrect)
+	assert.Equal(t, 4.0, *response.Answers[0].Points)
+	assert.Equal(t, "Well argued", response.Answers[1].Feedback.Comment)
+}
+
+func TestEstimateAbility(t *testing.T) {
+	item := models.ItemParameters{Model: models.IRT2PL, Discrimination: 1.5, Difficulty: 0}
+
+	t.Run("no answers give the prior", func(t *testing.T) {
+		estimate := services.EstimateAbility(nil)
+		assert.InDelta(t, 0, estimate.Ability, 1e-9)
+		assert.InDelta(t, 1, estimate.SE, 0.01)
+	})
+
+	t.Run("right and wrong answers mirror each other", func(t *testing.T) {
+		right := services.EstimateAbility([]services.ItemResponse{{Parameters: item, Correct: true}})
+		wrong := services.EstimateAbility([]services.ItemResponse{{Parameters: item, Correct: false}})
+		assert.Greater(t, right.Ability, 0.0)
+		assert.InDelta(t, -right.Ability, wrong.Ability, 1e-9)
+		assert.Less(t, right.SE, 1.0)
+	})
+
+	t.Run("a perfect score stays finite", func(t *testing.T) {
+		responses := []services.ItemResponse{}
+		for i := 0; i < 10; i++ {
+			responses = append(responses, services.ItemResponse{Parameters: item, Correct: true})
+		}
+		estimate := services.EstimateAbility(responses)
+		assert.Greater(t, estimate.Ability, 1.0)
+		assert.Less(t, estimate.Ability, 4.0)
+	})
+
+	t.Run("the most informative item sits at the ability", func(t *testing.T) {
+		items := []models.ItemParameters{
+			{Discrimination: 1, Difficulty: -2},
+			{Discrimination: 1, Difficulty: 0.9},
+			{Discrimination: 1, Difficulty: 2},
+			{Discrimination: 2, Difficulty: -0.5},
+		}
+		assert.Equal(t, 1, services.SelectItem(items, 1))
+		assert.Equal(t, 3, services.SelectItem(items, -0.4))
+		assert.Equal(t, -1, services.SelectItem(nil, 0))
+		assert.InDelta(t, 0.25, services.ItemInformation(items[0], -2), 1e-9)
+	})
+}
+
+func TestAdaptiveTestSimulation(t *testing.T) {
+	// A pool of 45 items spread over the ability scale, and simulated candidates
+	// answering them by the 2PL model
+	pool := []models.ItemParameters{}
+	for i := 0; i < 45; i++ {
+		pool = append(pool, models.ItemParameters{
+			Model:          models.IRT2PL,
+			Discrimination: 0.8 + 0.3*float64(i%5),
+			Difficulty:     -3 + 6*float64(i)/44,
+		})
+	}
+	const maxItems, targetSE = 30, 0.3
+
+	rng := rand.New(rand.NewSource(11))
+	for _, ability := range []float64{-1.5, 0, 1.5} {
+		totalError := 0.0
+		for run := 0; run < 20; run++ {
+			remaining := append([]models.ItemParameters{}, pool...)
+			responses := []services.ItemResponse{}
+			estimate := services.EstimateAbility(nil)
+
+			var stop services.AdaptiveStop
+			for {
+				stop = services.AdaptiveStopRule(maxItems, targetSE, len(responses), len(remaining), estimate)
+				if stop != "" {
+					break
+				}
+				next := services.SelectItem(remaining, estimate.Ability)
+				item := remaining[next]
+				remaining = append(remaining[:next], remaining[next+1:]...)
+
+				correct := rng.Float64() < services.ItemProbability(item, ability)
+				responses = append(responses, services.ItemResponse{Parameters: item, Correct: correct})
+				estimate = services.EstimateAbility(responses)
+			}
+
+			if stop == services.AdaptiveStopTargetSE {
+				assert.LessOrEqual(t, estimate.SE, targetSE)
+			} else {
+				assert.Equal(t, services.AdaptiveStopMaxItems, stop)
+				assert.Len(t, responses, maxItems)
+			}
+			assert.Less(t, len(responses), len(pool))
+			totalError += estimate.Ability - ability
+		}
+
+		// The estimates centre on the simulated ability, pulled slightly towards
+		// the prior mean as expected a posteriori estimates are
+		assert.InDelta(t, 0, totalError/20, 0.25, "ability %.1f", ability)
+	}
+
+	t.Run("stopping rules", func(t *testing.T) {
+		precise := services.AbilityEstimate{Ability: 0.4, SE: 0.2}
+		vague := services.AbilityEstimate{Ability: 0.4, SE: 0.6}
+
+		assert.Equal(t, services.AdaptiveStopMaxItems, services.AdaptiveStopRule(10, 0.3, 10, 5, vague))
+		assert.Equal(t, services.AdaptiveStopTargetSE, services.AdaptiveStopRule(10, 0.3, 4, 5, precise))
+		assert.Equal(t, services.AdaptiveStopPoolExhausted, services.AdaptiveStopRule(0, 0, 6, 0, vague))
+		assert.Equal(t, services.AdaptiveStop(""), services.AdaptiveStopRule(0, 0, 6, 1, precise))
+		assert.Equal(t, services.AdaptiveStop(""), services.AdaptiveStopRule(10, 0.3, 0, 5, precise))
+	})
+}
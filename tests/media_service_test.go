@@ -0,0 +1,246 @@
+package tests
+
+import (
+	"bytes"
+	"exam-system/config"
+	"exam-system/models"
+	"exam-system/services"
+	"exam-system/storage"
+	"exam-system/utils"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// pngFile is enough of a PNG for content sniffing
+var pngFile = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+
+func setupMediaTest(t *testing.T) (*services.MediaService, *services.QuestionService, *gorm.DB, string) {
+	config.AppConfig = &config.Config{
+		JWT:   config.JWTConfig{Secret: "test-secret"},
+		Media: config.MediaConfig{URLExpiry: time.Hour},
+	}
+
+	dir := t.TempDir()
+	store, err := storage.NewLocalStorage(dir)
+	assert.NoError(t, err)
+
+	db := setupQuestionTestDB()
+	logger := logrus.New()
+	return services.NewMediaService(db, store, logger), services.NewQuestionService(db, logger), db, dir
+}
+
+// signedQuery pulls the expiry and signature out of a signed media link
+func signedQuery(t *testing.T, link string) (int64, string) {
+	parsed, err := url.Parse(link)
+	assert.NoError(t, err)
+	expires, err := strconv.ParseInt(parsed.Query().Get("expires"), 10, 64)
+	assert.NoError(t, err)
+	return expires, parsed.Query().Get("signature")
+}
+
+func TestDetectMediaType(t *testing.T) {
+	assert.Equal(t, "image/png", services.DetectMediaType(pngFile))
+	assert.Equal(t, "audio/mpeg", services.DetectMediaType([]byte("ID3\x03\x00\x00\x00\x00\x00\x00")))
+	assert.Equal(t, "audio/mpeg", services.DetectMediaType([]byte{0xFF, 0xFB, 0x90, 0x64, 0x00}))
+	assert.NotEqual(t, "image/svg+xml", services.DetectMediaType([]byte(`<svg onload="alert(1)"></svg>`)))
+}
+
+func TestMediaService_UploadMedia(t *testing.T) {
+	mediaService, _, _, dir := setupMediaTest(t)
+
+	t.Run("image is stored and served from a signed link", func(t *testing.T) {
+		media, err := mediaService.UploadMedia(bytes.NewReader(pngFile), "../diagram.png", int64(len(pngFile)), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, models.MediaImage, media.Kind)
+		assert.Equal(t, "image/png", media.ContentType)
+		assert.Equal(t, "diagram.png", media.Filename)
+		assert.Len(t, media.Checksum, 64)
+
+		stored, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(media.Key)))
+		assert.NoError(t, err)
+		assert.Equal(t, pngFile, stored)
+
+		expires, signature := signedQuery(t, utils.SignMediaURL(media.ID, time.Now().Add(time.Minute)))
+		content, err := mediaService.OpenSignedMedia(media.ID, expires, signature)
+		assert.NoError(t, err)
+		served, _ := io.ReadAll(content.Body)
+		content.Body.Close()
+		assert.Equal(t, pngFile, served)
+
+		_, err = mediaService.OpenSignedMedia(media.ID+1, expires, signature)
+		assert.EqualError(t, err, "invalid media signature")
+		_, err = mediaService.OpenSignedMedia(media.ID, expires+60, signature)
+		assert.EqualError(t, err, "invalid media signature")
+
+		expires, signature = signedQuery(t, utils.SignMediaURL(media.ID, time.Now().Add(-time.Minute)))
+		_, err = mediaService.OpenSignedMedia(media.ID, expires, signature)
+		assert.EqualError(t, err, "media link has expired")
+	})
+
+	t.Run("unsupported type is rejected", func(t *testing.T) {
+		svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"></svg>`)
+		media, err := mediaService.UploadMedia(bytes.NewReader(svg), "logo.svg", int64(len(svg)), 1)
+		assert.Nil(t, media)
+		assert.Contains(t, err.Error(), "invalid media: unsupported file type")
+	})
+
+	t.Run("oversized image is rejected", func(t *testing.T) {
+		media, err := mediaService.UploadMedia(bytes.NewReader(pngFile), "huge.png", 6<<20, 1)
+		assert.Nil(t, media)
+		assert.EqualError(t, err, "invalid media: image files are limited to 5 MB")
+	})
+}
+
+func TestMediaService_CleanupOrphans(t *testing.T) {
+	mediaService, questionService, db, dir := setupMediaTest(t)
+
+	kept, err := mediaService.UploadMedia(bytes.NewReader(pngFile), "kept.png", int64(len(pngFile)), 1)
+	assert.NoError(t, err)
+	dropped, err := mediaService.UploadMedia(bytes.NewReader(pngFile), "dropped.png", int64(len(pngFile)), 1)
+	assert.NoError(t, err)
+	unused, err := mediaService.UploadMedia(bytes.NewReader(pngFile), "unused.png", int64(len(pngFile)), 1)
+	assert.NoError(t, err)
+
+	question, err := questionService.CreateQuestion(services.CreateQuestionRequest{
+		Title:       "Diagram",
+		Content:     "Which shape is shown?",
+		Type:        models.MultipleChoice,
+		Difficulty:  models.Easy,
+		Attachments: []models.Attachment{{MediaID: kept.ID, Alt: "A shape"}},
+		Options: []models.Option{
+			{ID: "a", Text: "Square", IsCorrect: true, Attachment: &models.Attachment{MediaID: dropped.ID}},
+			{ID: "b", Text: "Circle", IsCorrect: false},
+		},
+		Tags:      []string{"shapes"},
+		Points:    1,
+		TimeLimit: 60,
+	}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, models.MediaImage, question.Attachments[0].Kind)
+	assert.Equal(t, "image/png", question.Options[0].Attachment.ContentType)
+
+	response := question.ToResponse(false)
+	assert.Contains(t, response.Attachments[0].URL, "/api/v1/media/")
+	assert.NotNil(t, response.Options[0].Attachment)
+	assert.EqualError(t, mediaService.DeleteMedia(kept.ID), "media is attached to questions")
+
+	// Not yet past its grace period
+	removed, err := mediaService.CleanupOrphans(time.Now(), time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	// Attached media survives the sweep, uploads never attached don't
+	later := time.Now().Add(time.Hour)
+	removed, err = mediaService.CleanupOrphans(later, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(unused.Key)))
+	assert.True(t, os.IsNotExist(err))
+
+	// An exam showing the first revision keeps the option's file when an edit drops it
+	exam := models.Exam{Title: "Shapes", Duration: 30, TotalPoints: 1, PassScore: 50, Status: models.ExamClosed, IsActive: true, CreatedBy: 1}
+	assert.NoError(t, db.Create(&exam).Error)
+	assert.NoError(t, db.Create(&models.ExamQuestion{ExamID: exam.ID, QuestionID: question.ID, Revision: 1, Order: 1, Points: 1}).Error)
+
+	_, err = questionService.UpdateQuestion(question.ID, services.UpdateQuestionRequest{
+		Title:       question.Title,
+		Content:     question.Content,
+		Type:        question.Type,
+		Difficulty:  question.Difficulty,
+		Attachments: []models.Attachment{{MediaID: kept.ID}},
+		Options: []models.Option{
+			{ID: "a", Text: "Square", IsCorrect: true},
+			{ID: "b", Text: "Circle", IsCorrect: false},
+		},
+		Tags:      []string{"shapes"},
+		Points:    1,
+		TimeLimit: 60,
+		IsActive:  true,
+	}, 1)
+	assert.NoError(t, err)
+	assert.EqualError(t, mediaService.DeleteMedia(dropped.ID), "media is attached to questions")
+
+	removed, err = mediaService.CleanupOrphans(later, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	// So does a result that answered the first revision
+	assert.NoError(t, db.Model(&models.ExamQuestion{}).Where("exam_id = ?", exam.ID).Update("revision", 2).Error)
+	result := models.Result{
+		UserID:     2,
+		ExamID:     exam.ID,
+		UserExamID: 1,
+		MaxPoints:  1,
+		Answers:    models.Answers{{QuestionID: question.ID, Revision: 1, SelectedOptions: []string{"a"}, IsCorrect: true, Points: 1, MaxPoints: 1}},
+		StartTime:  time.Now().Add(-time.Hour),
+		EndTime:    time.Now(),
+	}
+	assert.NoError(t, db.Create(&result).Error)
+
+	removed, err = mediaService.CleanupOrphans(later, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(dropped.Key)))
+	assert.NoError(t, err)
+
+	// Once nothing shows that revision its file goes
+	assert.NoError(t, db.Delete(&result).Error)
+	removed, err = mediaService.CleanupOrphans(later, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(dropped.Key)))
+	assert.True(t, os.IsNotExist(err))
+
+	// An exam can't be pinned to a revision whose files are gone
+	examService := services.NewExamService(db, nil, logrus.New())
+	_, err = examService.CreateExam(services.CreateExamRequest{
+		Title:     "Old shapes",
+		Duration:  30,
+		PassScore: 50,
+		Questions: []services.ExamQuestionRequest{{QuestionID: question.ID, Revision: 1, Order: 1, Points: 1}},
+	}, 1)
+	assert.ErrorContains(t, err, "shows media that has been removed")
+
+	// A deleted question's files stay while an exam shows it, then go
+	assert.NoError(t, questionService.DeleteQuestion(question.ID))
+	removed, err = mediaService.CleanupOrphans(later, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(kept.Key)))
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.Where("exam_id = ?", exam.ID).Delete(&models.ExamQuestion{}).Error)
+	removed, err = mediaService.CleanupOrphans(later, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(kept.Key)))
+	assert.True(t, os.IsNotExist(err))
+
+	t.Run("unknown media is rejected", func(t *testing.T) {
+		question, err := questionService.CreateQuestion(services.CreateQuestionRequest{
+			Title:       "Missing",
+			Content:     "Listen",
+			Type:        models.TrueFalse,
+			Difficulty:  models.Easy,
+			Attachments: []models.Attachment{{MediaID: 999}},
+			Options: []models.Option{
+				{ID: "a", Text: "True", IsCorrect: true},
+				{ID: "b", Text: "False", IsCorrect: false},
+			},
+			Tags:      []string{"misc"},
+			Points:    1,
+			TimeLimit: 60,
+		}, 1)
+		assert.Nil(t, question)
+		assert.EqualError(t, err, "invalid attachment: media 999 not found")
+	})
+}
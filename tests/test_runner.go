@@ -60,6 +60,7 @@ func SetupTestDatabase() *gorm.DB {
 	err = db.AutoMigrate(
 		&models.User{},
 		&models.Question{},
+		&models.QuestionRevision{},
 		&models.Exam{},
 		&models.ExamQuestion{},
 		&models.UserExam{},
@@ -81,6 +82,7 @@ func CleanupTestDatabase(db *gorm.DB) {
 		&models.ExamQuestion{},
 		&models.Exam{},
 		&models.Question{},
+		&models.QuestionRevision{},
 		&models.User{},
 	)
 }
@@ -111,9 +113,9 @@ func CreateTestUser(db *gorm.DB, role models.UserRole) *models.User {
 // CreateTestQuestion creates a test question for testing purposes
 func CreateTestQuestion(db *gorm.DB, createdBy uint) *models.Question {
 	question := &models.Question{
-		Title:   "Test Question",
-		Content: "What is the capital of France?",
-		Type:    models.MultipleChoice,
+		Title:      "Test Question",
+		Content:    "What is the capital of France?",
+		Type:       models.MultipleChoice,
 		Difficulty: models.Easy,
 		Options: models.Options{
 			{ID: "a", Text: "London", IsCorrect: false},
@@ -180,4 +182,3 @@ func CreateTestUserExam(db *gorm.DB, userID, examID uint) *models.UserExam {
 	db.Create(userExam)
 	return userExam
 }
-
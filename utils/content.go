@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// mathSpan finds LaTeX math so it reaches the client untouched for KaTeX or
+// MathJax: $$...$$, \[...\], \(...\) and $...$. Inline $...$ must not start or
+// end with a space, so prices like "$5 and $10" aren't mistaken for math.
+var mathSpan = regexp.MustCompile(`\$\$[\s\S]+?\$\$|\\\[[\s\S]+?\\\]|\\\([\s\S]+?\\\)|\$[^\s$](?:[^$\n]*?[^\s$])?\$`)
+
+// mathPlaceholder stands in for a math span while Markdown is rendered; it is
+// plain text to Markdown and to the sanitizer
+const mathPlaceholder = "\u2063math%d\u2063"
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.Table, extension.Strikethrough),
+	// Raw HTML is let through here and cleaned up by the sanitizer
+	goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+)
+
+// contentPolicy allows the formatting, tables, links and images authors use in
+// questions and strips scripts, event handlers, styles and unsafe URLs
+var contentPolicy = func() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^[\w\- ]+$`)).OnElements("code", "pre", "span", "div")
+	return policy
+}()
+
+// SanitizeHTML removes anything from author HTML that could run script in a
+// candidate's browser
+func SanitizeHTML(source string) string {
+	return contentPolicy.Sanitize(source)
+}
+
+// RenderMarkdown renders Markdown to sanitized HTML, leaving LaTeX math as
+// written
+func RenderMarkdown(source string) string {
+	spans := []string{}
+	protected := mathSpan.ReplaceAllStringFunc(source, func(span string) string {
+		spans = append(spans, span)
+		return fmt.Sprintf(mathPlaceholder, len(spans)-1)
+	})
+
+	var out bytes.Buffer
+	if err := markdown.Convert([]byte(protected), &out); err != nil {
+		return RenderPlainText(source)
+	}
+
+	rendered := SanitizeHTML(out.String())
+	for i, span := range spans {
+		rendered = strings.Replace(rendered, fmt.Sprintf(mathPlaceholder, i), html.EscapeString(span), 1)
+	}
+	return rendered
+}
+
+// RenderPlainText escapes plain text for display as HTML, keeping line breaks
+func RenderPlainText(source string) string {
+	if source == "" {
+		return ""
+	}
+	return strings.ReplaceAll(html.EscapeString(source), "\n", "<br>")
+}
+
+// HTMLToXHTML re-serializes an HTML fragment as well-formed XHTML, for embedding
+// rendered content in XML documents such as QTI items
+func HTMLToXHTML(source string) string {
+	context := &nethtml.Node{Type: nethtml.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := nethtml.ParseFragment(strings.NewReader(source), context)
+	if err != nil {
+		return html.EscapeString(source)
+	}
+
+	var out bytes.Buffer
+	for _, node := range nodes {
+		if err := nethtml.Render(&out, node); err != nil {
+			return html.EscapeString(source)
+		}
+	}
+	return out.String()
+}
@@ -15,6 +15,20 @@ type RedisClient struct {
 	ctx    context.Context
 }
 
+// RedisStore is the subset of RedisClient the services depend on, so tests
+// can substitute an in-memory or mocked store
+type RedisStore interface {
+	Set(key string, value interface{}, expiration time.Duration) error
+	Get(key string) (string, error)
+	Del(key string) error
+	SetJSON(key string, value interface{}, expiration time.Duration) error
+	HSetJSON(key, field string, value interface{}) error
+	HGetAll(key string) (map[string]string, error)
+	Expire(key string, expiration time.Duration) error
+}
+
+var _ RedisStore = (*RedisClient)(nil)
+
 func InitRedis() (*RedisClient, error) {
 	cfg := config.AppConfig.Redis
 
@@ -71,6 +85,18 @@ func (r *RedisClient) GetJSON(key string, dest interface{}) error {
 	return json.Unmarshal([]byte(jsonData), dest)
 }
 
+func (r *RedisClient) HSetJSON(key, field string, value interface{}) error {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return r.client.HSet(r.ctx, key, field, jsonData).Err()
+}
+
+func (r *RedisClient) HGetAll(key string) (map[string]string, error) {
+	return r.client.HGetAll(r.ctx, key).Result()
+}
+
 func (r *RedisClient) Incr(key string) (int64, error) {
 	return r.client.Incr(r.ctx, key).Result()
 }
@@ -121,4 +147,3 @@ func (r *RedisClient) IsRateLimited(key string, limit int, window time.Duration)
 func (r *RedisClient) Close() error {
 	return r.client.Close()
 }
-